@@ -2,6 +2,8 @@ module github.com/joeblew99/plat-telemetry/service
 
 go 1.23
 
-require github.com/kardianos/service v1.2.2
-
-require golang.org/x/sys v0.0.0-20201015000850-e3ed0017c211 // indirect
+require (
+	github.com/kardianos/service v1.2.2
+	golang.org/x/sys v0.0.0-20201015000850-e3ed0017c211
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// logLevel returns the level the wrapper logs at: --log-level, else
+// LOG_LEVEL, else debug with --verbose or --foreground and info otherwise
+func logLevel(flag string, verbose bool) (slog.Level, error) {
+	s := flag
+	if s == "" {
+		s = os.Getenv("LOG_LEVEL")
+	}
+	if s == "" {
+		if verbose {
+			return slog.LevelDebug, nil
+		}
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// logHandler returns the slog handler writing to w in format: text or json,
+// "" for LOG_FORMAT, else text
+func logHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	if format == "" {
+		format = os.Getenv("LOG_FORMAT")
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+}
+
+// fileHandler returns the handler recording the wrapper's logs in the log
+// file, as key=value pairs without the time, which the file records itself
+func fileHandler(l *logFile, level slog.Level) slog.Handler {
+	return slog.NewTextHandler(&streamLog{out: io.Discard, file: l, stream: "wrapper"}, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+}
+
+// teeHandler hands each record to every handler enabled for its level
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
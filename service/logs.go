@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logName is the current log file in --log-dir; rotated ones are named
+// service-<time>.log next to it
+const logName = "service.log"
+
+// defaultLogDir is where the log files go by default, relative to the project
+// root
+var defaultLogDir = filepath.Join("service", ".data", "logs")
+
+// followInterval is how often `logs -f` looks for new lines
+const followInterval = 500 * time.Millisecond
+
+// logRecord is one line of the log files
+type logRecord struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"` // wrapper, stdout or stderr
+	Msg    string    `json:"msg"`
+}
+
+// logFile is the current log file, rotated by size and age
+// A rotated file is renamed with the time of the rotation, and only the
+// newest keep of them are kept.
+type logFile struct {
+	dir     string
+	maxSize int64         // bytes; 0: no size limit
+	maxAge  time.Duration // 0: no age limit
+	keep    int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openLogFile(dir string, maxSize int64, maxAge time.Duration, keep int) (*logFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &logFile{dir: dir, maxSize: maxSize, maxAge: maxAge, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, logName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size, l.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+// write appends a record, rotating the file first if it is due
+func (l *logFile) write(rec logRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && (l.maxSize > 0 && l.size+int64(len(line)) > l.maxSize ||
+		l.maxAge > 0 && time.Since(l.opened) >= l.maxAge) {
+		if err := l.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate the log file: %v\n", err)
+		}
+	}
+	if l.f == nil {
+		return
+	}
+	n, _ := l.f.Write(line)
+	l.size += int64(n)
+}
+
+// rotate renames the current file and starts a new one
+func (l *logFile) rotate() error {
+	l.f.Close()
+	l.f = nil
+	current := filepath.Join(l.dir, logName)
+	rotated := filepath.Join(l.dir, "service-"+time.Now().UTC().Format("20060102T150405.000")+".log")
+	if err := os.Rename(current, rotated); err != nil {
+		l.open()
+		return err
+	}
+	l.prune()
+	return l.open()
+}
+
+// prune removes the rotated files past the newest keep
+func (l *logFile) prune() {
+	rotated := rotatedLogs(l.dir)
+	for len(rotated) > l.keep {
+		os.Remove(rotated[0])
+		rotated = rotated[1:]
+	}
+}
+
+// rotatedLogs returns the rotated log files in dir, oldest first
+func rotatedLogs(dir string) []string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "service-*.log"))
+	sort.Strings(matches)
+	return matches
+}
+
+// streamLog copies what it is written to out and records it line by line in
+// the log file
+type streamLog struct {
+	out    io.Writer
+	file   *logFile
+	stream string
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (s *streamLog) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.out.Write(p)
+
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.file.write(logRecord{Time: now, Stream: s.stream, Msg: strings.TrimRight(string(s.partial[:i]), "\r")})
+		s.partial = s.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush records what is left of an unterminated last line
+func (s *streamLog) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.partial) > 0 {
+		s.file.write(logRecord{Time: time.Now(), Stream: s.stream, Msg: string(s.partial)})
+		s.partial = nil
+	}
+}
+
+// pipe returns the write end of a pipe for a stream of task, whose lines go
+// to out and the log file
+// The copy ends once every process holding the write end has exited, which
+// closes done; processes task leaves behind can't keep Wait from returning,
+// as they could with an io.Writer as cmd.Stdout.
+func (l *logFile) pipe(stream string, out io.Writer) (w *os.File, done chan struct{}, err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		defer r.Close()
+		s := &streamLog{out: out, file: l, stream: stream}
+		io.Copy(s, r)
+		s.flush()
+	}()
+	return w, done, nil
+}
+
+// showLogs prints the last n records of the log files, then with follow the
+// ones that follow, across rotations, until interrupted
+func showLogs(dir string, n int, follow bool) error {
+	current := filepath.Join(dir, logName)
+	files := append(rotatedLogs(dir), current)
+	var lines []string
+	var shown int64 // of the current file, where following starts
+	for i := len(files) - 1; i >= 0 && len(lines) < n; i-- {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			continue
+		}
+		if files[i] == current {
+			shown = int64(len(data))
+		}
+		fileLines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if len(fileLines) == 1 && fileLines[0] == "" {
+			continue
+		}
+		lines = append(fileLines, lines...)
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for _, line := range lines {
+		printRecord(line)
+	}
+	if !follow {
+		if len(lines) == 0 {
+			if _, err := os.Stat(current); err != nil {
+				return fmt.Errorf("no logs in %s", dir)
+			}
+		}
+		return nil
+	}
+
+	var f *os.File
+	var pending []byte // a partial last line, completed by the next read
+	for {
+		info, err := os.Stat(current)
+		switch {
+		case err != nil:
+			// Not created yet, or between the rename and the new file
+		case f == nil:
+			if f, err = os.Open(current); err != nil {
+				return err
+			}
+			f.Seek(shown, io.SeekStart)
+		default:
+			// Rotated or truncated: finish the old file, then read the new one from the start
+			old, _ := f.Stat()
+			offset, _ := f.Seek(0, io.SeekCurrent)
+			if !os.SameFile(old, info) || info.Size() < offset {
+				pending = printLines(f, pending)
+				f.Close()
+				if f, err = os.Open(current); err != nil {
+					return err
+				}
+				pending = nil
+			}
+		}
+		if f != nil {
+			pending = printLines(f, pending)
+		}
+		time.Sleep(followInterval)
+	}
+}
+
+// printLines prints the complete records read from r after pending and
+// returns the partial line left over
+func printLines(r io.Reader, pending []byte) []byte {
+	data, _ := io.ReadAll(r)
+	pending = append(pending, data...)
+	for {
+		i := bytes.IndexByte(pending, '\n')
+		if i < 0 {
+			return pending
+		}
+		printRecord(string(pending[:i]))
+		pending = pending[i+1:]
+	}
+}
+
+func printRecord(line string) {
+	var rec logRecord
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		fmt.Println(line)
+		return
+	}
+	fmt.Printf("%s %-7s %s\n", rec.Time.Local().Format("2006-01-02 15:04:05"), rec.Stream, rec.Msg)
+}
@@ -1,56 +1,121 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/kardianos/service"
 )
 
+// defaultName is the service name of the instance installed without --name
+const defaultName = "plat-telemetry"
+
+// serviceName restricts --name to what every service manager accepts
+var serviceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 type program struct {
-	cmd     *exec.Cmd
-	workDir string
+	workDir      string
+	task         string // --task, if given
+	target       string // the task target that runs the stack, start:fg by default
+	restart      restartPolicy
+	limit        processLimit
+	failedPath   string        // why the service last failed, see fail
+	grace        time.Duration // how long Stop takes before SIGKILL, the ordered shutdown included
+	processGrace time.Duration // how long Stop waits for a process without a shutdown timeout; 0: no ordered shutdown
+	logs         *logFile      // where the wrapper and task log to as well; nil: nowhere
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd     // the running task target
+	exited   chan struct{} // closed when cmd has exited
+	stopping bool
+	stop     chan struct{} // closed by Stop
 }
 
 func (p *program) Start(s service.Service) error {
-	log.Println("Starting plat-telemetry service...")
+	slog.Info("Starting plat-telemetry service", "workdir", p.workDir, "target", p.target)
+	os.Remove(p.failedPath)
 	go p.run()
 	return nil
 }
 
 func (p *program) run() {
-	// Use full path since launchd doesn't have Homebrew in PATH
-	taskPath := "/opt/homebrew/bin/task"
-	if _, err := os.Stat(taskPath); os.IsNotExist(err) {
-		// Fallback for Intel Macs or custom installs
-		taskPath = "/usr/local/bin/task"
+	// Services get a minimal PATH, so look in the usual install locations too
+	taskPath, err := findTask(p.task)
+	if err != nil {
+		p.fail(fmt.Sprintf("cannot start: %v", err))
+	}
+	slog.Debug("Using task", "task", taskPath, "target", p.target, "workdir", p.workDir, "path", servicePath())
+	if p.limit.restarts > 0 {
+		go p.watchProcesses()
 	}
+	p.supervise(taskPath)
+}
 
-	p.cmd = exec.Command(taskPath, "start:fg")
-	p.cmd.Dir = p.workDir
-	p.cmd.Stdout = os.Stdout
-	p.cmd.Stderr = os.Stderr
+// Stop terminates the task target and everything it started, and returns once
+// it has exited
+// The stack's processes are stopped one at a time in reverse dependency order
+// (see stopInOrder), then the process group gets SIGTERM, so process-compose
+// and whatever is left exit, and SIGKILL if it is still running after the
+// grace period.
+func (p *program) Stop(s service.Service) error {
+	slog.Info("Stopping plat-telemetry service")
+	p.mu.Lock()
+	if !p.stopping {
+		p.stopping = true
+		close(p.stop)
+	}
+	cmd, exited := p.cmd, p.exited
+	p.mu.Unlock()
+	if cmd == nil {
+		return nil
+	}
 
-	// Set PATH so child processes (task calling task) can find binaries
-	p.cmd.Env = append(os.Environ(),
-		"PATH=/opt/homebrew/bin:/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin",
-	)
+	deadline := time.Now().Add(p.grace)
+	if p.processGrace > 0 {
+		p.stopInOrder(deadline)
+	}
+	if err := terminate(cmd.Process); err != nil {
+		slog.Error("Failed to terminate task", "err", err)
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(max(time.Until(deadline), termWait)):
+	}
 
-	if err := p.cmd.Run(); err != nil {
-		log.Printf("Task exited: %v", err)
+	slog.Warn("Task still running after the grace period; killing it", "grace", p.grace)
+	if err := kill(cmd.Process); err != nil {
+		return fmt.Errorf("failed to kill task: %w", err)
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(killWait):
+		return fmt.Errorf("task (pid %d) did not exit after SIGKILL", cmd.Process.Pid)
 	}
 }
 
-func (p *program) Stop(s service.Service) error {
-	log.Println("Stopping plat-telemetry service...")
-	if p.cmd != nil && p.cmd.Process != nil {
-		// Send SIGTERM to the process group
-		p.cmd.Process.Signal(os.Interrupt)
-	}
-	return nil
+// eventLog writes log lines to the service manager's log
+type eventLog struct {
+	logger service.Logger
+}
+
+func (l eventLog) Write(p []byte) (int, error) {
+	return len(p), l.logger.Info(strings.TrimSpace(string(p)))
 }
 
 func main() {
@@ -59,28 +124,196 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	// service binary is in service/.bin/, so go up 2 levels
-	workDir := filepath.Dir(filepath.Dir(filepath.Dir(exe)))
+	// service binary is in service/.bin/, so go up 2 levels (unless --workdir)
+	defaultWorkDir := filepath.Dir(filepath.Dir(filepath.Dir(exe)))
+
+	// Usage: plat-telemetry-svc [install|uninstall|start|stop|restart|status] [--task <path>] [restart flags]
+	//        plat-telemetry-svc install --system [--user <user>] [--group <group>] [flags]
+	//        plat-telemetry-svc run --foreground [--log-level <level>] [--log-format text|json] [flags]
+	//        plat-telemetry-svc resume <process>
+	//        plat-telemetry-svc logs [-f] [-n <lines>]
+	// Several instances: --name <x> --workdir <path> [--task-target <t>], on every command
+	command, args := "", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("plat-telemetry-svc", flag.ExitOnError)
+	name := flags.String("name", defaultName, "service name, to install several instances side by side")
+	workDirFlag := flags.String("workdir", defaultWorkDir, "project root the instance runs in")
+	target := flags.String("task-target", "start:fg", "task target that runs the stack in the foreground")
+	taskFlag := flags.String("task", "", "task binary (default: "+taskEnv+", else task on PATH or in the usual install locations)")
+	maxRestarts := flags.Int("max-restarts", 5, "give up after this many restarts in a row without a stable minute (0: no limit)")
+	crashLoop := flags.Int("crash-loop", 10, "give up after this many exits within --crash-window (0: off)")
+	crashWindow := flags.Duration("crash-window", 10*time.Minute, "window of the crash loop detector")
+	grace := flags.Duration("grace", 15*time.Second, "how long stop waits for the stack to exit before killing it")
+	processGrace := flags.Duration("process-grace", 10*time.Second, "how long stop waits for each process without a shutdown timeout in process-compose.yaml (0: stop them all at once)")
+	processRestarts := flags.Int("process-restarts", 5, "hold a process down as broken after this many restarts within --process-window (0: off)")
+	processWindow := flags.Duration("process-window", 10*time.Minute, "window of the per-process restart limit")
+	alert := flags.String("alert", "", "shell command run when a process breaks (PLAT_TELEMETRY_PROCESS, PLAT_TELEMETRY_REASON)")
+	foreground := flags.Bool("foreground", false, "run: run in this terminal instead of under the service manager")
+	verbose := flags.Bool("verbose", false, "log what the wrapper does, not only what goes wrong (--log-level debug)")
+	logLevelFlag := flags.String("log-level", "", "debug, info, warn or error (default: $LOG_LEVEL, else debug with --verbose or --foreground, else info)")
+	logFormat := flags.String("log-format", "", "text or json (default: $LOG_FORMAT, else text)")
+	logDir := flags.String("log-dir", defaultLogDir, "directory of the log files, relative to the project root (empty: no log files)")
+	logMaxSize := flags.Int("log-max-size", 10, "rotate the log file at this many MB (0: no size limit)")
+	logMaxAge := flags.Duration("log-max-age", 24*time.Hour, "rotate the log file once it is this old (0: no age limit)")
+	logKeep := flags.Int("log-keep", 7, "rotated log files to keep")
+	system := flags.Bool("system", false, "install: system-wide (LaunchDaemon, system systemd unit), running at boot without a login")
+	userName := flags.String("user", "", "install --system: user the service runs as (default: $SUDO_USER)")
+	group := flags.String("group", "", "install --system: group the service runs as (default: the user's)")
+	follow := flags.Bool("f", false, "logs: follow the log as it grows")
+	lines := flags.Int("n", 50, "logs: how many lines to show")
+	flags.Parse(args)
+	if *crashLoop > 0 && *crashWindow <= 0 {
+		log.Fatal("--crash-window must be positive")
+	}
+	if *processRestarts > 0 && *processWindow <= 0 {
+		log.Fatal("--process-window must be positive")
+	}
+	if *processGrace < 0 {
+		log.Fatal("--process-grace must not be negative")
+	}
+	if *logMaxSize < 0 || *logMaxAge < 0 || *logKeep < 0 {
+		log.Fatal("--log-max-size, --log-max-age and --log-keep must not be negative")
+	}
+	if !serviceName.MatchString(*name) {
+		log.Fatalf("Invalid --name %q: use letters, digits, '.', '_' and '-'", *name)
+	}
+	if *target == "" {
+		log.Fatal("--task-target must not be empty")
+	}
+	level, err := logLevel(*logLevelFlag, *verbose || *foreground)
+	if err != nil {
+		log.Fatalf("--log-level: %v", err)
+	}
+	if _, err := logHandler(io.Discard, *logFormat, level); err != nil {
+		log.Fatalf("--log-format: %v", err)
+	}
+	workDir, err := filepath.Abs(*workDirFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		log.Fatalf("--workdir %s is not a directory", workDir)
+	}
+	*workDirFlag = workDir
+	if (*userName != "" || *group != "") && !*system {
+		log.Fatal("--user and --group need --system")
+	}
+	if *logDir != "" && !filepath.IsAbs(*logDir) {
+		*logDir = filepath.Join(workDir, *logDir)
+	}
 
+	if *taskFlag != "" {
+		abs, err := filepath.Abs(*taskFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*taskFlag = abs
+	}
+	// Flags given to install go into the service definition, so the service runs with them
+	var arguments []string
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "foreground", "f", "n", "system", "user", "group":
+			return
+		}
+		// One argument per flag, so bool flags round-trip rather than stopping parsing
+		arguments = append(arguments, "--"+f.Name+"="+f.Value.String())
+	})
+
+	displayName, failedPath := "Plat Telemetry Service", exe+".failed"
+	if *name != defaultName {
+		displayName, failedPath = displayName+" ("+*name+")", exe+"."+*name+".failed"
+	}
 	svcConfig := &service.Config{
-		Name:             "plat-telemetry",
-		DisplayName:      "Plat Telemetry Service",
+		Name:             *name,
+		DisplayName:      displayName,
 		Description:      "Runs plat-telemetry via Process Compose",
 		WorkingDirectory: workDir,
+		Arguments:        arguments,
 		Option: service.KeyValue{
-			"UserService": true, // Install as user service (LaunchAgent, not LaunchDaemon)
+			"UserService": true, // Install as user service (LaunchAgent, not LaunchDaemon); see --system
+			// The wrapper restarts task itself and exits non-zero when it gives
+			// up; restarting the wrapper then would restart the crash loop
+			"KeepAlive": false,
+			"Restart":   "no",
+			"OnFailure": "noaction", // Windows: no SCM recovery actions, for the same reason
+			// Windows: start once the network is up, not with the first services at boot
+			"DelayedAutoStart": true,
 		},
 	}
 
-	prg := &program{workDir: workDir}
+	// A system-wide install is found again without --system
+	if *system || (command != "install" && installedSystem(svcConfig.Name)) {
+		if err := configureSystem(svcConfig, *userName, *group); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	prg := &program{
+		workDir:      workDir,
+		task:         *taskFlag,
+		target:       *target,
+		restart:      restartPolicy{maxRestarts: *maxRestarts, crashLoop: *crashLoop, crashWindow: *crashWindow},
+		limit:        processLimit{restarts: *processRestarts, window: *processWindow, alert: *alert},
+		failedPath:   failedPath,
+		grace:        *grace,
+		processGrace: *processGrace,
+		stop:         make(chan struct{}),
+	}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	// Running the service: log through slog, as the log package then does
+	// too, and to the log files as well
+	if command == "" || command == "run" {
+		// A Windows service has no stderr: log to the Event Log instead
+		var logOut io.Writer = os.Stderr
+		if runtime.GOOS == "windows" && command == "" && !service.Interactive() {
+			if logger, err := s.SystemLogger(nil); err == nil {
+				logOut = eventLog{logger}
+			}
+		}
+		h, _ := logHandler(logOut, *logFormat, level)
+		var logErr error
+		if *logDir != "" {
+			if prg.logs, logErr = openLogFile(*logDir, int64(*logMaxSize)<<20, *logMaxAge, *logKeep); logErr == nil {
+				h = teeHandler{h, fileHandler(prg.logs, level)}
+			}
+		}
+		slog.SetDefault(slog.New(h))
+		if logErr != nil {
+			slog.Error("Failed to open the log file", "dir", *logDir, "err", logErr)
+		}
+	}
+
+	if command != "" {
+		switch command {
+		case "logs":
+			dir := *logDir
+			if dir == "" {
+				dir = filepath.Join(workDir, defaultLogDir)
+			}
+			if err := showLogs(dir, *lines, *follow); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "resume":
+			if flags.NArg() != 1 {
+				log.Fatal("Usage: plat-telemetry-svc resume <process>")
+			}
+			if err := resume(workDir, flags.Arg(0)); err != nil {
+				log.Fatalf("Failed to resume: %v", err)
+			}
+			return
 		case "install":
+			// Fail now rather than when the service starts
+			if _, err := findTask(*taskFlag); err != nil {
+				log.Fatalf("Failed to install: %v", err)
+			}
 			err = s.Install()
 			if err != nil {
 				if strings.Contains(err.Error(), "already exists") {
@@ -128,15 +361,45 @@ func main() {
 			}
 			log.Println("Service stopped")
 			return
+		case "restart":
+			// Wait for the old stack to be gone, so the new one gets its ports
+			if status, _ := s.Status(); status == service.StatusRunning {
+				if err := s.Stop(); err != nil {
+					log.Fatalf("Failed to stop: %v", err)
+				}
+				if err := waitStatus(s, service.StatusStopped, *grace+killWait+5*time.Second); err != nil {
+					log.Fatalf("Failed to stop: %v", err)
+				}
+				log.Println("Service stopped")
+			}
+			if err := s.Start(); err != nil {
+				log.Fatalf("Failed to start: %v", err)
+			}
+			log.Println("Service restarted")
+			return
+		case "run":
+			if *foreground {
+				runForeground(prg)
+				return
+			}
 		case "status":
 			status, err := s.Status()
 			if err != nil {
 				log.Fatalf("Failed to get status: %v", err)
 			}
+			names, reasons := brokenProcesses(filepath.Join(workDir, brokenDir))
+			for _, name := range names {
+				log.Printf("Process %s is broken: %s (resume it with: resume %s)", name, reasons[name], name)
+			}
 			switch status {
 			case service.StatusRunning:
 				log.Println("Service is running")
+				showProcesses(workDir, reasons)
 			case service.StatusStopped:
+				if reason := failure(prg.failedPath); reason != "" {
+					log.Printf("Service failed: %s", reason)
+					os.Exit(1)
+				}
 				log.Println("Service is stopped")
 			default:
 				log.Println("Service status unknown")
@@ -145,9 +408,60 @@ func main() {
 		}
 	}
 
-	// Run as service
+	if command != "" {
+		log.Fatalf("Unknown command %q (install, uninstall, start, stop, restart, status, run, resume, logs)", command)
+	}
+
+	// Run as service (also `run` without --foreground)
 	err = s.Run()
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// showProcesses logs the state of each process the stack runs, from the
+// Process Compose API
+func showProcesses(workDir string, broken map[string]string) {
+	procs, err := newPCClient(workDir).processes()
+	if err != nil {
+		log.Printf("Process states unavailable (process-compose starting?): %v", err)
+		return
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].Name < procs[j].Name })
+	for _, pr := range procs {
+		state := pr.describe()
+		if _, ok := broken[pr.Name]; ok {
+			state += ", held down as broken"
+		}
+		log.Printf("  %-12s %s", pr.Name, state)
+	}
+}
+
+// runForeground runs the wrapper in the terminal, bypassing the service
+// manager, until Ctrl-C or SIGTERM
+func runForeground(p *program) {
+	slog.Info("Running in the foreground (Ctrl-C stops)", "workdir", p.workDir)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	p.Start(nil)
+	<-signals
+	signal.Stop(signals)
+	if err := p.Stop(nil); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// waitStatus waits until the service manager reports the service in status want
+func waitStatus(s service.Service, want service.Status, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := s.Status()
+		if err == nil && status == want {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service still running after %s", timeout)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
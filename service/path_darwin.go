@@ -0,0 +1,11 @@
+//go:build darwin
+
+package main
+
+// defaultPath lists where macOS installs keep task and the tools it runs:
+// Homebrew on Apple silicon and Intel, go install, and the system
+func defaultPath() []string {
+	dirs := []string{"/opt/homebrew/bin", "/opt/homebrew/sbin", "/usr/local/bin"}
+	dirs = append(dirs, homeDirs("go/bin", ".local/bin")...)
+	return append(dirs, "/usr/bin", "/bin", "/usr/sbin", "/sbin")
+}
@@ -0,0 +1,11 @@
+//go:build unix && !darwin
+
+package main
+
+// defaultPath lists where Linux and BSD installs keep task and the tools it
+// runs: packages and install scripts, snap, Linuxbrew, go install, and the system
+func defaultPath() []string {
+	dirs := []string{"/usr/local/bin", "/snap/bin", "/home/linuxbrew/.linuxbrew/bin"}
+	dirs = append(dirs, homeDirs("go/bin", ".local/bin", "bin")...)
+	return append(dirs, "/usr/bin", "/bin", "/usr/local/sbin", "/usr/sbin", "/sbin")
+}
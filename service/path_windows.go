@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultPath lists where Windows installs keep task and the tools it runs:
+// winget, Scoop, Chocolatey and go install
+func defaultPath() []string {
+	var dirs []string
+	if local := os.Getenv("LOCALAPPDATA"); local != "" {
+		dirs = append(dirs, filepath.Join(local, "Microsoft", "WinGet", "Links"))
+	}
+	dirs = append(dirs, homeDirs(filepath.Join("scoop", "shims"), filepath.Join("go", "bin"))...)
+	if data := os.Getenv("ProgramData"); data != "" {
+		dirs = append(dirs, filepath.Join(data, "chocolatey", "bin"))
+	}
+	return dirs
+}
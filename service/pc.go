@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pcSocket is where pc:run:fg serves the Process Compose API, relative to
+// the project root (PC_SOCKET in pc/Taskfile.yml)
+var pcSocket = filepath.Join("pc", ".pc.sock")
+
+// pcTimeout bounds each call to the Process Compose API
+const pcTimeout = 5 * time.Second
+
+// pcProcess is the state of a process as the Process Compose API reports it
+type pcProcess struct {
+	Name          string        `json:"name"`
+	Status        string        `json:"status"` // Running, Restarting, Completed, Disabled, ...
+	IsReady       string        `json:"is_ready"`
+	HasReadyProbe bool          `json:"has_ready_probe"`
+	Restarts      int           `json:"restarts"`
+	ExitCode      int           `json:"exit_code"`
+	Pid           int           `json:"pid"`
+	Age           time.Duration `json:"age"`
+}
+
+// active reports whether the process is running or about to be
+func (pr pcProcess) active() bool {
+	switch pr.Status {
+	case "Running", "Launching", "Launched", "Restarting", "Pending":
+		return true
+	}
+	return false
+}
+
+// describe returns e.g. "Running, ready, pid 4242, up 3h12m, 1 restart(s)"
+func (pr pcProcess) describe() string {
+	parts := []string{pr.Status}
+	if pr.HasReadyProbe {
+		parts = append(parts, strings.ToLower(pr.IsReady))
+	}
+	if pr.Status == "Running" {
+		parts = append(parts, fmt.Sprintf("pid %d", pr.Pid), "up "+pr.Age.Round(time.Second).String())
+	} else if !pr.active() && pr.Status != "Disabled" {
+		parts = append(parts, fmt.Sprintf("exit code %d", pr.ExitCode))
+	}
+	if pr.Restarts > 0 {
+		parts = append(parts, fmt.Sprintf("%d restart(s)", pr.Restarts))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pcClient calls the Process Compose API over its unix socket
+type pcClient struct {
+	http *http.Client
+}
+
+func newPCClient(workDir string) *pcClient {
+	socket := filepath.Join(workDir, pcSocket)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &pcClient{http: &http.Client{Transport: transport, Timeout: pcTimeout}}
+}
+
+// processes returns the state of every process process-compose manages
+func (c *pcClient) processes() ([]pcProcess, error) {
+	var resp struct {
+		Data []pcProcess `json:"data"`
+	}
+	if err := c.do(http.MethodGet, "/processes", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// stopProcess stops a process; process-compose does not restart it
+func (c *pcClient) stopProcess(name string) error {
+	return c.do(http.MethodPatch, "/process/stop/"+name, nil)
+}
+
+// startProcess starts a stopped process
+func (c *pcClient) startProcess(name string) error {
+	return c.do(http.MethodPost, "/process/start/"+name, nil)
+}
+
+func (c *pcClient) do(method, path string, out any) error {
+	req, err := http.NewRequest(method, "http://process-compose"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("process-compose API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return fmt.Errorf("process-compose API: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,44 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in a process group of its own, so Stop reaches
+// everything process-compose spawns, and a terminal's Ctrl-C reaches the
+// wrapper only
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// track does nothing: the process group reaches everything p starts
+func track(p *os.Process) error {
+	return nil
+}
+
+// release does nothing: see track
+func release(p *os.Process) {}
+
+// terminate sends SIGTERM to the process group led by p
+func terminate(p *os.Process) error {
+	return signalGroup(p, syscall.SIGTERM)
+}
+
+// kill sends SIGKILL to the process group led by p
+func kill(p *os.Process) error {
+	return signalGroup(p, syscall.SIGKILL)
+}
+
+// signalGroup signals the group, which outlives its leader while any member
+// is left; a group with none left is not an error
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	if err := syscall.Kill(-p.Pid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	jobsMu sync.Mutex
+	jobs   = make(map[int]windows.Handle) // job object of each running task, by pid
+)
+
+// setProcessGroup starts cmd in a process group of its own, so a console's
+// Ctrl-C reaches the wrapper only
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// track puts p in a job object of its own, which every process it starts
+// joins too
+// Windows has no process groups to signal: the job reaches the whole tree
+// even after task itself has exited, and as it kills its processes when its
+// last handle closes, the tree also dies with the wrapper.
+func track(p *os.Process) error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create job object: %w", err)
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("failed to configure job object: %w", err)
+	}
+
+	h, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(p.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("failed to open task (pid %d): %w", p.Pid, err)
+	}
+	defer windows.CloseHandle(h)
+	if err := windows.AssignProcessToJobObject(job, h); err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("failed to assign task to job object: %w", err)
+	}
+
+	jobsMu.Lock()
+	jobs[p.Pid] = job
+	jobsMu.Unlock()
+	return nil
+}
+
+// release closes the job object of p, killing what is left of its tree
+func release(p *os.Process) {
+	jobsMu.Lock()
+	job, ok := jobs[p.Pid]
+	delete(jobs, p.Pid)
+	jobsMu.Unlock()
+	if ok {
+		windows.CloseHandle(job)
+	}
+}
+
+// terminate asks p and the processes it started to exit
+// Windows has no SIGTERM: taskkill without /F closes their windows, which
+// console programs without one ignore, so Stop escalates once the grace
+// period is over.
+func terminate(p *os.Process) error {
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(p.Pid)).Run()
+}
+
+// kill ends p and the processes it started: everything in its job object, or
+// its tree as taskkill finds it if it has none
+func kill(p *os.Process) error {
+	jobsMu.Lock()
+	job, ok := jobs[p.Pid]
+	jobsMu.Unlock()
+	if ok {
+		return windows.TerminateJobObject(job, 1)
+	}
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pcConfig is the process-compose config pc:run:fg runs the stack from,
+// relative to the project root (PC_CONFIG in pc/Taskfile.yml)
+var pcConfig = "process-compose.yaml"
+
+// pollInterval is how often Stop asks process-compose whether a process it
+// stopped is gone
+const pollInterval = 250 * time.Millisecond
+
+// termWait is the least time task gets to exit after SIGTERM, even when the
+// ordered shutdown used up the grace period
+const termWait = 2 * time.Second
+
+// pcConfigFile is what the ordered shutdown reads of the process-compose config
+type pcConfigFile struct {
+	Processes map[string]struct {
+		DependsOn map[string]any `yaml:"depends_on"`
+		Shutdown  struct {
+			TimeoutSeconds int `yaml:"timeout_seconds"`
+		} `yaml:"shutdown"`
+	} `yaml:"processes"`
+}
+
+// stopStep is a process of the ordered shutdown and how long it may take to stop
+type stopStep struct {
+	name  string
+	grace time.Duration
+}
+
+// stopOrder returns the processes of the process-compose config under workDir
+// in reverse dependency order: each after every process that depends on it
+// So telegraf stops, and flushes, while liftbridge and NATS still take its
+// writes, and NATS stops last. A process's grace is its
+// shutdown.timeout_seconds, else fallback.
+func stopOrder(workDir string, fallback time.Duration) ([]stopStep, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, pcConfig))
+	if err != nil {
+		return nil, err
+	}
+	var conf pcConfigFile
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("%s: %w", pcConfig, err)
+	}
+
+	// Processes still running that depend on each process
+	dependents := make(map[string]int, len(conf.Processes))
+	for _, proc := range conf.Processes {
+		for dep := range proc.DependsOn {
+			dependents[dep]++
+		}
+	}
+	order := make([]stopStep, 0, len(conf.Processes))
+	stopped := make(map[string]bool, len(conf.Processes))
+	for len(order) < len(conf.Processes) {
+		var ready, left []string
+		for name := range conf.Processes {
+			switch {
+			case stopped[name]:
+			case dependents[name] == 0:
+				ready = append(ready, name)
+			default:
+				left = append(left, name)
+			}
+		}
+		if len(ready) == 0 {
+			sort.Strings(left)
+			return nil, fmt.Errorf("%s: dependency cycle among %s", pcConfig, strings.Join(left, ", "))
+		}
+		sort.Strings(ready)
+		for _, name := range ready {
+			proc := conf.Processes[name]
+			grace := fallback
+			if proc.Shutdown.TimeoutSeconds > 0 {
+				grace = time.Duration(proc.Shutdown.TimeoutSeconds) * time.Second
+			}
+			order = append(order, stopStep{name: name, grace: grace})
+			stopped[name] = true
+			for dep := range proc.DependsOn {
+				dependents[dep]--
+			}
+		}
+	}
+	return order, nil
+}
+
+// stopInOrder stops the stack's processes one at a time through the Process
+// Compose API, in reverse dependency order, before the process group is
+// signaled
+// Each process gets its grace to stop, cut short by deadline; one that takes
+// longer is left to process-compose's own kill and the group signal. Without
+// the config or the API, everything is left to the signal, as before.
+func (p *program) stopInOrder(deadline time.Time) {
+	order, err := stopOrder(p.workDir, p.processGrace)
+	if err != nil {
+		slog.Warn("Stopping the processes all at once: no stop order", "err", err)
+		return
+	}
+	pc := newPCClient(p.workDir)
+	for _, step := range order {
+		procs, err := pc.processes()
+		if err != nil {
+			slog.Warn("Stopping the processes all at once: Process Compose API not reachable", "err", err)
+			return
+		}
+		if !running(procs, step.name) {
+			continue
+		}
+		wait := min(step.grace, time.Until(deadline)).Round(100 * time.Millisecond)
+		if wait <= 0 {
+			slog.Warn("Grace period used up; stopping the remaining processes all at once", "grace", p.grace)
+			return
+		}
+
+		slog.Info("Stopping process", "process", step.name, "grace", wait)
+		until := time.Now().Add(wait)
+		// process-compose may answer only once the process is gone, past pcTimeout
+		if err := pc.stopProcess(step.name); err != nil {
+			slog.Debug("Stop request for process returned an error", "process", step.name, "err", err)
+		}
+		if !waitStopped(pc, step.name, until) {
+			slog.Warn("Process still running after its grace period; moving on", "process", step.name, "grace", wait)
+		}
+	}
+}
+
+// waitStopped waits until process-compose reports the process no longer
+// running, or until; an unreachable API counts as stopped, as the stack is
+// going down
+func waitStopped(pc *pcClient, name string, until time.Time) bool {
+	for {
+		procs, err := pc.processes()
+		if err != nil || !running(procs, name) {
+			return true
+		}
+		if time.Now().After(until) {
+			return false
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// running reports whether the named process is among procs and active
+func running(procs []pcProcess, name string) bool {
+	for _, pr := range procs {
+		if pr.Name == name {
+			return pr.active()
+		}
+	}
+	return false
+}
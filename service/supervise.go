@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Restart backoff: the first restart waits restartDelay, each one after it
+// twice as long up to maxRestartDelay
+// A child that stayed up for stableRun counts as healthy again, which resets
+// the delay and the count of consecutive restarts.
+const (
+	restartDelay    = time.Second
+	maxRestartDelay = time.Minute
+	stableRun       = time.Minute
+)
+
+// killWait is how long Stop waits for task to exit after SIGKILL
+const killWait = 5 * time.Second
+
+// copyWait is how long a task's last output may take to reach the log file
+const copyWait = time.Second
+
+// restartPolicy decides when the supervisor gives up on the task target
+type restartPolicy struct {
+	maxRestarts int // consecutive restarts without a stable run; 0: no limit
+	crashLoop   int // exits within crashWindow that count as a crash loop; 0: off
+	crashWindow time.Duration
+}
+
+// supervise runs the task target (start:fg) until Stop, restarting it with
+// backoff when it exits
+// launchd and systemd only see the wrapper, so it restarts the child itself and
+// exits non-zero once the policy gives up, which the service manager records
+// as a failed service. A clean exit of the child stops the service too.
+func (p *program) supervise(taskPath string) {
+	delay := restartDelay
+	failures := 0
+	var exits []time.Time
+	for {
+		started := time.Now()
+		err := p.runTask(taskPath)
+		if p.isStopping() {
+			return
+		}
+		if err == nil {
+			slog.Info("Task exited cleanly; stopping the service", "target", p.target)
+			os.Exit(0)
+		}
+
+		now := time.Now()
+		if now.Sub(started) >= stableRun {
+			delay, failures = restartDelay, 0
+		}
+		failures++
+		exits = recent(append(exits, now), now, p.restart.crashWindow)
+
+		switch {
+		case p.restart.maxRestarts > 0 && failures > p.restart.maxRestarts:
+			p.fail(fmt.Sprintf("task %s exited %d times in a row, last: %v", p.target, failures, err))
+		case p.restart.crashLoop > 0 && len(exits) >= p.restart.crashLoop:
+			p.fail(fmt.Sprintf("crash loop: task %s exited %d times within %s, last: %v", p.target, len(exits), p.restart.crashWindow, err))
+		}
+
+		slog.Warn("Task exited; restarting it", "target", p.target, "after", now.Sub(started).Round(time.Second), "err", err,
+			"delay", delay, "restart", failures)
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// runTask runs the task target once, until it exits
+// What it started and left behind is killed with it, so a restart doesn't
+// find the old stack still holding its ports.
+func (p *program) runTask(taskPath string) error {
+	cmd := exec.Command(taskPath, p.target)
+	cmd.Dir = p.workDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	var ends []*os.File // the wrapper's ends of the log pipes
+	var copied []chan struct{}
+	if p.logs != nil {
+		for _, stream := range []string{"stdout", "stderr"} {
+			out := os.Stdout
+			if stream == "stderr" {
+				out = os.Stderr
+			}
+			end, done, err := p.logs.pipe(stream, out)
+			if err != nil {
+				closeAll(ends)
+				return err
+			}
+			ends, copied = append(ends, end), append(copied, done)
+		}
+		cmd.Stdout, cmd.Stderr = ends[0], ends[1]
+	}
+	setProcessGroup(cmd)
+
+	// Set PATH so child processes (task calling task) can find binaries
+	cmd.Env = withPath(os.Environ(), servicePath())
+
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		closeAll(ends)
+		return nil
+	}
+	err := cmd.Start()
+	closeAll(ends) // task has its own copies now
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	if err := track(cmd.Process); err != nil {
+		slog.Warn("Failed to track the processes task starts", "err", err)
+	}
+	exited := make(chan struct{})
+	p.cmd, p.exited = cmd, exited
+	p.mu.Unlock()
+	slog.Debug("Started task", "target", p.target, "pid", cmd.Process.Pid)
+
+	err = cmd.Wait()
+	slog.Debug("Task exited", "target", p.target, "pid", cmd.Process.Pid, "err", err)
+	kill(cmd.Process)
+	release(cmd.Process)
+	waitCopied(copied)
+
+	p.mu.Lock()
+	p.cmd, p.exited = nil, nil
+	p.mu.Unlock()
+	close(exited)
+	return err
+}
+
+// waitCopied waits a moment for the last lines of task to reach the log file,
+// which a process that outlived the group may hold back
+func waitCopied(copied []chan struct{}) {
+	timeout := time.After(copyWait)
+	for _, done := range copied {
+		select {
+		case <-done:
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+func (p *program) isStopping() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopping
+}
+
+// fail marks the service failed: it records why for the status command and
+// exits non-zero
+func (p *program) fail(reason string) {
+	slog.Error("Service failed", "reason", reason)
+	stamp := time.Now().Format(time.RFC3339) + " " + reason + "\n"
+	if err := os.WriteFile(p.failedPath, []byte(stamp), 0o644); err != nil {
+		slog.Error("Failed to record the failure", "err", err)
+	}
+	os.Exit(1)
+}
+
+// failure returns why the service last failed, if it did and has not been
+// started again since
+func failure(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// recent drops the times more than window before now
+func recent(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > window {
+		i++
+	}
+	return times[i:]
+}
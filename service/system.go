@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+
+	"github.com/kardianos/service"
+)
+
+// systemUnitPaths is where a system-wide install (--system) puts the service
+// definition, per OS; %s is the service name
+var systemUnitPaths = map[string]string{
+	"linux":  "/etc/systemd/system/%s.service",
+	"darwin": "/Library/LaunchDaemons/%s.plist",
+}
+
+// installedSystem reports whether the service is installed system-wide, so
+// start, stop and status find it without --system
+func installedSystem(name string) bool {
+	path, ok := systemUnitPaths[runtime.GOOS]
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(fmt.Sprintf(path, name))
+	return err == nil
+}
+
+// configureSystem turns cfg into a system-wide service running as userName
+// and group: a LaunchDaemon or a system systemd unit, which start at boot
+// without anyone logged in
+// userName defaults to the user who ran sudo, so the stack doesn't run as
+// root by accident; HOME is set for it, which launchd does not do and the
+// wrapper needs to find task (see defaultPath).
+func configureSystem(cfg *service.Config, userName, group string) error {
+	cfg.Option["UserService"] = false
+	if runtime.GOOS == "windows" {
+		// Windows services are system-wide already; accounts need a password
+		if userName != "" || group != "" {
+			return fmt.Errorf("--user and --group are not supported on Windows; set the account in services.msc")
+		}
+		return nil
+	}
+
+	if userName == "" {
+		userName = os.Getenv("SUDO_USER")
+	}
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return fmt.Errorf("--user: %w", err)
+		}
+		cfg.UserName = u.Username
+		if cfg.EnvVars == nil {
+			cfg.EnvVars = make(map[string]string)
+		}
+		cfg.EnvVars["HOME"] = u.HomeDir
+		cfg.EnvVars["USER"] = u.Username
+	}
+	if group == "" {
+		return nil
+	}
+	if _, err := user.LookupGroup(group); err != nil {
+		return fmt.Errorf("--group: %w", err)
+	}
+	if strings.ContainsAny(group, "<>&\"'\n") {
+		return fmt.Errorf("--group: invalid group name %q", group)
+	}
+
+	// kardianos/service has no group setting: install its templates with one
+	switch runtime.GOOS {
+	case "linux":
+		cfg.Option["SystemdScript"] = strings.Replace(systemdUnit, "{{/* group */}}", "Group="+group, 1)
+	case "darwin":
+		cfg.Option["LaunchdConfig"] = strings.Replace(launchdPlist, "{{/* group */}}",
+			"<key>GroupName</key>\n\t<string>"+group+"</string>", 1)
+	default:
+		return fmt.Errorf("--group is not supported on %s", runtime.GOOS)
+	}
+	return nil
+}
+
+// systemdUnit is kardianos/service's systemd unit with a Group= line
+const systemdUnit = `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+{{range $i, $dep := .Dependencies}}
+{{$dep}} {{end}}
+
+[Service]
+StartLimitInterval=5
+StartLimitBurst=10
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+{{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
+{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
+{{if .UserName}}User={{.UserName}}{{end}}
+{{/* group */}}
+{{if .ReloadSignal}}ExecReload=/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}
+{{if .PIDFile}}PIDFile={{.PIDFile|cmd}}{{end}}
+{{if and .LogOutput .HasOutputFileSupport -}}
+StandardOutput=file:{{.LogDirectory}}/{{.Name}}.out
+StandardError=file:{{.LogDirectory}}/{{.Name}}.err
+{{- end}}
+{{if gt .LimitNOFILE -1 }}LimitNOFILE={{.LimitNOFILE}}{{end}}
+{{if .Restart}}Restart={{.Restart}}{{end}}
+{{if .SuccessExitStatus}}SuccessExitStatus={{.SuccessExitStatus}}{{end}}
+RestartSec=120
+EnvironmentFile=-/etc/sysconfig/{{.Name}}
+
+{{range $k, $v := .EnvVars -}}
+Environment={{$k}}={{$v}}
+{{end -}}
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// launchdPlist is kardianos/service's launchd plist with a GroupName key
+const launchdPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Disabled</key>
+	<false/>
+	{{- if .EnvVars}}
+	<key>EnvironmentVariables</key>
+	<dict>
+		{{- range $k, $v := .EnvVars}}
+		<key>{{html $k}}</key>
+		<string>{{html $v}}</string>
+		{{- end}}
+	</dict>
+	{{- end}}
+	<key>KeepAlive</key>
+	<{{bool .KeepAlive}}/>
+	<key>Label</key>
+	<string>{{html .Name}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{html .Path}}</string>
+		{{- if .Config.Arguments}}
+		{{- range .Config.Arguments}}
+		<string>{{html .}}</string>
+		{{- end}}
+	{{- end}}
+	</array>
+	{{- if .ChRoot}}
+	<key>RootDirectory</key>
+	<string>{{html .ChRoot}}</string>
+	{{- end}}
+	<key>RunAtLoad</key>
+	<{{bool .RunAtLoad}}/>
+	<key>SessionCreate</key>
+	<{{bool .SessionCreate}}/>
+	{{- if .StandardErrorPath}}
+	<key>StandardErrorPath</key>
+	<string>{{html .StandardErrorPath}}</string>
+	{{- end}}
+	{{- if .StandardOutPath}}
+	<key>StandardOutPath</key>
+	<string>{{html .StandardOutPath}}</string>
+	{{- end}}
+	{{- if .UserName}}
+	<key>UserName</key>
+	<string>{{html .UserName}}</string>
+	{{- end}}
+	{{/* group */}}
+	{{- if .WorkingDirectory}}
+	<key>WorkingDirectory</key>
+	<string>{{html .WorkingDirectory}}</string>
+	{{- end}}
+</dict>
+</plist>
+`
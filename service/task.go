@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// taskEnv names the environment variable overriding the task binary
+const taskEnv = "PLAT_TELEMETRY_TASK"
+
+// findTask resolves the task binary: the --task flag, then PLAT_TELEMETRY_TASK,
+// then task on the service's PATH (see servicePath)
+// Services start with a minimal PATH (launchd has no Homebrew, systemd no
+// ~/go/bin), so the per-OS install locations are searched too.
+func findTask(flagPath string) (string, error) {
+	for _, override := range []string{flagPath, os.Getenv(taskEnv)} {
+		if override == "" {
+			continue
+		}
+		if _, err := os.Stat(override); err != nil {
+			return "", fmt.Errorf("task binary %s: %w", override, err)
+		}
+		return override, nil
+	}
+
+	name := "task"
+	if runtime.GOOS == "windows" {
+		name = "task.exe"
+	}
+	for _, dir := range filepath.SplitList(servicePath()) {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("task not found on PATH or in %s; install it or pass --task (or set %s)",
+		strings.Join(defaultPath(), string(os.PathListSeparator)), taskEnv)
+}
+
+// servicePath returns the PATH for task and the processes it starts: the
+// service's own, with the per-OS install locations it lacks appended
+func servicePath() string {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		seen[dir] = true
+	}
+	for _, dir := range defaultPath() {
+		if !seen[dir] {
+			dirs = append(dirs, dir)
+			seen[dir] = true
+		}
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
+
+// withPath returns env with PATH set to path
+// Windows spells it Path in the environment, and names are case-insensitive.
+func withPath(env []string, path string) []string {
+	out := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if name, _, _ := strings.Cut(kv, "="); !strings.EqualFold(name, "PATH") {
+			out = append(out, kv)
+		}
+	}
+	return append(out, "PATH="+path)
+}
+
+// homeDirs joins dirs under the user's home directory, skipping them when
+// it is unknown
+func homeDirs(dirs ...string) []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	out := make([]string, len(dirs))
+	for i, dir := range dirs {
+		out[i] = filepath.Join(home, dir)
+	}
+	return out
+}
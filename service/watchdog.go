@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often the watchdog asks process-compose for the state
+// of its processes
+const watchInterval = 5 * time.Second
+
+// alertTimeout bounds the --alert command
+const alertTimeout = 30 * time.Second
+
+// brokenDir holds a marker per process held down by the watchdog, relative to
+// the project root
+var brokenDir = filepath.Join("service", ".data", "broken")
+
+// processLimit caps how often process-compose may restart one process
+// process-compose restarts a crashing process forever, so an update whose
+// build crashes on start would flap; past the limit the process is stopped
+// and held down as broken until `resume <name>`.
+type processLimit struct {
+	restarts int // restarts within window that break a process; 0: off
+	window   time.Duration
+	alert    string // shell command run when a process breaks
+}
+
+// watchProcesses counts the restarts of every process process-compose
+// manages, breaks those over the limit, and keeps broken ones stopped, also
+// after the stack itself restarts
+func (p *program) watchProcesses() {
+	pc := newPCClient(p.workDir)
+	dir := filepath.Join(p.workDir, brokenDir)
+	seen := make(map[string]int)             // restart count at the last look
+	restarts := make(map[string][]time.Time) // when the restarts were seen, within the window
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// Not up yet, or restarting with the stack
+		procs, err := pc.processes()
+		if err != nil {
+			slog.Debug("Process Compose API not reachable", "err", err)
+			continue
+		}
+		now := time.Now()
+		for _, pr := range procs {
+			last, known := seen[pr.Name]
+			seen[pr.Name] = pr.Restarts
+			if known && pr.Restarts != last {
+				slog.Debug("Process restarted", "process", pr.Name, "status", pr.Status, "restarts", pr.Restarts)
+			}
+
+			if brokenReason(dir, pr.Name) != "" {
+				if pr.active() {
+					if err := pc.stopProcess(pr.Name); err != nil {
+						slog.Error("Failed to hold broken process down", "process", pr.Name, "err", err)
+					} else {
+						slog.Warn("Holding broken process down (resume it with: resume <process>)", "process", pr.Name)
+					}
+				}
+				delete(restarts, pr.Name)
+				continue
+			}
+
+			// A count lower than before: process-compose itself restarted
+			if !known || pr.Restarts <= last {
+				continue
+			}
+			for range pr.Restarts - last {
+				restarts[pr.Name] = append(restarts[pr.Name], now)
+			}
+			restarts[pr.Name] = recent(restarts[pr.Name], now, p.limit.window)
+			if n := len(restarts[pr.Name]); n >= p.limit.restarts {
+				reason := fmt.Sprintf("restarted %d times within %s, last exit code %d", n, p.limit.window, pr.ExitCode)
+				p.breakProcess(pc, dir, pr.Name, reason)
+				delete(restarts, pr.Name)
+			}
+		}
+	}
+}
+
+// breakProcess stops a process, marks it broken and runs the alert command
+func (p *program) breakProcess(pc *pcClient, dir, name, reason string) {
+	slog.Error("Process is broken; holding it down until: resume <process>", "process", name, "reason", reason)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		slog.Error("Failed to record broken process", "process", name, "err", err)
+	}
+	stamp := time.Now().Format(time.RFC3339) + " " + reason + "\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(stamp), 0o644); err != nil {
+		slog.Error("Failed to record broken process", "process", name, "err", err)
+	}
+	if err := pc.stopProcess(name); err != nil {
+		slog.Error("Failed to stop broken process", "process", name, "err", err)
+	}
+	if p.limit.alert != "" {
+		if err := runAlert(p.limit.alert, name, reason); err != nil {
+			slog.Error("Alert command failed", "process", name, "err", err)
+		}
+	}
+}
+
+// runAlert runs the --alert command through the shell, with the process and
+// why it broke in PLAT_TELEMETRY_PROCESS and PLAT_TELEMETRY_REASON
+func runAlert(command, name, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(ctx, shell, flag, command)
+	cmd.Env = append(withPath(os.Environ(), servicePath()),
+		"PLAT_TELEMETRY_PROCESS="+name, "PLAT_TELEMETRY_REASON="+reason)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// brokenReason returns why a process was marked broken, or "" if it is not
+func brokenReason(dir, name string) string {
+	return failure(filepath.Join(dir, name))
+}
+
+// brokenProcesses returns the processes marked broken, sorted, with why
+func brokenProcesses(dir string) ([]string, map[string]string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil
+	}
+	var names []string
+	reasons := make(map[string]string)
+	for _, e := range entries {
+		if reason := brokenReason(dir, e.Name()); reason != "" {
+			names = append(names, e.Name())
+			reasons[e.Name()] = reason
+		}
+	}
+	sort.Strings(names)
+	return names, reasons
+}
+
+// resume clears the broken mark of a process and starts it again, if the
+// stack is running
+func resume(workDir, name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid process name %q", name)
+	}
+	marker := filepath.Join(workDir, brokenDir, name)
+	if err := os.Remove(marker); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("process %s is not broken", name)
+		}
+		return err
+	}
+
+	if err := newPCClient(workDir).startProcess(name); err != nil {
+		log.Printf("Resumed %s; it starts with the stack (%v)", name, err)
+		return nil
+	}
+	log.Printf("Resumed %s and started it", name)
+	return nil
+}
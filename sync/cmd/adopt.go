@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Adopt brings a manually installed binary of a subsystem under sync management
+// Usage: sync adopt <subsystem> [--binary <path>] [--commit <hash>] [--force] [--json]
+// Without --binary, an unmanaged binary named after the repo is looked for in
+// the subsystem's .bin/, then on PATH. Without --commit, the version the binary
+// reports is resolved to the upstream tag's commit.
+func Adopt(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+	binary := fs.String("binary", "", "binary to adopt (default: the repo's binary in .bin/ or on PATH)")
+	commit := fs.String("commit", "", "upstream commit it was built from (default: from its version output)")
+	name := fs.String("name", "", "file name to install it as under .bin/ (default: the binary's name)")
+	force := fs.Bool("force", false, "adopt even if sync already manages an active version")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync adopt <subsystem> [--binary <path>] [--commit <hash>] [--force] [--json]")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+	var repo config.RepoConfig
+	for _, r := range cfg.Repos {
+		if r.Subsystem == subsystem {
+			repo = r
+		}
+	}
+	if repo.Subsystem == "" {
+		fmt.Fprintf(stdout, "❌ Unknown subsystem %s (not in the repos of sync.yaml)\n", subsystem)
+		os.Exit(1)
+	}
+	updater.Configure(cfg)
+
+	path := *binary
+	if path == "" {
+		found, err := findUnmanaged(repo)
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ %v\n", err)
+			fmt.Fprintln(stdout, "   Pass the binary with --binary <path>")
+			os.Exit(1)
+		}
+		path = found
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		fail("", err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		fmt.Fprintf(stdout, "❌ %s is not a file\n", path)
+		os.Exit(1)
+	}
+
+	a := updater.Adoption{Subsystem: subsystem, Binary: path, Name: *name, Commit: *commit}
+	if a.Name == "" {
+		a.Name = filepath.Base(path)
+	}
+	a.Probe, a.Release = updater.Probe(path)
+	if a.SHA256, err = updater.Fingerprint(path); err != nil {
+		fail("Failed to hash "+path, err)
+	}
+	if a.Commit == "" {
+		a.Commit = releaseCommit(cfg, repo, a.Release)
+	}
+	if a.Commit == "" {
+		// Unknown provenance: named after the hash, so the next poll offers an update
+		a.Commit = "adopted-" + a.SHA256[:12]
+	}
+
+	entry, err := updater.Adopt(a, *force)
+	if err != nil {
+		fail("", err)
+	}
+
+	if *jsonOutput {
+		writeJSON(a)
+		return
+	}
+	fmt.Fprintf(stdout, "✅ Adopted %s %s from %s\n", subsystem, revision.Short(entry.To), path)
+	if a.Probe != "" {
+		fmt.Fprintf(stdout, "   reports: %s\n", a.Probe)
+	}
+	fmt.Fprintf(stdout, "   sha256:  %s\n", a.SHA256)
+	if strings.HasPrefix(a.Commit, "adopted-") {
+		fmt.Fprintln(stdout, "   ⚠️  Its upstream commit is unknown, so the next poll will offer an update; pass --commit if you know it")
+	}
+}
+
+// findUnmanaged looks for a binary named after the repo (or its artifact
+// binary) that sync doesn't manage: in the subsystem's .bin/, then on PATH
+func findUnmanaged(repo config.RepoConfig) (string, error) {
+	_, name, _ := strings.Cut(repo.Repo, "/")
+	if repo.Artifact.Binary != "" {
+		name = repo.Artifact.Binary
+	}
+	if bin, err := versions.BinDir(repo.Subsystem); err == nil {
+		candidate := filepath.Join(bin, name)
+		if info, err := os.Lstat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate, nil
+		}
+	}
+	if found, err := exec.LookPath(name); err == nil {
+		return found, nil
+	}
+	return "", fmt.Errorf("no unmanaged %s found in %s/.bin/ or on PATH", name, repo.Subsystem)
+}
+
+// releaseCommit resolves the version a binary reports to the commit of the
+// matching upstream tag, trying it with and without the "v" prefix
+// It returns "" if the tag can't be found.
+func releaseCommit(cfg *config.Config, repo config.RepoConfig, release string) string {
+	if release == "" {
+		return ""
+	}
+	client, err := githubClient(cfg)
+	if err != nil {
+		logger.Warn("Can't look up the release", "release", release, "err", err)
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Checks.Timeout)
+	defer cancel()
+
+	var lookupErr error
+	for _, tag := range []string{release, strings.TrimPrefix(release, "v")} {
+		commit, err := checker.TagCommit(ctx, client, repo, tag)
+		if err == nil {
+			return commit
+		}
+		lookupErr = err
+	}
+	logger.Warn("No upstream tag for the release", "release", release, "repo", repo.Repo, "err", lookupErr)
+	return ""
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/api"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/httpserver"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+)
+
+// startAPI serves the status API in the background when API_PORT is set
+// Used by the polling daemons; `sync watch` mounts the API on its own server.
+func startAPI(cfg *config.Config) {
+	port := os.Getenv("API_PORT")
+	if port == "" {
+		return
+	}
+
+	loadAPIToken(cfg)
+	addr := fmt.Sprintf(":%s", port)
+	srv, err := httpserver.New(addr, api.Handler(), cfg.Server)
+	if err != nil {
+		fatal("Failed to configure API server", "err", err)
+	}
+
+	logger.Info("Status API listening", "addr", addr)
+	go func() {
+		if err := httpserver.ListenAndServe(srv); err != nil {
+			fatal("API server failed", "err", err)
+		}
+	}()
+}
+
+// loadAPIToken enables the API's write endpoints when an API token is configured
+func loadAPIToken(cfg *config.Config) {
+	token, err := secrets.New("API token", "SYNC_API_TOKEN", cfg.Secrets.APITokenFile)
+	if err != nil {
+		fatal("Failed to load API token", "err", err)
+	}
+	if token.Get() == "" {
+		return
+	}
+	go token.Watch(context.Background(), cfg.Secrets.ReloadInterval)
+	api.SetToken(token)
+	logger.Info("API writes enabled", "auth", "bearer token")
+}
+
+// OpenAPI prints the OpenAPI document of the status API
+// Usage: sync openapi
+func OpenAPI(args []string) {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	fs.Parse(args)
+	writeJSON(api.OpenAPI())
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/artifacts"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Artifacts inspects and cleans the content-addressed artifact store
+func Artifacts(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(stdout, "Usage: sync artifacts <ls|gc> [args]")
+		fmt.Fprintln(stdout, "  ls [--json]                  List stored blobs and the installed files using them")
+		fmt.Fprintln(stdout, "  gc [--dry-run] [--json]      Remove blobs no installed version references")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "ls":
+		fs := flag.NewFlagSet("artifacts ls", flag.ExitOnError)
+		jsonOutput := fs.Bool("json", false, "output JSON")
+		fs.Parse(args[1:])
+
+		list, err := artifacts.List()
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ Failed to read artifact store: %v\n", err)
+			os.Exit(1)
+		}
+		if *jsonOutput {
+			if list == nil {
+				list = []artifacts.Artifact{}
+			}
+			writeJSON(list)
+			return
+		}
+		if len(list) == 0 {
+			fmt.Fprintln(stdout, "No artifacts stored (versioned installs are stored from the next update)")
+			return
+		}
+
+		var stored, referenced int64
+		for _, a := range list {
+			refs := make([]string, len(a.Refs))
+			for i, r := range a.Refs {
+				refs[i] = r.String()
+			}
+			stored += a.Size
+			referenced += a.Size * int64(len(a.Refs))
+			fmt.Fprintf(stdout, "%s  %10s  %d ref(s)  %s\n", a.Digest[:12], versions.FormatBytes(a.Size), len(a.Refs), strings.Join(refs, ", "))
+		}
+		fmt.Fprintf(stdout, "\n%d artifacts, %s stored", len(list), versions.FormatBytes(stored))
+		if saved := referenced - stored; saved > 0 {
+			fmt.Fprintf(stdout, " (%s saved by deduplication)", versions.FormatBytes(saved))
+		}
+		fmt.Fprintln(stdout)
+
+	case "gc":
+		fs := flag.NewFlagSet("artifacts gc", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "report what would be removed without deleting anything")
+		jsonOutput := fs.Bool("json", false, "output JSON")
+		fs.Parse(args[1:])
+
+		removed, err := artifacts.GC(*dryRun)
+		if *jsonOutput {
+			if removed == nil {
+				removed = []artifacts.Artifact{}
+			}
+			writeJSON(removed)
+		} else {
+			verb, reclaimed := "Removed", "reclaimed"
+			if *dryRun {
+				verb, reclaimed = "Would remove", "would be reclaimed"
+			}
+			var total int64
+			for _, a := range removed {
+				total += a.Size
+				fmt.Fprintf(stdout, "🗑  %s %s (%s)\n", verb, a.Digest[:12], versions.FormatBytes(a.Size))
+			}
+			if len(removed) == 0 {
+				fmt.Fprintln(stdout, "✅ Nothing to collect")
+			} else {
+				fmt.Fprintf(stdout, "✅ %s %d artifacts, %s %s\n", verb, len(removed), versions.FormatBytes(total), reclaimed)
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(stderr, "❌ Artifact GC failed: %v\n", err)
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(stdout, "Unknown artifacts command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
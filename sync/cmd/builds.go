@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/buildenv"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+)
+
+// BuildDiff is the machine-readable result of sync builds diff
+type BuildDiff struct {
+	A           buildenv.Build        `json:"a"`
+	B           buildenv.Build        `json:"b"`
+	SameVersion bool                  `json:"sameVersion"`
+	Differences []buildenv.Difference `json:"differences"`
+}
+
+// Builds lists, shows or compares the recorded environments of source builds
+// Usage: sync builds [list|show|diff] [args]
+func Builds(args []string) {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "list":
+		listBuilds(args)
+	case "show":
+		showBuild(args)
+	case "diff":
+		diffBuilds(args)
+	default:
+		fmt.Fprintln(stdout, "Usage: sync builds [list|show|diff] [args]")
+		fmt.Fprintln(stdout, "  list [subsystem] [--json]   recorded source builds, newest first")
+		fmt.Fprintln(stdout, "  show <build> [--json]       the environment a build ran in")
+		fmt.Fprintln(stdout, "  diff <a> <b> [--json]       why two builds differ: toolchain, go env, variables, OS image")
+		fmt.Fprintln(stdout, "  A build is its ID, <subsystem> (newest), <subsystem>@<version>, or a file from `sync builds show --json`")
+		os.Exit(1)
+	}
+}
+
+func listBuilds(args []string) {
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("builds list", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	builds, err := buildenv.List(subsystem)
+	if err != nil {
+		fail("", err)
+	}
+	if *jsonOutput {
+		if builds == nil {
+			builds = []buildenv.Build{}
+		}
+		writeJSON(builds)
+		return
+	}
+	if len(builds) == 0 {
+		fmt.Fprintln(stdout, "No builds recorded (source builds record their environment from the next update)")
+		return
+	}
+	for _, b := range builds {
+		fmt.Fprintf(stdout, "%-28s %-10s %-12s %s  %s\n", b.ID, b.Subsystem, revision.Short(b.Version), b.Time.Local().Format(time.DateTime), b.Env.Summary())
+	}
+}
+
+func showBuild(args []string) {
+	ref := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ref, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("builds show", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if ref == "" && fs.NArg() > 0 {
+		ref = fs.Arg(0)
+	}
+	if ref == "" {
+		fmt.Fprintln(stdout, "Usage: sync builds show <build> [--json]")
+		os.Exit(1)
+	}
+
+	b, err := buildenv.Find(ref)
+	if err != nil {
+		fail("", err)
+	}
+	if *jsonOutput {
+		writeJSON(b)
+		return
+	}
+	trigger := ""
+	if b.Trigger != "" {
+		trigger = " (" + b.Trigger + ")"
+	}
+	fmt.Fprintf(stdout, "Build %s: %s %s on %s, %s%s\n", b.ID, b.Subsystem, revision.Short(b.Version), b.Host, b.Time.Local().Format(time.DateTime), trigger)
+	fmt.Fprintf(stdout, "  %-22s %s\n", "os", b.Env.OS)
+	if b.Env.Kernel != "" {
+		fmt.Fprintf(stdout, "  %-22s %s\n", "kernel", b.Env.Kernel)
+	}
+	fmt.Fprintf(stdout, "  %-22s %s\n", "platform", b.Env.Platform)
+	if b.Env.Modules != "" {
+		fmt.Fprintf(stdout, "  %-22s %s\n", "modules", b.Env.Modules)
+	}
+	for _, section := range []struct {
+		name string
+		m    map[string]string
+	}{{"tools", b.Env.Tools}, {"go", b.Env.Go}, {"vars", b.Env.Vars}} {
+		keys := make([]string, 0, len(section.m))
+		for k := range section.m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(stdout, "  %-22s %s\n", section.name+"."+k, section.m[k])
+		}
+	}
+}
+
+func diffBuilds(args []string) {
+	var refs []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		refs, args = append(refs, args[0]), args[1:]
+	}
+	fs := flag.NewFlagSet("builds diff", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	refs = append(refs, fs.Args()...)
+	if len(refs) != 2 {
+		fmt.Fprintln(stdout, "Usage: sync builds diff <a> <b> [--json]")
+		fmt.Fprintln(stdout, "  Run `sync builds` to see recorded builds")
+		os.Exit(1)
+	}
+
+	a, err := buildenv.Find(refs[0])
+	if err != nil {
+		fail("", err)
+	}
+	b, err := buildenv.Find(refs[1])
+	if err != nil {
+		fail("", err)
+	}
+	d := BuildDiff{A: a, B: b, SameVersion: revision.Same(a.Version, b.Version), Differences: buildenv.Diff(a.Env, b.Env)}
+	if d.Differences == nil {
+		d.Differences = []buildenv.Difference{}
+	}
+	if *jsonOutput {
+		writeJSON(d)
+		return
+	}
+
+	fmt.Fprintf(stdout, "a: %s  %s %s on %s, %s\n", a.ID, a.Subsystem, revision.Short(a.Version), a.Host, a.Time.Local().Format(time.DateTime))
+	fmt.Fprintf(stdout, "b: %s  %s %s on %s, %s\n", b.ID, b.Subsystem, revision.Short(b.Version), b.Host, b.Time.Local().Format(time.DateTime))
+	if !d.SameVersion {
+		fmt.Fprintln(stdout, "⚠️  The builds are of different commits; their sources differ too")
+	}
+	if len(d.Differences) == 0 {
+		fmt.Fprintln(stdout, "\n✅ The build environments are identical")
+		return
+	}
+	fmt.Fprintf(stdout, "\n%d difference(s):\n", len(d.Differences))
+	for _, diff := range d.Differences {
+		fmt.Fprintf(stdout, "  %s\n    a: %s\n    b: %s\n", diff.Field, orUnset(diff.A), orUnset(diff.B))
+	}
+}
+
+// orUnset returns v, or "(unset)" when it is empty
+func orUnset(v string) string {
+	if v == "" {
+		return "(unset)"
+	}
+	return v
+}
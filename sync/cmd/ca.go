@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/pki"
+)
+
+// CA manages the built-in certificate authority used for mutual TLS
+func CA(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(stdout, "Usage: sync ca <init|issue> [args]")
+		fmt.Fprintln(stdout, "  init [--dir <dir>]           Create a new CA")
+		fmt.Fprintln(stdout, "  issue <host> [--dir <dir>]   Issue a server/client certificate for host")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "init":
+		fs := flag.NewFlagSet("ca init", flag.ExitOnError)
+		dir := fs.String("dir", defaultCADir(), "CA directory")
+		fs.Parse(args[1:])
+
+		if err := pki.Init(*dir); err != nil {
+			fmt.Fprintf(stdout, "❌ CA init failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(stdout, "✅ CA created in %s\n", *dir)
+	case "issue":
+		if len(args) < 2 {
+			fmt.Fprintln(stdout, "Usage: sync ca issue <host> [--dir <dir>]")
+			os.Exit(1)
+		}
+		host := args[1]
+
+		fs := flag.NewFlagSet("ca issue", flag.ExitOnError)
+		dir := fs.String("dir", defaultCADir(), "CA directory")
+		fs.Parse(args[2:])
+
+		certPath, keyPath, err := pki.Issue(*dir, host)
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ Issue failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(stdout, "✅ Issued certificate for %s\n", host)
+		fmt.Fprintf(stdout, "   cert: %s\n", certPath)
+		fmt.Fprintf(stdout, "   key:  %s\n", keyPath)
+		fmt.Fprintf(stdout, "   ca:   %s\n", filepath.Join(*dir, pki.CACertFile))
+	default:
+		fmt.Fprintf(stdout, "Unknown ca command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// defaultCADir returns <data dir>/ca
+func defaultCADir() string {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "ca"
+	}
+	return filepath.Join(dir, "ca")
+}
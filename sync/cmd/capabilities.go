@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+)
+
+// Capabilities reports which providers, notifiers, packaging formats and
+// control surfaces this build supports
+// Usage: sync capabilities [--json]
+func Capabilities(args []string) {
+	fs := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	report := capabilities.Get()
+	if *jsonOutput {
+		writeJSON(report)
+		return
+	}
+
+	build := report.Version
+	if report.Commit != "" {
+		build += " (" + revision.Short(report.Commit) + ")"
+	}
+	fmt.Fprintf(stdout, "sync %s, %s %s/%s\n", build, report.GoVersion, report.OS, report.Arch)
+	if len(report.Tags) > 0 {
+		fmt.Fprintf(stdout, "  %-10s %s\n", "tags:", strings.Join(report.Tags, ", "))
+	}
+	for _, kind := range capabilities.Kinds() {
+		names := report.Supports[kind]
+		if len(names) == 0 {
+			names = []string{"none"}
+		}
+		fmt.Fprintf(stdout, "  %-10s %s\n", kind+":", strings.Join(names, ", "))
+	}
+}
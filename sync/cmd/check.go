@@ -1,28 +1,152 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 
+	"github.com/google/go-github/v80/github"
 	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
 )
 
-// Check runs version check for all subsystems
-func Check() {
-	fmt.Println("Checking for upstream updates...")
+// CheckResult is the machine-readable result of checking one subsystem
+type CheckResult struct {
+	Subsystem       string `json:"subsystem"`
+	Current         string `json:"current"`
+	Latest          string `json:"latest"`
+	Release         string `json:"release,omitempty"` // releases mode: newest release at or above the pin
+	Pin             string `json:"pin,omitempty"`     // tag and releases modes: version pinned in the Taskfile
+	UpdateAvailable bool   `json:"updateAvailable"`
+	Signer          string `json:"signer,omitempty"`     // signatures: who signed the upstream tag
+	Unverified      string `json:"unverified,omitempty"` // signatures policy warn: why the tag failed verification
+	Error           string `json:"error,omitempty"`
+	ErrorKind       string `json:"errorKind,omitempty"` // see sync errors
+}
+
+// Check compares the installed version of each configured subsystem with its upstream
+// Usage: sync check [subsystem|all] [--json]
+// If a check fails, it exits with the code of the first failure's kind.
+func Check(args []string) {
+	jsonOutput := false
+	only := ""
+	for _, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			jsonOutput = true
+		case "all":
+		default:
+			only = arg
+		}
+	}
+
+	cfg := loadConfig()
+
+	// Check the repos the poller watches, with the same settings
+	var repos []config.RepoConfig
+	for _, repo := range cfg.Repos {
+		if only == "" || repo.Subsystem == only {
+			repos = append(repos, repo)
+		}
+	}
+	if len(cfg.Repos) == 0 {
+		fmt.Fprintf(stdout, "❌ %s\n", i18n.T("check.no_repos"))
+		os.Exit(1)
+	}
+	if len(repos) == 0 {
+		fmt.Fprintf(stdout, "❌ %s\n", i18n.T("check.unknown_subsystem", only))
+		os.Exit(1)
+	}
 
-	subsystems := []string{"arc", "liftbridge", "nats", "telegraf"}
+	client, err := githubClient(cfg)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %s\n", i18n.T("check.token_failed", err))
+		os.Exit(1)
+	}
 
-	for _, subsystem := range subsystems {
-		current, latest, err := checker.CheckVersion(subsystem)
-		if err != nil {
-			fmt.Printf("❌ %s: %v\n", subsystem, err)
+	if !jsonOutput {
+		printFreeze()
+		fmt.Fprintln(stdout, i18n.T("check.checking"))
+	}
+
+	results := make([]CheckResult, 0, len(repos))
+	var failure error
+	for _, repo := range repos {
+		subsystem := repo.Subsystem
+		result, latest, err := checkRepo(cfg, client, repo)
+		if err != nil && failure == nil {
+			failure = err
+		}
+		current := result.Current
+		results = append(results, result)
+
+		if jsonOutput {
 			continue
 		}
 
-		if current == latest {
-			fmt.Printf("✅ %s: up-to-date (%s)\n", subsystem, current)
-		} else {
-			fmt.Printf("🔄 %s: %s → %s (update available)\n", subsystem, current, latest)
+		switch {
+		case result.Error != "":
+			fmt.Fprintf(stdout, "❌ %s: %s\n", subsystem, result.Error)
+			if kind := syncerr.Kind(result.ErrorKind); kind != syncerr.Unknown {
+				fmt.Fprintf(stdout, "   → %s\n", hint(kind))
+			}
+		case !result.UpdateAvailable:
+			fmt.Fprintf(stdout, "✅ %s\n", i18n.T("check.up_to_date", subsystem, revision.Short(current)))
+		case latest.Supersedes():
+			fmt.Fprintf(stdout, "🔄 %s\n", i18n.T("check.supersedes", subsystem, revision.Short(current), revision.Short(latest.Commit), latest.Release, latest.Pin))
+		default:
+			fmt.Fprintf(stdout, "🔄 %s\n", i18n.T("check.available", subsystem, revision.Short(current), revision.Short(latest.Commit)))
+		}
+		if result.Unverified != "" {
+			fmt.Fprintf(stdout, "   ⚠️  %s\n", result.Unverified)
 		}
 	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(stderr, "❌ Failed to encode results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if failure != nil {
+		os.Exit(syncerr.ExitCode(failure))
+	}
+}
+
+// checkRepo checks one repo against its upstream within the configured timeout
+// A failed check is reported in the result as well as returned.
+func checkRepo(cfg *config.Config, client *github.Client, repo config.RepoConfig) (CheckResult, checker.Upstream, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Checks.Timeout)
+	defer cancel()
+
+	result := CheckResult{Subsystem: repo.Subsystem}
+	current, latest, err := checker.CheckVersion(ctx, client, repo)
+	result.Current = current
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorKind = string(syncerr.KindOf(err))
+		return result, latest, err
+	}
+	result.Latest = latest.Commit
+	result.Release, result.Pin = latest.Release, latest.Pin
+	result.Signer, result.Unverified = latest.Signer, latest.Unverified
+	result.UpdateAvailable = !revision.Same(current, latest.Commit)
+	return result, latest, nil
+}
+
+// githubClient creates the GitHub client the poller would use
+func githubClient(cfg *config.Config) (*github.Client, error) {
+	token, err := secrets.New("GitHub token", "GITHUB_TOKEN", cfg.Secrets.GitHubTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return ghclient.New(token, cfg.Provider, cfg.FixturesDir, cfg.GitHub), nil
 }
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/buildenv"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// commands lists the commands of sync, for completion
+var commands = []string{
+	"adopt", "approve", "artifacts", "audit", "builds", "ca", "capabilities", "check", "checkout", "clone",
+	"completion", "delta", "diff", "divergence", "errors", "events", "freeze", "gc", "generate", "history",
+	"hosts", "identity", "internal", "notify", "openapi", "pending", "policy", "poll", "poll-taskfiles", "promote", "pull", "reject",
+	"releases", "render", "report", "rollback", "selftest", "snapshot", "state", "status", "tags", "thaw", "train", "update",
+	"verify", "versions", "watch",
+}
+
+// subsystemCommands take a configured subsystem as their first argument
+var subsystemCommands = map[string]bool{
+	"adopt": true, "check": true, "diff": true, "divergence": true, "history": true, "policy": true, "promote": true,
+	"render": true, "report": true, "rollback": true, "tags": true, "update": true, "verify": true, "versions": true,
+}
+
+// subcommands of the commands that have them
+var subcommands = map[string][]string{
+	"artifacts":  {"ls", "gc"},
+	"builds":     {"list", "show", "diff"},
+	"ca":         {"init", "issue"},
+	"completion": {"bash", "zsh", "fish"},
+	"delta":      {"create", "apply"},
+	"generate":   {"installer"},
+	"notify":     {"test"},
+	"snapshot":   {"list", "restore"},
+	"state":      {"migrate"},
+	"train":      {"list", "show", "approve", "reject"},
+}
+
+// Completion prints the completion script of a shell
+// The scripts call `sync __complete` for the candidates, so they offer the
+// subsystems of sync.yaml, pending updates and installed versions as they are
+// at the time of <TAB>.
+// Usage: sync completion <bash|zsh|fish>
+func Completion(args []string) {
+	shell := ""
+	if len(args) > 0 {
+		shell = args[0]
+	}
+	script, ok := completionScripts[shell]
+	if !ok {
+		fmt.Fprintln(stdout, "Usage: sync completion <bash|zsh|fish>")
+		fmt.Fprintln(stdout, "  bash: source <(sync completion bash)")
+		fmt.Fprintln(stdout, "  zsh:  source <(sync completion zsh)")
+		fmt.Fprintln(stdout, "  fish: sync completion fish | source")
+		os.Exit(1)
+	}
+	fmt.Fprint(stdout, script)
+}
+
+// Complete prints the candidates for the last of args, one per line
+// args are the words after sync up to the one being completed, which may be
+// empty. It never fails: what can't be read offers nothing.
+// Usage: sync __complete <word>...
+func Complete(args []string) {
+	for _, c := range candidates(args) {
+		fmt.Fprintln(stdout, c)
+	}
+}
+
+func candidates(args []string) []string {
+	if len(args) <= 1 {
+		return commands
+	}
+	command, words := args[0], args[1:len(args)-1]
+	prev := args[len(args)-2]
+
+	switch {
+	case command == "rollback" && prev == "--to":
+		// The versions of the subsystem given before --to
+		for _, w := range words {
+			if !strings.HasPrefix(w, "-") {
+				return installedVersions(w)
+			}
+		}
+		return nil
+	case (command == "promote" && (prev == "--from" || prev == "--to")) || (command == "releases" && len(words) == 0):
+		return environments()
+	case command == "approve" || command == "reject":
+		if len(words) == 0 {
+			return pendingSubsystems()
+		}
+	case subsystemCommands[command]:
+		if len(words) == 0 {
+			return subsystems()
+		}
+	case command == "train" && len(words) == 1 && words[0] != "list":
+		return trainNames()
+	case command == "builds" && len(words) == 1 && words[0] == "list":
+		return subsystems()
+	case command == "builds" && (len(words) == 1 || len(words) == 2 && words[0] == "diff"):
+		return buildIDs()
+	case subcommands[command] != nil:
+		if len(words) == 0 {
+			return subcommands[command]
+		}
+	}
+	return nil
+}
+
+// subsystems returns the subsystems configured in sync.yaml
+func subsystems() []string {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, r := range cfg.Repos {
+		names = append(names, r.Subsystem)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pendingSubsystems returns the subsystems with an update awaiting approval
+func pendingSubsystems() []string {
+	pending, err := updater.Pending()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, p := range pending {
+		names = append(names, p.Subsystem)
+	}
+	return names
+}
+
+// installedVersions returns the versions of a subsystem a rollback can switch to
+func installedVersions(subsystem string) []string {
+	list, err := versions.List(subsystem)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, v := range list {
+		if !v.Active {
+			names = append(names, v.Version)
+		}
+	}
+	return names
+}
+
+// trainNames returns the release trains, newest first
+func trainNames() []string {
+	trains, err := updater.Trains()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, t := range trains {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// buildIDs returns the recorded builds, newest first
+func buildIDs() []string {
+	builds, err := buildenv.List("")
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, b := range builds {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+// environments returns the promotion stages configured in sync.yaml
+func environments() []string {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range cfg.Environments {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for sync: source <(sync completion bash)
+_sync() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(sync __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "$cur"))
+}
+complete -o default -F _sync sync
+`,
+	"zsh": `#compdef sync
+# zsh completion for sync: source <(sync completion zsh)
+_sync() {
+    local -a candidates
+    candidates=("${(@f)$(sync __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if (( ${#candidates[@]} )) && [[ -n ${candidates[1]} ]]; then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _sync sync
+`,
+	"fish": `# fish completion for sync: sync completion fish | source
+function __sync_complete
+    set -l words (commandline -opc)
+    sync __complete $words[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c sync -f -a '(__sync_complete)'
+`,
+}
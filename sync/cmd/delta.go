@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/delta"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Delta creates and applies binary patches between installed versions
+func Delta(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(stdout, "Usage: sync delta <create|apply> [args]")
+		fmt.Fprintln(stdout, "  create <subsystem> [--from <version>] [--to <version>] [-o <file>]")
+		fmt.Fprintln(stdout, "                               Write a patch (default: previous → active version)")
+		fmt.Fprintln(stdout, "  apply <subsystem> <file> [--no-fallback]")
+		fmt.Fprintln(stdout, "                               Install and activate the version a patch builds")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "create":
+		deltaCreate(args[1:])
+	case "apply":
+		deltaApply(args[1:])
+	default:
+		fmt.Fprintf(stdout, "Unknown delta command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// deltaCreate writes a patch from one installed version to another
+func deltaCreate(args []string) {
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("delta create", flag.ExitOnError)
+	from := fs.String("from", "", "base version (default: the one installed before the active version)")
+	to := fs.String("to", "", "target version (default: the active version)")
+	out := fs.String("o", "", "patch file (default: <subsystem>-<from>-<to>.patch)")
+	fs.Parse(args)
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync delta create <subsystem> [--from <version>] [--to <version>] [-o <file>]")
+		os.Exit(1)
+	}
+
+	var err error
+	if *to == "" {
+		if *to, err = versions.Active(subsystem); err == nil && *to == "" {
+			err = fmt.Errorf("no active version of %s", subsystem)
+		}
+	} else {
+		*to, err = versions.Resolve(subsystem, *to)
+	}
+	if err == nil && *from == "" {
+		*from, err = versions.Previous(subsystem)
+	} else if err == nil {
+		*from, err = versions.Resolve(subsystem, *from)
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("%s-%s-%s.patch", subsystem, revision.Short(*from), revision.Short(*to))
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	m, err := delta.Create(subsystem, *from, *to, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		fmt.Fprintf(stdout, "❌ Delta create failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	var full int64
+	for _, file := range m.Files {
+		full += file.Size
+	}
+	info, err := os.Stat(*out)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(stdout, "✅ Wrote %s (%s → %s)\n", *out, revision.Short(*from), revision.Short(*to))
+	fmt.Fprintf(stdout, "   patch: %s, full build: %s", versions.FormatBytes(info.Size()), versions.FormatBytes(full))
+	if full > 0 {
+		fmt.Fprintf(stdout, " (%.0f%% smaller)", 100*(1-float64(info.Size())/float64(full)))
+	}
+	fmt.Fprintln(stdout)
+}
+
+// deltaApply installs the version a patch builds and switches to it
+func deltaApply(args []string) {
+	var positional []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = append(positional, args[0]), args[1:]
+	}
+
+	fs := flag.NewFlagSet("delta apply", flag.ExitOnError)
+	noFallback := fs.Bool("no-fallback", false, "fail instead of downloading the full artifact when the patch does not apply")
+	fs.Parse(args)
+	positional = append(positional, fs.Args()...)
+	if len(positional) != 2 {
+		fmt.Fprintln(stdout, "Usage: sync delta apply <subsystem> <file> [--no-fallback]")
+		os.Exit(1)
+	}
+	subsystem, path := positional[0], positional[1]
+
+	abs, err := filepath.Abs(path)
+	if err == nil {
+		path = abs
+	}
+	// With sync.yaml, the subsystem's configs are re-rendered for the version
+	// it switches to
+	if cfg, err := config.LoadDefault(); err == nil {
+		updater.Configure(cfg)
+	}
+	entry, err := updater.ApplyDelta(subsystem, path, !*noFallback)
+	if err != nil {
+		fail("", err)
+	}
+
+	fmt.Fprintf(stdout, "✅ %s updated: %s → %s\n", subsystem, orUnknown(entry.From), orUnknown(entry.To))
+	// Stay for the regression watch, which may roll the update back
+	updater.WaitForWatches()
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/gitops"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Where sync diff found the commits
+const (
+	diffSourceGit    = "git"    // the subsystem's clone in <subsystem>/.src
+	diffSourceGitHub = "github" // the GitHub compare API
+)
+
+// DiffResult is the machine-readable result of sync diff
+type DiffResult struct {
+	Subsystem string          `json:"subsystem"`
+	Repo      string          `json:"repo"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Release   string          `json:"release,omitempty"` // releases mode: the tag to is
+	Source    string          `json:"source,omitempty"`  // git or github; unset when from is to
+	Total     int             `json:"total"`             // commits in the range, listed or not
+	Commits   []gitops.Commit `json:"commits"`           // newest first
+}
+
+// Diff lists the upstream commits between the installed version of a
+// subsystem and the one it would update to, e.g. before approving an update
+// Usage: sync diff <subsystem> [--from <rev>] [--to <rev>] [--limit <n>] [--json]
+// The target is the pending update if there is one, else the latest upstream
+// version. Commits come from the local clone when it has both ends, else
+// from GitHub.
+func Diff(args []string) {
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	from := fs.String("from", "", "compare from this commit or tag instead of the installed version")
+	to := fs.String("to", "", "compare up to this commit or tag instead of the update target")
+	limit := fs.Int("limit", 50, "commits shown (0 for all)")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync diff <subsystem> [--from <rev>] [--to <rev>] [--limit <n>] [--json]")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+	var repo *config.RepoConfig
+	for i := range cfg.Repos {
+		if cfg.Repos[i].Subsystem == subsystem {
+			repo = &cfg.Repos[i]
+		}
+	}
+	if repo == nil {
+		fmt.Fprintf(stdout, "❌ %s is not configured in sync.yaml\n", subsystem)
+		os.Exit(1)
+	}
+
+	client, err := githubClient(cfg)
+	if err != nil {
+		fail("Failed to read the GitHub token", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Checks.Timeout)
+	defer cancel()
+
+	result := DiffResult{Subsystem: subsystem, Repo: repo.Repo, From: *from, To: *to}
+	if result.From == "" {
+		if result.From, err = checker.GetCurrentVersion(subsystem); err != nil {
+			fail("Failed to read the installed version (pass --from)", err)
+		}
+	}
+	if result.To == "" {
+		result.To, result.Release, err = diffTarget(ctx, client, *repo)
+		if err != nil {
+			fail("Failed to look up the update target", err)
+		}
+	}
+
+	if !revision.Same(result.From, result.To) {
+		result.Commits, result.Total, result.Source, err = commitRange(ctx, client, *repo, result.From, result.To)
+		if err != nil {
+			fail("Failed to list commits", err)
+		}
+	}
+	if result.Commits == nil {
+		result.Commits = []gitops.Commit{}
+	}
+	if *limit > 0 && len(result.Commits) > *limit {
+		result.Commits = result.Commits[:*limit]
+	}
+	more := result.Total - len(result.Commits)
+
+	if *jsonOutput {
+		writeJSON(result)
+		return
+	}
+
+	target := revision.Short(result.To)
+	if result.Release != "" {
+		target = result.Release + " (" + target + ")"
+	}
+	switch {
+	case result.Source == "":
+		fmt.Fprintf(stdout, "✅ %s is at %s already\n", subsystem, target)
+		return
+	case result.Total == 0:
+		fmt.Fprintf(stdout, "No commits in %s from %s to %s: the target is not ahead of it\n", repo.Repo, revision.Short(result.From), target)
+		return
+	}
+	via := "GitHub"
+	if result.Source == diffSourceGit {
+		via = "the local clone"
+	}
+	fmt.Fprintf(stdout, "%s: %d commit(s) from %s to %s, newest first (from %s):\n", repo.Repo, result.Total, revision.Short(result.From), target, via)
+	for _, c := range result.Commits {
+		fmt.Fprintf(stdout, "  %s  %s  %-20s %s\n", revision.Short(c.SHA), c.Date.Local().Format("2006-01-02"), c.Author, c.Subject)
+	}
+	if more > 0 {
+		fmt.Fprintf(stdout, "  … and %d more (--limit 0 lists all)\n", more)
+	}
+}
+
+// commitRange lists the upstream commits from → to of a subsystem, newest
+// first, from its clone in <subsystem>/.src when that has both ends, else
+// from GitHub; it returns the total and where they came from
+func commitRange(ctx context.Context, client *github.Client, repo config.RepoConfig, from, to string) ([]gitops.Commit, int, string, error) {
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return nil, 0, "", err
+	}
+	commits, err := gitops.Log(filepath.Join(root, repo.Subsystem, ".src"), from, to)
+	if err == nil {
+		return commits, len(commits), diffSourceGit, nil
+	}
+	commits, total, err := checker.CompareCommits(ctx, client, repo.Repo, from, to)
+	return commits, total, diffSourceGitHub, err
+}
+
+// diffTarget returns the version a subsystem would update to: its pending
+// update, or the latest upstream version
+func diffTarget(ctx context.Context, client *github.Client, repo config.RepoConfig) (string, string, error) {
+	pending, err := updater.Pending()
+	if err != nil {
+		return "", "", err
+	}
+	for _, p := range pending {
+		if p.Subsystem == repo.Subsystem && p.Target != "" {
+			return p.Target, p.Release, nil
+		}
+	}
+
+	latest, err := checker.LatestVersion(ctx, client, repo)
+	if err != nil {
+		return "", "", err
+	}
+	return latest.Commit, latest.Release, nil
+}
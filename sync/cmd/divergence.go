@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/forks"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// DivergenceInfo is a fork's comparison with upstream, as sync divergence reports it
+type DivergenceInfo struct {
+	checker.Divergence
+	Merge *forks.MergeResult `json:"merge,omitempty"` // --merge: the pull request merging upstream
+}
+
+// Divergence compares the subsystems built from our forks with their upstream
+// Usage: sync divergence [subsystem] [--merge] [--json]
+// The daemons do this every fork.interval; this command compares right away.
+// --merge also merges upstream into forks that are behind and opens pull
+// requests, as fork.merge has the daemons do.
+func Divergence(args []string) {
+	jsonOutput, merge := false, false
+	only := ""
+	for _, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			jsonOutput = true
+		case "--merge", "-merge":
+			merge = true
+		default:
+			only = arg
+		}
+	}
+
+	cfg := loadConfig()
+	var repos []config.RepoConfig
+	for _, repo := range cfg.Repos {
+		if repo.Fork.Enabled() && (only == "" || repo.Subsystem == only) {
+			repos = append(repos, repo)
+		}
+	}
+	if len(repos) == 0 {
+		if only != "" {
+			fmt.Fprintf(stdout, "❌ %s is not configured as a fork (repos[].fork.upstream)\n", only)
+		} else {
+			fmt.Fprintln(stdout, "❌ No repos are configured as forks (repos[].fork.upstream)")
+		}
+		os.Exit(1)
+	}
+
+	client, err := githubClient(cfg)
+	if err != nil {
+		fail("Failed to read the GitHub token", err)
+	}
+
+	list := make([]DivergenceInfo, 0, len(repos))
+	var failure error
+	for _, repo := range repos {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Checks.Timeout)
+		info, err := divergence(ctx, client, repo, merge)
+		cancel()
+		d := info.Divergence
+		if err != nil && failure == nil {
+			failure = err
+		}
+		compared := !d.Checked.IsZero()
+		if compared {
+			list = append(list, info)
+		}
+		if jsonOutput {
+			continue
+		}
+
+		switch {
+		case !compared:
+		case d.Behind == 0:
+			fmt.Fprintf(stdout, "✅ %s: %s is even with %s (%d commit(s) ahead)\n", d.Subsystem, d.Fork, d.Upstream, d.Ahead)
+		case d.Diverged(repo.Fork.Threshold):
+			fmt.Fprintf(stdout, "⚠️  %s: %s is %d commit(s) behind %s, %d ahead (threshold %d)\n", d.Subsystem, d.Fork, d.Behind, d.Upstream, d.Ahead, repo.Fork.Threshold)
+		default:
+			fmt.Fprintf(stdout, "🍴 %s: %s is %d commit(s) behind %s, %d ahead\n", d.Subsystem, d.Fork, d.Behind, d.Upstream, d.Ahead)
+		}
+		switch m := info.Merge; {
+		case m == nil:
+		case m.Conflict:
+			fmt.Fprintf(stdout, "   ⚠️  Upstream does not merge cleanly; conflicts reported in %s\n", m.URL)
+		case m.Opened:
+			fmt.Fprintf(stdout, "   🔀 Merged upstream %s on %s; opened %s\n", revision.Short(m.Commit), repo.Fork.MergeBranch, m.URL)
+		default:
+			fmt.Fprintf(stdout, "   🔀 Merged upstream %s on %s; updated %s\n", revision.Short(m.Commit), repo.Fork.MergeBranch, m.URL)
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ %s: %v\n", repo.Subsystem, err)
+			if kind := syncerr.KindOf(err); kind != syncerr.Unknown {
+				fmt.Fprintf(stdout, "   → %s\n", hint(kind))
+			}
+		}
+	}
+
+	if jsonOutput {
+		writeJSON(list)
+	}
+	if failure != nil {
+		os.Exit(syncerr.ExitCode(failure))
+	}
+}
+
+// divergence compares a fork with upstream and, if asked to and behind, merges
+// upstream in
+// A failed merge still returns the comparison.
+func divergence(ctx context.Context, client *github.Client, repo config.RepoConfig, merge bool) (DivergenceInfo, error) {
+	d, err := checker.ForkDivergence(ctx, client, repo)
+	if err != nil {
+		return DivergenceInfo{}, err
+	}
+	info := DivergenceInfo{Divergence: d}
+	if !merge || d.Behind == 0 {
+		return info, nil
+	}
+	result, err := forks.Merge(ctx, client, repo, d)
+	if err != nil {
+		return info, err
+	}
+	info.Merge = &result
+	return info, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// Errors lists the error kinds with their exit codes and remediation hints
+// Usage: sync errors [--json]
+func Errors(args []string) {
+	fs := flag.NewFlagSet("errors", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	if *jsonOutput {
+		writeJSON(syncerr.All())
+		return
+	}
+	for _, info := range syncerr.All() {
+		fmt.Fprintf(stdout, "%3d  %-20s %s\n", info.ExitCode, info.Kind, hint(info.Kind))
+	}
+}
+
+// fail prints err with the remediation hint of its kind and exits with the kind's code
+// msg, if set, prefixes the error (e.g. "Failed to load config").
+func fail(msg string, err error) {
+	if msg != "" {
+		fmt.Fprintf(stdout, "❌ %s: %v\n", msg, err)
+	} else {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+	}
+	if kind := syncerr.KindOf(err); kind != syncerr.Unknown {
+		fmt.Fprintf(stdout, "   → %s\n", hint(kind))
+	}
+	os.Exit(syncerr.ExitCode(err))
+}
+
+// hint returns the remediation hint of kind in the user's locale
+func hint(kind syncerr.Kind) string {
+	return i18n.Or("hint."+string(kind), syncerr.Hint(kind))
+}
+
+// loadConfig loads sync.yaml, exiting if it is invalid
+func loadConfig() *config.Config {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		fail(i18n.T("config.load_failed"), err)
+	}
+	if err := nethttp.Configure(cfg.Network); err != nil {
+		fail(i18n.T("config.load_failed"), err)
+	}
+	return cfg
+}
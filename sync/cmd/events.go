@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/api"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/client"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+)
+
+// defaultAPIURL is the status API of `sync watch` on its default port
+const defaultAPIURL = "http://localhost:8080"
+
+// Events prints the update events of a running daemon, from its status API
+// Usage: sync events [--follow] [--subsystem <name>] [--since <id>] [--url <url>] [--json] [--ca <file>] [--cert <file> --key <file>]
+// Without --follow it prints the events the daemon kept and exits; with it,
+// it keeps printing new ones and reconnects if the daemon restarts.
+func Events(args []string) {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "keep printing new events")
+	fs.BoolVar(follow, "f", false, "shorthand for --follow")
+	subsystem := fs.String("subsystem", "", "only events of this subsystem")
+	since := fs.Uint64("since", 0, "start after this event ID")
+	baseURL := fs.String("url", os.Getenv("SYNC_API_URL"), "status API of the daemon (default $SYNC_API_URL or "+defaultAPIURL+")")
+	jsonOutput := fs.Bool("json", false, "output one JSON event per line")
+	caFile := fs.String("ca", "", "CA to verify the daemon against (default: server.client.ca_file)")
+	certFile := fs.String("cert", "", "client certificate, for a daemon requiring one (default: server.client.cert_file)")
+	keyFile := fs.String("key", "", "key of --cert (default: server.client.key_file)")
+	fs.Parse(args)
+	if *baseURL == "" {
+		*baseURL = defaultAPIURL
+	}
+
+	cfg := loadConfig() // proxies and network.ca_bundle
+	if *caFile == "" {
+		*caFile = cfg.Server.Client.CAFile
+	}
+	if *certFile == "" {
+		*certFile, *keyFile = cfg.Server.Client.CertFile, cfg.Server.Client.KeyFile
+	}
+	c, err := client.New(*baseURL, "").WithClientCert(*caFile, *certFile, *keyFile)
+	if err != nil {
+		fail("", err)
+	}
+	opts := client.EventsOptions{Subsystem: *subsystem, Since: *since, Follow: *follow}
+	show := func(se api.StreamedEvent) {
+		if *jsonOutput {
+			data, _ := json.Marshal(se)
+			fmt.Fprintln(os.Stdout, string(data))
+			return
+		}
+		fmt.Fprintln(stdout, formatEvent(se))
+	}
+
+	backoff := time.Second
+	for {
+		last, err := c.Events(context.Background(), opts, show)
+		if !*follow {
+			if err != nil {
+				fail("", err)
+			}
+			return
+		}
+
+		// The daemon restarted or dropped us for falling behind: resume after
+		// the last event printed
+		if last > opts.Since {
+			opts.Since = last
+			backoff = time.Second
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "⚠️  %v (reconnecting in %s)\n", err, backoff)
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// formatEvent renders an event as one line of human-readable output
+func formatEvent(se api.StreamedEvent) string {
+	e := se.Event
+	line := fmt.Sprintf("%s #%d %-12s %-18s", clock(e.Time), se.ID, e.Subsystem, e.Type)
+	var details []string
+	switch e.Type {
+	case events.UpdateProgress:
+		step := fmt.Sprintf("[%d/%d] %s", e.Step, e.Steps, e.Phase)
+		if e.Percent > 0 {
+			step += fmt.Sprintf(" %d%%", e.Percent)
+		}
+		details = append(details, step)
+	case events.ForkDiverged:
+		details = append(details, fmt.Sprintf("%d behind, %d ahead of %s", e.Behind, e.Ahead, e.Upstream))
+	default:
+		if e.From != "" || e.To != "" {
+			details = append(details, orUnknown(e.From)+" → "+revision.Short(e.To))
+		}
+	}
+	if e.Trigger != "" {
+		details = append(details, e.Trigger)
+	}
+	if e.Duration > 0 {
+		details = append(details, e.Duration.Round(time.Second).String())
+	}
+	if e.Error != "" {
+		details = append(details, e.Error)
+	}
+	return strings.TrimRight(line+" "+strings.Join(details, ", "), " ")
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+)
+
+// Freeze blocks automatic updates fleet-wide until thawed or until the given time
+// Usage: sync freeze --reason <text> [--until <time|duration>]
+func Freeze(args []string) {
+	fs := flag.NewFlagSet("freeze", flag.ExitOnError)
+	reason := fs.String("reason", "", "why updates are frozen, e.g. the incident ID (required)")
+	until := fs.String("until", "", "end of the freeze: YYYY-MM-DD, YYYY-MM-DDTHH:MM, RFC3339, or a duration such as 4h (default: until thawed)")
+	fs.Parse(args)
+
+	end, err := parseUntil(*until)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	cfg := loadConfig()
+
+	f, err := freeze.Set(*reason, end, audit.Actor())
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "⏸  %s\n", i18n.T("freeze.frozen", freezeText(f)))
+	fmt.Fprintln(stdout, i18n.T("freeze.note"))
+	announceLatestFreeze(cfg)
+}
+
+// Thaw lifts an update freeze fleet-wide
+// Usage: sync thaw
+func Thaw(args []string) {
+	fs := flag.NewFlagSet("thaw", flag.ExitOnError)
+	fs.Parse(args)
+
+	cfg := loadConfig()
+
+	f, lifted, err := freeze.Thaw(audit.Actor())
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	if !lifted {
+		fmt.Fprintln(stdout, i18n.T("freeze.not_frozen"))
+		return
+	}
+	fmt.Fprintf(stdout, "▶ %s\n", i18n.T("freeze.thawed", f.Reason))
+	announceLatestFreeze(cfg)
+}
+
+// Audit lists recorded operator actions, newest first
+// Usage: sync audit [--limit N] [--json]
+func Audit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "maximum number of entries to list (0 for all)")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	entries, err := audit.Load()
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ Failed to load audit log: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[:*limit]
+	}
+
+	if *jsonOutput {
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+		writeJSON(entries)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(stdout, i18n.T("audit.empty"))
+		return
+	}
+	for _, e := range entries {
+		fmt.Fprintf(stdout, "%s  %-7s %-24s %s\n", e.Time.Local().Format(time.RFC3339), e.Action, e.Actor, e.Detail)
+	}
+}
+
+// announceLatestFreeze sends this host's latest freeze or thaw to the fleet
+func announceLatestFreeze(cfg *config.Config) {
+	c, _, err := freeze.Latest()
+	if err != nil {
+		fmt.Fprintf(stdout, "⚠️  %v\n", err)
+		return
+	}
+	announce(cfg, cfg.NATS.Subjects.Freeze, c)
+}
+
+// printFreeze prints a banner when updates are frozen
+func printFreeze() {
+	if f, active, _ := freeze.Current(); active {
+		fmt.Fprintf(stdout, "⏸  %s\n\n", i18n.T("freeze.frozen", freezeText(f)))
+	}
+}
+
+// freezeText describes a freeze in the user's locale, like freeze.Freeze.String
+func freezeText(f freeze.Freeze) string {
+	until := i18n.T("freeze.until_thawed")
+	if !f.Until.IsZero() {
+		until = i18n.T("freeze.until", f.Until.Local().Format(time.DateTime))
+	}
+	return i18n.T("freeze.detail", f.Reason, until, f.By)
+}
+
+// logFreeze logs a freeze in effect when a daemon starts
+func logFreeze() {
+	if f, active, _ := freeze.Current(); active {
+		logger.Info("Updates frozen", "freeze", f)
+	}
+}
+
+// parseUntil parses --until as a duration from now or a point in time
+func parseUntil(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+	return parseTime(s)
+}
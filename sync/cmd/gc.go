@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/artifacts"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// GC removes old installed versions according to the gc policy in sync.yaml
+// Usage: sync gc [--dry-run] [--json]
+func GC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be removed without deleting anything")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	cfg := loadConfig()
+
+	removed, err := runGC(cfg, *dryRun)
+	if *jsonOutput {
+		if removed == nil {
+			removed = []versions.Removed{}
+		}
+		writeJSON(removed)
+	} else {
+		verb, reclaimed := "Removed", "reclaimed"
+		if *dryRun {
+			verb, reclaimed = "Would remove", "would be reclaimed"
+		}
+		var total int64
+		for _, r := range removed {
+			total += r.Bytes
+			fmt.Fprintf(stdout, "🗑  %s %s %s (%s)\n", verb, r.Subsystem, revision.Short(r.Version), versions.FormatBytes(r.Bytes))
+		}
+		if len(removed) == 0 {
+			fmt.Fprintln(stdout, "✅ Nothing to collect")
+		} else {
+			fmt.Fprintf(stdout, "✅ %s %d versions, %s %s\n", verb, len(removed), versions.FormatBytes(total), reclaimed)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "❌ GC failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// startGC runs version GC on gc.interval in the background
+func startGC(cfg *config.Config) {
+	if cfg.GC.Interval < 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.GC.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			removed, err := runGC(cfg, false)
+			if err != nil {
+				logger.Warn("Version GC failed", "err", err)
+			}
+			if len(removed) > 0 {
+				var total int64
+				for _, r := range removed {
+					total += r.Bytes
+				}
+				logger.Info("Version GC removed versions", "removed", len(removed), "reclaimed", versions.FormatBytes(total))
+			}
+
+			// Blobs of the removed versions are freed once nothing else links them
+			blobs, err := artifacts.GC(false)
+			if err != nil {
+				logger.Warn("Artifact GC failed", "err", err)
+			}
+			if len(blobs) > 0 {
+				var total int64
+				for _, a := range blobs {
+					total += a.Size
+				}
+				logger.Info("Artifact GC removed artifacts", "removed", len(blobs), "reclaimed", versions.FormatBytes(total))
+			}
+		}
+	}()
+}
+
+// runGC applies the configured policy to every subsystem with versioned installs
+func runGC(cfg *config.Config, dryRun bool) ([]versions.Removed, error) {
+	policy, err := versions.PolicyFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	subsystems, err := versions.Subsystems()
+	if err != nil {
+		return nil, err
+	}
+	return versions.GC(subsystems, policy, dryRun)
+}
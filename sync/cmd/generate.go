@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/gitops"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/installer"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Generate writes files generated from this host's setup
+// Usage: sync generate installer [flags]
+func Generate(args []string) {
+	if len(args) < 1 || args[0] != "installer" {
+		fmt.Fprintln(stdout, "Usage: sync generate installer [flags]")
+		fmt.Fprintln(stdout, "  installer   signed bootstrap script provisioning a new host with this host's pinned builds")
+		os.Exit(1)
+	}
+	generateInstaller(args[1:])
+}
+
+func generateInstaller(args []string) {
+	fs := flag.NewFlagSet("generate installer", flag.ExitOnError)
+	output := fs.String("o", "install.sh", "script to write; its signature and public key go next to it as .sig and .pub")
+	lockfile := fs.String("lockfile", "", "subsystem -> version YAML to pin (default: the first of gc.lockfiles, else the active versions)")
+	repo := fs.String("repo", "", "project repository new hosts check out (default: this checkout's origin)")
+	ref := fs.String("ref", "", "project commit they check out (default: this checkout's HEAD)")
+	name := fs.String("name", "", "identity.name of the new host (default: its hostname)")
+	labels := fs.String("labels", "", "identity.labels of the new host, e.g. site=ams,role=edge")
+	natsURL := fs.String("nats", "", "nats.url the host registers over (default: sync.yaml's)")
+	system := fs.Bool("system", false, "install the service system-wide")
+	user := fs.String("user", "", "with --system: the account the service runs as")
+	noConfig := fs.Bool("no-config", false, "keep the checked out sync.yaml instead of writing this host's")
+	keyFile := fs.String("key", "", "ed25519 private key (PKCS#8 PEM) to sign with (default: this host's identity key)")
+	fs.Parse(args)
+
+	cfg := loadConfig()
+	root, err := config.ProjectRoot()
+	if err != nil {
+		fail("", err)
+	}
+	if *repo == "" {
+		if *repo, err = gitops.OriginURL(root); err != nil {
+			fail("no --repo given", err)
+		}
+	}
+	if *ref == "" {
+		if *ref, err = gitops.GetCommitHash(root); err != nil {
+			fail("no --ref given", err)
+		}
+	}
+
+	lock, source, err := installerLock(cfg, root, *lockfile)
+	if err != nil {
+		fail("", err)
+	}
+	pins, err := installer.Pins(lock)
+	if err != nil {
+		fail("", err)
+	}
+
+	o := installer.Options{Repo: *repo, Ref: *ref, Pins: pins, System: *system, User: *user}
+	host, _ := os.Hostname()
+	o.Generated = fmt.Sprintf("on %s at %s", host, time.Now().UTC().Format(time.RFC3339))
+	if !*noConfig {
+		path, err := config.Path()
+		if err != nil {
+			fail("", err)
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fail("", err)
+		}
+		labelMap, err := parseLabels(*labels)
+		if err != nil {
+			fail("", err)
+		}
+		if o.Config, err = installer.HostConfig(src, *name, labelMap, *natsURL); err != nil {
+			fail("", err)
+		}
+		o.Register = *natsURL != "" || cfg.NATS.URL != ""
+	}
+
+	script, err := installer.Generate(o)
+	if err != nil {
+		fail("", err)
+	}
+	sign, pubPEM, signer, err := installerSigner(*keyFile)
+	if err != nil {
+		fail("", err)
+	}
+	for _, f := range []struct {
+		path string
+		data []byte
+		mode os.FileMode
+	}{
+		{*output, script, 0755},
+		{*output + ".sig", sign(script), 0644},
+		{*output + ".pub", pubPEM, 0644},
+	} {
+		if err := os.WriteFile(f.path, f.data, f.mode); err != nil {
+			fail("", err)
+		}
+	}
+
+	fmt.Fprintf(stdout, "✅ Wrote %s, signed by %s (%s.sig, %s.pub)\n", *output, signer, *output, *output)
+	fmt.Fprintf(stdout, "   Project %s at %s; builds pinned from %s:\n", *repo, revision.Short(*ref), source)
+	for _, p := range pins {
+		fmt.Fprintf(stdout, "   %-12s %s (%d file(s))\n", p.Subsystem, revision.Short(p.Version), len(p.Files))
+	}
+	if o.Config == nil {
+		fmt.Fprintln(stdout, "   The host keeps the checked out sync.yaml and doesn't wait for registration")
+	}
+	fmt.Fprintf(stdout, "\nOn the new host, verify then run it:\n")
+	fmt.Fprintf(stdout, "  openssl pkeyutl -verify -pubin -inkey %s.pub -rawin -in %s -sigfile %s.sig && sh %s\n",
+		filepath.Base(*output), filepath.Base(*output), filepath.Base(*output), filepath.Base(*output))
+}
+
+// installerLock returns the versions an installer pins and where they come
+// from: the lockfile given, else the first of gc.lockfiles, else the versions
+// active on this host
+func installerLock(cfg *config.Config, root, path string) (map[string]string, string, error) {
+	if path == "" && len(cfg.GC.Lockfiles) > 0 {
+		path = cfg.GC.Lockfiles[0]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+	}
+	if path != "" {
+		lock, err := installer.ReadLockfile(path)
+		return lock, path, err
+	}
+
+	lock := make(map[string]string)
+	for _, r := range cfg.Repos {
+		if active, err := versions.Active(r.Subsystem); err == nil && active != "" {
+			lock[r.Subsystem] = active
+		}
+	}
+	if len(lock) == 0 {
+		return nil, "", errors.New("nothing to pin: no lockfile and no versioned installs on this host (give --lockfile)")
+	}
+	return lock, "the active versions", nil
+}
+
+// installerSigner returns how to sign an installer, the public key to verify
+// it with, as PEM, and who signs
+func installerSigner(keyFile string) (func([]byte) []byte, []byte, string, error) {
+	if keyFile == "" {
+		id := identity.Current()
+		if id == nil {
+			return nil, nil, "", errors.New("this host has no identity to sign with yet (run sync identity, or give --key)")
+		}
+		pub, err := id.PublicKeyPEM()
+		return id.Sign, pub, "host " + id.ID, err
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, "", fmt.Errorf("%s: no PEM data", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%s: %w", keyFile, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, nil, "", fmt.Errorf("%s: not an ed25519 key", keyFile)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, "", err
+	}
+	sign := func(data []byte) []byte { return ed25519.Sign(key, data) }
+	return sign, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), keyFile, nil
+}
+
+// parseLabels parses key=value,key=value
+func parseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %q (want key=value)", kv)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
@@ -1,17 +1,32 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
-
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"syscall"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/diskspace"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/gitops"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/plain"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
 )
 
-// Clone clones a git repository (thin wrapper calling gitops logic)
+// Clone clones a git repository (thin wrapper around gitops)
+// Private remotes authenticate per git.credentials in sync.yaml. Transfer
+// progress goes to stderr unless --quiet; git.timeout bounds the clone.
 func Clone(args []string) {
+	args, opts := gitOptions(args)
 	if len(args) < 2 {
-		fmt.Println("Usage: sync clone <url> <path> [version]")
+		fmt.Fprintln(stdout, "Usage: sync clone <url> <path> [version] [--recurse-submodules] [--quiet]")
 		os.Exit(1)
 	}
 
@@ -22,89 +37,174 @@ func Clone(args []string) {
 		version = args[2]
 	}
 
-	fmt.Printf("▶ Cloning %s to %s", url, path)
+	fmt.Fprintf(stdout, "▶ Cloning %s to %s", url, path)
 	if version != "" {
-		fmt.Printf(" @ %s", version)
+		fmt.Fprintf(stdout, " @ %s", version)
 	}
-	fmt.Println()
+	fmt.Fprintln(stdout)
 
-	err := cloneRepo(url, path, version)
+	cfg, ctx, cancel := configureGit()
+	defer cancel()
+	if err := cloneSpace(ctx, cfg, url, path); err != nil {
+		fail("Clone refused", err)
+	}
+	err := gitops.Clone(ctx, url, path, version, opts)
 	if err != nil {
-		fmt.Printf("❌ Clone failed: %v\n", err)
-		os.Exit(1)
+		fail("Clone failed", err)
 	}
 
-	fmt.Println("✅ Clone completed")
+	fmt.Fprintln(stdout, "✅ Clone completed")
 }
 
-// Pull updates a git repository (thin wrapper calling gitops logic)
+// Pull updates a git repository (thin wrapper around gitops)
 func Pull(args []string) {
+	args, opts := gitOptions(args)
 	if len(args) < 1 {
-		fmt.Println("Usage: sync pull <path>")
+		fmt.Fprintln(stdout, "Usage: sync pull <path> [--recurse-submodules] [--quiet]")
 		os.Exit(1)
 	}
 
 	path := args[0]
 
-	fmt.Printf("▶ Pulling updates for %s\n", path)
+	fmt.Fprintf(stdout, "▶ Pulling updates for %s\n", path)
 
-	hash, err := pullRepo(path)
+	_, ctx, cancel := configureGit()
+	defer cancel()
+	hash, err := gitops.Pull(ctx, path, opts)
 	if err != nil {
-		fmt.Printf("❌ Pull failed: %v\n", err)
-		os.Exit(1)
+		fail("Pull failed", err)
 	}
 
-	fmt.Printf("✅ Updated to commit %s\n", hash)
+	fmt.Fprintf(stdout, "✅ Updated to commit %s\n", revision.Short(hash))
 }
 
-// cloneRepo contains the git clone logic
-func cloneRepo(url, path, version string) error {
-	opts := &git.CloneOptions{
-		URL:   url,
-		Depth: 1,
+// Checkout fetches and checks out a branch, tag or commit in an existing
+// clone, as when a subsystem's pinned version changes (thin wrapper around gitops)
+func Checkout(args []string) {
+	args, opts := gitOptions(args)
+	if len(args) < 2 {
+		fmt.Fprintln(stdout, "Usage: sync checkout <path> <ref> [--recurse-submodules] [--quiet]")
+		os.Exit(1)
 	}
 
-	if version != "" {
-		opts.ReferenceName = plumbing.ReferenceName(version)
-	}
+	path, ref := args[0], args[1]
+
+	fmt.Fprintf(stdout, "▶ Checking out %s in %s\n", ref, path)
 
-	_, err := git.PlainClone(path, false, opts)
+	_, ctx, cancel := configureGit()
+	defer cancel()
+	hash, err := gitops.Checkout(ctx, path, ref, opts)
 	if err != nil {
-		return fmt.Errorf("failed to clone %s: %w", url, err)
+		fail("Checkout failed", err)
 	}
 
-	return nil
+	fmt.Fprintf(stdout, "✅ Checked out %s (commit %s)\n", ref, revision.Short(hash))
 }
 
-// pullRepo contains the git pull logic and returns the new commit hash
-func pullRepo(path string) (string, error) {
-	repo, err := git.PlainOpen(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to open repo: %w", err)
+// gitOptions takes the clone, pull and checkout flags out of args, wherever they are
+func gitOptions(args []string) ([]string, gitops.Options) {
+	opts := gitops.Options{Progress: gitProgress()}
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "--recurse-submodules", "-recurse-submodules":
+			opts.RecurseSubmodules = true
+		case "--quiet", "-quiet", "-q":
+			opts.Progress = nil
+		default:
+			rest = append(rest, arg)
+		}
 	}
+	return rest, opts
+}
 
-	worktree, err := repo.Worktree()
-	if err != nil {
-		return "", fmt.Errorf("failed to get worktree: %w", err)
+// configureGit loads the git credentials of sync.yaml, exiting if it is
+// invalid, and returns it with the context of one git operation: cancelled
+// after git.timeout or on SIGINT/SIGTERM, so a stuck transfer fails rather
+// than blocking whoever ran it
+func configureGit() (*config.Config, context.Context, context.CancelFunc) {
+	cfg := loadConfig()
+	if err := gitops.Configure(cfg); err != nil {
+		fail("Failed to load git credentials", err)
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithTimeout(ctx, cfg.Git.Timeout)
+	return cfg, ctx, func() {
+		cancel()
+		stop()
+	}
+}
 
-	err = worktree.Pull(&git.PullOptions{
-		RemoteName: "origin",
-	})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return "", fmt.Errorf("failed to pull: %w", err)
+// cloneSpace checks there is room for a clone of url at path: the size
+// GitHub reports for github.com repos (0 for other remotes), plus
+// disk.reserve_bytes
+func cloneSpace(ctx context.Context, cfg *config.Config, url, path string) error {
+	if cfg.Disk.Disabled {
+		return nil
+	}
+	var need int64
+	if repo := githubRepo(url); repo != "" {
+		if client, err := githubClient(cfg); err == nil {
+			if need, err = checker.RepoSize(ctx, client, repo); err != nil {
+				fmt.Fprintf(stdout, "⚠️  Could not look up the size of %s: %v\n", repo, err)
+			}
+		}
 	}
+	_, err := diskspace.Check(path, "the clone of "+url, need, cfg.Disk.ReserveBytes)
+	if err != nil && syncerr.KindOf(err) != syncerr.DiskFull {
+		fmt.Fprintf(stdout, "⚠️  Could not check free disk space: %v\n", err)
+		return nil
+	}
+	return err
+}
 
-	// Get and return new commit hash
-	head, err := repo.Head()
-	if err != nil {
-		return "", fmt.Errorf("failed to get HEAD: %w", err)
+// gitProgress returns where the remote's progress messages go: stderr as
+// they come on a terminal, where they redraw in place; otherwise, and with
+// --plain, one line per stage as it passes each 10% so logs stay readable
+func gitProgress() io.Writer {
+	if isTerminal(os.Stderr) && !plain.Enabled() {
+		return os.Stderr
 	}
+	return &progressLines{w: os.Stderr, decile: -1}
+}
+
+// stagePattern splits a progress message into its stage and percentage,
+// e.g. "Receiving objects:  40% (120/300)"
+var stagePattern = regexp.MustCompile(`^(.*?):\s+(\d{1,3})%`)
+
+// progressLines writes the lines of redrawn progress messages that start a
+// stage, pass a 10% mark or finish it
+type progressLines struct {
+	w      io.Writer
+	line   []byte
+	stage  string
+	decile int
+}
 
-	hash := head.Hash().String()
-	if len(hash) > 7 {
-		hash = hash[:7]
+func (p *progressLines) Write(b []byte) (int, error) {
+	for _, c := range b {
+		if c != '\n' && c != '\r' {
+			p.line = append(p.line, c)
+			continue
+		}
+		p.flush()
 	}
+	return len(b), nil
+}
 
-	return hash, nil
+func (p *progressLines) flush() {
+	line := string(bytes.TrimSpace(p.line))
+	p.line = p.line[:0]
+	if line == "" {
+		return
+	}
+	if m := stagePattern.FindStringSubmatch(line); m != nil {
+		percent, _ := strconv.Atoi(m[2])
+		decile := percent / 10
+		if m[1] == p.stage && decile == p.decile {
+			return
+		}
+		p.stage, p.decile = m[1], decile
+	}
+	fmt.Fprintln(p.w, line)
 }
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+)
+
+// Installed is the version of a subsystem installed at a point in time
+type Installed struct {
+	Subsystem   string    `json:"subsystem"`
+	Version     string    `json:"version,omitempty"`
+	InstalledAt time.Time `json:"installedAt,omitzero"`
+	Trigger     string    `json:"trigger,omitempty"`
+	Current     bool      `json:"current"` // still the installed version
+}
+
+// History lists past updates, or with --at reconstructs which versions were installed at a point in time
+// Usage: sync history [subsystem] [--limit N] [--at <time>] [--json]
+func History(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	at := fs.String("at", "", "point in time: YYYY-MM-DD (end of day), YYYY-MM-DDTHH:MM, or RFC3339")
+	limit := fs.Int("limit", 20, "maximum number of updates to list (0 for all)")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	entries, err := history.Load()
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ Failed to load history: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *at == "" {
+		listHistory(entries, subsystem, *limit, *jsonOutput)
+		return
+	}
+
+	t, err := parseTime(*at)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	historyAt(entries, subsystem, t, *jsonOutput)
+}
+
+// listHistory prints recorded update attempts, newest first
+func listHistory(entries []history.Entry, subsystem string, limit int, jsonOutput bool) {
+	list := make([]history.Entry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if subsystem != "" && entries[i].Subsystem != subsystem {
+			continue
+		}
+		list = append(list, entries[i])
+		if limit > 0 && len(list) == limit {
+			break
+		}
+	}
+
+	if jsonOutput {
+		writeJSON(list)
+		return
+	}
+	printFreeze()
+
+	if len(list) == 0 {
+		fmt.Fprintln(stdout, i18n.T("history.empty"))
+		return
+	}
+
+	for _, e := range list {
+		icon := "✅"
+		if !e.Success {
+			icon = "❌"
+		}
+		fmt.Fprintf(stdout, "%s %s  %-12s %s → %s  (%s, %s)\n",
+			icon, e.Time.Local().Format(time.RFC3339), e.Subsystem, orUnknown(e.From), orUnknown(e.To), e.Trigger, e.Duration.Round(time.Second))
+		if e.Error != "" {
+			// Errors can carry build output; the first line is enough here
+			msg, _, _ := strings.Cut(e.Error, "\n")
+			fmt.Fprintf(stdout, "   %s\n", msg)
+		}
+	}
+}
+
+// historyAt prints the version of each subsystem installed at t
+func historyAt(entries []history.Entry, only string, t time.Time, jsonOutput bool) {
+	installed := history.At(entries, t)
+
+	subsystems := historySubsystems(entries)
+	if only != "" {
+		subsystems = []string{only}
+	}
+
+	results := make([]Installed, 0, len(subsystems))
+	for _, subsystem := range subsystems {
+		result := Installed{Subsystem: subsystem}
+
+		// The current install predates t, so nothing has replaced it since
+		if installedAt, err := checker.GetInstalledAt(subsystem); err == nil && !installedAt.After(t) {
+			result.Version, _ = checker.GetCurrentVersion(subsystem)
+			result.InstalledAt = installedAt
+			result.Current = true
+		} else if e, ok := installed[subsystem]; ok {
+			result.Version = e.To
+			result.InstalledAt = e.Time
+			result.Trigger = e.Trigger
+		}
+		results = append(results, result)
+	}
+
+	if jsonOutput {
+		writeJSON(results)
+		return
+	}
+
+	fmt.Fprintln(stdout, i18n.T("history.state_at", t.Format(time.RFC3339)))
+	for _, r := range results {
+		switch {
+		case r.Current:
+			fmt.Fprintf(stdout, "✅ %s\n", i18n.T("history.installed_current", r.Subsystem, revision.Short(r.Version), r.InstalledAt.Format(time.RFC3339)))
+		case r.Version != "":
+			fmt.Fprintf(stdout, "✅ %s\n", i18n.T("history.installed_via", r.Subsystem, revision.Short(r.Version), r.InstalledAt.Format(time.RFC3339), r.Trigger))
+		default:
+			fmt.Fprintf(stdout, "❓ %s\n", i18n.T("history.unknown", r.Subsystem))
+		}
+	}
+}
+
+// orUnknown returns version shortened for display, or "?" if it is empty
+func orUnknown(version string) string {
+	if version == "" {
+		return "?"
+	}
+	return revision.Short(version)
+}
+
+// writeJSON prints v as indented JSON on stdout
+func writeJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(stderr, "❌ Failed to encode JSON: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// historySubsystems returns every configured or recorded subsystem, sorted
+func historySubsystems(entries []history.Entry) []string {
+	seen := make(map[string]bool)
+	if cfg, err := config.LoadDefault(); err == nil {
+		for _, repo := range cfg.Repos {
+			seen[repo.Subsystem] = true
+		}
+	}
+	for _, e := range entries {
+		seen[e.Subsystem] = true
+	}
+
+	subsystems := make([]string, 0, len(seen))
+	for subsystem := range seen {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+// parseTime parses a user-supplied point in time
+// A bare date means the end of that day in local time
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want YYYY-MM-DD, YYYY-MM-DDTHH:MM, or RFC3339)", s)
+}
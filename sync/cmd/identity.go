@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+)
+
+// ensureIdentity loads this host's identity when a daemon starts, generating
+// it on first boot
+func ensureIdentity(cfg *config.Config) {
+	id, err := identity.Ensure(cfg.Identity)
+	if err != nil {
+		logger.Warn("No host identity; records won't be attributed to this host", "err", err)
+		return
+	}
+	logger.Info("Host identity", "id", id.ID, "name", id.Name)
+}
+
+// Identity shows this host's identity, creating it if it has none yet
+// Usage: sync identity [--json]
+func Identity(args []string) {
+	fs := flag.NewFlagSet("identity", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	id, err := identity.Ensure(loadConfig().Identity)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		writeJSON(id)
+		return
+	}
+	fmt.Fprintf(stdout, "ID:         %s\n", id.ID)
+	fmt.Fprintf(stdout, "Name:       %s\n", id.Name)
+	if len(id.Labels) > 0 {
+		fmt.Fprintf(stdout, "Labels:     %s\n", formatLabels(id.Labels))
+	}
+	fmt.Fprintf(stdout, "Created:    %s\n", id.CreatedAt.Local().Format(time.RFC3339))
+	if id.RegisteredAt.IsZero() {
+		fmt.Fprintln(stdout, "Registered: not yet (a daemon registers on its next NATS connect)")
+	} else {
+		fmt.Fprintf(stdout, "Registered: %s\n", id.RegisteredAt.Local().Format(time.RFC3339))
+	}
+}
+
+// Hosts lists the hosts registered with this controller
+// Usage: sync hosts [--json]
+func Hosts(args []string) {
+	fs := flag.NewFlagSet("hosts", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	hosts, err := identity.Hosts()
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		if hosts == nil {
+			hosts = []identity.Host{}
+		}
+		writeJSON(hosts)
+		return
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintln(stdout, "No hosts registered (the controller needs nats.registry: true)")
+		return
+	}
+	for _, h := range hosts {
+		fmt.Fprintf(stdout, "%-20s %-18s last registered %s  %s\n",
+			h.Name, h.ID, h.LastSeen.Local().Format(time.RFC3339), formatLabels(h.Labels))
+	}
+}
+
+// formatLabels returns e.g. "role=edge site=ams"
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
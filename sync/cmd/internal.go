@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// internalProtocol is the version of the `sync internal` request/response format
+// Bump it only for incompatible changes; new ops and fields are additive.
+const internalProtocol = 1
+
+// internalRequest is the JSON input of an internal op; each op reads the fields it needs
+type internalRequest struct {
+	Subsystem string `json:"subsystem,omitempty"`
+	Version   string `json:"version,omitempty"` // verify: installed version (default: the active one)
+}
+
+// internalResponse is the JSON output of every internal op
+type internalResponse struct {
+	Protocol int            `json:"protocol"`
+	Op       string         `json:"op"`
+	OK       bool           `json:"ok"`
+	Result   any            `json:"result,omitempty"` // may be set on failure too
+	Error    *internalError `json:"error,omitempty"`
+}
+
+// internalError describes a failed op with its kind, as listed by sync errors
+type internalError struct {
+	Message  string `json:"message"`
+	Kind     string `json:"kind"`
+	ExitCode int    `json:"exitCode"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// internalOp runs one op; needsSubsystem ops fail before running without one
+// An op may return a result along with its error, e.g. the failing check.
+type internalOp struct {
+	describe       string
+	needsSubsystem bool
+	run            func(req internalRequest) (any, error)
+}
+
+// internalOps holds the ops by name (filled in by init: ops itself lists them)
+var internalOps map[string]internalOp
+
+func init() {
+	internalOps = map[string]internalOp{
+		"ops":     {"list the available ops", false, opList},
+		"check":   {"check a subsystem against its upstream, as sync check does", true, opCheck},
+		"current": {"read the installed .version of a subsystem", true, opCurrent},
+		"pinned":  {"read the version pinned in a subsystem's Taskfile", true, opPinned},
+		"install": {"install a fresh build from .bin as a new version and activate it", true, opInstall},
+		"verify":  {"re-hash an installed version against its recorded SHA256", true, opVerify},
+		"frozen":  {"report whether updates are frozen", false, opFrozen},
+	}
+}
+
+// Internal runs one op of the stable interface for Taskfiles
+// Usage: sync internal <op> [request-json|-]
+// The request is the JSON argument, or stdin for "-"; the response is
+// always a single JSON object on stdout, and the exit code is the error kind's.
+func Internal(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(stdout, "Usage: sync internal <op> [request-json|-]")
+		fmt.Fprintln(stdout, "  Run `sync internal ops` to list the ops")
+		os.Exit(1)
+	}
+	name := args[0]
+	resp := internalResponse{Protocol: internalProtocol, Op: name}
+
+	result, err := runInternal(name, args[1:])
+	if err != nil {
+		kind := syncerr.KindOf(err)
+		resp.Error = &internalError{Message: err.Error(), Kind: string(kind), ExitCode: syncerr.ExitCode(err)}
+		if kind != syncerr.Unknown {
+			resp.Error.Hint = syncerr.Hint(kind)
+		}
+	}
+	resp.OK, resp.Result = err == nil, result
+
+	if err := json.NewEncoder(os.Stdout).Encode(resp); err != nil {
+		fmt.Fprintf(stderr, "❌ Failed to encode JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		os.Exit(syncerr.ExitCode(err))
+	}
+}
+
+// runInternal parses the request of op name and runs it
+func runInternal(name string, args []string) (any, error) {
+	op, ok := internalOps[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown op %q (see sync internal ops)", name)
+	}
+
+	req, err := readInternalRequest(args)
+	if err != nil {
+		return nil, err
+	}
+	if op.needsSubsystem && req.Subsystem == "" {
+		return nil, fmt.Errorf("op %s needs a subsystem", name)
+	}
+	return op.run(req)
+}
+
+// readInternalRequest decodes the request from the argument, or stdin for "-"
+// Stdin is only read when asked for: tasks inherit it, and it may never close.
+// Unknown fields are rejected so typos in a Taskfile don't go unnoticed.
+func readInternalRequest(args []string) (internalRequest, error) {
+	var req internalRequest
+	var input []byte
+	switch {
+	case len(args) > 1:
+		return req, fmt.Errorf("expected one request argument, got %d", len(args))
+	case len(args) == 1 && args[0] == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return req, fmt.Errorf("failed to read request: %w", err)
+		}
+		input = data
+	case len(args) == 1:
+		input = []byte(args[0])
+	}
+	if len(bytes.TrimSpace(input)) == 0 {
+		return req, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid request: %w", err)
+	}
+	return req, nil
+}
+
+// internalRepo returns the repo of subsystem from sync.yaml
+func internalRepo(subsystem string) (*config.Config, config.RepoConfig, error) {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil, config.RepoConfig{}, err
+	}
+	for _, repo := range cfg.Repos {
+		if repo.Subsystem == subsystem {
+			return cfg, repo, nil
+		}
+	}
+	return nil, config.RepoConfig{}, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("subsystem %s is not in the repos of sync.yaml", subsystem))
+}
+
+func opList(internalRequest) (any, error) {
+	type op struct {
+		Op             string `json:"op"`
+		Description    string `json:"description"`
+		NeedsSubsystem bool   `json:"needsSubsystem"`
+	}
+	list := make([]op, 0, len(internalOps))
+	for name, o := range internalOps {
+		list = append(list, op{name, o.describe, o.needsSubsystem})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Op < list[j].Op })
+	return list, nil
+}
+
+func opCheck(req internalRequest) (any, error) {
+	cfg, repo, err := internalRepo(req.Subsystem)
+	if err != nil {
+		return nil, err
+	}
+	client, err := githubClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := checkRepo(cfg, client, repo)
+	return result, err
+}
+
+func opCurrent(req internalRequest) (any, error) {
+	bin, err := versions.BinDir(req.Subsystem)
+	if err != nil {
+		return nil, err
+	}
+	info, err := checker.ReadVersionFile(filepath.Join(bin, ".version"))
+	if os.IsNotExist(err) {
+		return nil, syncerr.Wrap(syncerr.NotFound, fmt.Errorf("%s is not installed (no .bin/.version)", req.Subsystem))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Subsystem string            `json:"subsystem"`
+		Commit    string            `json:"commit"`
+		Timestamp time.Time         `json:"timestamp,omitzero"`
+		Checksum  string            `json:"checksum,omitempty"`
+		Files     map[string]string `json:"files,omitempty"`
+	}{req.Subsystem, info.Commit, info.Timestamp, info.Checksum, info.Files}, nil
+}
+
+func opPinned(req internalRequest) (any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	pin, err := checker.PinnedVersion(ctx, req.Subsystem)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"subsystem": req.Subsystem, "pin": pin}, nil
+}
+
+func opInstall(req internalRequest) (any, error) {
+	version, err := versions.Install(req.Subsystem)
+	if err != nil {
+		return nil, err
+	}
+	// installed is false when .bin holds no new build
+	return map[string]any{"subsystem": req.Subsystem, "version": version, "installed": version != ""}, nil
+}
+
+func opVerify(req internalRequest) (any, error) {
+	version := req.Version
+	if version == "" {
+		active, err := versions.Active(req.Subsystem)
+		if err != nil {
+			return nil, err
+		}
+		if active == "" {
+			return nil, syncerr.Wrap(syncerr.NotFound, fmt.Errorf("%s has no active version under .bin/versions/", req.Subsystem))
+		}
+		version = active
+	}
+	v, err := versions.Verify(req.Subsystem, version)
+	if err != nil {
+		return nil, err
+	}
+	if !v.OK() {
+		return v, syncerr.Wrap(syncerr.ChecksumMismatch, fmt.Errorf("%s %s: %d file(s) do not match their recorded SHA256", req.Subsystem, version, len(v.Problems)))
+	}
+	return v, nil
+}
+
+func opFrozen(internalRequest) (any, error) {
+	f, active, err := freeze.Current()
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return map[string]bool{"frozen": false}, nil
+	}
+	return struct {
+		Frozen bool `json:"frozen"`
+		freeze.Freeze
+	}{true, f}, nil
+}
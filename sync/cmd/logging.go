@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+)
+
+// logger logs what the daemons start, stop and fail to set up
+var logger = logging.For("sync")
+
+// fatal logs msg as an error and exits, for daemons that cannot start
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// logStart logs a daemon starting, with the build and its capabilities
+func logStart(daemon, msg string) {
+	r := capabilities.Get()
+	supports := make([]any, 0, len(capabilities.Kinds()))
+	for _, kind := range capabilities.Kinds() {
+		supports = append(supports, slog.String(kind, strings.Join(r.Supports[kind], ",")))
+	}
+	attrs := []any{"daemon", daemon, "version", r.Version, "commit", revision.Short(r.Commit), "go", r.GoVersion, "os", r.OS, "arch", r.Arch}
+	if len(r.Tags) > 0 {
+		attrs = append(attrs, "tags", strings.Join(r.Tags, ","))
+	}
+	logger.Info(msg, append(attrs, slog.Group("supports", supports...))...)
+}
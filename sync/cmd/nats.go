@@ -0,0 +1,64 @@
+//go:build !nonats
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/natscmd"
+)
+
+// startEvents connects the configured event sinks and command subscribers
+func startEvents(cfg *config.Config) {
+	if !cfg.NATS.Enabled() {
+		return
+	}
+	if cfg.NATS.Embedded.Enabled {
+		startEmbeddedNATS(cfg.NATS.Embedded)
+	}
+
+	nc, err := events.ConnectNATS(cfg.NATS)
+	if err != nil {
+		logger.Warn("NATS events disabled", "err", err)
+		return
+	}
+
+	if err := natscmd.ServeFreeze(nc, cfg.NATS.Subjects.Freeze); err != nil {
+		logger.Warn("Fleet-wide update freezes disabled", "err", err)
+	}
+
+	if err := natscmd.ServeReleases(nc, cfg.NATS.Subjects.Release); err != nil {
+		logger.Warn("Promoted releases disabled", "err", err)
+	}
+
+	if cfg.NATS.Registry {
+		if err := natscmd.ServeRegistrations(nc, cfg.NATS.Subjects.Register); err != nil {
+			logger.Warn("Host registry disabled", "err", err)
+		}
+	}
+	if id := identity.Current(); id != nil {
+		natscmd.RegisterOnConnect(nc, cfg.NATS.Subjects.Register, id)
+	}
+
+	if cfg.NATS.CommandSubject != "" {
+		if _, err := natscmd.Serve(nc, cfg.NATS.CommandSubject); err != nil {
+			logger.Warn("NATS commands disabled", "err", err)
+		}
+	}
+}
+
+// announce sends a change made by a CLI command to the fleet
+func announce(cfg *config.Config, subject string, v any) {
+	if !cfg.NATS.Enabled() {
+		fmt.Fprintln(stdout, "⚠️  NATS is not configured; the change applies to this host only")
+		return
+	}
+	if err := events.Announce(cfg.NATS, subject, v); err != nil {
+		fmt.Fprintf(stdout, "⚠️  Could not announce to the fleet (%v); the change applies to this host only\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "📣 Announced to the fleet on %s\n", subject)
+}
@@ -0,0 +1,21 @@
+//go:build nonats
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// startEvents warns when NATS is configured but this build was made with -tags nonats
+func startEvents(cfg *config.Config) {
+	if cfg.NATS.Enabled() {
+		logger.Warn("NATS events disabled: not compiled into this build (-tags nonats)")
+	}
+}
+
+// announce notes that this build cannot share changes with the fleet
+func announce(cfg *config.Config, subject string, v any) {
+	fmt.Fprintln(stdout, "⚠️  NATS is not compiled into this build (-tags nonats); the change applies to this host only")
+}
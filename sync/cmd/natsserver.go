@@ -0,0 +1,16 @@
+//go:build !nonats && !nonatsserver
+
+package cmd
+
+import (
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/natsserver"
+)
+
+// startEmbeddedNATS runs the control-plane nats-server inside this daemon
+// If it fails, the daemon still starts and the NATS client keeps retrying.
+func startEmbeddedNATS(cfg config.EmbeddedNATSConfig) {
+	if _, err := natsserver.Start(cfg); err != nil {
+		logger.Warn("Embedded NATS disabled", "err", err)
+	}
+}
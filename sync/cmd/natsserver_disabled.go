@@ -0,0 +1,10 @@
+//go:build !nonats && nonatsserver
+
+package cmd
+
+import "github.com/joeblew99/plat-telemetry/sync/pkg/config"
+
+// startEmbeddedNATS warns that this build was made with -tags nonatsserver
+func startEmbeddedNATS(cfg config.EmbeddedNATSConfig) {
+	logger.Warn("Embedded NATS disabled: not compiled into this build (-tags nonatsserver)", "url", cfg.URL())
+}
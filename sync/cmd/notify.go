@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/notify"
+)
+
+// Notify checks the chat channels and webhooks of notify.sinks
+// Usage: sync notify test [sink]
+func Notify(args []string) {
+	if len(args) < 1 || args[0] != "test" || len(args) > 2 {
+		fmt.Fprintln(stdout, "Usage: sync notify test [sink]")
+		fmt.Fprintln(stdout, "  Posts a test message to every sink of notify.sinks, or to the one named")
+		os.Exit(1)
+	}
+	name := ""
+	if len(args) == 2 {
+		name = args[1]
+	}
+
+	results, err := notify.Test(loadConfig(), name)
+	if err != nil {
+		fail("", err)
+	}
+	names := make([]string, 0, len(results))
+	for n := range results {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	failed := false
+	for _, n := range names {
+		if err := results[n]; err != nil {
+			fmt.Fprintf(stdout, "❌ %s: %v\n", n, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(stdout, "✅ %s: test message posted\n", n)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
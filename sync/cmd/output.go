@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/plain"
+)
+
+// stdout and stderr carry all human-readable command output, so --plain
+// applies to every command (JSON goes to os.Stdout untouched)
+var (
+	stdout = plain.NewWriter(os.Stdout)
+	stderr = plain.NewWriter(os.Stderr)
+)
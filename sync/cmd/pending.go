@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Pending lists detected updates waiting for approval
+// Usage: sync pending [--json]
+func Pending(args []string) {
+	fs := flag.NewFlagSet("pending", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	pending, err := updater.Pending()
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		if pending == nil {
+			pending = []updater.PendingUpdate{}
+		}
+		writeJSON(pending)
+		return
+	}
+
+	printFreeze()
+	if len(pending) == 0 {
+		fmt.Fprintln(stdout, i18n.T("pending.none"))
+		return
+	}
+
+	fmt.Fprintln(stdout, i18n.T("pending.header"))
+	for _, p := range pending {
+		fmt.Fprintf(stdout, "  %s\n", i18n.T("pending.entry",
+			p.Subsystem, orUnknown(p.From), orUnknown(p.Target), p.Trigger, p.Time.Local().Format(time.RFC3339)))
+		for _, note := range p.Compatibility.Notes() {
+			fmt.Fprintf(stdout, "    %s\n", note)
+		}
+	}
+	fmt.Fprintln(stdout, i18n.T("pending.hint"))
+}
+
+// Approve applies a pending update
+// Usage: sync approve <subsystem> [--dry-run]
+func Approve(args []string) {
+	subsystem, dryRun := approvalArgs("approve", args, true)
+
+	cfg := loadConfig()
+	if dryRun {
+		cfg.DryRun = true
+	}
+	updater.Configure(cfg)
+	showProgress()
+
+	if _, err := updater.Approve(subsystem); err != nil {
+		fail("", err)
+	}
+	// Stay for the regression watch, which may roll the update back
+	updater.WaitForWatches()
+}
+
+// Reject discards a pending update
+// Usage: sync reject <subsystem>
+func Reject(args []string) {
+	subsystem, _ := approvalArgs("reject", args, false)
+
+	p, err := updater.Reject(subsystem)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "✅ %s\n", i18n.T("pending.discarded", subsystem, orUnknown(p.From), orUnknown(p.Target)))
+}
+
+// approvalArgs parses `<subsystem> [--dry-run]` for approve and reject
+func approvalArgs(name string, args []string, withDryRun bool) (string, bool) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dryRun := new(bool)
+	if withDryRun {
+		fs.BoolVar(dryRun, "dry-run", false, "show what the update would do without running it")
+	}
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	if subsystem == "" {
+		fmt.Fprintf(stdout, "Usage: sync %s <subsystem>\n", name)
+		fmt.Fprintln(stdout, "  Run `sync pending` to see updates awaiting approval")
+		os.Exit(1)
+	}
+	return subsystem, *dryRun
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Policy shows which rule of policies: would apply to an update of a
+// subsystem detected now, and the attributes the conditions see
+// Usage: sync policy <subsystem> [--to <version>] [--trigger <trigger>] [--json]
+func Policy(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("policy", flag.ExitOnError)
+	to := fs.String("to", "", "upstream version of the update, e.g. v1.2.4")
+	trigger := fs.String("trigger", updater.TriggerPoll, "what detected the update (poll, webhook, taskfile, promote)")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync policy <subsystem> [--to <version>] [--trigger <trigger>] [--json]")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+	repo, ok := cfg.Repo(subsystem)
+	if !ok {
+		fmt.Fprintf(stdout, "❌ Unknown subsystem %s\n", subsystem)
+		os.Exit(1)
+	}
+	updater.Configure(cfg)
+	req := updater.Request{Subsystem: subsystem, Trigger: *trigger, Target: *to}
+	if repo.Mode == config.ModeReleases {
+		// Updates in releases mode carry the tag, which is what bump compares
+		req.Release = *to
+	}
+	rule, attrs := updater.Evaluate(req)
+
+	if *jsonOutput {
+		out := struct {
+			Rule       string         `json:"rule,omitempty"`
+			Action     string         `json:"action"`
+			Attributes map[string]any `json:"attributes,omitempty"`
+		}{Action: repo.Policy, Attributes: attrs}
+		if rule != nil {
+			out.Rule, out.Action = rule.Name, rule.Action
+		}
+		writeJSON(out)
+		return
+	}
+
+	if len(cfg.Policies) == 0 {
+		fmt.Fprintf(stdout, "No policies configured; %s follows its repo policy: %s\n", subsystem, repo.Policy)
+		return
+	}
+	if rule == nil {
+		fmt.Fprintf(stdout, "No rule matches; %s follows its repo policy: %s\n", subsystem, repo.Policy)
+	} else {
+		fmt.Fprintf(stdout, "Rule %s matches: %s\n", rule.Name, rule.Action)
+		fmt.Fprintf(stdout, "  when: %s\n", rule.When)
+		if rule.Message != "" {
+			fmt.Fprintf(stdout, "  %s\n", rule.Message)
+		}
+	}
+
+	fmt.Fprintln(stdout, "\nAttributes:")
+	printAttributes("", attrs)
+}
+
+// printAttributes prints attrs sorted, nested maps as dotted names
+func printAttributes(prefix string, attrs map[string]any) {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch v := attrs[name].(type) {
+		case map[string]any:
+			printAttributes(prefix+name+".", v)
+		case map[string]string:
+			if len(v) == 0 {
+				fmt.Fprintf(stdout, "  %-18s (none)\n", prefix+name)
+			}
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(stdout, "  %-18s %q\n", prefix+name+"."+k, v[k])
+			}
+		case string:
+			fmt.Fprintf(stdout, "  %-18s %q\n", prefix+name, v)
+		default:
+			fmt.Fprintf(stdout, "  %-18s %v\n", prefix+name, v)
+		}
+	}
+}
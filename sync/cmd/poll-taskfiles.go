@@ -1,17 +1,50 @@
 package cmd
 
 import (
-	"log"
+	"flag"
 
+	"github.com/joeblew99/plat-telemetry/sync/pkg/notify"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
 	taskfilepoller "github.com/joeblew99/plat-telemetry/sync/pkg/taskfile-poller"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/workers"
 )
 
 // PollTaskfiles starts the Taskfile polling loop
-func PollTaskfiles() {
-	log.Println("🔄 sync poll-taskfiles - Monitor Taskfiles for version changes")
+func PollTaskfiles(args []string) {
+	fs := flag.NewFlagSet("poll-taskfiles", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "log what updates would do instead of running them")
+	fs.Parse(args)
 
-	p := taskfilepoller.NewTaskfilePoller()
+	logStart("poll-taskfiles", "Monitoring Taskfiles for version changes")
+
+	cfg := loadConfig()
+	if *dryRun {
+		cfg.DryRun = true
+	}
+
+	status.SetDaemon("poll-taskfiles")
+	if err := status.Load(); err != nil {
+		logger.Warn("Could not restore previous state", "err", err)
+	}
+	logFreeze()
+	ensureIdentity(cfg)
+	startAPI(cfg)
+	updater.Configure(cfg)
+	startEvents(cfg)
+	notify.Start(cfg)
+	updater.StartQueue(cfg.Queue, "poll-taskfiles")
+	updater.StartTrains()
+	startPromotions(cfg)
+
+	triggers := workers.New("taskfile triggers", cfg.Queue.Concurrency)
+	onShutdown(cfg.Queue.ShutdownTimeout,
+		shutdownStep{"taskfile triggers", triggers.Shutdown},
+		stopQueueStep(),
+		flushNotifyStep())
+
+	p := taskfilepoller.NewTaskfilePoller(triggers)
 	if err := p.Start(); err != nil {
-		log.Fatalf("❌ Taskfile poller failed: %v", err)
+		fatal("Taskfile poller failed", "err", err)
 	}
 }
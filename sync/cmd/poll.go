@@ -1,17 +1,54 @@
 package cmd
 
 import (
-	"log"
+	"context"
+	"flag"
 
+	"github.com/joeblew99/plat-telemetry/sync/pkg/notify"
 	"github.com/joeblew99/plat-telemetry/sync/pkg/poller"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
 )
 
 // Poll starts the polling loop for upstream repositories
-func Poll() {
-	log.Println("🔄 sync poll - Monitor upstream repositories for updates")
+func Poll(args []string) {
+	fs := flag.NewFlagSet("poll", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "log what updates would do instead of running them")
+	fs.Parse(args)
 
-	p := poller.NewPoller()
+	logStart("poll", "Monitoring upstream repositories for updates")
+
+	cfg := loadConfig()
+	if *dryRun {
+		cfg.DryRun = true
+	}
+
+	token, err := secrets.New("GitHub token", "GITHUB_TOKEN", cfg.Secrets.GitHubTokenFile)
+	if err != nil {
+		fatal("Failed to load GitHub token", "err", err)
+	}
+	go token.Watch(context.Background(), cfg.Secrets.ReloadInterval)
+
+	status.SetDaemon("poll")
+	if err := status.Load(); err != nil {
+		logger.Warn("Could not restore previous state", "err", err)
+	}
+	logFreeze()
+	ensureIdentity(cfg)
+	startAPI(cfg)
+	updater.Configure(cfg)
+	startEvents(cfg)
+	notify.Start(cfg)
+	updater.StartQueue(cfg.Queue, "poll")
+	updater.StartTrains()
+	startPromotions(cfg)
+	startGC(cfg)
+
+	onShutdown(cfg.Queue.ShutdownTimeout, stopQueueStep(), flushNotifyStep())
+
+	p := poller.NewPoller(cfg, token)
 	if err := p.Start(); err != nil {
-		log.Fatalf("❌ Poller failed: %v", err)
+		fatal("Poller failed", "err", err)
 	}
 }
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/plain"
+)
+
+// showProgress prints the phases of updates run by this command as they happen
+// On a terminal the percentage a phase reports is redrawn in place; otherwise,
+// and with --plain, it is printed as it passes each 10% so logs stay readable.
+func showProgress() {
+	terminal := isTerminal(os.Stdout) && !plain.Enabled()
+	redrawing, decile := false, 0
+	events.Subscribe(func(e events.Event) {
+		// Anything after a redrawn percentage starts on a fresh line
+		if redrawing && (e.Type != events.UpdateProgress || e.Percent == 0) {
+			fmt.Fprintln(stdout)
+			redrawing = false
+		}
+		if e.Type != events.UpdateProgress {
+			return
+		}
+
+		if e.Percent == 0 {
+			fmt.Fprintf(stdout, "⏳ [%d/%d] %s: %s...\n", e.Step, e.Steps, e.Subsystem, i18n.T("phase."+e.Phase))
+			decile = 0
+			return
+		}
+		switch {
+		case terminal:
+			fmt.Fprintf(stdout, "\r\033[K   %3d%% %s", e.Percent, e.Detail)
+			redrawing = true
+		case e.Percent/10 != decile:
+			fmt.Fprintf(stdout, "   %3d%% %s\n", e.Percent, e.Detail)
+			decile = e.Percent / 10
+		}
+	})
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/promote"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Promote copies the release a subsystem runs in one environment into the next
+// Usage: sync promote <subsystem> --from <env> --to <env> [--force] [--json]
+func Promote(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("promote", flag.ExitOnError)
+	from := fs.String("from", "", "environment the release soaked in (required)")
+	to := fs.String("to", "", "environment to promote it into, the next one in environments (required)")
+	force := fs.Bool("force", false, "promote before the soak time in --from has passed")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	if subsystem == "" || *from == "" || *to == "" {
+		fmt.Fprintln(stdout, "Usage: sync promote <subsystem> --from <env> --to <env> [--force] [--json]")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+	if len(cfg.Environments) == 0 {
+		fmt.Fprintln(stdout, "❌ No environments configured in sync.yaml")
+		os.Exit(1)
+	}
+
+	r, err := promote.Promote(cfg, subsystem, *from, *to, *force, audit.Actor())
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		writeJSON(r)
+	} else {
+		fmt.Fprintf(stdout, "✅ Promoted %s %s: %s → %s (soaked %s, %d file(s) pinned)\n",
+			r.Subsystem, revision.Short(r.Version), r.From, r.Environment, time.Since(r.SoakedSince).Round(time.Minute), len(r.Files))
+	}
+	announce(cfg, cfg.NATS.Subjects.Release, r)
+}
+
+// Releases lists the releases promoted into each environment
+// Usage: sync releases [env] [--json]
+func Releases(args []string) {
+	env := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		env, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("releases", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	list, err := promote.List(env)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		if list == nil {
+			list = []promote.Release{}
+		}
+		writeJSON(list)
+		return
+	}
+
+	printFreeze()
+	if len(list) == 0 {
+		fmt.Fprintln(stdout, i18n.T("promote.none"))
+		return
+	}
+	for _, r := range list {
+		fmt.Fprintf(stdout, "%-10s %-12s %s  (from %s, by %s, %s)\n",
+			r.Environment, r.Subsystem, revision.Short(r.Version), r.From, r.By, r.Time.Local().Format(time.RFC3339))
+	}
+}
+
+// startPromotions installs the releases of this host's environment that are
+// not yet running, for daemons in a promoted environment
+func startPromotions(cfg *config.Config) {
+	if !cfg.Promoted() {
+		return
+	}
+	logger.Info("Installing promoted releases instead of building upstream changes", "environment", cfg.Environment)
+	updater.Reconcile()
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Render renders a subsystem's configs from their templates for the
+// installed version, as an update does before the restart
+// Usage: sync render <subsystem> [--dry-run] [--restart] [--json]
+func Render(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "render and validate the configs without replacing them")
+	restart := fs.Bool("restart", false, "restart the subsystem's processes if a config changed")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync render <subsystem> [--dry-run] [--restart] [--json]")
+		fmt.Fprintln(stdout, "  Renders the configs: of the subsystem in sync.yaml and checks them")
+		os.Exit(1)
+	}
+
+	updater.Configure(loadConfig())
+	rendered, err := updater.RenderConfigs(subsystem, *dryRun, *restart)
+	if err != nil {
+		fail("", err)
+	}
+
+	if *jsonOutput {
+		writeJSON(rendered)
+		return
+	}
+	for _, r := range rendered {
+		switch {
+		case !r.Changed && r.Template == "":
+			fmt.Fprintf(stdout, "✅ %s passes %s %s\n", r.Output, subsystem, orUnknown(r.Release))
+		case !r.Changed:
+			fmt.Fprintf(stdout, "✅ %s is up to date for %s %s\n", r.Output, subsystem, orUnknown(r.Release))
+		case *dryRun:
+			fmt.Fprintf(stdout, "📝 %s would change for %s %s; it passed validation\n", r.Output, subsystem, orUnknown(r.Release))
+		default:
+			fmt.Fprintf(stdout, "✅ Rendered %s for %s %s\n", r.Output, subsystem, orUnknown(r.Release))
+		}
+	}
+}
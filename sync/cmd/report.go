@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/report"
+)
+
+// Report summarizes the update history of a period per subsystem, for reviews
+// Usage: sync report [subsystem] [--since 90d] [--until <time>] [--json | --markdown]
+func Report(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	since := fs.String("since", "90d", "start of the period: a time ago (90d, 12w, 36h) or a point in time")
+	until := fs.String("until", "", "end of the period (default: now), as --since")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	markdown := fs.Bool("markdown", false, "output a Markdown table")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	now := time.Now()
+	end := now
+	start, err := parseSince(*since, now)
+	if err == nil && *until != "" {
+		end, err = parseSince(*until, now)
+	}
+	if err == nil && !start.Before(end) {
+		err = fmt.Errorf("--since %s is not before --until %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	entries, err := history.Load()
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ Failed to load history: %v\n", err)
+		os.Exit(1)
+	}
+	subsystems := historySubsystems(entries)
+	if subsystem != "" {
+		subsystems = []string{subsystem}
+		only := entries[:0:0]
+		for _, e := range entries {
+			if e.Subsystem == subsystem {
+				only = append(only, e)
+			}
+		}
+		entries = only
+	}
+
+	r := report.New(entries, subsystems, start, end)
+	switch {
+	case *jsonOutput:
+		writeJSON(r)
+	case *markdown:
+		report.WriteMarkdown(os.Stdout, r)
+	default:
+		report.WriteText(stdout, r)
+	}
+}
+
+// parseSince parses a period bound: a time ago in days (90d), weeks (12w) or
+// any Go duration (36h), or a point in time as parseTime takes it
+func parseSince(s string, now time.Time) (time.Time, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if v, err := strconv.Atoi(n); err == nil && v >= 0 {
+				return now.Add(-time.Duration(v) * unit), nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	t, err := parseTime(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since/--until %q (want e.g. 90d, 12w, 36h, YYYY-MM-DD or RFC3339)", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Rollback switches a subsystem back to a previously installed version
+// Usage: sync rollback <subsystem> [--to <version>] [--restart]
+func Rollback(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	to := fs.String("to", "", "version to restore (default: the one installed before the active version)")
+	restart := fs.Bool("restart", false, "restart the subsystem's processes afterwards")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync rollback <subsystem> [--to <version>] [--restart]")
+		fmt.Fprintln(stdout, "  Run `sync versions <subsystem>` to see installed versions")
+		os.Exit(1)
+	}
+
+	// With sync.yaml, the subsystem's configs are re-rendered for the version
+	// it switches to
+	if cfg, err := config.LoadDefault(); err == nil {
+		updater.Configure(cfg)
+	}
+	entry, err := updater.Rollback(subsystem, *to, *restart)
+	if err != nil {
+		fail("", err)
+	}
+
+	fmt.Fprintf(stdout, "✅ %s\n", i18n.T("rollback.done", subsystem, orUnknown(entry.From), orUnknown(entry.To)))
+	if !*restart {
+		fmt.Fprintf(stdout, "   %s\n", i18n.T("rollback.restart", subsystem))
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/selftest"
+)
+
+// Selftest verifies the detect → build → install machinery end to end on this host
+func Selftest(args []string) {
+	jsonOutput := len(args) > 0 && (args[0] == "--json" || args[0] == "-json")
+
+	if !jsonOutput {
+		fmt.Fprintln(stdout, "Running sync self-test...")
+	}
+
+	steps, err := selftest.Run()
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ Self-test could not run: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, step := range steps {
+		if !step.OK && !step.Skipped {
+			failed = true
+		}
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(steps)
+	} else {
+		for _, step := range steps {
+			switch {
+			case step.Skipped:
+				fmt.Fprintf(stdout, "⏭️  %s: skipped (%s)\n", step.Name, step.Detail)
+			case step.OK:
+				fmt.Fprintf(stdout, "✅ %s: %s (%v)\n", step.Name, step.Detail, step.Duration.Round(1e6))
+			default:
+				fmt.Fprintf(stdout, "❌ %s: %s\n", step.Name, step.Detail)
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
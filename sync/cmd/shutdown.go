@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/notify"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// shutdownStep is one piece of in-flight work a daemon drains before exiting
+type shutdownStep struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// onShutdown drains the daemon on SIGINT or SIGTERM, then exits
+// Steps run in order and share timeout; whatever is still running when it
+// expires is logged, so no in-flight update goes unaccounted for.
+func onShutdown(timeout time.Duration, steps ...shutdownStep) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		logger.Info("Waiting for running work to finish (signal again to exit now)", "signal", sig.String(), "timeout", timeout)
+		go func() {
+			<-signals
+			logger.Info("Exiting without waiting")
+			os.Exit(1)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		code := 0
+		for _, step := range steps {
+			if err := step.stop(ctx); err != nil {
+				logger.Warn("Stopped with work still running", "step", step.name, "err", err)
+				code = 1
+			}
+		}
+		if code == 0 {
+			logger.Info("Shut down cleanly")
+		}
+		os.Exit(code)
+	}()
+}
+
+// flushNotifyStep posts the notifications still queued (see notify.Flush)
+func flushNotifyStep() shutdownStep {
+	return shutdownStep{"notifications", notify.Flush}
+}
+
+// stopQueueStep drains the update queue (see updater.StopQueue)
+func stopQueueStep() shutdownStep {
+	return shutdownStep{"update queue", updater.StopQueue}
+}
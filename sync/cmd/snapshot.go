@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/backup"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// Snapshot lists and restores pre-update data directory snapshots
+func Snapshot(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(stdout, "Usage: sync snapshot <list|restore> [args]")
+		fmt.Fprintln(stdout, "  list [subsystem]              List snapshots, newest first")
+		fmt.Fprintln(stdout, "  restore <subsystem> [name]    Restore a snapshot (default: newest)")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+
+	switch args[0] {
+	case "list":
+		repos := cfg.Repos
+		if len(args) > 1 {
+			repo, ok := cfg.Repo(args[1])
+			if !ok {
+				fmt.Fprintf(stdout, "❌ Unknown subsystem: %s\n", args[1])
+				os.Exit(1)
+			}
+			repos = []config.RepoConfig{repo}
+		}
+
+		for _, repo := range repos {
+			snapshots, err := backup.List(repo.Subsystem)
+			if err != nil {
+				fmt.Fprintf(stdout, "❌ %s: %v\n", repo.Subsystem, err)
+				continue
+			}
+			if len(snapshots) == 0 {
+				continue
+			}
+			fmt.Fprintf(stdout, "%s:\n", repo.Subsystem)
+			for _, s := range snapshots {
+				fmt.Fprintf(stdout, "  %s  (%s)\n", s.Name, s.Time.Local().Format(time.RFC3339))
+			}
+		}
+	case "restore":
+		if len(args) < 2 {
+			fmt.Fprintln(stdout, "Usage: sync snapshot restore <subsystem> [name]")
+			os.Exit(1)
+		}
+		repo, ok := cfg.Repo(args[1])
+		if !ok || repo.DataDir == "" {
+			fmt.Fprintf(stdout, "❌ %s has no data_dir configured\n", args[1])
+			os.Exit(1)
+		}
+
+		snapshots, err := backup.List(repo.Subsystem)
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ Failed to list snapshots: %v\n", err)
+			os.Exit(1)
+		}
+		if len(snapshots) == 0 {
+			fmt.Fprintf(stdout, "❌ No snapshots for %s\n", repo.Subsystem)
+			os.Exit(1)
+		}
+
+		snapshot := snapshots[0]
+		if len(args) > 2 {
+			found := false
+			for _, s := range snapshots {
+				if s.Name == args[2] {
+					snapshot, found = s, true
+					break
+				}
+			}
+			if !found {
+				fmt.Fprintf(stdout, "❌ No snapshot %s for %s\n", args[2], repo.Subsystem)
+				os.Exit(1)
+			}
+		}
+
+		dir, err := repo.DataPath()
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		if err := backup.Restore(snapshot.Path, dir); err != nil {
+			fmt.Fprintf(stdout, "❌ Restore failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(stdout, "✅ Restored %s from %s\n", dir, snapshot.Name)
+		fmt.Fprintf(stdout, "   Restart it to pick up the data: task reload PROC=%s\n", repo.Subsystem)
+	default:
+		fmt.Fprintf(stdout, "Unknown snapshot command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
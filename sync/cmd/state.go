@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// State manages the state store
+// Usage: sync state migrate <from-backend>
+// migrate copies every bucket of another backend (file, sqlite or nats) into
+// the one state.backend selects, e.g. after switching from file to nats.
+// Stop the daemons first, so nothing is written to the old store meanwhile.
+func State(args []string) {
+	if len(args) != 2 || args[0] != "migrate" {
+		fmt.Fprintln(stdout, "Usage: sync state migrate <from-backend>")
+		fmt.Fprintln(stdout, "  migrate <file|sqlite|nats>   Copy another backend's state into state.backend's")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+	from := args[1]
+	if from == cfg.State.Backend {
+		fmt.Fprintf(stdout, "❌ state.backend already is %s\n", from)
+		os.Exit(1)
+	}
+	src, err := state.Open(cfg, from)
+	if err != nil {
+		fail("Failed to open the "+from+" state store", err)
+	}
+	dst, err := state.Open(cfg, cfg.State.Backend)
+	if err != nil {
+		fail("Failed to open the "+cfg.State.Backend+" state store", err)
+	}
+
+	n, err := state.Copy(src, dst)
+	if err != nil {
+		fail(fmt.Sprintf("Migration failed after %d key(s)", n), err)
+	}
+	fmt.Fprintf(stdout, "✅ Copied %d key(s) from the %s state store to %s\n", n, from, cfg.State.Backend)
+}
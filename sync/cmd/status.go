@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Status lists the updates queued or running in the daemons, with their queue
+// positions and estimated completion
+// Usage: sync status [--json]
+func Status(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	updater.Configure(loadConfig())
+	queued, err := updater.Queued()
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		if queued == nil {
+			queued = []updater.QueuedUpdate{}
+		}
+		writeJSON(queued)
+		return
+	}
+
+	printFreeze()
+	if len(queued) == 0 {
+		fmt.Fprintln(stdout, i18n.T("status.none"))
+		return
+	}
+
+	fmt.Fprintln(stdout, i18n.T("status.header"))
+	var last time.Time
+	known := true
+	for _, u := range queued {
+		var line string
+		switch u.State {
+		case updater.QueueRunning:
+			line = i18n.T("status.running", u.Daemon, u.Subsystem, time.Since(u.Started).Round(time.Second), u.Trigger)
+		case updater.QueueRetrying:
+			line = i18n.T("status.retrying", u.Daemon, u.Subsystem, u.Position, u.Attempts, clock(u.NextAt))
+		default:
+			line = i18n.T("status.queued", u.Daemon, u.Subsystem, u.Position, u.Trigger)
+		}
+		if u.ETA.IsZero() {
+			known = false
+			line += ", " + i18n.T("status.eta_unknown")
+		} else {
+			line += ", " + i18n.T("status.eta", clock(u.ETA), time.Until(u.ETA).Round(time.Second))
+			if u.ETA.After(last) {
+				last = u.ETA
+			}
+		}
+		fmt.Fprintf(stdout, "  %s\n", line)
+	}
+	if known {
+		fmt.Fprintln(stdout, i18n.T("status.done_by", clock(last), time.Until(last).Round(time.Second)))
+	}
+}
+
+// clock formats t as local time of day, with the date if it isn't today
+func clock(t time.Time) string {
+	t = t.Local()
+	if t.Format(time.DateOnly) == time.Now().Format(time.DateOnly) {
+		return t.Format(time.TimeOnly)
+	}
+	return t.Format(time.DateTime)
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/gitops"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/semver"
+)
+
+// TagInfo is a tag listed by sync tags
+type TagInfo struct {
+	checker.Tag
+	Pinned    bool `json:"pinned,omitempty"`    // the version pinned in the subsystem's Taskfile
+	Installed bool `json:"installed,omitempty"` // the commit the subsystem runs
+}
+
+// Tags lists the upstream tags and releases of a subsystem, a GitHub repo, or
+// any git remote, newest first, so a new pin can be picked
+// Usage: sync tags <subsystem|owner/repo|url|path> [--constraint <range>] [--prereleases] [--limit <n>] [--json]
+func Tags(args []string) {
+	target := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		target, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	constraint := fs.String("constraint", "", `semver range, e.g. ">=2.10, <3" or "~2.10"`)
+	prereleases := fs.Bool("prereleases", false, "include prereleases")
+	limit := fs.Int("limit", 20, "tags shown (0 for all)")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if target == "" {
+		fmt.Fprintln(stdout, "Usage: sync tags <subsystem|owner/repo|url|path> [--constraint <range>] [--prereleases] [--limit <n>] [--json]")
+		os.Exit(1)
+	}
+
+	var filter *semver.Constraint
+	if *constraint != "" {
+		c, err := semver.ParseConstraint(*constraint)
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		filter = &c
+	}
+
+	cfg := loadConfig()
+	ctx := context.Background()
+	source, tags, err := listTags(ctx, cfg, target)
+	if err != nil {
+		fail("Failed to list tags", err)
+	}
+
+	// Mark what a configured subsystem pins and runs
+	var pin, current string
+	for _, repo := range cfg.Repos {
+		if repo.Subsystem == target {
+			pin, _ = checker.PinnedVersion(ctx, target)
+			current, _ = checker.GetCurrentVersion(target)
+		}
+	}
+
+	list := []TagInfo{}
+	for _, t := range tags {
+		if t.Prerelease && !*prereleases {
+			continue
+		}
+		if filter != nil {
+			v, ok := semver.Parse(t.Name)
+			if !ok || !filter.Check(v) {
+				continue
+			}
+		}
+		list = append(list, TagInfo{
+			Tag:       t,
+			Pinned:    pin != "" && t.Name == pin,
+			Installed: current != "" && t.Commit != "" && revision.Same(t.Commit, current),
+		})
+	}
+	more := 0
+	if *limit > 0 && len(list) > *limit {
+		list, more = list[:*limit], len(list)-*limit
+	}
+
+	if *jsonOutput {
+		writeJSON(list)
+		return
+	}
+
+	if len(list) == 0 {
+		fmt.Fprintf(stdout, "No matching tags in %s\n", source)
+		return
+	}
+	fmt.Fprintf(stdout, "Tags of %s, newest first:\n", source)
+	for _, t := range list {
+		line := fmt.Sprintf("  %-20s %s", t.Name, revision.Short(t.Commit))
+		switch {
+		case t.Release && t.Prerelease:
+			line += "  prerelease"
+		case t.Release:
+			line += "  release"
+		}
+		if !t.Published.IsZero() {
+			line += " " + t.Published.Local().Format("2006-01-02")
+		}
+		if t.Pinned {
+			line += "  ← pinned"
+		}
+		if t.Installed {
+			line += "  (installed)"
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	if more > 0 {
+		fmt.Fprintf(stdout, "  … and %d more (--limit 0 lists all)\n", more)
+	}
+}
+
+// listTags resolves target to a GitHub repo or git remote and lists its tags,
+// returning what was listed
+// GitHub repos also report releases; other remotes only tags.
+func listTags(ctx context.Context, cfg *config.Config, target string) (string, []checker.Tag, error) {
+	repo := githubRepo(target)
+	for _, r := range cfg.Repos {
+		if r.Subsystem == target {
+			repo = r.Repo
+		}
+	}
+	if repo != "" {
+		client, err := githubClient(cfg)
+		if err != nil {
+			return repo, nil, err
+		}
+		tags, err := checker.ListTags(ctx, client, repo)
+		return repo, tags, err
+	}
+
+	url := target
+	if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+		if url, err = gitops.OriginURL(target); err != nil {
+			return target, nil, err
+		}
+	}
+	if err := gitops.Configure(cfg); err != nil {
+		return url, nil, err
+	}
+	remote, err := gitops.RemoteTags(url)
+	if err != nil {
+		return url, nil, err
+	}
+	tags := make([]checker.Tag, 0, len(remote))
+	for name, commit := range remote {
+		tags = append(tags, checker.Tag{Name: name, Commit: commit})
+	}
+	return url, checker.SortTags(tags), nil
+}
+
+// githubRepo returns owner/name if target names a GitHub repo, either in that
+// form or as a github.com URL ("" otherwise)
+func githubRepo(target string) string {
+	for _, prefix := range []string{"https://github.com/", "http://github.com/", "git@github.com:"} {
+		if rest, ok := strings.CutPrefix(target, prefix); ok {
+			return strings.TrimSuffix(strings.TrimSuffix(rest, "/"), ".git")
+		}
+	}
+	if strings.Count(target, "/") == 1 && !strings.ContainsAny(target, `:\`) && !strings.HasPrefix(target, "/") {
+		if _, err := os.Stat(target); err != nil {
+			return target
+		}
+	}
+	return ""
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/gitops"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// TrainChangelog is the machine-readable result of sync train show
+type TrainChangelog struct {
+	updater.Train
+	Changes []TrainChange `json:"changes"` // in rollout order
+}
+
+// TrainChange is the upstream commits one update of a train brings in
+type TrainChange struct {
+	DiffResult
+	Error string `json:"error,omitempty"` // why the commits could not be listed
+}
+
+// Train lists, shows, approves or rejects release trains
+// Usage: sync train [list|show|approve|reject] [name] [flags]
+func Train(args []string) {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "list":
+		listTrains(args)
+	case "show":
+		showTrain(args)
+	case "approve":
+		approveTrain(args)
+	case "reject":
+		rejectTrain(args)
+	default:
+		fmt.Fprintln(stdout, "Usage: sync train [list|show|approve|reject] [name]")
+		fmt.Fprintln(stdout, "  list [--json]                      release trains, newest first")
+		fmt.Fprintln(stdout, "  show [name] [--limit n] [--json]   a train's updates and combined changelog (default: the newest)")
+		fmt.Fprintln(stdout, "  approve <name> [--dry-run]         roll the train out, in order")
+		fmt.Fprintln(stdout, "  reject <name>                      discard the train")
+		os.Exit(1)
+	}
+}
+
+func listTrains(args []string) {
+	fs := flag.NewFlagSet("train list", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	trains, err := updater.Trains()
+	if err != nil {
+		fail("", err)
+	}
+	if *jsonOutput {
+		if trains == nil {
+			trains = []updater.Train{}
+		}
+		writeJSON(trains)
+		return
+	}
+	if len(trains) == 0 {
+		if tc := loadConfig().Train; !tc.Enabled() {
+			fmt.Fprintln(stdout, "No release trains (set train.period in sync.yaml to collect updates into trains)")
+		} else {
+			fmt.Fprintf(stdout, "No release trains yet; the next detected update opens one for %s\n", tc.Period)
+		}
+		return
+	}
+	for _, t := range trains {
+		fmt.Fprintf(stdout, "%-18s %-10s %d update(s)  %s\n", t.Name, t.State, len(t.Updates), trainWhen(t))
+	}
+}
+
+// trainWhen describes where a train is in its life, e.g. "departs 2024-06-10 09:00:00"
+func trainWhen(t updater.Train) string {
+	switch t.State {
+	case updater.TrainCollecting:
+		return "departs " + t.Departs.Local().Format(time.DateTime)
+	case updater.TrainReady:
+		return "departed " + t.Departed.Local().Format(time.DateTime) + ", waiting for approval"
+	case updater.TrainRolling:
+		return "approved by " + t.ApprovedBy
+	default:
+		return t.Finished.Local().Format(time.DateTime) + ", by " + t.ApprovedBy
+	}
+}
+
+func showTrain(args []string) {
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("train show", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "commits shown per update (0 for all)")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+
+	t, err := updater.GetTrain(name)
+	if err != nil {
+		fail("", err)
+	}
+	cl := TrainChangelog{Train: t, Changes: trainChanges(t, *limit)}
+	if *jsonOutput {
+		writeJSON(cl)
+		return
+	}
+
+	fmt.Fprintf(stdout, "Release train %s: %s, %s\n", t.Name, t.State, trainWhen(t))
+	for i, c := range cl.Changes {
+		outcome := ""
+		if i < len(t.Results) {
+			outcome = " [" + t.Results[i].Outcome + "]"
+		}
+		target := revision.Short(c.To)
+		if c.Release != "" {
+			target = c.Release + " (" + target + ")"
+		}
+		fmt.Fprintf(stdout, "\n%d. %s %s → %s%s\n", i+1, c.Subsystem, orUnknown(revision.Short(c.From)), orUnknown(target), outcome)
+		for _, note := range t.Updates[i].Compatibility.Notes() {
+			fmt.Fprintf(stdout, "   %s\n", note)
+		}
+		switch {
+		case c.Error != "":
+			fmt.Fprintf(stdout, "   (changelog unavailable: %s)\n", c.Error)
+		case c.Total == 0:
+			fmt.Fprintln(stdout, "   (no commits listed)")
+		}
+		for _, commit := range c.Commits {
+			fmt.Fprintf(stdout, "   %s  %s  %-20s %s\n", revision.Short(commit.SHA), commit.Date.Local().Format("2006-01-02"), commit.Author, commit.Subject)
+		}
+		if more := c.Total - len(c.Commits); more > 0 {
+			fmt.Fprintf(stdout, "   … and %d more (--limit 0 lists all)\n", more)
+		}
+	}
+	for i, r := range t.Results {
+		if r.Error != "" {
+			fmt.Fprintf(stdout, "\n❌ %d. %s failed: %s\n", i+1, r.Subsystem, r.Error)
+		}
+	}
+	if t.State == updater.TrainCollecting || t.State == updater.TrainReady {
+		fmt.Fprintf(stdout, "\nApprove with: sync train approve %s\n", t.Name)
+	}
+}
+
+// trainChanges lists the commits each update of a train brings in, as sync
+// diff does; an update whose commits can't be listed says why
+func trainChanges(t updater.Train, limit int) []TrainChange {
+	cfg := loadConfig()
+	client, clientErr := githubClient(cfg)
+	changes := make([]TrainChange, 0, len(t.Updates))
+	for _, u := range t.Updates {
+		c := TrainChange{DiffResult: DiffResult{Subsystem: u.Subsystem, From: u.From, To: u.Target, Release: u.Release, Commits: []gitops.Commit{}}}
+		repo, ok := cfg.Repo(u.Subsystem)
+		switch {
+		case !ok:
+			c.Error = "not configured in sync.yaml"
+		case u.From == "" || u.Target == "":
+			c.Error = "versions unknown"
+		case clientErr != nil:
+			c.Error = clientErr.Error()
+		case !revision.Same(u.From, u.Target):
+			c.Repo = repo.Repo
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Checks.Timeout)
+			commits, total, source, err := commitRange(ctx, client, repo, u.From, u.Target)
+			cancel()
+			if err != nil {
+				c.Error = err.Error()
+				break
+			}
+			c.Commits, c.Total, c.Source = commits, total, source
+			if limit > 0 && len(c.Commits) > limit {
+				c.Commits = c.Commits[:limit]
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func approveTrain(args []string) {
+	name, dryRun := trainArgs("approve", args, true)
+
+	cfg := loadConfig()
+	if dryRun {
+		cfg.DryRun = true
+	}
+	updater.Configure(cfg)
+	showProgress()
+
+	t, err := updater.ApproveTrain(name, audit.Actor())
+	if err != nil {
+		fail("", err)
+	}
+	if !dryRun {
+		fmt.Fprintf(stdout, "✅ Release train %s rolled out: %d update(s)\n", t.Name, len(t.Updates))
+	} else {
+		for i, u := range t.Updates {
+			fmt.Fprintf(stdout, "🧪 %d. would update %s %s → %s\n", i+1, u.Subsystem, orUnknown(revision.Short(u.From)), orUnknown(revision.Short(u.Target)))
+		}
+	}
+	// Stay for the regression watches, which may roll updates back
+	updater.WaitForWatches()
+}
+
+func rejectTrain(args []string) {
+	name, _ := trainArgs("reject", args, false)
+
+	t, err := updater.RejectTrain(name, audit.Actor())
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "✅ Release train %s discarded (%d update(s))\n", t.Name, len(t.Updates))
+}
+
+// trainArgs parses `<name> [--dry-run]` for train approve and reject
+func trainArgs(name string, args []string, withDryRun bool) (string, bool) {
+	train := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		train, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("train "+name, flag.ExitOnError)
+	dryRun := new(bool)
+	if withDryRun {
+		fs.BoolVar(dryRun, "dry-run", false, "show what the rollout would do without running it")
+	}
+	fs.Parse(args)
+	if train == "" && fs.NArg() > 0 {
+		train = fs.Arg(0)
+	}
+
+	if train == "" {
+		fmt.Fprintf(stdout, "Usage: sync train %s <name>\n", name)
+		fmt.Fprintln(stdout, "  Run `sync train` to see release trains")
+		os.Exit(1)
+	}
+	return train, *dryRun
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Update runs the update workflow for a subsystem immediately
+// Usage: sync update <subsystem> [--dry-run]
+func Update(args []string) {
+	// Accept the subsystem before or after the flags
+	subsystem := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subsystem, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "show what the update would do without running it")
+	fs.Parse(args)
+	if subsystem == "" && fs.NArg() > 0 {
+		subsystem = fs.Arg(0)
+	}
+
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync update <subsystem> [--dry-run]")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+	if *dryRun {
+		cfg.DryRun = true
+	}
+	updater.Configure(cfg)
+	printFreeze()
+	showProgress()
+
+	if err := updater.Run(updater.Request{Subsystem: subsystem, Trigger: updater.TriggerManual}); err != nil {
+		fail("", err)
+	}
+	// Stay for the regression watch, which may roll the update back
+	updater.WaitForWatches()
+}
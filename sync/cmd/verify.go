@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Verify re-hashes installed binaries against the SHA256s recorded at install time
+// Usage: sync verify [subsystem] [--all] [--json]
+// Without --all only the active version of each subsystem is checked. It exits
+// with the checksum_mismatch code if any file was modified, removed or replaced.
+func Verify(args []string) {
+	// Accept the subsystem before or after the flags
+	only := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		only, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	all := fs.Bool("all", false, "verify every installed version, not just the active one")
+	jsonOutput := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if only == "" && fs.NArg() > 0 {
+		only = fs.Arg(0)
+	}
+
+	subsystems := []string{only}
+	if only == "" {
+		var err error
+		if subsystems, err = versions.Subsystems(); err != nil {
+			fmt.Fprintf(stdout, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	results := []versions.Verification{}
+	for _, subsystem := range subsystems {
+		list, err := versions.List(subsystem)
+		if err != nil {
+			fmt.Fprintf(stdout, "❌ Failed to list versions: %v\n", err)
+			os.Exit(1)
+		}
+		if len(list) == 0 && only != "" {
+			fmt.Fprintf(stdout, "❌ No versions of %s installed under .bin/versions/\n", subsystem)
+			os.Exit(1)
+		}
+		for _, v := range list {
+			if !*all && !v.Active {
+				continue
+			}
+			result, err := versions.Verify(subsystem, v.Version)
+			if err != nil {
+				fmt.Fprintf(stdout, "❌ Failed to verify %s %s: %v\n", subsystem, revision.Short(v.Version), err)
+				os.Exit(1)
+			}
+			results = append(results, result)
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Recorded && !r.OK() {
+			failed++
+		}
+	}
+	if *jsonOutput {
+		writeJSON(results)
+		if failed > 0 {
+			os.Exit(syncerr.Describe(syncerr.ChecksumMismatch).ExitCode)
+		}
+		return
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintln(stdout, "No versions installed under .bin/versions/ yet")
+		return
+	}
+	for _, r := range results {
+		switch {
+		case !r.Recorded:
+			fmt.Fprintf(stdout, "⚠️  %s %s: no checksums recorded (installed before they were; the next update records them)\n", r.Subsystem, revision.Short(r.Version))
+		case r.OK():
+			fmt.Fprintf(stdout, "✅ %s %s: %d file(s) match their recorded SHA256\n", r.Subsystem, revision.Short(r.Version), r.Files)
+		default:
+			fmt.Fprintf(stdout, "❌ %s %s:\n", r.Subsystem, revision.Short(r.Version))
+			for _, p := range r.Problems {
+				fmt.Fprintf(stdout, "   %-10s %s%s\n", p.Issue, p.File, digests(p))
+			}
+		}
+	}
+	if failed > 0 {
+		fail("", syncerr.Wrap(syncerr.ChecksumMismatch, fmt.Errorf("%d installed version(s) failed verification", failed)))
+	}
+}
+
+// digests formats the recorded and actual SHA256 of a problem, shortened
+func digests(p versions.Problem) string {
+	short := func(d string) string {
+		if len(d) > 12 {
+			return d[:12]
+		}
+		return d
+	}
+	switch {
+	case p.Want != "" && p.Got != "":
+		return fmt.Sprintf(" (recorded %s, found %s)", short(p.Want), short(p.Got))
+	case p.Want != "":
+		return fmt.Sprintf(" (recorded %s)", short(p.Want))
+	case p.Got != "":
+		return fmt.Sprintf(" (found %s)", short(p.Got))
+	}
+	return ""
+}
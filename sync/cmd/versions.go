@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Versions lists the builds of a subsystem installed under .bin/versions/
+// Usage: sync versions <subsystem> [--json]
+func Versions(args []string) {
+	jsonOutput := false
+	subsystem := ""
+	for _, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			jsonOutput = true
+		default:
+			subsystem = arg
+		}
+	}
+
+	if subsystem == "" {
+		fmt.Fprintln(stdout, "Usage: sync versions <subsystem> [--json]")
+		os.Exit(1)
+	}
+
+	list, err := versions.List(subsystem)
+	if err != nil {
+		fmt.Fprintf(stdout, "❌ Failed to list versions: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		if list == nil {
+			list = []versions.Version{}
+		}
+		writeJSON(list)
+		return
+	}
+
+	printFreeze()
+	if len(list) == 0 {
+		fmt.Fprintf(stdout, "No versions of %s installed under .bin/versions/ yet\n", subsystem)
+		return
+	}
+
+	fmt.Fprintf(stdout, "Installed versions of %s:\n", subsystem)
+	for _, v := range list {
+		marker := "  "
+		if v.Active {
+			marker = "* "
+		}
+		installed := v.InstalledAt.Local().Format(time.RFC3339)
+		if v.Platform != "" {
+			installed += ", " + v.Platform
+		}
+		fmt.Fprintf(stdout, "%s%s  (installed %s)\n", marker, revision.Short(v.Version), installed)
+	}
+}
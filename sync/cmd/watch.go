@@ -1,12 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 
+	"github.com/joeblew99/plat-telemetry/sync/pkg/api"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/chaos"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/httpserver"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/notify"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
 	"github.com/joeblew99/plat-telemetry/sync/pkg/webhook"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/workers"
 )
 
 // Watch starts the webhook server
@@ -16,22 +25,76 @@ func Watch() {
 		port = "8080"
 	}
 
-	server := webhook.NewServer()
+	logStart("watch", "Serving GitHub webhooks")
+
+	cfg := loadConfig()
+
+	secret, err := secrets.New("webhook secret", "WEBHOOK_SECRET", cfg.Secrets.WebhookSecretFile)
+	if err != nil {
+		fatal("Failed to load webhook secret", "err", err)
+	}
+	go secret.Watch(context.Background(), cfg.Secrets.ReloadInterval)
+
+	status.SetDaemon("watch")
+	if err := status.Load(); err != nil {
+		logger.Warn("Could not restore previous state", "err", err)
+	}
+	logFreeze()
+	ensureIdentity(cfg)
+	updater.Configure(cfg)
+	startEvents(cfg)
+	notify.Start(cfg)
+	updater.StartQueue(cfg.Queue, "watch")
+	updater.StartTrains()
+	startPromotions(cfg)
+
+	triggers := workers.New("webhook triggers", cfg.Queue.Concurrency)
+	server := webhook.NewServer(cfg.Webhook, secret, cfg.Secrets.RotationGrace, triggers)
+	mux := http.NewServeMux()
 
 	// Health check endpoint
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if err := chaos.Fail(chaos.Health); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "OK")
 	})
 
+	// Status API
+	loadAPIToken(cfg)
+	api.Register(mux)
+
 	// Webhook endpoint
-	http.HandleFunc("/webhook", server.HandleWebhook)
-	http.HandleFunc("/webhook/", server.HandleWebhook)
+	mux.HandleFunc("/webhook", server.HandleWebhook)
+	mux.HandleFunc("/webhook/", server.HandleWebhook)
 
 	addr := fmt.Sprintf(":%s", port)
-	log.Printf("▶ Webhook server listening on %s", addr)
+	srv, err := httpserver.New(addr, mux, cfg.Server)
+	if err != nil {
+		fatal("Failed to configure server", "err", err)
+	}
+	srv.RegisterOnShutdown(api.CloseStreams)
+
+	tls := "off"
+	switch {
+	case cfg.Server.TLS.ClientCAFile != "":
+		tls = "mTLS"
+	case cfg.Server.TLS.Enabled():
+		tls = "on"
+	}
+	logger.Info("Webhook server listening", "addr", addr, "tls", tls)
+
+	// Stop taking deliveries first, then let the updates they triggered finish
+	onShutdown(cfg.Queue.ShutdownTimeout,
+		shutdownStep{"webhook server", srv.Shutdown},
+		shutdownStep{"webhook triggers", triggers.Shutdown},
+		stopQueueStep(),
+		flushNotifyStep())
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatal(err)
+	if err := httpserver.ListenAndServe(srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("Webhook server failed", "err", err)
 	}
+	select {} // shutting down: onShutdown exits
 }
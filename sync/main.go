@@ -2,21 +2,121 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
 	"github.com/joeblew99/plat-telemetry/sync/cmd"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/chaos"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/i18n"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/plain"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
 )
 
 func main() {
+	// --plain (or SYNC_PLAIN=1) swaps emoji and ANSI escapes for [LEVEL]
+	// prefixes, --log-level (or LOG_LEVEL) sets the minimum level logged and
+	// --log-format (or LOG_FORMAT) picks text or json logs; they may appear
+	// anywhere on the command line
+	plain.FromEnv()
+	var logLevel, logFormat string
+	args := []string{os.Args[0]}
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case arg == "--plain" || arg == "-plain":
+			plain.Enable()
+		case logOption(arg, "log-level", &logLevel, os.Args, &i):
+		case logOption(arg, "log-format", &logFormat, os.Args, &i):
+		default:
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+
+	// Scrub secrets from everything logged, including task build output
+	redact.RegisterEnv()
+	if err := logging.Setup(redact.NewWriter(plain.NewWriter(os.Stderr)), logFormat); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if logLevel != "" {
+		if err := logging.SetLevel(logLevel); err != nil {
+			log.Fatalf("❌ --log-level: %v", err)
+		}
+	}
+
+	if err := chaos.InitFromEnv(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	// Messages follow sync.yaml's locale: and display:; commands that need
+	// the config report it if it is invalid
+	locale := ""
+	var stateErr error
+	if cfg, err := config.LoadDefault(); err == nil {
+		locale = cfg.Locale
+		revision.SetLength(cfg.Display.HashLength)
+		stateErr = state.Configure(cfg)
+	}
+	i18n.Use(i18n.Detect(locale))
+	if stateErr != nil {
+		log.Fatalf("❌ %v", stateErr)
+	}
+
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: sync <command> [args]")
+		fmt.Println("Usage: sync [--plain] [--log-level debug|info|warn|error] [--log-format text|json] <command> [args]")
 		fmt.Println("Commands:")
-		fmt.Println("  check                          Check for upstream updates")
-		fmt.Println("  poll                           Poll upstream repos for updates")
-		fmt.Println("  poll-taskfiles                 Poll Taskfiles for version changes")
+		fmt.Println("  check [subsystem] [--json]     Check for upstream updates")
+		fmt.Println("  poll [--dry-run]               Poll upstream repos for updates")
+		fmt.Println("  poll-taskfiles [--dry-run]     Poll Taskfiles for version changes")
 		fmt.Println("  watch                          Start webhook server")
-		fmt.Println("  clone <url> <path> [version]   Clone git repository")
-		fmt.Println("  pull <path>                    Pull git repository updates")
+		fmt.Println("  update <subsystem> [--dry-run] Run the update workflow now")
+		fmt.Println("  status [--json]                List queued and running updates with their ETAs")
+		fmt.Println("  events [--follow] [args]       Print a daemon's update events (--subsystem, --since, --url, --json, --cert)")
+		fmt.Println("  pending [--json]               List updates awaiting approval")
+		fmt.Println("  approve <subsystem> [args]     Apply a pending update (--dry-run)")
+		fmt.Println("  reject <subsystem>             Discard a pending update")
+		fmt.Println("  history [subsystem] [--json]   List past updates (--limit N, --at <time> for installed versions)")
+		fmt.Println("  report [subsystem] [args]      Summarize updates per subsystem (--since 90d, --until, --json, --markdown)")
+		fmt.Println("  selftest [--json]              Verify detect/build/install end to end on this host")
+		fmt.Println("  capabilities [--json]          Report what this build supports")
+		fmt.Println("  versions <subsystem> [--json]  List installed versions (* = active)")
+		fmt.Println("  verify [subsystem] [--all]     Re-hash installed binaries against their recorded SHA256")
+		fmt.Println("  builds [list|show|diff] [args] Recorded build environments; diff explains why two builds differ")
+		fmt.Println("  adopt <subsystem> [args]       Bring a manually installed binary under sync (--binary, --commit)")
+		fmt.Println("  rollback <subsystem> [args]    Switch back to a previous version (--to, --restart)")
+		fmt.Println("  render <subsystem> [args]      Render its configs from templates for the installed version (--dry-run, --restart, --json)")
+		fmt.Println("  promote <subsystem> [args]     Promote a soaked release to the next environment (--from, --to)")
+		fmt.Println("  releases [env] [--json]        List the releases promoted into each environment")
+		fmt.Println("  freeze --reason <id> [args]    Block automatic updates fleet-wide (--until <time|duration>)")
+		fmt.Println("  thaw                           Lift an update freeze")
+		fmt.Println("  audit [--json]                 List freezes, thaws and other operator actions")
+		fmt.Println("  errors [--json]                List error kinds with exit codes and remediation hints")
+		fmt.Println("  openapi                        Print the OpenAPI document of the status API")
+		fmt.Println("  gc [--dry-run] [--json]        Remove old installed versions per the gc policy")
+		fmt.Println("  delta <create|apply> [args]    Build or apply a binary patch between versions")
+		fmt.Println("  artifacts <ls|gc> [args]       Inspect or clean the deduplicated artifact store")
+		fmt.Println("  snapshot <list|restore> [args] Manage pre-update data dir snapshots")
+		fmt.Println("  ca <init|issue> [args]         Manage the built-in CA for mutual TLS")
+		fmt.Println("  internal <op> [request-json]   JSON interface for Taskfiles (sync internal ops lists the ops)")
+		fmt.Println("  clone <url> <path> [version]   Clone git repository (--recurse-submodules, --quiet)")
+		fmt.Println("  pull <path>                    Pull git repository updates (--recurse-submodules, --quiet)")
+		fmt.Println("  checkout <path> <ref>          Fetch and check out a branch, tag or commit (--recurse-submodules, --quiet)")
+		fmt.Println("  tags <subsystem|repo|url|path> List upstream tags and releases (--constraint, --prereleases, --limit, --json)")
+		fmt.Println("  diff <subsystem> [args]        List upstream commits an update would bring in (--from, --to, --limit, --json)")
+		fmt.Println("  divergence [subsystem]         Compare forked subsystems with their upstream (--merge, --json)")
+		fmt.Println("  state migrate <from-backend>   Copy the state store of another backend into state.backend's")
+		fmt.Println("  identity [--json]              Show this host's identity (created on first boot)")
+		fmt.Println("  hosts [--json]                 List the hosts registered with this controller")
+		fmt.Println("  policy <subsystem> [args]      Show which rule of policies: applies to an update now (--to, --trigger, --json)")
+		fmt.Println("  train [list|show|approve|reject] [name]  Release trains: updates collected over train.period, approved as one")
+		fmt.Println("  generate installer [args]      Write a signed bootstrap script provisioning a new host (--lockfile, --name, --labels)")
+		fmt.Println("  notify test [sink]             Post a test message to the chat channels of notify.sinks")
+		fmt.Println("  completion <bash|zsh|fish>     Print a shell completion script (subsystems, pending updates, versions)")
 		os.Exit(1)
 	}
 
@@ -24,19 +124,124 @@ func main() {
 
 	switch command {
 	case "check":
-		cmd.Check()
+		cmd.Check(os.Args[2:])
 	case "poll":
-		cmd.Poll()
+		cmd.Poll(os.Args[2:])
 	case "poll-taskfiles":
-		cmd.PollTaskfiles()
+		cmd.PollTaskfiles(os.Args[2:])
 	case "watch":
 		cmd.Watch()
+	case "update":
+		cmd.Update(os.Args[2:])
+	case "status":
+		cmd.Status(os.Args[2:])
+	case "events":
+		cmd.Events(os.Args[2:])
+	case "pending":
+		cmd.Pending(os.Args[2:])
+	case "approve":
+		cmd.Approve(os.Args[2:])
+	case "reject":
+		cmd.Reject(os.Args[2:])
+	case "history":
+		cmd.History(os.Args[2:])
+	case "report":
+		cmd.Report(os.Args[2:])
+	case "capabilities":
+		cmd.Capabilities(os.Args[2:])
+	case "selftest":
+		cmd.Selftest(os.Args[2:])
+	case "versions":
+		cmd.Versions(os.Args[2:])
+	case "verify":
+		cmd.Verify(os.Args[2:])
+	case "adopt":
+		cmd.Adopt(os.Args[2:])
+	case "rollback":
+		cmd.Rollback(os.Args[2:])
+	case "render":
+		cmd.Render(os.Args[2:])
+	case "notify":
+		cmd.Notify(os.Args[2:])
+	case "promote":
+		cmd.Promote(os.Args[2:])
+	case "releases":
+		cmd.Releases(os.Args[2:])
+	case "freeze":
+		cmd.Freeze(os.Args[2:])
+	case "thaw":
+		cmd.Thaw(os.Args[2:])
+	case "audit":
+		cmd.Audit(os.Args[2:])
+	case "errors":
+		cmd.Errors(os.Args[2:])
+	case "openapi":
+		cmd.OpenAPI(os.Args[2:])
+	case "gc":
+		cmd.GC(os.Args[2:])
+	case "artifacts":
+		cmd.Artifacts(os.Args[2:])
+	case "delta":
+		cmd.Delta(os.Args[2:])
+	case "snapshot":
+		cmd.Snapshot(os.Args[2:])
+	case "ca":
+		cmd.CA(os.Args[2:])
+	case "internal":
+		cmd.Internal(os.Args[2:])
 	case "clone":
 		cmd.Clone(os.Args[2:])
 	case "pull":
 		cmd.Pull(os.Args[2:])
+	case "checkout":
+		cmd.Checkout(os.Args[2:])
+	case "tags":
+		cmd.Tags(os.Args[2:])
+	case "diff":
+		cmd.Diff(os.Args[2:])
+	case "divergence":
+		cmd.Divergence(os.Args[2:])
+	case "state":
+		cmd.State(os.Args[2:])
+	case "identity":
+		cmd.Identity(os.Args[2:])
+	case "hosts":
+		cmd.Hosts(os.Args[2:])
+	case "policy":
+		cmd.Policy(os.Args[2:])
+	case "train":
+		cmd.Train(os.Args[2:])
+	case "builds":
+		cmd.Builds(os.Args[2:])
+	case "generate":
+		cmd.Generate(os.Args[2:])
+	case "completion":
+		cmd.Completion(os.Args[2:])
+	case "__complete":
+		cmd.Complete(os.Args[2:])
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		os.Exit(1)
 	}
 }
+
+// logOption reports whether arg is the option --name (or -name), as name=value
+// or followed by the value, which it stores in value
+func logOption(arg, name string, value *string, args []string, i *int) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+	arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if v, ok := strings.CutPrefix(arg, name+"="); ok {
+		*value = v
+		return true
+	}
+	if arg != name {
+		return false
+	}
+	if *i+1 < len(args) {
+		*i++
+		*value = args[*i]
+	}
+	return true
+}
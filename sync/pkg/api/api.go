@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/processes"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// logger logs API requests that change state or fail on the server side
+var logger = logging.For("api")
+
+func init() {
+	capabilities.Register(capabilities.Control, "status-api")
+}
+
+// Register adds the status API routes to mux
+//
+//	GET    /api/status       overall daemon health
+//	GET    /api/subsystems   per-subsystem versions, checks and last update
+//	GET    /api/queue        queued and running updates with positions and ETAs
+//	GET    /api/processes    state and health of each process of the stack
+//	GET    /api/freeze       active update freeze, if any
+//	POST   /api/freeze       freeze automatic updates (API token required)
+//	DELETE /api/freeze       lift the freeze (API token required)
+//	GET    /api/events       live update events as Server-Sent Events
+//	GET    /api/errors       error kinds with their exit codes and remediation hints
+//	GET    /api/openapi.json OpenAPI document of these routes
+//	GET    /metrics          Prometheus metrics
+func Register(mux *http.ServeMux) {
+	hub.start()
+	for _, rt := range routes() {
+		h := rt.handler
+		if rt.auth {
+			h = authorized(h.ServeHTTP)
+		}
+		mux.Handle(rt.method+" "+rt.path, h)
+	}
+}
+
+// Handler returns a mux serving only the status API and metrics
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	Register(mux)
+	return mux
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	st := status.Status()
+	code := http.StatusOK
+	if !st.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, st)
+}
+
+func handleSubsystems(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, status.Subsystems())
+}
+
+func handleQueue(w http.ResponseWriter, r *http.Request) {
+	queued, err := updater.Queued()
+	if err != nil {
+		logger.Error("Failed to read the update queue", "err", err)
+		http.Error(w, "failed to read the update queue", http.StatusInternalServerError)
+		return
+	}
+	if queued == nil {
+		queued = []updater.QueuedUpdate{}
+	}
+	writeJSON(w, http.StatusOK, queued)
+}
+
+func handleProcesses(w http.ResponseWriter, r *http.Request) {
+	list, err := processes.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func handleErrors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, syncerr.All())
+}
+
+// writeJSON encodes v as the response body, with secrets redacted
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode API response", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(redact.Bytes(data))
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+)
+
+// Tuning of GET /api/events
+const (
+	// RecentEvents is how many past events a daemon keeps for clients that
+	// connect or reconnect after they were published
+	RecentEvents = 100
+
+	// streamBuffer is how many events a slow client may fall behind before it
+	// is disconnected; it catches up on reconnect with Last-Event-ID
+	streamBuffer = 64
+
+	// keepAlive is how often an idle stream sends a comment, so proxies and
+	// load balancers don't close it
+	keepAlive = 15 * time.Second
+)
+
+// StreamedEvent is an event with its place in the daemon's event sequence,
+// sent as the id of its Server-Sent Event
+type StreamedEvent struct {
+	ID uint64 `json:"id"`
+	events.Event
+}
+
+// stream fans the daemon's events out to the connected clients
+type stream struct {
+	once    sync.Once
+	mu      sync.Mutex
+	seq     uint64
+	recent  []StreamedEvent // oldest first, at most RecentEvents
+	clients map[chan StreamedEvent]struct{}
+	closed  chan struct{}
+}
+
+var hub = &stream{clients: make(map[chan StreamedEvent]struct{}), closed: make(chan struct{})}
+
+// start subscribes the stream to the event bus, once per process
+func (s *stream) start() {
+	s.once.Do(func() { events.Subscribe(s.publish) })
+}
+
+func (s *stream) publish(e events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	se := StreamedEvent{ID: s.seq, Event: e}
+	s.recent = append(s.recent, se)
+	if len(s.recent) > RecentEvents {
+		s.recent = s.recent[len(s.recent)-RecentEvents:]
+	}
+
+	// Never block Publish: a client too slow to keep up is dropped instead
+	for ch := range s.clients {
+		select {
+		case ch <- se:
+		default:
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the kept events after id and a channel of those that follow
+func (s *stream) subscribe(after uint64) ([]StreamedEvent, chan StreamedEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// An ID from before the daemon restarted: everything kept is new
+	if after > s.seq {
+		after = 0
+	}
+	var missed []StreamedEvent
+	for _, se := range s.recent {
+		if se.ID > after {
+			missed = append(missed, se)
+		}
+	}
+	ch := make(chan StreamedEvent, streamBuffer)
+	s.clients[ch] = struct{}{}
+	return missed, ch
+}
+
+func (s *stream) unsubscribe(ch chan StreamedEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[ch]; ok {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+// CloseStreams ends every open event stream
+// Register it with http.Server.RegisterOnShutdown: Shutdown waits for active
+// requests, which a stream never stops being on its own.
+func CloseStreams() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	select {
+	case <-hub.closed:
+	default:
+		close(hub.closed)
+	}
+}
+
+// handleEvents streams the daemon's events as Server-Sent Events
+// Clients resume with the Last-Event-ID header (or ?since=) and get the kept
+// events they missed first; ?follow=false returns the kept events and closes.
+// With ?format=cloudevents each event's data is a CloudEvent.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since := r.Header.Get("Last-Event-ID")
+	if s := q.Get("since"); s != "" {
+		since = s
+	}
+	var after uint64
+	if since != "" {
+		n, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid event ID %q", since), http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+	follow := true
+	if f := q.Get("follow"); f != "" {
+		b, err := strconv.ParseBool(f)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid follow %q", f), http.StatusBadRequest)
+			return
+		}
+		follow = b
+	}
+	subsystem := q.Get("subsystem")
+	cloud := false
+	switch format := q.Get("format"); format {
+	case "", config.EventFormatJSON:
+	case config.EventFormatCloudEvents:
+		cloud = true
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	// The server's write timeout is meant for ordinary responses
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	missed, ch := hub.subscribe(after)
+	defer hub.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: don't buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	send := func(se StreamedEvent) bool {
+		if subsystem != "" && se.Subsystem != subsystem {
+			return true
+		}
+		var v any = se
+		if cloud {
+			v = se.Cloud(se.Event)
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			logger.Error("Failed to encode event", "err", err)
+			return true
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", se.ID, se.Type, redact.Bytes(data))
+		return err == nil
+	}
+
+	for _, se := range missed {
+		if !send(se) {
+			return
+		}
+	}
+	rc.Flush()
+	if !follow {
+		return
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case se, ok := <-ch:
+			if !ok {
+				return // fell behind; the client resumes from its last ID
+			}
+			if !send(se) {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-hub.closed:
+			return
+		}
+		rc.Flush()
+	}
+}
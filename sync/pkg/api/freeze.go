@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+)
+
+// FreezeStatus is the response of the freeze endpoints
+type FreezeStatus struct {
+	Frozen bool           `json:"frozen"`
+	Freeze *freeze.Freeze `json:"freeze,omitempty"`
+}
+
+// FreezeRequest is the body of POST /api/freeze
+type FreezeRequest struct {
+	Reason string    `json:"reason"`         // e.g. the incident ID
+	Until  time.Time `json:"until,omitzero"` // zero: until thawed
+	Actor  string    `json:"actor"`          // who to record in the audit log, with the client address
+}
+
+var (
+	tokenMu sync.RWMutex
+	token   *secrets.Secret
+)
+
+// SetToken sets the bearer token that authorizes API writes
+// Without one, write endpoints are disabled.
+func SetToken(t *secrets.Secret) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	token = t
+}
+
+// authorized rejects requests without the API bearer token
+func authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenMu.RLock()
+		t := token
+		tokenMu.RUnlock()
+
+		want := ""
+		if t != nil {
+			want = t.Get()
+		}
+		if want == "" {
+			http.Error(w, "API writes disabled: no API token configured", http.StatusForbidden)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func handleGetFreeze(w http.ResponseWriter, r *http.Request) {
+	f, active, err := freeze.Current()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, freezeStatus(f, active))
+}
+
+func handleFreeze(w http.ResponseWriter, r *http.Request) {
+	var req FreezeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f, err := freeze.Set(req.Reason, req.Until, actor(r, req.Actor))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Info("Updates frozen", "freeze", f)
+	writeJSON(w, http.StatusCreated, freezeStatus(f, true))
+}
+
+func handleThaw(w http.ResponseWriter, r *http.Request) {
+	by := actor(r, r.URL.Query().Get("actor"))
+	f, lifted, err := freeze.Thaw(by)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if lifted {
+		logger.Info("Updates thawed", "lifted", f.Reason, "by", by)
+	}
+	writeJSON(w, http.StatusOK, FreezeStatus{Frozen: false})
+}
+
+// actor names who made an API change for the audit log
+func actor(r *http.Request, given string) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if given == "" {
+		given = "api"
+	}
+	return given + " via API from " + host
+}
+
+func freezeStatus(f freeze.Freeze, active bool) FreezeStatus {
+	if !active {
+		return FreezeStatus{}
+	}
+	return FreezeStatus{Frozen: true, Freeze: &f}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/processes"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Version is the version of the status API contract in the OpenAPI document
+// New routes and fields bump the minor version; removing or changing one bumps
+// the major version.
+const Version = "1.2.0"
+
+// route is an endpoint of the status API: Register serves it and OpenAPI
+// describes it, so the document can't drift from the mux
+type route struct {
+	method, path string
+	id, summary  string // operationId and summary in the document
+	handler      http.Handler
+	auth         bool              // needs the API token
+	query        map[string]string // query parameters and what they do
+	body         any               // JSON request body
+	response     any               // JSON response body; nil for plain text
+	stream       any               // Server-Sent Events data instead of a response body
+	codes        []int             // status codes returning response, success first
+	errors       []int             // status codes returning a plain text error
+}
+
+func routes() []route {
+	return []route{
+		{method: "GET", path: "/api/status", id: "getStatus", summary: "Overall daemon health",
+			handler: http.HandlerFunc(handleStatus), response: status.Daemon{}, codes: []int{200, 503}},
+		{method: "GET", path: "/api/subsystems", id: "listSubsystems", summary: "Per-subsystem versions, checks and last update",
+			handler: http.HandlerFunc(handleSubsystems), response: []status.Subsystem{}, codes: []int{200}},
+		{method: "GET", path: "/api/queue", id: "listQueue", summary: "Queued and running updates with positions and ETAs",
+			handler: http.HandlerFunc(handleQueue), response: []updater.QueuedUpdate{}, codes: []int{200}, errors: []int{500}},
+		{method: "GET", path: "/api/processes", id: "listProcesses", summary: "State and health of each process of the stack (from process-compose)",
+			handler: http.HandlerFunc(handleProcesses), response: []processes.Process{}, codes: []int{200}, errors: []int{503}},
+		{method: "GET", path: "/api/freeze", id: "getFreeze", summary: "Active update freeze, if any",
+			handler: http.HandlerFunc(handleGetFreeze), response: FreezeStatus{}, codes: []int{200}, errors: []int{500}},
+		{method: "POST", path: "/api/freeze", id: "setFreeze", summary: "Freeze automatic updates",
+			handler: http.HandlerFunc(handleFreeze), auth: true, body: FreezeRequest{},
+			response: FreezeStatus{}, codes: []int{201}, errors: []int{400, 401, 403}},
+		{method: "DELETE", path: "/api/freeze", id: "thaw", summary: "Lift the update freeze",
+			handler: http.HandlerFunc(handleThaw), auth: true, query: map[string]string{"actor": "Who to record in the audit log"},
+			response: FreezeStatus{}, codes: []int{200}, errors: []int{401, 403, 500}},
+		{method: "GET", path: "/api/events", id: "streamEvents", summary: "Live update events as Server-Sent Events",
+			handler: http.HandlerFunc(handleEvents), stream: StreamedEvent{}, codes: []int{200}, errors: []int{400},
+			query: map[string]string{
+				"subsystem": "Only events of this subsystem",
+				"since":     "Start after this event ID instead of the Last-Event-ID header",
+				"follow":    "false: return the kept events and close instead of streaming",
+				"format":    "cloudevents: send each event as a CloudEvents 1.0 event (structured mode) carrying it",
+			}},
+		{method: "GET", path: "/api/errors", id: "listErrors", summary: "Error kinds with their exit codes and remediation hints",
+			handler: http.HandlerFunc(handleErrors), response: []syncerr.Info{}, codes: []int{200}},
+		{method: "GET", path: "/api/openapi.json", id: "getOpenAPI", summary: "This OpenAPI document",
+			handler: http.HandlerFunc(handleOpenAPI), response: map[string]any{}, codes: []int{200}},
+		{method: "GET", path: "/metrics", id: "getMetrics", summary: "Prometheus metrics",
+			handler: metrics.Handler(), codes: []int{200}},
+	}
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, OpenAPI())
+}
+
+// OpenAPI returns the OpenAPI 3.1 document of the status API, generated from
+// the routes and the Go types they encode
+func OpenAPI() map[string]any {
+	s := &schemas{defs: make(map[string]any), types: make(map[string]reflect.Type)}
+	paths := make(map[string]map[string]any)
+	for _, rt := range routes() {
+		if paths[rt.path] == nil {
+			paths[rt.path] = make(map[string]any)
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = s.operation(rt)
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "sync status API",
+			"version":     Version,
+			"description": "Sync state of a plat-telemetry sync daemon, and update freezes. Write endpoints need the API token as a bearer token.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": s.defs,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// operation describes a route
+func (s *schemas) operation(rt route) map[string]any {
+	responses := make(map[string]any)
+	for _, code := range rt.codes {
+		content := map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}
+		switch {
+		case rt.response != nil:
+			content = map[string]any{"application/json": map[string]any{"schema": s.of(reflect.TypeOf(rt.response))}}
+		case rt.stream != nil:
+			content = map[string]any{"text/event-stream": map[string]any{"schema": s.of(reflect.TypeOf(rt.stream))}}
+		}
+		responses[strconv.Itoa(code)] = map[string]any{"description": http.StatusText(code), "content": content}
+	}
+	for _, code := range rt.errors {
+		responses[strconv.Itoa(code)] = map[string]any{
+			"description": http.StatusText(code),
+			"content":     map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}},
+		}
+	}
+
+	op := map[string]any{"operationId": rt.id, "summary": rt.summary, "responses": responses}
+	if rt.auth {
+		op["security"] = []any{map[string]any{"bearer": []string{}}}
+	}
+	if rt.body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": s.of(reflect.TypeOf(rt.body))}},
+		}
+	}
+	if len(rt.query) > 0 {
+		names := make([]string, 0, len(rt.query))
+		for name := range rt.query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		params := make([]any, 0, len(names))
+		for _, name := range names {
+			params = append(params, map[string]any{
+				"name": name, "in": "query", "description": rt.query[name],
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		op["parameters"] = params
+	}
+	return op
+}
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	durationType = reflect.TypeFor[time.Duration]()
+	kindType     = reflect.TypeFor[syncerr.Kind]()
+)
+
+// schemaNames names the components whose Go names say too little outside their
+// package
+var schemaNames = map[reflect.Type]string{
+	reflect.TypeFor[history.Entry](): "HistoryEntry",
+	reflect.TypeFor[syncerr.Info]():  "ErrorInfo",
+	kindType:                         "ErrorKind",
+}
+
+// schemas collects the component schemas of the Go types a document refers to
+type schemas struct {
+	defs  map[string]any
+	types map[string]reflect.Type // which type took each name
+}
+
+// of returns the JSON schema of t as encoding/json encodes it; structs and
+// error kinds become components referred to by name
+func (s *schemas) of(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "integer", "format": "int64", "description": "Nanoseconds"}
+	case kindType:
+		return s.ref(t, func() map[string]any {
+			var kinds []string
+			for _, info := range syncerr.All() {
+				kinds = append(kinds, string(info.Kind))
+			}
+			return map[string]any{"type": "string", "enum": kinds, "description": "Error kind, see GET /api/errors"}
+		})
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		return s.ref(t, func() map[string]any { return s.object(t) })
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// ref adds the schema of the named type t to the components, once, and
+// returns a reference to it
+// Types of the same name in different packages get the package as a prefix.
+func (s *schemas) ref(t reflect.Type, schema func() map[string]any) map[string]any {
+	name, ok := schemaNames[t]
+	if !ok {
+		name = t.Name()
+	}
+	if other, ok := s.types[name]; ok && other != t {
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	if _, ok := s.types[name]; !ok {
+		s.types[name] = t
+		s.defs[name] = schema()
+	}
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// object returns the schema of a struct: its JSON fields, with those encoded
+// even when empty required
+func (s *schemas) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	var required []string
+	s.fields(t, props, &required)
+
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fields adds the JSON fields of struct t to props, flattening embedded
+// structs the way encoding/json does
+func (s *schemas) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			s.fields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.of(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
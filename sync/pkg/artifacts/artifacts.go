@@ -0,0 +1,294 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/filelock"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+func init() {
+	capabilities.Register(capabilities.Packaging, "content-addressed-store")
+}
+
+// Layout inside the data dir
+//
+//	artifacts/sha256/<digest>   one read-only blob per distinct file content
+//	artifacts/.lock             serializes Put and GC across sync processes
+//
+// Installed files are hard links to their blob, so identical binaries in
+// several subsystems or versions take the space of one.
+const (
+	storeDir = "artifacts"
+	blobDir  = "sha256"
+	lockFile = ".lock"
+)
+
+// Ref is an installed file that uses a blob
+type Ref struct {
+	Subsystem string `json:"subsystem"`
+	Version   string `json:"version"`
+	File      string `json:"file"`
+	Path      string `json:"path"` // installed file, relative to the project root
+}
+
+// String returns <subsystem>@<version>/<file>
+func (r Ref) String() string {
+	return r.Subsystem + "@" + r.Version + "/" + r.File
+}
+
+// key is the state store key of a reference: <digest>/<subsystem>/<version>/<file>
+// One key per reference keeps the count correct when processes add refs concurrently.
+func (r Ref) key(digest string) string {
+	return digest + "/" + r.Subsystem + "/" + r.Version + "/" + r.File
+}
+
+// Artifact is a blob in the store and the installed files referencing it
+type Artifact struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+	Refs   []Ref  `json:"refs"`
+}
+
+// Dir returns <data dir>/artifacts
+func Dir() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, storeDir), nil
+}
+
+// Put stores the file at path by digest and replaces it with a hard link to the blob
+// If a blob with the same content exists, the file's own copy is dropped.
+// The store must be on the same filesystem as path.
+func Put(path string, ref Ref) (string, error) {
+	digest, err := Digest(path)
+	if err != nil {
+		return "", err
+	}
+	h, err := lock()
+	if err != nil {
+		return "", err
+	}
+	defer h.Release()
+
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	blob := filepath.Join(dir, blobDir, digest)
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return "", fmt.Errorf("failed to create artifact store: %w", err)
+	}
+
+	// Record the reference first, so GC never sees a linked blob without one
+	if err := state.Put(state.BucketArtifacts, ref.key(digest), ref); err != nil {
+		return "", err
+	}
+	if err := link(path, blob); err != nil {
+		state.Delete(state.BucketArtifacts, ref.key(digest))
+		return "", err
+	}
+	return digest, nil
+}
+
+// link makes path and blob the same file, keeping an existing blob
+func link(path, blob string) error {
+	if _, err := os.Stat(blob); os.IsNotExist(err) {
+		if err := os.Link(path, blob); err != nil {
+			return fmt.Errorf("failed to store %s: %w", filepath.Base(path), err)
+		}
+	} else {
+		if same(path, blob) {
+			return nil
+		}
+		tmp := path + ".link"
+		os.Remove(tmp)
+		if err := os.Link(blob, tmp); err != nil {
+			return fmt.Errorf("failed to link %s: %w", filepath.Base(path), err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to link %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	// Writing through one link would change every file sharing the blob
+	info, err := os.Stat(blob)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(blob, info.Mode().Perm()&^0222)
+}
+
+// Release drops the references held by an installed version
+func Release(subsystem, version string) error {
+	refs, err := refs()
+	if err != nil {
+		return err
+	}
+	for digest, list := range refs {
+		for _, r := range list {
+			if r.Subsystem == subsystem && r.Version == version {
+				if _, err := state.Delete(state.BucketArtifacts, r.key(digest)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the blobs in the store, largest first
+func List() ([]Artifact, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, blobDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	refs, err := refs()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Artifact, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		list = append(list, Artifact{Digest: e.Name(), Size: info.Size(), Refs: refs[e.Name()]})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Digest < list[j].Digest
+	})
+	return list, nil
+}
+
+// GC removes blobs no installed file references and reports them
+// References whose file was deleted or replaced outside sync are dropped
+// first. With dryRun, nothing is deleted.
+func GC(dryRun bool) ([]Artifact, error) {
+	h, err := lock()
+	if err != nil {
+		return nil, err
+	}
+	defer h.Release()
+
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Artifact
+	for _, a := range list {
+		blob := filepath.Join(dir, blobDir, a.Digest)
+		live := 0
+		for _, r := range a.Refs {
+			if same(filepath.Join(root, r.Path), blob) {
+				live++
+				continue
+			}
+			if !dryRun {
+				if _, err := state.Delete(state.BucketArtifacts, r.key(a.Digest)); err != nil {
+					return removed, err
+				}
+			}
+		}
+		if live > 0 {
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(blob); err != nil {
+				return removed, fmt.Errorf("failed to remove artifact %s: %w", a.Digest, err)
+			}
+		}
+		removed = append(removed, a)
+	}
+	return removed, nil
+}
+
+// refs returns the recorded references by digest
+func refs() (map[string][]Ref, error) {
+	out := make(map[string][]Ref)
+	err := state.ForEach(state.BucketArtifacts, func(key string, data []byte) error {
+		digest, _, _ := strings.Cut(key, "/")
+		var r Ref
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		out[digest] = append(out[digest], r)
+		return nil
+	})
+	return out, err
+}
+
+// lock takes the store lock
+func lock() (*filelock.Handle, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	h, err := filelock.Acquire(filepath.Join(dir, lockFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock artifact store: %w", err)
+	}
+	return h, nil
+}
+
+// same reports whether a and b are the same file on disk
+func same(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
+
+// Digest returns the hex SHA256 of a file's content
+func Digest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// Audited actions
+const (
+	ActionFreeze  = "freeze"
+	ActionThaw    = "thaw"
+	ActionPromote = "promote"
+	ActionAdopt   = "adopt"
+	ActionTrain   = "train"
+	ActionScan    = "scan" // a scanner's verdict on a new build
+)
+
+// Entry is an operator action recorded in the audit log
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"`            // user@host, or the remote source of the action
+	Host   string    `json:"host,omitempty"`   // identity of the host that recorded it, see pkg/identity
+	Detail string    `json:"detail,omitempty"` // e.g. the freeze reason
+}
+
+// keyFormat gives fixed-width UTC keys so the store iterates in time order
+const keyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Append records an action in the audit log
+func Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Host == "" {
+		e.Host = identity.ID()
+	}
+	e.Detail = redact.String(e.Detail)
+	return state.Put(state.BucketAudit, e.Time.UTC().Format(keyFormat)+"/"+e.Action, e)
+}
+
+// Load returns the audit log, oldest first
+func Load() ([]Entry, error) {
+	var entries []Entry
+	err := state.ForEach(state.BucketAudit, func(key string, data []byte) error {
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("audit entry %s: %w", key, err)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// Actor returns user@host for actions taken on this machine
+func Actor() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
@@ -0,0 +1,328 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+func init() {
+	capabilities.Register(capabilities.Packaging, "snapshot-copy", "snapshot-tar")
+}
+
+// nameFormat names snapshots by creation time so they sort chronologically
+const nameFormat = "20060102T150405.000Z"
+
+// tarSuffix marks snapshots stored as gzip-compressed tarballs
+const tarSuffix = ".tar.gz"
+
+// Snapshot is a stored copy of a subsystem data dir
+type Snapshot struct {
+	Subsystem string    `json:"subsystem"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Time      time.Time `json:"time"`
+}
+
+// Dir returns where snapshots of a subsystem are kept: <DataDir>/backups/<subsystem>
+func Dir(subsystem string) (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "backups", subsystem), nil
+}
+
+// Create copies src into a new snapshot directory and returns its path
+// A missing src is stored as an empty snapshot so Restore can still clear it.
+func Create(subsystem, src string) (string, error) {
+	dst, err := newPath(subsystem, "")
+	if err != nil {
+		return "", err
+	}
+	if err := copyDir(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return "", fmt.Errorf("failed to back up %s: %w", src, err)
+	}
+	return dst, nil
+}
+
+// CreateTar archives src into a new .tar.gz snapshot and returns its path
+func CreateTar(subsystem, src string) (string, error) {
+	dst, err := newPath(subsystem, tarSuffix)
+	if err != nil {
+		return "", err
+	}
+	if err := writeTar(src, dst); err != nil {
+		os.Remove(dst)
+		return "", fmt.Errorf("failed to archive %s: %w", src, err)
+	}
+	return dst, nil
+}
+
+// Restore replaces dst with the contents of a snapshot
+func Restore(snapshot, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return fmt.Errorf("failed to clear %s: %w", dst, err)
+	}
+
+	var err error
+	if strings.HasSuffix(snapshot, tarSuffix) {
+		err = extractTar(snapshot, dst)
+	} else {
+		err = copyDir(snapshot, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore %s from %s: %w", dst, snapshot, err)
+	}
+	return nil
+}
+
+// List returns the snapshots of a subsystem, newest first
+func List(subsystem string) ([]Snapshot, error) {
+	dir, err := Dir(subsystem)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, e := range entries {
+		t, err := time.Parse(nameFormat, strings.TrimSuffix(e.Name(), tarSuffix))
+		if err != nil {
+			continue // not a snapshot
+		}
+		snapshots = append(snapshots, Snapshot{
+			Subsystem: subsystem,
+			Name:      e.Name(),
+			Path:      filepath.Join(dir, e.Name()),
+			Time:      t,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Prune deletes all but the newest keep snapshots of a subsystem and returns the removed ones
+func Prune(subsystem string, keep int) ([]Snapshot, error) {
+	snapshots, err := List(subsystem)
+	if err != nil || len(snapshots) <= keep {
+		return nil, err
+	}
+
+	removed := snapshots[keep:]
+	for _, s := range removed {
+		if err := os.RemoveAll(s.Path); err != nil {
+			return nil, fmt.Errorf("failed to remove snapshot %s: %w", s.Path, err)
+		}
+	}
+	return removed, nil
+}
+
+// newPath returns a fresh snapshot path for subsystem, creating its directory
+func newPath(subsystem, suffix string) (string, error) {
+	dir, err := Dir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup dir: %w", err)
+	}
+	return filepath.Join(dir, time.Now().UTC().Format(nameFormat)+suffix), nil
+}
+
+// copyDir recursively copies src to dst, preserving file modes and symlinks
+func copyDir(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return os.MkdirAll(dst, 0755)
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return writeFile(target, f, info.Mode().Perm())
+		default:
+			return nil // sockets, pipes and devices are not backed up
+		}
+	})
+}
+
+// writeTar archives src into a gzip-compressed tarball at dst
+func writeTar(src, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	if _, err := os.Stat(src); err == nil {
+		err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil || rel == "." {
+				return err
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+				return nil // sockets, pipes and devices are not backed up
+			}
+
+			var link string
+			if d.Type()&fs.ModeSymlink != 0 {
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			}
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(rel)
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+
+			if d.Type().IsRegular() {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				_, err = io.Copy(tw, f)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// extractTar unpacks a gzip-compressed tarball into dst
+func extractTar(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in snapshot: %s", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeFile writes the contents of r to a new file at path
+func writeFile(path string, r io.Reader, mode fs.FileMode) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
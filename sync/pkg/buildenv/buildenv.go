@@ -0,0 +1,283 @@
+// Package buildenv records the environment each source build ran in (the
+// toolchain versions, the build variables and the OS image), so two builds
+// of the same commit that differ can be explained
+package buildenv
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// timeout bounds each toolchain command run to capture the environment
+const timeout = 10 * time.Second
+
+// goSettings are the go env settings that change what go build produces
+var goSettings = []string{
+	"GOVERSION", "GOTOOLCHAIN", "GOOS", "GOARCH", "GOAMD64", "GOARM", "GOARM64", "GO386",
+	"CGO_ENABLED", "CC", "CXX", "CGO_CFLAGS", "CGO_LDFLAGS", "GOFLAGS", "GOEXPERIMENT",
+	"GOROOT", "GOPROXY", "GOPRIVATE", "GONOSUMDB", "GOSUMDB", "GOWORK",
+}
+
+// buildVars are the variables recorded from a build's environment besides
+// GO* and CGO_*
+var buildVars = []string{
+	"CC", "CXX", "CFLAGS", "CXXFLAGS", "LDFLAGS", "PKG_CONFIG_PATH",
+	"SOURCE_DATE_EPOCH", "SUBSYSTEM", "SYNC_RELEASE", "PATH",
+}
+
+// tools are the commands whose versions are recorded, with the arguments
+// printing them
+var tools = map[string][]string{
+	"go":   {"version"},
+	"task": {"--version"},
+	"git":  {"--version"},
+	"cc":   {"--version"},
+}
+
+// Build is the environment of one source build of a subsystem
+type Build struct {
+	ID        string      `json:"id"` // <subsystem>-<time>, e.g. nats-20240603T101500Z
+	Subsystem string      `json:"subsystem"`
+	Version   string      `json:"version"` // commit the build installed
+	Trigger   string      `json:"trigger,omitempty"`
+	Time      time.Time   `json:"time"`
+	Host      string      `json:"host"`
+	Env       Environment `json:"environment"`
+}
+
+// Environment is what a build ran with
+type Environment struct {
+	OS       string            `json:"os"`                // OS image, e.g. Ubuntu 22.04.4 LTS
+	Kernel   string            `json:"kernel,omitempty"`  // e.g. 6.8.0-35-generic
+	Platform string            `json:"platform"`          // os/arch of the building host
+	Tools    map[string]string `json:"tools"`             // version of go, task, git and cc; missing ones are left out
+	Go       map[string]string `json:"go,omitempty"`      // go env settings affecting the output
+	Vars     map[string]string `json:"vars,omitempty"`    // GO*, CGO_*, compiler flags and PATH as set for the build
+	Modules  string            `json:"modules,omitempty"` // SHA256 of the source's go.sum
+}
+
+// Difference is one field of the environments of two builds that differs
+type Difference struct {
+	Field string `json:"field"` // e.g. tools.go, go.CGO_ENABLED, vars.PATH
+	A     string `json:"a"`     // "" when unset
+	B     string `json:"b"`
+}
+
+// Capture records the environment of a build run in dir with env
+// Secrets in the recorded values are redacted. Commands that fail leave
+// their fields empty rather than failing the capture.
+func Capture(dir string, env []string) Environment {
+	e := Environment{
+		OS:       osImage(),
+		Kernel:   output(dir, env, "uname", "-r"),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		Tools:    make(map[string]string),
+		Vars:     make(map[string]string),
+	}
+	for name, args := range tools {
+		if v := firstLine(output(dir, env, name, args...)); v != "" {
+			e.Tools[name] = redact.String(v)
+		}
+	}
+	if data := output(dir, env, "go", append([]string{"env", "-json"}, goSettings...)...); data != "" {
+		if err := json.Unmarshal([]byte(data), &e.Go); err == nil {
+			for k, v := range e.Go {
+				if v == "" {
+					delete(e.Go, k)
+				} else {
+					e.Go[k] = redact.String(v)
+				}
+			}
+		}
+	}
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && (strings.HasPrefix(name, "GO") || strings.HasPrefix(name, "CGO_") || slices.Contains(buildVars, name)) {
+			e.Vars[name] = redact.String(value)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "go.sum")); err == nil {
+		e.Modules = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
+	return e
+}
+
+// output runs a command and returns its trimmed output, or "" if it fails
+func output(dir string, env []string, name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	if _, err := os.Stat(dir); err == nil {
+		cmd.Dir = dir
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(line)
+}
+
+// osImage names the host's OS release, e.g. "Ubuntu 22.04.4 LTS" from
+// /etc/os-release or "macOS 14.5" from sw_vers
+func osImage() string {
+	switch runtime.GOOS {
+	case "darwin":
+		if v := output("", nil, "sw_vers", "-productVersion"); v != "" {
+			return "macOS " + v
+		}
+	case "linux":
+		f, err := os.Open("/etc/os-release")
+		if err != nil {
+			break
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if v, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+				return strings.Trim(v, `"`)
+			}
+		}
+	}
+	return runtime.GOOS
+}
+
+// Diff returns the fields in which the environments of a and b differ,
+// sorted by field
+func Diff(a, b Environment) []Difference {
+	fa, fb := a.fields(), b.fields()
+	names := make([]string, 0, len(fa)+len(fb))
+	for name := range fa {
+		names = append(names, name)
+	}
+	for name := range fb {
+		if _, ok := fa[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []Difference
+	for _, name := range names {
+		if fa[name] != fb[name] {
+			diffs = append(diffs, Difference{Field: name, A: fa[name], B: fb[name]})
+		}
+	}
+	return diffs
+}
+
+// fields flattens the environment into dotted field names, e.g. tools.go
+func (e Environment) fields() map[string]string {
+	f := map[string]string{"os": e.OS, "kernel": e.Kernel, "platform": e.Platform, "modules": e.Modules}
+	for prefix, m := range map[string]map[string]string{"tools": e.Tools, "go": e.Go, "vars": e.Vars} {
+		for k, v := range m {
+			f[prefix+"."+k] = v
+		}
+	}
+	for k, v := range f {
+		if v == "" {
+			delete(f, k)
+		}
+	}
+	return f
+}
+
+// Record keeps a build in the state store
+func Record(b Build) error {
+	if b.ID == "" {
+		b.ID = b.Subsystem + "-" + b.Time.UTC().Format("20060102T150405Z")
+	}
+	if err := state.Put(state.BucketBuilds, b.ID, b); err != nil {
+		return fmt.Errorf("failed to record the build environment of %s: %w", b.Subsystem, err)
+	}
+	return nil
+}
+
+// List returns the recorded builds of a subsystem, or of all with "",
+// newest first
+func List(subsystem string) ([]Build, error) {
+	var builds []Build
+	err := state.ForEach(state.BucketBuilds, func(key string, data []byte) error {
+		var b Build
+		if err := json.Unmarshal(data, &b); err != nil {
+			return fmt.Errorf("build %s: %w", key, err)
+		}
+		if subsystem == "" || b.Subsystem == subsystem {
+			builds = append(builds, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded builds: %w", err)
+	}
+	sort.SliceStable(builds, func(i, j int) bool { return builds[i].Time.After(builds[j].Time) })
+	return builds, nil
+}
+
+// Find returns the build ref names: a build ID, <subsystem> for its newest
+// build, <subsystem>@<version> for the newest build of a version (a commit
+// hash prefix will do), or a file holding a build as `sync builds show
+// --json` prints it, e.g. copied from another host
+func Find(ref string) (Build, error) {
+	var b Build
+	if data, err := os.ReadFile(ref); err == nil {
+		if err := json.Unmarshal(data, &b); err != nil {
+			return b, fmt.Errorf("%s is not a build: %w", ref, err)
+		}
+		if b.Subsystem == "" {
+			return b, fmt.Errorf("%s is not a build: no subsystem", ref)
+		}
+		return b, nil
+	}
+
+	found, err := state.Get(state.BucketBuilds, ref, &b)
+	if err != nil {
+		return b, fmt.Errorf("failed to read build %s: %w", ref, err)
+	}
+	if found {
+		return b, nil
+	}
+
+	subsystem, version, _ := strings.Cut(ref, "@")
+	builds, err := List(subsystem)
+	if err != nil {
+		return b, err
+	}
+	for _, b := range builds {
+		if version == "" || strings.HasPrefix(b.Version, version) {
+			return b, nil
+		}
+	}
+	if version != "" {
+		return b, fmt.Errorf("no recorded build of %s version %s", subsystem, version)
+	}
+	return b, fmt.Errorf("no recorded build %s (builds are recorded from the next source build)", ref)
+}
+
+// Summary returns e.g. "go1.22.4 on Ubuntu 22.04.4 LTS (linux/amd64)"
+func (e Environment) Summary() string {
+	s := fmt.Sprintf("%s (%s)", e.OS, e.Platform)
+	if v := e.Go["GOVERSION"]; v != "" {
+		s = v + " on " + s
+	}
+	return s
+}
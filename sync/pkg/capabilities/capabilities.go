@@ -0,0 +1,92 @@
+package capabilities
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Capability kinds
+const (
+	Provider  = "providers" // where upstream versions come from
+	Notifier  = "notifiers" // where update events are sent
+	Packaging = "packaging" // install and snapshot formats
+	Control   = "control"   // ways to observe or drive sync
+	Storage   = "storage"   // state store backends
+)
+
+// kinds lists every capability kind, in report order
+var kinds = []string{Provider, Notifier, Packaging, Control, Storage}
+
+var (
+	mu         sync.Mutex
+	registered = make(map[string]map[string]bool)
+)
+
+// Report describes what this sync build supports
+type Report struct {
+	Version   string              `json:"version"`
+	Commit    string              `json:"commit,omitempty"`
+	GoVersion string              `json:"goVersion"`
+	OS        string              `json:"os"`
+	Arch      string              `json:"arch"`
+	Tags      []string            `json:"tags,omitempty"` // build tags, e.g. nonats,nometrics
+	Supports  map[string][]string `json:"supports"`       // kind -> names, sorted
+}
+
+// Register records that this build supports name under kind
+// Feature packages call it from init(), so features compiled out of a build
+// (e.g. by build tags) are absent from the report.
+func Register(kind string, names ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if registered[kind] == nil {
+		registered[kind] = make(map[string]bool)
+	}
+	for _, name := range names {
+		registered[kind][name] = true
+	}
+}
+
+// Get returns the capability report for this build
+func Get() Report {
+	r := Report{
+		Version:   "(devel)",
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Supports:  make(map[string][]string),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			r.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision":
+				r.Commit = s.Value
+			case s.Key == "-tags" && s.Value != "":
+				r.Tags = strings.Split(s.Value, ",")
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, kind := range kinds {
+		names := make([]string, 0, len(registered[kind]))
+		for name := range registered[kind] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		r.Supports[kind] = names
+	}
+	return r
+}
+
+// Kinds returns the capability kinds in report order
+func Kinds() []string {
+	return kinds
+}
@@ -0,0 +1,89 @@
+package chaos
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+)
+
+// logger logs the failures chaos mode injects
+var logger = logging.For("chaos")
+
+// Injection points
+const (
+	Provider = "provider" // GitHub API requests
+	Build    = "build"    // task sync:update runs
+	Health   = "health"   // health checks (/health and post-update)
+)
+
+// EnvVar enables chaos mode, e.g. SYNC_CHAOS=provider=0.2,build=0.5
+// Deliberately undocumented in the CLI usage: this is for operators verifying
+// that rollback, alerting and queue behavior work, never for production.
+const EnvVar = "SYNC_CHAOS"
+
+var (
+	mu    sync.RWMutex
+	rates map[string]float64
+)
+
+// InitFromEnv enables chaos mode from SYNC_CHAOS if set
+func InitFromEnv() error {
+	spec := os.Getenv(EnvVar)
+	if spec == "" {
+		return nil
+	}
+	return Init(spec)
+}
+
+// Init parses a spec of point=rate pairs (rate between 0 and 1)
+func Init(spec string) error {
+	parsed := make(map[string]float64)
+	for _, part := range strings.Split(spec, ",") {
+		point, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return fmt.Errorf("invalid chaos spec %q (want point=rate)", part)
+		}
+		switch point {
+		case Provider, Build, Health:
+		default:
+			return fmt.Errorf("unknown chaos point %q (want %s, %s or %s)", point, Provider, Build, Health)
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid chaos rate %q for %s (want 0..1)", value, point)
+		}
+		parsed[point] = rate
+	}
+
+	mu.Lock()
+	rates = parsed
+	mu.Unlock()
+
+	points := make([]string, 0, len(parsed))
+	for point, rate := range parsed {
+		points = append(points, fmt.Sprintf("%s=%.0f%%", point, rate*100))
+	}
+	sort.Strings(points)
+	logger.Warn("CHAOS MODE enabled: injecting failures", "points", strings.Join(points, ", "))
+	return nil
+}
+
+// Fail returns an injected error for point at its configured rate, or nil
+func Fail(point string) error {
+	mu.RLock()
+	rate := rates[point]
+	mu.RUnlock()
+
+	if rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+
+	logger.Error("Chaos: injecting failure", "point", point)
+	return fmt.Errorf("chaos: injected %s failure", point)
+}
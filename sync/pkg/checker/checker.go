@@ -1,68 +1,156 @@
 package checker
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
 )
 
 // CheckVersion checks if a subsystem has updates available
-// Returns: current version, latest version, error
-func CheckVersion(subsystem string) (string, string, error) {
-	// Find project root - sync binary is in sync/.bin/, so go up 2 levels
-	// From: /path/to/project/sync/.bin/sync
-	// To:   /path/to/project
-	root, err := filepath.Abs(filepath.Join(filepath.Dir(os.Args[0]), "..", ".."))
+// Returns: current version, latest upstream version, error
+func CheckVersion(ctx context.Context, client *github.Client, repo config.RepoConfig) (string, Upstream, error) {
+	current, err := GetCurrentVersion(repo.Subsystem)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get project root: %w", err)
+		return "", Upstream{}, fmt.Errorf("failed to read current version: %w", err)
 	}
 
-	// Read current version from <subsystem>/.bin/.version
-	versionPath := filepath.Join(root, subsystem, ".bin", ".version")
-	current, err := readVersion(versionPath)
+	latest, err := LatestVersion(ctx, client, repo)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to read current version: %w", err)
+		return current, Upstream{}, err
 	}
+	return current, latest, nil
+}
 
-	// For now, return same version (TODO: implement GitHub API check)
-	// This will be expanded to check GitHub releases API
-	latest := current
+// VersionInfo is the content of a .version file
+type VersionInfo struct {
+	Commit    string
+	Timestamp time.Time
+	Checksum  string
+	Release   string            // release tag the build is of, when known
+	OS        string            // GOOS the build targets ("" for builds that predate recording it)
+	Arch      string            // GOARCH the build targets
+	Files     map[string]string // SHA256 of each installed file by name, from the "sha256 <file>:" lines
+}
 
-	return current, latest, nil
+// Platform returns the build's os/arch, or "" if it isn't recorded
+func (v VersionInfo) Platform() string {
+	if v.OS == "" && v.Arch == "" {
+		return ""
+	}
+	return v.OS + "/" + v.Arch
 }
 
-// readVersion reads the version file and extracts the commit hash
-func readVersion(path string) (string, error) {
+// CheckPlatform returns a platform_mismatch error if the build targets another
+// OS or architecture than this host
+// Builds that don't record their platform pass.
+func (v VersionInfo) CheckPlatform() error {
+	if (v.OS == "" || v.OS == runtime.GOOS) && (v.Arch == "" || v.Arch == runtime.GOARCH) {
+		return nil
+	}
+	return syncerr.Wrap(syncerr.PlatformMismatch, fmt.Errorf("built for %s, this host is %s/%s", v.Platform(), runtime.GOOS, runtime.GOARCH))
+}
+
+// ReadVersionFile parses the "key: value" lines of a .version file
+func ReadVersionFile(path string) (VersionInfo, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return VersionInfo{}, err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "commit:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				return strings.TrimSpace(parts[1]), nil
+	var info VersionInfo
+	for _, line := range strings.Split(string(data), "\n") {
+		// File names may contain colons, digests don't
+		if entry, ok := strings.CutPrefix(line, "sha256 "); ok {
+			if i := strings.LastIndex(entry, ":"); i > 0 {
+				if info.Files == nil {
+					info.Files = make(map[string]string)
+				}
+				info.Files[entry[:i]] = strings.TrimSpace(entry[i+1:])
 			}
+			continue
+		}
+		// Timestamps contain colons, so only split on the first one
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "commit":
+			info.Commit = value
+		case "timestamp":
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				info.Timestamp = t
+			}
+		case "checksum":
+			info.Checksum = value
+		case "release":
+			info.Release = value
+		case "os":
+			info.OS = value
+		case "arch":
+			info.Arch = value
 		}
 	}
+	return info, nil
+}
 
-	return "", fmt.Errorf("no commit hash found in version file")
+// readVersion reads the version file and extracts the commit hash
+func readVersion(path string) (string, error) {
+	info, err := ReadVersionFile(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Commit == "" {
+		return "", fmt.Errorf("no commit hash found in version file")
+	}
+	return info.Commit, nil
 }
 
 // GetCurrentVersion gets the current commit hash for a subsystem
 func GetCurrentVersion(subsystem string) (string, error) {
-	// Find project root - sync binary is in sync/.bin/, so go up 2 levels
-	// From: /path/to/project/sync/.bin/sync
-	// To:   /path/to/project
-	root, err := filepath.Abs(filepath.Join(filepath.Dir(os.Args[0]), "..", ".."))
+	root, err := config.ProjectRoot()
 	if err != nil {
-		return "", fmt.Errorf("failed to get project root: %w", err)
+		return "", err
 	}
 
 	// Read current version from <subsystem>/.bin/.version
 	versionPath := filepath.Join(root, subsystem, ".bin", ".version")
 	return readVersion(versionPath)
 }
+
+// GetCurrentRelease returns the release tag recorded in a subsystem's
+// .version file, "" for builds not made from a release
+func GetCurrentRelease(subsystem string) (string, error) {
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return "", err
+	}
+	info, err := ReadVersionFile(filepath.Join(root, subsystem, ".bin", ".version"))
+	return info.Release, err
+}
+
+// GetInstalledAt returns the build/install timestamp recorded in a subsystem's .version file
+func GetInstalledAt(subsystem string) (time.Time, error) {
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := ReadVersionFile(filepath.Join(root, subsystem, ".bin", ".version"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if info.Timestamp.IsZero() {
+		return time.Time{}, fmt.Errorf("no timestamp found in version file")
+	}
+	return info.Timestamp, nil
+}
@@ -0,0 +1,59 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// Combined CI states of a commit, as returned by CommitChecks
+const (
+	ChecksSuccess = "success"
+	ChecksPending = "pending"
+	ChecksFailure = "failure"
+)
+
+// CommitChecks returns the combined state of a commit's statuses and check
+// runs on GitHub (owner/name): failure if any failed, pending while any is
+// still running, success once all passed or when there are none
+func CommitChecks(ctx context.Context, client *github.Client, repo, sha string) (string, error) {
+	owner, name := parseRepo(repo)
+	if owner == "" || name == "" {
+		return "", syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid repo format: %s", repo))
+	}
+
+	state := ChecksSuccess
+	combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, name, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", ghclient.Classify(fmt.Errorf("failed to get statuses of %s: %w", sha, err))
+	}
+	// Without any statuses GitHub reports pending
+	if combined.GetTotalCount() > 0 {
+		switch combined.GetState() {
+		case "failure", "error":
+			return ChecksFailure, nil
+		case "pending":
+			state = ChecksPending
+		}
+	}
+
+	runs, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, name, sha, &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}})
+	if err != nil {
+		return "", ghclient.Classify(fmt.Errorf("failed to list check runs of %s: %w", sha, err))
+	}
+	for _, run := range runs.CheckRuns {
+		if run.GetStatus() != "completed" {
+			state = ChecksPending
+			continue
+		}
+		switch run.GetConclusion() {
+		case "success", "neutral", "skipped":
+		default:
+			return ChecksFailure, nil
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,74 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/gitops"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// maxComparePages bounds how many pages of 100 commits a comparison reads
+const maxComparePages = 10
+
+// CompareCommits lists the commits of a GitHub repo (owner/name) that to has
+// and from doesn't, newest first, with GitHub's total count of them
+// The total can exceed the commits listed: only the first 1000 are read. When
+// to is behind from (a downgrade), nothing is listed.
+func CompareCommits(ctx context.Context, client *github.Client, repo, from, to string) ([]gitops.Commit, int, error) {
+	owner, name := parseRepo(repo)
+	if owner == "" || name == "" {
+		return nil, 0, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid repo format: %s", repo))
+	}
+
+	var list []gitops.Commit
+	total := 0
+	opts := &github.ListOptions{PerPage: 100}
+	for page := 0; page < maxComparePages; page++ {
+		cmp, resp, err := client.Repositories.CompareCommits(ctx, owner, name, from, to, opts)
+		if err != nil {
+			return nil, 0, ghclient.Classify(fmt.Errorf("failed to compare %s...%s: %w", from, to, err))
+		}
+		total = cmp.GetAheadBy()
+		for _, c := range cmp.Commits {
+			subject, _, _ := strings.Cut(c.GetCommit().GetMessage(), "\n")
+			author := c.GetCommit().GetAuthor().GetName()
+			if author == "" {
+				author = c.GetAuthor().GetLogin()
+			}
+			list = append(list, gitops.Commit{
+				SHA:     c.GetSHA(),
+				Subject: subject,
+				Author:  author,
+				Date:    c.GetCommit().GetAuthor().GetDate().Time,
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	// GitHub lists the oldest first
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	return list, total, nil
+}
+
+// RepoSize returns the size GitHub reports for a repo (owner/name) in bytes,
+// roughly what a clone of it takes
+func RepoSize(ctx context.Context, client *github.Client, repo string) (int64, error) {
+	owner, name := parseRepo(repo)
+	if owner == "" || name == "" {
+		return 0, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid repo format: %s", repo))
+	}
+	r, _, err := client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return 0, ghclient.Classify(fmt.Errorf("failed to get repo %s: %w", repo, err))
+	}
+	return int64(r.GetSize()) << 10, nil // GitHub counts KiB
+}
@@ -0,0 +1,59 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// Divergence is how far a fork's tracked branch is from its upstream
+type Divergence struct {
+	Subsystem string    `json:"subsystem"`
+	Fork      string    `json:"fork"`     // owner/name:branch
+	Upstream  string    `json:"upstream"` // owner/name:branch
+	Behind    int       `json:"behind"`   // upstream commits the fork lacks
+	Ahead     int       `json:"ahead"`    // fork commits upstream lacks (our patches)
+	Checked   time.Time `json:"checked"`
+}
+
+// Diverged reports whether the fork is at least threshold commits behind
+// (never for a threshold of 0)
+func (d Divergence) Diverged(threshold int) bool {
+	return threshold > 0 && d.Behind >= threshold
+}
+
+// ForkDivergence compares a repo's fork branch with the upstream it tracks
+// GitHub compares across the fork network, so the upstream branch is given
+// as owner:branch and no clone is needed.
+func ForkDivergence(ctx context.Context, client *github.Client, repo config.RepoConfig) (Divergence, error) {
+	owner, name := parseRepo(repo.Repo)
+	upOwner, upName := parseRepo(repo.Fork.Upstream)
+	if owner == "" || name == "" || upOwner == "" || upName == "" {
+		return Divergence{}, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid fork of %s: upstream %q", repo.Repo, repo.Fork.Upstream))
+	}
+	branch := repo.ForkBranch()
+	upBranch := repo.Fork.Branch
+	if upBranch == "" {
+		upBranch = branch
+	}
+
+	// Base is our branch, head the upstream's: ahead_by counts the upstream
+	// commits missing from the fork
+	cmp, _, err := client.Repositories.CompareCommits(ctx, owner, name, branch, upOwner+":"+upBranch, &github.ListOptions{PerPage: 1})
+	if err != nil {
+		return Divergence{}, ghclient.Classify(fmt.Errorf("failed to compare %s with %s: %w", repo.Repo, repo.Fork.Upstream, err))
+	}
+	return Divergence{
+		Subsystem: repo.Subsystem,
+		Fork:      repo.Repo + ":" + branch,
+		Upstream:  repo.Fork.Upstream + ":" + upBranch,
+		Behind:    cmp.GetAheadBy(),
+		Ahead:     cmp.GetBehindBy(),
+		Checked:   time.Now(),
+	}, nil
+}
@@ -0,0 +1,147 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+)
+
+// verifyTag checks the signature of an annotated tag against the repo's keys,
+// returning who signed it
+// GitHub serves the tag's signature and the payload it covers; both are
+// checked here against the configured keys rather than trusting GitHub's
+// verdict, and the payload must name this tag and the commit it points to,
+// so a signature from another tag can't be passed off as this one's.
+func verifyTag(ctx context.Context, client *github.Client, owner, repo, tag string, obj *github.GitObject, keys config.SignatureConfig) (string, error) {
+	if obj.GetType() != "tag" {
+		return "", errors.New("lightweight tag, which can't be signed")
+	}
+	t, _, err := client.Git.GetTag(ctx, owner, repo, obj.GetSHA())
+	if err != nil {
+		return "", ghclient.Classify(fmt.Errorf("failed to get tag %s: %w", tag, err))
+	}
+	signature, payload := t.GetVerification().GetSignature(), t.GetVerification().GetPayload()
+	if signature == "" {
+		return "", errors.New("not signed")
+	}
+	if err := checkTagPayload(payload, tag, t.GetObject().GetSHA()); err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"):
+		if keys.Keyring == "" {
+			return "", errors.New("GPG signature, but no signatures.keyring is configured")
+		}
+		return verifyGPG(keys.Keyring, payload, signature)
+	case strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----"):
+		if keys.AllowedSigners == "" {
+			return "", errors.New("SSH signature, but no signatures.allowed_signers is configured")
+		}
+		return verifySSH(ctx, keys.AllowedSigners, payload, signature)
+	default:
+		return "", errors.New("unsupported signature (want GPG or SSH)")
+	}
+}
+
+// checkTagPayload checks that the header of a signed tag payload names tag
+// and points at commit
+func checkTagPayload(payload, tag, commit string) error {
+	header, _, _ := strings.Cut(payload, "\n\n")
+	fields := make(map[string]string)
+	for _, line := range strings.Split(header, "\n") {
+		if key, value, ok := strings.Cut(line, " "); ok {
+			if _, seen := fields[key]; !seen {
+				fields[key] = value
+			}
+		}
+	}
+	switch {
+	case fields["tag"] != tag:
+		return fmt.Errorf("signed payload is for tag %q, not %s", fields["tag"], tag)
+	case commit == "" || fields["object"] != commit:
+		return fmt.Errorf("signed payload points at %q, not %s's commit %s", fields["object"], tag, commit)
+	}
+	return nil
+}
+
+// verifyGPG checks an armored detached signature of payload against a keyring file
+func verifyGPG(keyring, payload, signature string) (string, error) {
+	f, err := os.Open(keyPath(keyring))
+	if err != nil {
+		return "", fmt.Errorf("failed to open keyring: %w", err)
+	}
+	defer f.Close()
+	keys, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read keyring %s: %w", keyring, err)
+	}
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(keys, strings.NewReader(payload), strings.NewReader(signature), nil)
+	if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+		return "", fmt.Errorf("signed by a GPG key not in %s", keyring)
+	}
+	if err != nil {
+		return "", fmt.Errorf("bad GPG signature: %w", err)
+	}
+	who := "GPG key " + signer.PrimaryKey.KeyIdString()
+	if id := signer.PrimaryIdentity(); id != nil {
+		who += " (" + id.Name + ")"
+	}
+	return who, nil
+}
+
+// verifySSH checks an SSH signature of payload with ssh-keygen, as git does:
+// the signer must be listed in the allowed_signers file for the git namespace
+func verifySSH(ctx context.Context, allowedSigners, payload, signature string) (string, error) {
+	allowed := keyPath(allowedSigners)
+	sig, err := os.CreateTemp("", "sync-tag-*.sig")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(sig.Name())
+	if _, err := sig.WriteString(signature); err != nil {
+		sig.Close()
+		return "", err
+	}
+	if err := sig.Close(); err != nil {
+		return "", err
+	}
+
+	out, err := exec.CommandContext(ctx, "ssh-keygen", "-Y", "find-principals", "-f", allowed, "-s", sig.Name()).Output()
+	if err != nil {
+		return "", fmt.Errorf("signed by an SSH key not in %s", allowedSigners)
+	}
+	principal, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+
+	verify := exec.CommandContext(ctx, "ssh-keygen", "-Y", "verify", "-f", allowed, "-I", principal, "-n", "git", "-s", sig.Name())
+	verify.Stdin = strings.NewReader(payload)
+	var output bytes.Buffer
+	verify.Stdout, verify.Stderr = &output, &output
+	if err := verify.Run(); err != nil {
+		return "", fmt.Errorf("bad SSH signature from %s: %s", principal, strings.TrimSpace(output.String()))
+	}
+	return "SSH signer " + principal, nil
+}
+
+// keyPath resolves a configured key file relative to the project root
+func keyPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if root, err := config.ProjectRoot(); err == nil {
+		return filepath.Join(root, path)
+	}
+	return path
+}
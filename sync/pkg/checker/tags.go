@@ -0,0 +1,112 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/semver"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// maxTagPages bounds how many pages of 100 tags and releases are read
+const maxTagPages = 10
+
+// Tag is an upstream tag, with its GitHub release if it has one
+type Tag struct {
+	Name       string    `json:"name"`
+	Commit     string    `json:"commit,omitempty"`
+	Release    bool      `json:"release"`
+	Prerelease bool      `json:"prerelease,omitempty"` // a GitHub prerelease, or a semver prerelease tag
+	Published  time.Time `json:"published,omitzero"`   // of the release
+}
+
+// ListTags returns the tags and releases of a GitHub repo (owner/name)
+// Drafts are skipped. Only the newest 1000 tags and releases are read.
+func ListTags(ctx context.Context, client *github.Client, repo string) ([]Tag, error) {
+	owner, name := parseRepo(repo)
+	if owner == "" || name == "" {
+		return nil, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid repo format: %s", repo))
+	}
+
+	byName := make(map[string]*Tag)
+	opts := &github.ListOptions{PerPage: 100}
+	for page := 0; page < maxTagPages; page++ {
+		tags, resp, err := client.Repositories.ListTags(ctx, owner, name, opts)
+		if err != nil {
+			return nil, ghclient.Classify(fmt.Errorf("failed to list tags: %w", err))
+		}
+		for _, t := range tags {
+			byName[t.GetName()] = &Tag{Name: t.GetName(), Commit: t.GetCommit().GetSHA()}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	opts = &github.ListOptions{PerPage: 100}
+	for page := 0; page < maxTagPages; page++ {
+		releases, resp, err := client.Repositories.ListReleases(ctx, owner, name, opts)
+		if err != nil {
+			return nil, ghclient.Classify(fmt.Errorf("failed to list releases: %w", err))
+		}
+		for _, r := range releases {
+			if r.GetDraft() {
+				continue
+			}
+			t, ok := byName[r.GetTagName()]
+			if !ok {
+				t = &Tag{Name: r.GetTagName()}
+				byName[t.Name] = t
+			}
+			t.Release, t.Prerelease, t.Published = true, r.GetPrerelease(), r.GetPublishedAt().Time
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	list := make([]Tag, 0, len(byName))
+	for _, t := range byName {
+		list = append(list, *t)
+	}
+	return SortTags(list), nil
+}
+
+// SortTags orders tags newest first: semantic versions by precedence, then the
+// others by name. Semver prerelease tags are marked as prereleases.
+func SortTags(tags []Tag) []Tag {
+	versions := make([]semver.Version, len(tags))
+	isSemver := make([]bool, len(tags))
+	for i := range tags {
+		versions[i], isSemver[i] = semver.Parse(tags[i].Name)
+		if isSemver[i] && versions[i].IsPrerelease() {
+			tags[i].Prerelease = true
+		}
+	}
+	idx := make([]int, len(tags))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		i, k := idx[a], idx[b]
+		if isSemver[i] != isSemver[k] {
+			return isSemver[i]
+		}
+		if isSemver[i] {
+			return semver.Compare(versions[i], versions[k]) > 0
+		}
+		return tags[i].Name > tags[k].Name
+	})
+
+	sorted := make([]Tag, len(tags))
+	for a, i := range idx {
+		sorted[a] = tags[i]
+	}
+	return sorted
+}
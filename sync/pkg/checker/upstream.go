@@ -0,0 +1,188 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/semver"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// Upstream is the version a subsystem should be built from
+type Upstream struct {
+	Commit  string // full hash; compare with revision.Same, as older .version files record short ones
+	Release string // releases mode: tag of the newest release at or above the pin
+	Pin     string // tag and releases modes: the version pinned in the Taskfile
+
+	// When upstream published it: the release's publish time in releases
+	// mode, the commit's in branch mode; zero in tag mode and when unknown
+	Published time.Time
+
+	// With signatures configured: who signed the tag, or, under policy warn,
+	// why it failed verification (policy require fails the lookup instead)
+	Signer     string
+	Unverified string
+}
+
+// LatestVersion returns the upstream version a subsystem should be built from
+// Tag-mode repos resolve the tag pinned in the subsystem's Taskfile
+// (task <subsystem>:config:version); releases-mode repos take the newest
+// GitHub release that is at least that pin; branch-mode repos follow the branch head.
+// With signatures configured, the tag's signature is verified too.
+func LatestVersion(ctx context.Context, client *github.Client, repo config.RepoConfig) (Upstream, error) {
+	owner, name := parseRepo(repo.Repo)
+	if owner == "" || name == "" {
+		return Upstream{}, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid repo format: %s", repo.Repo))
+	}
+
+	if repo.Mode == config.ModeBranch {
+		latest, published, err := latestCommit(ctx, client, owner, name, repo.Branch)
+		if err != nil {
+			return Upstream{}, ghclient.Classify(fmt.Errorf("failed to get latest commit: %w", err))
+		}
+		return Upstream{Commit: latest, Published: published}, nil
+	}
+
+	pin, err := PinnedVersion(ctx, repo.Subsystem)
+	if err != nil {
+		return Upstream{}, fmt.Errorf("failed to get desired version from Taskfile: %w", err)
+	}
+	up := Upstream{Pin: pin}
+	tag := pin
+	if repo.Mode == config.ModeReleases {
+		if tag, up.Published, err = latestRelease(ctx, client, owner, name, pin, repo.Prereleases); err != nil {
+			return Upstream{}, ghclient.Classify(err)
+		}
+		up.Release = tag
+	}
+	obj, err := tagObject(ctx, client, owner, name, tag)
+	if err != nil {
+		return Upstream{}, ghclient.Classify(fmt.Errorf("failed to get tag commit: %w", err))
+	}
+	up.Commit = obj.GetSHA()
+
+	if repo.Signatures.Enabled() {
+		signer, err := verifyTag(ctx, client, owner, name, tag, obj, repo.Signatures)
+		switch {
+		case err == nil:
+			up.Signer = signer
+		case syncerr.KindOf(err) != syncerr.Unknown:
+			return Upstream{}, err // could not fetch the tag, so nothing was verified
+		case repo.Signatures.Policy == config.SignaturesWarn:
+			up.Unverified = fmt.Sprintf("tag %s: %v", tag, err)
+		default:
+			return Upstream{}, syncerr.Wrap(syncerr.SignatureInvalid, fmt.Errorf("refusing tag %s: %w", tag, err))
+		}
+	}
+	return up, nil
+}
+
+// Supersedes reports whether a newer release replaces the pinned version
+func (u Upstream) Supersedes() bool {
+	return u.Release != "" && u.Release != u.Pin
+}
+
+// latestRelease returns the tag of the highest semver release of a repo,
+// or pin when no release is higher, and when it was published (zero if pin
+// has no release)
+// Drafts and tags that aren't semver are skipped, and so are prereleases
+// unless allowed. Only the 100 most recent releases are considered.
+func latestRelease(ctx context.Context, client *github.Client, owner, repo, pin string, prereleases bool) (string, time.Time, error) {
+	best, ok := semver.Parse(pin)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("pinned version %q is not a semantic version", pin)
+	}
+
+	releases, _, err := client.Repositories.ListReleases(ctx, owner, repo, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to list releases: %w", err)
+	}
+	var published time.Time
+	for _, r := range releases {
+		v, ok := semver.Parse(r.GetTagName())
+		if !ok || r.GetDraft() {
+			continue
+		}
+		if (r.GetPrerelease() || v.IsPrerelease()) && !prereleases {
+			continue
+		}
+		switch c := semver.Compare(v, best); {
+		case c > 0:
+			best, published = v, r.GetPublishedAt().Time
+		case c == 0 && published.IsZero():
+			published = r.GetPublishedAt().Time
+		}
+	}
+	return best.String(), published, nil
+}
+
+// TagCommit returns the commit hash a tag of repo stands for, as LatestVersion
+// would record it (e.g. to fingerprint a binary built from that tag)
+func TagCommit(ctx context.Context, client *github.Client, repo config.RepoConfig, tag string) (string, error) {
+	owner, name := parseRepo(repo.Repo)
+	if owner == "" || name == "" {
+		return "", syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid repo format: %s", repo.Repo))
+	}
+	obj, err := tagObject(ctx, client, owner, name, tag)
+	if err != nil {
+		return "", ghclient.Classify(fmt.Errorf("failed to get tag commit: %w", err))
+	}
+	return obj.GetSHA(), nil
+}
+
+// tagObject gets the object a tag ref points at: the commit of a lightweight
+// tag, or the tag object of an annotated one (whose hash stands for the commit)
+func tagObject(ctx context.Context, client *github.Client, owner, repo, tag string) (*github.GitObject, error) {
+	ref, _, err := client.Git.GetRef(ctx, owner, repo, "tags/"+tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tag ref: %w", err)
+	}
+	return ref.GetObject(), nil
+}
+
+// latestCommit gets the latest commit hash from a branch, and its commit date
+func latestCommit(ctx context.Context, client *github.Client, owner, repo, branch string) (string, time.Time, error) {
+	commits, _, err := client.Repositories.ListCommits(ctx, owner, repo, &github.CommitsListOptions{
+		SHA:         branch,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to list commits: %w", err)
+	}
+	if len(commits) == 0 {
+		return "", time.Time{}, fmt.Errorf("no commits found")
+	}
+	return commits[0].GetSHA(), commits[0].GetCommit().GetCommitter().GetDate().Time, nil
+}
+
+// parseRepo splits "owner/repo" into (owner, repo)
+func parseRepo(repo string) (string, string) {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return "", ""
+	}
+	return owner, name
+}
+
+// PinnedVersion reads the version pinned in a subsystem's Taskfile
+func PinnedVersion(ctx context.Context, subsystem string) (string, error) {
+	// Call task <subsystem>:config:version to get the pinned version
+	cmd := exec.CommandContext(ctx, "task", subsystem+":config:version")
+	cmd.WaitDelay = time.Second // don't wait on children of a killed task holding stdout
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run task %s:config:version: %w", subsystem, err)
+	}
+
+	version := strings.TrimSpace(string(output))
+	if version == "" {
+		return "", fmt.Errorf("empty version returned from task %s:config:version", subsystem)
+	}
+	return version, nil
+}
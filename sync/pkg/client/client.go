@@ -0,0 +1,272 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/api"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/pki"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/processes"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Client calls the status API of a sync daemon, e.g. http://localhost:9090
+// It speaks the contract of api.Version: the routes and types of the OpenAPI
+// document the daemon serves at /api/openapi.json.
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// New returns a client for the daemon at baseURL, using the configured
+// outbound transport (proxies and network.ca_bundle)
+// token is the API token the write endpoints need; empty for read-only use.
+func New(baseURL, token string) *Client {
+	return &Client{base: strings.TrimSuffix(baseURL, "/"), token: token, http: nethttp.Client()}
+}
+
+// WithHTTPClient returns a copy of c sending its requests with hc, e.g. one
+// with a client certificate for a daemon requiring mutual TLS
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	copied := *c
+	copied.http = hc
+	return &copied
+}
+
+// WithClientCert returns a copy of c that presents certFile/keyFile to a
+// daemon requiring mutual TLS (server.tls.client_ca_file) and trusts caFile
+// on top of the roots the outbound transport trusts; either may be empty
+func (c *Client) WithClientCert(caFile, certFile, keyFile string) (*Client, error) {
+	tlsConfig, err := pki.ClientTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	base, ok := nethttp.Transport().(*http.Transport)
+	if !ok {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := base.Clone()
+	if tlsConfig.RootCAs == nil && t.TLSClientConfig != nil {
+		tlsConfig.RootCAs = t.TLSClientConfig.RootCAs // network.ca_bundle
+	}
+	t.TLSClientConfig = tlsConfig
+	return c.WithHTTPClient(&http.Client{Transport: t}), nil
+}
+
+// Error is a response the API answered with an unexpected status code
+type Error struct {
+	StatusCode int
+	Message    string // the plain text error of the response
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("status API: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Status returns the overall health of the daemon
+// An unhealthy daemon answers 503 with its status, which is not an error.
+func (c *Client) Status(ctx context.Context) (status.Daemon, error) {
+	var st status.Daemon
+	err := c.do(ctx, http.MethodGet, "/api/status", nil, &st, http.StatusOK, http.StatusServiceUnavailable)
+	return st, err
+}
+
+// Subsystems returns the sync state of every subsystem
+func (c *Client) Subsystems(ctx context.Context) ([]status.Subsystem, error) {
+	var subs []status.Subsystem
+	err := c.do(ctx, http.MethodGet, "/api/subsystems", nil, &subs, http.StatusOK)
+	return subs, err
+}
+
+// Queue returns the updates queued or running in every daemon
+func (c *Client) Queue(ctx context.Context) ([]updater.QueuedUpdate, error) {
+	var queued []updater.QueuedUpdate
+	err := c.do(ctx, http.MethodGet, "/api/queue", nil, &queued, http.StatusOK)
+	return queued, err
+}
+
+// Processes returns the state of each process of the stack
+// It fails with a 503 *Error while process-compose is not running.
+func (c *Client) Processes(ctx context.Context) ([]processes.Process, error) {
+	var list []processes.Process
+	err := c.do(ctx, http.MethodGet, "/api/processes", nil, &list, http.StatusOK)
+	return list, err
+}
+
+// Freeze returns the active update freeze, if any
+func (c *Client) Freeze(ctx context.Context) (api.FreezeStatus, error) {
+	var f api.FreezeStatus
+	err := c.do(ctx, http.MethodGet, "/api/freeze", nil, &f, http.StatusOK)
+	return f, err
+}
+
+// SetFreeze freezes automatic updates fleet-wide (API token required)
+func (c *Client) SetFreeze(ctx context.Context, req api.FreezeRequest) (api.FreezeStatus, error) {
+	var f api.FreezeStatus
+	err := c.do(ctx, http.MethodPost, "/api/freeze", req, &f, http.StatusCreated)
+	return f, err
+}
+
+// Thaw lifts the update freeze (API token required)
+// actor names the caller in the audit log; empty records "api".
+func (c *Client) Thaw(ctx context.Context, actor string) (api.FreezeStatus, error) {
+	path := "/api/freeze"
+	if actor != "" {
+		path += "?" + url.Values{"actor": {actor}}.Encode()
+	}
+	var f api.FreezeStatus
+	err := c.do(ctx, http.MethodDelete, path, nil, &f, http.StatusOK)
+	return f, err
+}
+
+// Errors returns the error kinds the daemon knows, with their exit codes and
+// remediation hints
+func (c *Client) Errors(ctx context.Context) ([]syncerr.Info, error) {
+	var infos []syncerr.Info
+	err := c.do(ctx, http.MethodGet, "/api/errors", nil, &infos, http.StatusOK)
+	return infos, err
+}
+
+// EventsOptions selects the events Events delivers
+type EventsOptions struct {
+	Subsystem string // only events of this subsystem; empty for all
+	Since     uint64 // start after this event ID; 0 for every event the daemon kept
+	Follow    bool   // keep streaming new events instead of returning after the kept ones
+}
+
+// Events calls fn with the daemon's update events, oldest first, until the
+// stream ends or ctx is done
+// It returns the ID of the last event delivered, to resume from with
+// EventsOptions.Since after the daemon restarts or drops a slow client.
+func (c *Client) Events(ctx context.Context, opts EventsOptions, fn func(api.StreamedEvent)) (uint64, error) {
+	query := url.Values{"follow": {strconv.FormatBool(opts.Follow)}}
+	if opts.Subsystem != "" {
+		query.Set("subsystem", opts.Subsystem)
+	}
+	if opts.Since > 0 {
+		query.Set("since", strconv.FormatUint(opts.Since, 10))
+	}
+	path := "/api/events?" + query.Encode()
+
+	last := opts.Since
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return last, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid status API URL %s: %w", c.base, err))
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return last, classify(fmt.Errorf("failed to call GET %s: %w", path, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return last, classify(&Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))})
+	}
+
+	// Only data lines matter: the event carries its own ID and type
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var se api.StreamedEvent
+		if err := json.Unmarshal([]byte(data), &se); err != nil {
+			return last, fmt.Errorf("failed to decode event: %w", err)
+		}
+		fn(se)
+		last = se.ID
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return last, classify(fmt.Errorf("event stream broke: %w", err))
+	}
+	return last, nil
+}
+
+// Version returns the API version the daemon serves, from its OpenAPI document
+// Clients of api.Version work with daemons of the same major version.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var doc struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/openapi.json", nil, &doc, http.StatusOK)
+	return doc.Info.Version, err
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out, if its status is one of codes
+func (c *Client) do(ctx context.Context, method, path string, body, out any, codes ...int) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid status API URL %s: %w", c.base, err))
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return classify(fmt.Errorf("failed to call %s %s: %w", method, path, err))
+	}
+	defer resp.Body.Close()
+
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("failed to decode the response of %s %s: %w", method, path, err)
+			}
+			return nil
+		}
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	return classify(&Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))})
+}
+
+// classify gives errors calling the API their kind
+func classify(err error) error {
+	var apiErr *Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return syncerr.Wrap(syncerr.AuthFailed, err)
+		case http.StatusNotFound:
+			return syncerr.Wrap(syncerr.NotFound, err)
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return syncerr.Wrap(syncerr.Network, err)
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Defaults for Watch: how often the clocks are compared, and how far the wall
+// clock may drift from the monotonic one between two samples before it counts
+// as a jump (an NTP step, a fixed RTC, someone running date)
+const (
+	DefaultInterval  = 10 * time.Second
+	DefaultThreshold = time.Minute
+)
+
+// Watch calls onJump with how far the wall clock jumped, whenever it moves more
+// than threshold away from the monotonic clock between two samples taken every
+// interval, until ctx is done
+// Forward jumps are positive, backward ones negative. A suspended machine looks
+// like a forward jump too, which is as good a reason to look at schedules again.
+func Watch(ctx context.Context, interval, threshold time.Duration, onJump func(jump time.Duration)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if jump := Jump(last, now); jump > threshold || jump < -threshold {
+				onJump(jump)
+			}
+			last = now
+		}
+	}
+}
+
+// Jump returns how much more the wall clock moved than the monotonic clock
+// from then to now, both read with time.Now
+func Jump(then, now time.Time) time.Duration {
+	return now.Round(0).Sub(then.Round(0)) - now.Sub(then)
+}
+
+// Until returns the time left until at, a wall clock time persisted by an
+// earlier run, clamped to [0, limit]
+// Schedules built on it count down on the monotonic clock, so a clock that was
+// wrong when at was recorded, or is now, delays them by limit at most.
+func Until(at time.Time, limit time.Duration) time.Duration {
+	return min(max(time.Until(at.Round(0)), 0), limit)
+}
@@ -0,0 +1,284 @@
+package delta
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	capabilities.Register(capabilities.Packaging, "delta-zstd")
+}
+
+// manifestName is the first entry of a patch file
+const manifestName = "manifest.json"
+
+// maxWindow caps the zstd window (and so the decoder's memory) at 2 GiB
+const maxWindow = 1 << 31
+
+// Manifest describes a patch between two installed versions of a subsystem
+type Manifest struct {
+	Subsystem string    `json:"subsystem"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Created   time.Time `json:"created"`
+	Files     []File    `json:"files"`
+}
+
+// File is one file of the target version
+// With Base set, the file is compressed against the same-named file of the
+// From version; otherwise it is shipped whole (zstd-compressed).
+type File struct {
+	Name   string      `json:"name"`
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size"`
+	SHA256 string      `json:"sha256"`
+	Window int         `json:"window"`
+	Base   bool        `json:"base"`
+}
+
+// Create writes a patch that turns version from of a subsystem into version to
+// A patch is a tar of the manifest followed by files/<name> entries. Each
+// changed file is zstd-compressed using its previous build as a raw
+// dictionary, so only the bytes that differ cost bandwidth.
+func Create(subsystem, from, to string, w io.Writer) (Manifest, error) {
+	fromDir, err := versions.Dir(subsystem, from)
+	if err != nil {
+		return Manifest{}, err
+	}
+	toDir, err := versions.Dir(subsystem, to)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	entries, err := os.ReadDir(toDir)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("version %s of %s is not installed", to, subsystem)
+	}
+	if _, err := os.Stat(fromDir); err != nil {
+		return Manifest{}, fmt.Errorf("version %s of %s is not installed", from, subsystem)
+	}
+
+	m := Manifest{Subsystem: subsystem, From: from, To: to, Created: time.Now().UTC()}
+	var bodies [][]byte
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		target, err := os.ReadFile(filepath.Join(toDir, e.Name()))
+		if err != nil {
+			return Manifest{}, err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return Manifest{}, err
+		}
+		base, err := os.ReadFile(filepath.Join(fromDir, e.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return Manifest{}, err
+		}
+
+		f := File{
+			Name:   e.Name(),
+			Mode:   info.Mode().Perm(),
+			Size:   int64(len(target)),
+			SHA256: sum(target),
+			Window: window(len(base) + len(target)),
+			Base:   len(base) > 0,
+		}
+		body, err := encode(target, base, f.Window)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to compress %s: %w", f.Name, err)
+		}
+		m.Files = append(m.Files, f)
+		bodies = append(bodies, body)
+	}
+
+	tw := tar.NewWriter(w)
+	header, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := writeEntry(tw, manifestName, header); err != nil {
+		return Manifest{}, err
+	}
+	for i, f := range m.Files {
+		if err := writeEntry(tw, "files/"+f.Name, bodies[i]); err != nil {
+			return Manifest{}, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return Manifest{}, fmt.Errorf("failed to write patch: %w", err)
+	}
+	return m, nil
+}
+
+// Apply installs the target version of a patch next to its base version
+// Every file is checked against its SHA256 before the version directory
+// appears, so a bad or mismatched patch never leaves a half-built version.
+// The caller activates it.
+func Apply(subsystem, path string) (Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to open patch: %w", err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	var m Manifest
+	data, err := readEntry(tr, manifestName)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("invalid patch manifest: %w", err)
+	}
+	if m.Subsystem != subsystem {
+		return Manifest{}, fmt.Errorf("patch is for %s, not %s", m.Subsystem, subsystem)
+	}
+
+	fromDir, err := versions.Dir(subsystem, m.From)
+	if err != nil {
+		return m, err
+	}
+	toDir, err := versions.Dir(subsystem, m.To)
+	if err != nil {
+		return m, err
+	}
+	if _, err := os.Stat(fromDir); err != nil {
+		return m, fmt.Errorf("base version %s of %s is not installed", m.From, subsystem)
+	}
+
+	tmp := toDir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return m, err
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return m, fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, file := range m.Files {
+		if filepath.Base(file.Name) != file.Name {
+			return m, fmt.Errorf("invalid file name %q in patch", file.Name)
+		}
+		body, err := readEntry(tr, "files/"+file.Name)
+		if err != nil {
+			return m, err
+		}
+		var base []byte
+		if file.Base {
+			if base, err = os.ReadFile(filepath.Join(fromDir, file.Name)); err != nil {
+				return m, fmt.Errorf("failed to read base %s: %w", file.Name, err)
+			}
+		}
+		out, err := decode(body, base, file.Window)
+		if err != nil {
+			return m, fmt.Errorf("failed to patch %s: %w", file.Name, err)
+		}
+		if int64(len(out)) != file.Size || sum(out) != file.SHA256 {
+			return m, syncerr.Wrap(syncerr.ChecksumMismatch, fmt.Errorf("patched %s does not match checksum (is %s the installed build?)", file.Name, m.From))
+		}
+		if err := os.WriteFile(filepath.Join(tmp, file.Name), out, file.Mode|0200); err != nil {
+			return m, err
+		}
+	}
+
+	if err := os.RemoveAll(toDir); err != nil {
+		return m, fmt.Errorf("failed to replace %s: %w", toDir, err)
+	}
+	if err := os.Rename(tmp, toDir); err != nil {
+		return m, fmt.Errorf("failed to install %s: %w", m.To, err)
+	}
+	return m, nil
+}
+
+// encode compresses target, against base when there is one
+func encode(target, base []byte, window int) ([]byte, error) {
+	opts := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+		zstd.WithWindowSize(window),
+	}
+	if len(base) > 0 {
+		opts = append(opts, zstd.WithEncoderDictRaw(0, base))
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.EncodeAll(target, nil), nil
+}
+
+// decode reverses encode
+func decode(body, base []byte, window int) ([]byte, error) {
+	opts := []zstd.DOption{
+		zstd.WithDecoderMaxWindow(uint64(max(window, zstd.MinWindowSize))),
+		zstd.WithDecoderConcurrency(1),
+	}
+	if len(base) > 0 {
+		opts = append(opts, zstd.WithDecoderDictRaw(0, base))
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	return dec.DecodeAll(body, nil)
+}
+
+// window returns a zstd window covering n bytes, so matches can reach back
+// into the whole base build
+func window(n int) int {
+	if n <= zstd.MinWindowSize {
+		return zstd.MinWindowSize
+	}
+	return min(1<<bits.Len(uint(n-1)), maxWindow)
+}
+
+// writeEntry adds one file to a patch
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write patch: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write patch: %w", err)
+	}
+	return nil
+}
+
+// readEntry reads the next patch entry, which must be name
+func readEntry(tr *tar.Reader, name string) ([]byte, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("truncated patch (missing %s): %w", name, err)
+	}
+	if hdr.Name != name {
+		return nil, fmt.Errorf("unexpected patch entry %s (want %s)", hdr.Name, name)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, tr); err != nil {
+		return nil, fmt.Errorf("failed to read %s from patch: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sum returns the hex SHA256 of data
+func sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,53 @@
+package diskspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Free returns the bytes available to this process on the filesystem holding
+// path, which need not exist yet (its nearest existing parent is asked)
+func Free(path string) (int64, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	n, err := free(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read free space of %s: %w", dir, err)
+	}
+	return n, nil
+}
+
+// Check returns a disk_full error unless need bytes plus reserve are free on
+// the filesystem holding path, along with the free space it found
+// what names the work the space is for, e.g. "the nats build".
+func Check(path, what string, need, reserve int64) (int64, error) {
+	free, err := Free(path)
+	if err != nil {
+		return 0, err
+	}
+	if free >= need+reserve {
+		return free, nil
+	}
+	needs := "the " + versions.FormatBytes(reserve) + " reserve"
+	if need > 0 {
+		needs = "about " + versions.FormatBytes(need) + " plus " + needs
+	}
+	return free, syncerr.Wrap(syncerr.DiskFull, fmt.Errorf("not enough disk space for %s in %s: needs %s, %s free", what, path, needs, versions.FormatBytes(free)))
+}
@@ -0,0 +1,194 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+func init() {
+	capabilities.Register(capabilities.Packaging, "release-asset")
+}
+
+// maxChecksumsBytes bounds the checksums file, which is read into memory
+const maxChecksumsBytes = 1 << 20
+
+// File downloads url to dest, calling progress as bytes arrive
+// total is -1 when the server does not send a length.
+func File(ctx context.Context, url, dest string, progress func(done, total int64)) error {
+	resp, err := get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	counter := &counter{total: resp.ContentLength, progress: progress}
+	if _, err := io.Copy(f, io.TeeReader(resp.Body, counter)); err != nil {
+		f.Close()
+		return syncerr.Wrap(syncerr.Network, fmt.Errorf("failed to download %s: %w", url, err))
+	}
+	return f.Close()
+}
+
+// Checksum returns the SHA256 listed for name in the checksums file at url
+// The file has one "<sha256>  <name>" line per asset, as written by sha256sum
+// (a leading * on the name marks binary mode and is ignored).
+func Checksum(ctx context.Context, url, name string) (string, error) {
+	resp, err := get(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxChecksumsBytes))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	return "", fmt.Errorf("%s lists no checksum for %s", url, name)
+}
+
+// Extract writes the file called binary from archive into dir
+// name is the asset name, whose extension gives the format: .tar.gz/.tgz,
+// .zip, or anything else for a bare binary. Archived files match by base
+// name, so binaries inside a versioned top-level directory are found.
+func Extract(archive, name, binary, dir string) error {
+	target := filepath.Join(dir, binary)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return extractTar(archive, binary, target)
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(archive, binary, target)
+	default:
+		src, err := os.Open(archive)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		return writeBinary(target, src)
+	}
+}
+
+func extractTar(archive, binary, target string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(archive), err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in archive", binary)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(archive), err)
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == binary {
+			return writeBinary(target, tr)
+		}
+	}
+}
+
+func extractZip(archive, binary, target string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(archive), err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		if file.Mode().IsRegular() && path.Base(file.Name) == binary {
+			src, err := file.Open()
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			return writeBinary(target, src)
+		}
+	}
+	return fmt.Errorf("%s not found in archive", binary)
+}
+
+// writeBinary writes an executable via a temp file, so a failed copy
+// never leaves a truncated binary in place
+func writeBinary(target string, src io.Reader) error {
+	tmp := target + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// get starts a GET of url, failing on any status but 200
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := nethttp.Client().Do(req)
+	if err != nil {
+		return nil, syncerr.Wrap(syncerr.Network, fmt.Errorf("failed to download %s: %w", url, err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		kind := syncerr.Network
+		if resp.StatusCode == http.StatusNotFound {
+			kind = syncerr.NotFound
+		}
+		return nil, syncerr.Wrap(kind, fmt.Errorf("failed to download %s: %s", url, resp.Status))
+	}
+	return resp, nil
+}
+
+// counter reports the bytes written through it
+type counter struct {
+	done, total int64
+	progress    func(done, total int64)
+}
+
+func (c *counter) Write(b []byte) (int, error) {
+	c.done += int64(len(b))
+	if c.progress != nil {
+		c.progress(c.done, c.total)
+	}
+	return len(b), nil
+}
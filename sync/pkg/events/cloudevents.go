@@ -0,0 +1,62 @@
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+)
+
+// CloudEvents media types: a structured-mode event, and the data within it
+const (
+	CloudEventsContentType = "application/cloudevents+json"
+	cloudEventsDataType    = "application/json"
+)
+
+// CloudEventTypePrefix turns an event type into a CloudEvents type, e.g.
+// update.completed into com.github.joeblew99.plat-telemetry.sync.update.completed
+const CloudEventTypePrefix = "com.github.joeblew99.plat-telemetry.sync."
+
+// CloudEvent is an event in the CloudEvents 1.0 JSON format (structured mode)
+// The subject is the subsystem, and data the event as sync sends it natively.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"` // /sync/<host>
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            any       `json:"data"`
+}
+
+// Cloud returns e as a CloudEvent carrying data, usually e itself
+// The ID is derived from e, so the same event sent over NATS, the event
+// stream and webhooks has the same ID and consumers can deduplicate it.
+func (e Event) Cloud(data any) CloudEvent {
+	encoded, _ := json.Marshal(e)
+	sum := sha256.Sum256(encoded)
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(sum[:16]),
+		Source:          CloudSource(),
+		Type:            CloudEventTypePrefix + e.Type,
+		Subject:         e.Subsystem,
+		Time:            e.Time,
+		DataContentType: cloudEventsDataType,
+		Data:            data,
+	}
+}
+
+// CloudSource is the CloudEvents source of this host's events: /sync/ and
+// its identity's name, else its hostname
+func CloudSource() string {
+	if id := identity.Current(); id != nil && id.Name != "" {
+		return "/sync/" + id.Name
+	}
+	host, _ := os.Hostname()
+	return "/sync/" + host
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	UpdateStarted   = "update.started"
+	UpdateCompleted = "update.completed"
+	UpdateFailed    = "update.failed"
+	UpdatePending   = "update.pending"   // queued for approval
+	UpdateAvailable = "update.available" // detected under the notify policy
+	UpdateProgress  = "update.progress"  // a phase of a running update started or advanced
+	ForkDiverged    = "fork.diverged"    // a fork fell threshold commits behind its upstream
+	UpdateRegressed = "update.regressed" // metrics regressed after an update, which is rolled back
+)
+
+// Types lists the event types
+var Types = []string{UpdateStarted, UpdateCompleted, UpdateFailed, UpdatePending, UpdateAvailable, UpdateProgress, ForkDiverged, UpdateRegressed}
+
+// Event is a sync lifecycle event
+type Event struct {
+	Type      string        `json:"type"`
+	Time      time.Time     `json:"time"`
+	Subsystem string        `json:"subsystem"`
+	From      string        `json:"from,omitempty"` // version before the update
+	To        string        `json:"to,omitempty"`   // version after the update
+	Trigger   string        `json:"trigger,omitempty"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	ErrorKind string        `json:"errorKind,omitempty"` // e.g. health_check_failed, see sync errors
+	Output    string        `json:"output,omitempty"`    // failed updates: the end of the build output
+
+	// Progress events only: the phase (e.g. "build"), its place in the
+	// update, and how far along it is when the phase reports that itself
+	Phase   string `json:"phase,omitempty"`
+	Step    int    `json:"step,omitempty"`
+	Steps   int    `json:"steps,omitempty"`
+	Percent int    `json:"percent,omitempty"`
+	Detail  string `json:"detail,omitempty"` // e.g. "Receiving objects:  40% (120/300)"
+
+	// Fork events only: the upstream compared with, and how many commits our
+	// fork lacks (behind) and carries on top of it (ahead)
+	Upstream string `json:"upstream,omitempty"`
+	Behind   int    `json:"behind,omitempty"`
+	Ahead    int    `json:"ahead,omitempty"`
+}
+
+// Sink receives every published event
+// Sinks are called synchronously and must not block for long.
+type Sink func(Event)
+
+var (
+	mu    sync.RWMutex
+	sinks []Sink
+)
+
+// Subscribe registers a sink for all future events
+func Subscribe(sink Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// Publish delivers an event to every sink
+func Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, sink := range sinks {
+		sink(e)
+	}
+}
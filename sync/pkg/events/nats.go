@@ -0,0 +1,352 @@
+//go:build !nonats
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/natsauth"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/promote"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/nats-io/nats.go"
+)
+
+// logger logs the NATS connection, event publishing and the offline outbox
+var logger = logging.For("events")
+
+func init() {
+	capabilities.Register(capabilities.Notifier, "nats")
+}
+
+// StatusReport is published on every (re)connect so the controller sees
+// where an intermittently connected host stands
+type StatusReport struct {
+	Host       string             `json:"host"`
+	Identity   *identity.Public   `json:"identity,omitempty"` // see pkg/identity
+	Time       time.Time          `json:"time"`
+	Daemon     status.Daemon      `json:"daemon"`
+	Subsystems []status.Subsystem `json:"subsystems"`
+}
+
+var (
+	connectMu sync.Mutex
+	onConnect []func(*nats.Conn)
+)
+
+// OnConnect registers fn to run each time the NATS connection is (re)established
+func OnConnect(fn func(*nats.Conn)) {
+	connectMu.Lock()
+	defer connectMu.Unlock()
+	onConnect = append(onConnect, fn)
+}
+
+// ConnectNATS publishes every event to its configured NATS subject, as is or
+// as a CloudEvent (nats.format)
+// The connection retries in the background with jittered backoff, so a NATS
+// outage at startup doesn't stop the daemon. Events published while
+// disconnected are kept in the state store and sent once a server is reachable.
+func ConnectNATS(cfg config.NATSConfig) (*nats.Conn, error) {
+	out := &outbox{prefix: status.Status().Daemon + "/", limit: cfg.OutboxLimit}
+	online := func(nc *nats.Conn) {
+		go func() {
+			out.flush(nc)
+			publishStatus(nc, cfg.Subjects.Status)
+
+			connectMu.Lock()
+			hooks := onConnect
+			connectMu.Unlock()
+			for _, fn := range hooks {
+				fn(nc)
+			}
+		}()
+	}
+
+	opts := []nats.Option{
+		nats.Name("sync"),
+		nats.DontRandomize(), // servers are listed in order of preference
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.CustomReconnectDelay(reconnectDelay(cfg.Reconnect)),
+		nats.ReconnectBufSize(-1), // the outbox buffers instead, across restarts
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			logger.Info("NATS connected", "url", nc.ConnectedUrl())
+			online(nc)
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.Warn("NATS disconnected", "err", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info("NATS reconnected", "url", nc.ConnectedUrl())
+			online(nc)
+		}),
+	}
+	auth, err := natsauth.Options(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, auth...)
+
+	nc, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS at %s: %w", cfg.URL, err)
+	}
+	out.setConn(nc)
+
+	subjects := map[string]string{
+		UpdateStarted:   cfg.Subjects.Started,
+		UpdateCompleted: cfg.Subjects.Completed,
+		UpdateFailed:    cfg.Subjects.Failed,
+		UpdatePending:   cfg.Subjects.Pending,
+		UpdateAvailable: cfg.Subjects.Available,
+		UpdateProgress:  cfg.Subjects.Progress,
+		ForkDiverged:    cfg.Subjects.Diverged,
+		UpdateRegressed: cfg.Subjects.Regressed,
+	}
+
+	Subscribe(func(e Event) {
+		subject := subjects[e.Type]
+		if subject == "" {
+			return
+		}
+		var v any = e
+		if cfg.Format == config.EventFormatCloudEvents {
+			v = e.Cloud(e)
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			logger.Warn("Failed to encode event", "type", e.Type, "err", err)
+			return
+		}
+		// Progress is only worth seeing live: it is dropped while offline
+		// rather than replayed from the outbox after the update has finished
+		if e.Type == UpdateProgress {
+			if nc.IsConnected() {
+				nc.Publish(subject, data)
+			}
+			return
+		}
+		out.publish(subject, data)
+	})
+
+	// Freezes set on this host reach the fleet, after a reconnect if need be
+	freeze.OnChange(func(c freeze.Change) {
+		data, err := json.Marshal(c)
+		if err != nil {
+			logger.Warn("Failed to encode update freeze", "err", err)
+			return
+		}
+		out.publish(cfg.Subjects.Freeze, data)
+	})
+
+	// Releases promoted on this host reach the environment's hosts
+	promote.OnChange(func(r promote.Release) {
+		data, err := json.Marshal(r)
+		if err != nil {
+			logger.Warn("Failed to encode promoted release", "err", err)
+			return
+		}
+		out.publish(cfg.Subjects.Release, data)
+	})
+
+	logger.Info("Publishing update events to NATS", "url", cfg.URL)
+	return nc, nil
+}
+
+// Announce connects to NATS, publishes one message, and disconnects
+// For CLI commands that change fleet-wide state outside a daemon.
+func Announce(cfg config.NATSConfig, subject string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode message for %s: %w", subject, err)
+	}
+
+	opts := []nats.Option{nats.Name("sync"), nats.Timeout(5 * time.Second)}
+	auth, err := natsauth.Options(cfg)
+	if err != nil {
+		return err
+	}
+	nc, err := nats.Connect(cfg.URL, append(opts, auth...)...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS at %s: %w", cfg.URL, err)
+	}
+	defer nc.Close()
+
+	if err := nc.Publish(subject, data); err != nil {
+		return fmt.Errorf("failed to publish on %s: %w", subject, err)
+	}
+	if err := nc.FlushTimeout(5 * time.Second); err != nil {
+		return fmt.Errorf("failed to publish on %s: %w", subject, err)
+	}
+	return nil
+}
+
+// reconnectDelay doubles the wait per failed attempt up to the cap, then
+// picks a random point in its upper half so hosts spread out
+func reconnectDelay(cfg config.ReconnectConfig) nats.ReconnectDelayHandler {
+	return func(attempts int) time.Duration {
+		delay := cfg.Wait
+		for i := 1; i < attempts && delay < cfg.MaxWait; i++ {
+			delay *= 2
+		}
+		delay = min(delay, cfg.MaxWait)
+		return delay/2 + rand.N(delay/2+1)
+	}
+}
+
+// publishStatus sends this daemon's current status report
+func publishStatus(nc *nats.Conn, subject string) {
+	host, _ := os.Hostname()
+	var id *identity.Public
+	if current := identity.Current(); current != nil {
+		id = &current.Public
+	}
+	data, err := json.Marshal(StatusReport{
+		Host:       host,
+		Identity:   id,
+		Time:       time.Now(),
+		Daemon:     status.Status(),
+		Subsystems: status.Subsystems(),
+	})
+	if err != nil {
+		logger.Warn("Failed to encode status report", "err", err)
+		return
+	}
+	if err := nc.Publish(subject, data); err != nil {
+		logger.Warn("Failed to publish status report", "err", err)
+	}
+}
+
+// outboxMessage is a NATS message waiting for a connection
+type outboxMessage struct {
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// outbox keeps messages published while NATS is unreachable in the state
+// store, keyed <daemon>/<time>, and sends them in order on reconnect
+type outbox struct {
+	prefix string
+	limit  int
+
+	mu      sync.Mutex
+	nc      *nats.Conn
+	waiting int  // messages in the store, once counted
+	counted bool // whether waiting has been read from the store
+}
+
+// setConn sets the connection messages are published on
+func (o *outbox) setConn(nc *nats.Conn) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nc = nc
+}
+
+// publish sends a message now, or stores it if NATS is unreachable
+// While older messages are waiting, new ones queue behind them to keep order.
+// The store is only read once and when a message has to wait, so connected
+// publishing doesn't touch it.
+func (o *outbox) publish(subject string, data []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.counted {
+		if keys, err := o.keys(); err == nil {
+			o.waiting, o.counted = len(keys), true
+		} else {
+			logger.Warn("Failed to read NATS outbox", "err", err)
+		}
+	}
+	if o.counted && o.waiting == 0 && o.nc != nil && o.nc.IsConnected() {
+		if err := o.nc.Publish(subject, data); err == nil {
+			return
+		}
+	}
+
+	keys, err := o.keys()
+	if err != nil {
+		logger.Warn("Failed to read NATS outbox", "err", err)
+	}
+	key := fmt.Sprintf("%s%020d", o.prefix, time.Now().UnixNano())
+	if err := state.Put(state.BucketOutbox, key, outboxMessage{Subject: subject, Data: data}); err != nil {
+		logger.Warn("Failed to queue NATS message", "subject", subject, "err", err)
+		return
+	}
+	keys = append(keys, key)
+
+	// Drop the oldest messages beyond the limit
+	for len(keys) > o.limit {
+		if _, err := state.Delete(state.BucketOutbox, keys[0]); err != nil {
+			logger.Warn("Failed to trim NATS outbox", "err", err)
+			break
+		}
+		keys = keys[1:]
+	}
+	o.waiting, o.counted = len(keys), err == nil
+	logger.Info("NATS offline; queued message", "subject", subject, "waiting", len(keys))
+}
+
+// flush sends the stored messages in order, stopping at the first failure
+func (o *outbox) flush(nc *nats.Conn) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var pending []outboxMessage
+	var keys []string
+	err := state.ForEach(state.BucketOutbox, func(key string, data []byte) error {
+		if !strings.HasPrefix(key, o.prefix) {
+			return nil
+		}
+		var m outboxMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		pending = append(pending, m)
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Failed to read NATS outbox", "err", err)
+		return
+	}
+
+	sent := 0
+	for i, m := range pending {
+		if err := nc.Publish(m.Subject, m.Data); err != nil {
+			logger.Warn("Failed to send queued NATS messages", "err", err)
+			break
+		}
+		if _, err := state.Delete(state.BucketOutbox, keys[i]); err != nil {
+			logger.Warn("Failed to remove sent NATS message", "err", err)
+			break
+		}
+		sent++
+	}
+	o.waiting, o.counted = len(pending)-sent, true
+	if sent > 0 {
+		logger.Info("Sent queued NATS messages", "sent", sent)
+	}
+}
+
+// keys returns this daemon's stored message keys, oldest first
+func (o *outbox) keys() ([]string, error) {
+	var keys []string
+	err := state.ForEach(state.BucketOutbox, func(key string, _ []byte) error {
+		if strings.HasPrefix(key, o.prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
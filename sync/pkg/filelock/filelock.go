@@ -0,0 +1,63 @@
+package filelock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Handle is a held exclusive lock on a file
+// The lock is advisory and released by the OS if the process exits.
+type Handle struct {
+	f *os.File
+}
+
+// Acquire blocks until it holds the lock on path, creating the file if needed
+func Acquire(path string) (*Handle, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(f, true); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &Handle{f: f}, nil
+}
+
+// TryAcquire takes the lock on path if it is free, reporting whether it did
+func TryAcquire(path string) (*Handle, bool, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := lock(f, false); err != nil {
+		f.Close()
+		if isWouldBlock(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &Handle{f: f}, true, nil
+}
+
+// Release drops the lock
+func (h *Handle) Release() error {
+	if err := unlock(h.f); err != nil {
+		h.f.Close()
+		return err
+	}
+	return h.f.Close()
+}
+
+// openFile opens (or creates) the lock file
+func openFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,164 @@
+package forks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+)
+
+// errConflict marks a merge GitHub could not make cleanly
+var errConflict = errors.New("merge conflict")
+
+// MergeResult is the outcome of merging upstream into a fork
+type MergeResult struct {
+	Subsystem string `json:"subsystem"`
+	Upstream  string `json:"upstream"` // owner/name:branch
+	Commit    string `json:"commit"`   // upstream tip that was merged, or failed to
+	Conflict  bool   `json:"conflict"` // upstream doesn't merge cleanly; the pull request reports it
+	PR        int    `json:"pr"`
+	URL       string `json:"url"`
+	Opened    bool   `json:"opened"` // the pull request is new, rather than one already open
+}
+
+// Merge merges a fork's upstream branch into its merge branch and opens a
+// pull request from there into the fork's branch
+// The merge branch starts at the fork's branch and has new fork commits merged
+// in on every run. When upstream doesn't merge cleanly, a pull request
+// straight from the upstream branch reports the conflict instead. An open
+// pull request is reused rather than opened again.
+func Merge(ctx context.Context, client *github.Client, repo config.RepoConfig, d checker.Divergence) (MergeResult, error) {
+	owner, name, _ := strings.Cut(repo.Repo, "/")
+	upOwner, upName, _ := strings.Cut(repo.Fork.Upstream, "/")
+	branch, upBranch, mergeBranch := repo.ForkBranch(), repo.Fork.Branch, repo.Fork.MergeBranch
+	result := MergeResult{Subsystem: repo.Subsystem, Upstream: d.Upstream}
+
+	upTip, err := tip(ctx, client, upOwner, upName, upBranch)
+	if err != nil {
+		return result, err
+	}
+	result.Commit = upTip
+	forkTip, err := tip(ctx, client, owner, name, branch)
+	if err != nil {
+		return result, err
+	}
+
+	// Start the merge branch, or bring it up to date with the fork
+	_, resp, err := client.Git.GetRef(ctx, owner, name, "heads/"+mergeBranch)
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		ref := github.CreateRef{Ref: "refs/heads/" + mergeBranch, SHA: forkTip}
+		if _, _, err := client.Git.CreateRef(ctx, owner, name, ref); err != nil {
+			return result, ghclient.Classify(fmt.Errorf("failed to create branch %s: %w", mergeBranch, err))
+		}
+	case err != nil:
+		return result, ghclient.Classify(fmt.Errorf("failed to get branch %s: %w", mergeBranch, err))
+	default:
+		msg := fmt.Sprintf("Merge %s into %s", branch, mergeBranch)
+		if err := merge(ctx, client, owner, name, mergeBranch, branch, msg); err != nil {
+			return result, err
+		}
+	}
+
+	msg := fmt.Sprintf("Merge upstream %s (%s)", d.Upstream, revision.Short(upTip))
+	err = merge(ctx, client, owner, name, mergeBranch, upTip, msg)
+	if errors.Is(err, errConflict) {
+		result.Conflict = true
+		return openPR(ctx, client, owner, name, result, upOwner+":"+upBranch, branch, conflictTitle(d), conflictBody(d, repo, branch))
+	}
+	if err != nil {
+		return result, err
+	}
+	return openPR(ctx, client, owner, name, result, mergeBranch, branch, mergeTitle(d), mergeBody(d, mergeBranch))
+}
+
+// tip returns the commit a branch of owner/name points at
+func tip(ctx context.Context, client *github.Client, owner, name, branch string) (string, error) {
+	ref, _, err := client.Git.GetRef(ctx, owner, name, "heads/"+branch)
+	if err != nil {
+		return "", ghclient.Classify(fmt.Errorf("failed to get branch %s of %s/%s: %w", branch, owner, name, err))
+	}
+	return ref.GetObject().GetSHA(), nil
+}
+
+// merge merges head (a branch or commit) into base on GitHub
+// Conflicts wrap errConflict; a base that already has head is fine.
+func merge(ctx context.Context, client *github.Client, owner, name, base, head, msg string) error {
+	_, _, err := client.Repositories.Merge(ctx, owner, name, &github.RepositoryMergeRequest{
+		Base:          github.Ptr(base),
+		Head:          github.Ptr(head),
+		CommitMessage: github.Ptr(msg),
+	})
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%s does not merge cleanly into %s: %w", revision.Short(head), base, errConflict)
+	}
+	if err != nil {
+		return ghclient.Classify(fmt.Errorf("failed to merge %s into %s: %w", revision.Short(head), base, err))
+	}
+	return nil
+}
+
+// openPR returns the open pull request from head into base, opening one if
+// there is none
+func openPR(ctx context.Context, client *github.Client, owner, name string, result MergeResult, head, base, title, body string) (MergeResult, error) {
+	qualified := head
+	if !strings.Contains(head, ":") {
+		qualified = owner + ":" + head
+	}
+	open, _, err := client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{State: "open", Head: qualified, Base: base})
+	if err != nil {
+		return result, ghclient.Classify(fmt.Errorf("failed to list pull requests: %w", err))
+	}
+	if len(open) > 0 {
+		result.PR, result.URL = open[0].GetNumber(), open[0].GetHTMLURL()
+		return result, nil
+	}
+
+	pr, _, err := client.PullRequests.Create(ctx, owner, name, &github.NewPullRequest{
+		Title: github.Ptr(title),
+		Head:  github.Ptr(head),
+		Base:  github.Ptr(base),
+		Body:  github.Ptr(body),
+	})
+	if err != nil {
+		return result, ghclient.Classify(fmt.Errorf("failed to open a pull request from %s into %s: %w", head, base, err))
+	}
+	result.PR, result.URL, result.Opened = pr.GetNumber(), pr.GetHTMLURL(), true
+	return result, nil
+}
+
+// mergeTitle and mergeBody describe a pull request with upstream merged in
+func mergeTitle(d checker.Divergence) string {
+	return fmt.Sprintf("Merge upstream %s (%d commits)", d.Upstream, d.Behind)
+}
+
+func mergeBody(d checker.Divergence, mergeBranch string) string {
+	return fmt.Sprintf(`Merges %d upstream commit(s) from %s into %s, which carries %d commit(s) of its own.
+
+sync merged them on %s and keeps this pull request up to date. The subsystem
+builds from %s, so it is updated once this is merged.`, d.Behind, d.Upstream, d.Fork, d.Ahead, mergeBranch, d.Fork)
+}
+
+// conflictTitle and conflictBody describe a pull request reporting that
+// upstream doesn't merge cleanly
+func conflictTitle(d checker.Divergence) string {
+	return fmt.Sprintf("Merge upstream %s (%d commits, conflicts)", d.Upstream, d.Behind)
+}
+
+func conflictBody(d checker.Divergence, repo config.RepoConfig, branch string) string {
+	return fmt.Sprintf(`%s does not merge cleanly into %s: its %d new commit(s) conflict with the fork's %d own.
+
+Resolve the conflicts locally and push, then close this pull request:
+
+    git fetch https://github.com/%s.git %s
+    git checkout %s
+    git merge FETCH_HEAD`, d.Upstream, d.Fork, d.Behind, d.Ahead, repo.Fork.Upstream, repo.Fork.Branch, branch)
+}
@@ -0,0 +1,156 @@
+package freeze
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// Freeze blocks automatic updates, e.g. while an incident is open
+type Freeze struct {
+	Reason string    `json:"reason"`         // e.g. the incident ID
+	Until  time.Time `json:"until,omitzero"` // zero: until thawed
+	By     string    `json:"by"`
+	Since  time.Time `json:"since"`
+}
+
+// String returns e.g. "SEV-123 (until 2024-06-01 18:00:00, by ops@host)"
+func (f Freeze) String() string {
+	until := "until thawed"
+	if !f.Until.IsZero() {
+		until = "until " + f.Until.Local().Format(time.DateTime)
+	}
+	return fmt.Sprintf("%s (%s, by %s)", f.Reason, until, f.By)
+}
+
+// LogValue logs a freeze as its reason, who set it and its end, if any
+func (f Freeze) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("reason", f.Reason), slog.String("by", f.By)}
+	if !f.Until.IsZero() {
+		attrs = append(attrs, slog.Time("until", f.Until))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Change is a freeze or thaw, as stored and as announced to the fleet
+type Change struct {
+	Frozen bool      `json:"frozen"`
+	Freeze Freeze    `json:"freeze,omitzero"` // the freeze set, or the one lifted
+	Actor  string    `json:"actor"`
+	Time   time.Time `json:"time"`
+}
+
+// key is the state store key of the current change; there is one fleet-wide freeze
+const key = "fleet"
+
+var (
+	mu         sync.RWMutex
+	announcers []func(Change)
+)
+
+// OnChange registers fn to announce freezes and thaws made on this host to other hosts
+func OnChange(fn func(Change)) {
+	mu.Lock()
+	defer mu.Unlock()
+	announcers = append(announcers, fn)
+}
+
+// Set freezes all automatic updates until thawed or until (if not zero)
+func Set(reason string, until time.Time, actor string) (Freeze, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return Freeze{}, fmt.Errorf("a freeze needs a reason (e.g. the incident ID)")
+	}
+	now := time.Now()
+	if !until.IsZero() && !until.After(now) {
+		return Freeze{}, fmt.Errorf("freeze end %s is in the past", until.Format(time.DateTime))
+	}
+
+	f := Freeze{Reason: reason, Until: until, By: actor, Since: now}
+	c := Change{Frozen: true, Freeze: f, Actor: actor, Time: now}
+	if err := record(c, ""); err != nil {
+		return Freeze{}, err
+	}
+	announce(c)
+	return f, nil
+}
+
+// Thaw lifts the freeze, returning the one it lifted (false if none was active)
+func Thaw(actor string) (Freeze, bool, error) {
+	f, active, err := Current()
+	if err != nil || !active {
+		return f, false, err
+	}
+
+	c := Change{Frozen: false, Freeze: f, Actor: actor, Time: time.Now()}
+	if err := record(c, ""); err != nil {
+		return f, false, err
+	}
+	announce(c)
+	return f, true, nil
+}
+
+// Current returns the active freeze; an expired freeze is not active
+func Current() (Freeze, bool, error) {
+	c, found, err := Latest()
+	if err != nil || !found || !c.Frozen {
+		return Freeze{}, false, err
+	}
+	if !c.Freeze.Until.IsZero() && time.Now().After(c.Freeze.Until) {
+		return Freeze{}, false, nil
+	}
+	return c.Freeze, true, nil
+}
+
+// Latest returns the last freeze or thaw recorded on this host
+func Latest() (Change, bool, error) {
+	var c Change
+	found, err := state.Get(state.BucketFreeze, key, &c)
+	if err != nil {
+		return Change{}, false, fmt.Errorf("failed to read update freeze: %w", err)
+	}
+	return c, found, nil
+}
+
+// Apply records a change announced by another host, unless this host already
+// has the same or a newer one, reporting whether it was applied
+func Apply(c Change, source string) (bool, error) {
+	latest, found, err := Latest()
+	if err != nil {
+		return false, err
+	}
+	if found && !c.Time.After(latest.Time) {
+		return false, nil
+	}
+	return true, record(c, source)
+}
+
+// record stores a change and writes it to the audit log
+func record(c Change, source string) error {
+	if err := state.Put(state.BucketFreeze, key, c); err != nil {
+		return fmt.Errorf("failed to store update freeze: %w", err)
+	}
+
+	e := audit.Entry{Time: c.Time, Action: audit.ActionFreeze, Actor: c.Actor, Detail: c.Freeze.String()}
+	if !c.Frozen {
+		e.Action, e.Detail = audit.ActionThaw, "lifted "+c.Freeze.Reason
+	}
+	if source != "" {
+		e.Detail += " (via " + source + ")"
+	}
+	return audit.Append(e)
+}
+
+// announce passes a local change to the registered announcers
+func announce(c Change) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, fn := range announcers {
+		fn(c)
+	}
+}
@@ -0,0 +1,37 @@
+package ghclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// Classify gives a GitHub API error its kind: rate limits, rejected or
+// missing credentials, missing repos/refs, and network failures
+// Errors that are none of these are returned unchanged.
+func Classify(err error) error {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var respErr *github.ErrorResponse
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &rateErr), errors.As(err, &abuseErr):
+		return syncerr.Wrap(syncerr.RateLimited, err)
+	case errors.As(err, &respErr) && respErr.Response != nil:
+		switch respErr.Response.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return syncerr.Wrap(syncerr.AuthFailed, err)
+		case http.StatusNotFound:
+			return syncerr.Wrap(syncerr.NotFound, err)
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return syncerr.Wrap(syncerr.Network, err)
+	}
+	return err
+}
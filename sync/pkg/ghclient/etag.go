@@ -0,0 +1,87 @@
+package ghclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// cachedResponse is the last response for a URL, replayed on 304 Not Modified
+type cachedResponse struct {
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+// etagTransport makes GET requests conditional on the ETag of the last
+// response for the same URL and serves the stored body when GitHub answers
+// 304 Not Modified, which does not count against the rate limit
+// ETags and bodies are kept in the state store, so the savings survive restarts.
+type etagTransport struct {
+	base http.RoundTripper
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+
+	// Representations differ by media type; GitHub's ETags already vary by token
+	key := req.URL.String() + " " + req.Header.Get("Accept")
+	var cached cachedResponse
+	found, err := state.Get(state.BucketETags, key, &cached)
+	if err != nil {
+		logger.Warn("Failed to read cached GitHub response", "err", err)
+	}
+	if found && cached.ETag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && found:
+		resp.Body.Close()
+		metrics.GitHubNotModified()
+		return replay(req, resp, cached.Body), nil
+
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GitHub response: %w", err)
+		}
+		entry := cachedResponse{ETag: resp.Header.Get("ETag"), Body: body}
+		if err := state.Put(state.BucketETags, key, entry); err != nil {
+			logger.Warn("Failed to cache GitHub response", "err", err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return resp, nil
+}
+
+// replay turns a 304 into a 200 carrying the cached body
+// The 304's headers are kept, so rate-limit accounting stays current.
+func replay(req *http.Request, notModified *http.Response, body []byte) *http.Response {
+	h := notModified.Header.Clone()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK)),
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,125 @@
+package ghclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fixture is a recorded API response stored on disk
+type fixture struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body"`
+}
+
+// unsafeChars are replaced when mapping a request to a fixture file name
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fixtureName maps a request to its fixture file, e.g.
+// GET /repos/nats-io/nats-server/git/ref/tags/v2.10.24 -> GET_repos_nats-io_nats-server_git_ref_tags_v2.10.24.json
+func fixtureName(req *http.Request) string {
+	name := req.Method + "_" + strings.Trim(req.URL.Path, "/")
+	if query := req.URL.Query().Encode(); query != "" {
+		name += "_" + query
+	}
+	return unsafeChars.ReplaceAllString(name, "_") + ".json"
+}
+
+// replayTransport serves recorded responses from dir and never touches the network
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := filepath.Join(t.dir, fixtureName(req))
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Warn("No fixture", "method", req.Method, "path", req.URL.Path, "file", path)
+		body := fmt.Sprintf(`{"message":"Not Found (no fixture %s)"}`, filepath.Base(path))
+		return response(req, http.StatusNotFound, nil, []byte(body)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	if f.Status == 0 {
+		f.Status = http.StatusOK
+	}
+
+	return response(req, f.Status, f.Header, f.Body), nil
+}
+
+// recordTransport forwards requests and saves each response as a fixture in dir
+type recordTransport struct {
+	dir  string
+	base http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	f := fixture{Status: resp.StatusCode, Body: body}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		f.Header = map[string]string{"ETag": etag}
+	}
+	if !json.Valid(body) {
+		f.Body, _ = json.Marshal(string(body))
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(t.dir, 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(t.dir, fixtureName(req)), data, 0644)
+	}
+	if err != nil {
+		logger.Warn("Failed to record fixture", "path", req.URL.Path, "err", err)
+	}
+
+	return resp, nil
+}
+
+// response builds an in-memory HTTP response
+func response(req *http.Request, status int, header map[string]string, body []byte) *http.Response {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/json")
+	for k, v := range header {
+		h.Set(k, v)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
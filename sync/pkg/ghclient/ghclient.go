@@ -0,0 +1,119 @@
+package ghclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/chaos"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+)
+
+// logger logs the client setup, fixtures, the response cache and retries
+var logger = logging.For("ghclient")
+
+func init() {
+	capabilities.Register(capabilities.Provider, config.ProviderGitHub, config.ProviderFixture, config.ProviderRecord)
+}
+
+// ExpiryWarning is how far ahead of token expiry a warning is emitted
+const ExpiryWarning = 7 * 24 * time.Hour
+
+// expiryHeader is set by GitHub on responses to requests made with expiring tokens
+const expiryHeader = "GitHub-Authentication-Token-Expiration"
+
+// New creates a GitHub client that reads the token on every request, so a
+// rotated token takes effect without a restart
+// The provider selects where responses come from: the live API, recorded
+// fixtures in fixturesDir, or the live API while recording into fixturesDir.
+// Transient failures are retried per retry.
+func New(token *secrets.Secret, provider, fixturesDir string, retry config.GitHubConfig) *github.Client {
+	var base http.RoundTripper = nethttp.Transport()
+
+	switch provider {
+	case config.ProviderGitHub:
+		base = &etagTransport{base: base}
+	case config.ProviderFixture:
+		logger.Info("Using recorded GitHub API fixtures (offline)", "dir", fixturesDir)
+		base = &replayTransport{dir: fixturesDir}
+	case config.ProviderRecord:
+		logger.Info("Recording GitHub API responses", "dir", fixturesDir)
+		base = &recordTransport{dir: fixturesDir, base: base}
+	}
+
+	switch {
+	case provider == config.ProviderFixture:
+	case token.Get() != "":
+		logger.Info("Using authenticated GitHub API", "limit", "5000 req/hour")
+	default:
+		logger.Warn("Using unauthenticated GitHub API; set GITHUB_TOKEN for higher limits", "limit", "60 req/hour")
+	}
+
+	var transport http.RoundTripper = &authTransport{token: token, base: base}
+	if retry.Retries > 0 {
+		transport = &retryTransport{cfg: retry, base: transport}
+	}
+	return github.NewClient(&http.Client{Transport: transport})
+}
+
+// authTransport injects the current token and watches for near-expiry
+type authTransport struct {
+	token *secrets.Secret
+	base  http.RoundTripper
+
+	mu         sync.Mutex
+	lastWarned time.Time
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := chaos.Fail(chaos.Provider); err != nil {
+		metrics.GitHubResponse(nil, err)
+		return nil, err
+	}
+
+	if token := t.token.Get(); token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	metrics.GitHubResponse(resp, err)
+	if err == nil {
+		t.checkExpiry(resp)
+	}
+	return resp, err
+}
+
+// checkExpiry warns (at most hourly) when the token expires within ExpiryWarning
+func (t *authTransport) checkExpiry(resp *http.Response) {
+	value := resp.Header.Get(expiryHeader)
+	if value == "" {
+		return
+	}
+
+	// e.g. "2024-06-01 12:00:00 UTC"
+	expires, err := time.Parse("2006-01-02 15:04:05 MST", value)
+	if err != nil {
+		return
+	}
+
+	remaining := time.Until(expires)
+	if remaining > ExpiryWarning {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.lastWarned) < time.Hour {
+		return
+	}
+	t.lastWarned = time.Now()
+
+	logger.Warn("GitHub token expires soon; rotate it before then", "in", remaining.Round(time.Minute), "at", expires.Format(time.RFC3339))
+}
@@ -0,0 +1,105 @@
+package ghclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// retryTransport retries GitHub API reads that fail transiently
+// Network errors and 5xx responses back off exponentially; rate-limit
+// responses wait for Retry-After or X-RateLimit-Reset. Waits longer than
+// MaxWait are not taken: the response is returned as is, so go-github
+// reports a rate-limit error and the poller ends the cycle.
+type retryTransport struct {
+	cfg  config.GitHubConfig
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Writes are not idempotent, so only reads are retried
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.base.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt > t.cfg.Retries || req.Context().Err() != nil {
+			return resp, err
+		}
+		wait, reason := t.retryWait(resp, err, attempt)
+		if reason == "" || wait > t.cfg.MaxWait {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		logger.Warn("Retrying GitHub API request", "reason", reason, "wait", wait.Round(time.Second), "attempt", attempt, "retries", t.cfg.Retries)
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryWait decides whether an attempt should be retried and after how long
+// An empty reason means the result is final.
+func (t *retryTransport) retryWait(resp *http.Response, err error, attempt int) (time.Duration, string) {
+	if err != nil {
+		return t.backoff(attempt), fmt.Sprintf("request failed (%v)", err)
+	}
+
+	switch {
+	case resp.StatusCode >= 500:
+		if wait, ok := retryAfter(resp); ok {
+			return wait, resp.Status
+		}
+		return t.backoff(attempt), resp.Status
+
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		// Secondary rate limits say how long to back off
+		if wait, ok := retryAfter(resp); ok {
+			return wait, "secondary rate limit"
+		}
+		// The primary quota is exhausted until the reset time
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+				return max(time.Until(time.Unix(reset, 0)), 0) + time.Second, "rate limit exhausted"
+			}
+		}
+	}
+	// Other 4xx (e.g. a permission 403 or a missing tag) won't change on retry
+	return 0, ""
+}
+
+// backoff returns the delay before retry n: backoff doubled per retry
+func (t *retryTransport) backoff(n int) time.Duration {
+	delay := t.cfg.Backoff
+	for i := 1; i < n && delay < t.cfg.MaxWait; i++ {
+		delay *= 2
+	}
+	return min(delay, t.cfg.MaxWait)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+var (
+	mu          sync.RWMutex
+	credentials []config.GitCredential
+	githubToken *secrets.Secret
+	mirrorDir   string // empty unless git.mirrors is enabled
+	lfs         = true // check out Git LFS objects, unless git.lfs.disabled
+	retries     = config.DefaultGitRetries
+	backoff     = config.DefaultGitBackoff
+)
+
+// Configure sets the credentials Clone and Pull authenticate with: git.credentials,
+// and the GitHub token for github.com HTTPS remotes without one
+// With git.mirrors enabled, they also go through the local mirrors; clones
+// are retried per git.retries, and Git LFS objects checked out unless
+// git.lfs.disabled. The GitHub token is re-read as it rotates, like the
+// per-remote tokens, which are re-read on each use.
+func Configure(cfg *config.Config) error {
+	token, err := secrets.New("GitHub token", "GITHUB_TOKEN", cfg.Secrets.GitHubTokenFile)
+	if err != nil {
+		return err
+	}
+	go token.Watch(context.Background(), cfg.Secrets.ReloadInterval)
+	// HTTPS remotes go through the shared transport, for its proxy and CA bundle
+	httpClient := githttp.NewClient(nethttp.Client())
+	client.InstallProtocol("https", httpClient)
+	client.InstallProtocol("http", httpClient)
+
+	mu.Lock()
+	defer mu.Unlock()
+	credentials, githubToken = cfg.Git.Credentials, token
+	retries, backoff = cfg.Git.Retries, cfg.Git.Backoff
+	lfs = !cfg.Git.LFS.Disabled
+	mirrorDir = ""
+	if cfg.Git.Mirrors.Enabled {
+		mirrorDir = keyPath(cfg.Git.Mirrors.Dir)
+	}
+	return nil
+}
+
+// authFor returns how to authenticate to the remote at url (nil for none)
+func authFor(url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote %s: %w", url, err)
+	}
+	cred, ok := credentialFor(url)
+
+	switch ep.Protocol {
+	case "ssh":
+		user := ep.User
+		if user == "" {
+			user = "git"
+		}
+		return sshAuth(user, cred, ok)
+	case "http", "https":
+		if ok {
+			token, err := secrets.New("git token for "+cred.URL, cred.TokenEnv, keyPath(cred.TokenFile))
+			if err != nil {
+				return nil, syncerr.Wrap(syncerr.AuthFailed, err)
+			}
+			if token.Get() == "" {
+				return nil, syncerr.Wrap(syncerr.AuthFailed, fmt.Errorf("git.credentials for %s: token is empty", cred.URL))
+			}
+			username := cred.Username
+			if username == "" {
+				username = "git"
+			}
+			return &githttp.BasicAuth{Username: username, Password: token.Get()}, nil
+		}
+		mu.RLock()
+		token := githubToken
+		mu.RUnlock()
+		if ep.Host == "github.com" && token != nil && token.Get() != "" {
+			return &githttp.BasicAuth{Username: "x-access-token", Password: token.Get()}, nil
+		}
+	}
+	return nil, nil // public HTTPS, or a local path
+}
+
+// sshAuth authenticates as user with the credential's key file, or ssh-agent
+func sshAuth(user string, cred config.GitCredential, ok bool) (transport.AuthMethod, error) {
+	if ok && cred.SSHKey != "" {
+		keys, err := ssh.NewPublicKeysFromFile(user, keyPath(cred.SSHKey), os.Getenv(cred.PassphraseEnv))
+		if err != nil {
+			return nil, syncerr.Wrap(syncerr.AuthFailed, fmt.Errorf("failed to load SSH key %s: %w", cred.SSHKey, err))
+		}
+		if cred.KnownHosts != "" {
+			if keys.HostKeyCallback, err = ssh.NewKnownHostsCallback(keyPath(cred.KnownHosts)); err != nil {
+				return nil, fmt.Errorf("failed to read known_hosts %s: %w", cred.KnownHosts, err)
+			}
+		}
+		return keys, nil
+	}
+
+	agent, err := ssh.NewSSHAgentAuth(user)
+	if err != nil {
+		return nil, syncerr.Wrap(syncerr.AuthFailed, fmt.Errorf("SSH remotes need ssh_key in git.credentials or a running ssh-agent: %w", err))
+	}
+	if ok && cred.KnownHosts != "" {
+		if agent.HostKeyCallback, err = ssh.NewKnownHostsCallback(keyPath(cred.KnownHosts)); err != nil {
+			return nil, fmt.Errorf("failed to read known_hosts %s: %w", cred.KnownHosts, err)
+		}
+	}
+	return agent, nil
+}
+
+// credentialFor returns the credential with the longest URL prefix of url
+func credentialFor(url string) (config.GitCredential, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	var best config.GitCredential
+	found := false
+	for _, c := range credentials {
+		if strings.HasPrefix(url, c.URL) && (!found || len(c.URL) > len(best.URL)) {
+			best, found = c, true
+		}
+	}
+	return best, found
+}
+
+// keyPath resolves a configured file: ~/ is the home directory, relative
+// paths are relative to the project root
+func keyPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if root, err := config.ProjectRoot(); err == nil {
+		return filepath.Join(root, path)
+	}
+	return path
+}
@@ -1,18 +1,92 @@
 package gitops
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
 )
 
+// Options adjusts Clone and Pull
+type Options struct {
+	RecurseSubmodules bool      // also initialize and update submodules, and theirs
+	Progress          io.Writer // where the remote's progress messages go (nil for none)
+}
+
 // Clone clones a repository to the specified path at a specific version/branch
-func Clone(url, path, version string) error {
+// Private remotes authenticate with the credentials set by Configure. A
+// mirrored remote is cloned from its mirror, with origin still set to url.
+// The clone is made in a temporary directory next to path, retried after
+// network failures, and moved into place once complete: one that fails or is
+// cancelled through ctx leaves nothing behind at path.
+func Clone(ctx context.Context, url, path, version string, o Options) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(path); err == nil && len(entries) == 0 {
+		os.Remove(path) // an empty directory is taken over, as git clone does
+	} else if err == nil || !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clone %s: %s already exists and is not empty", url, path)
+	}
+	parent, prefix := filepath.Dir(path), "."+filepath.Base(path)+".clone-"
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", parent, err)
+	}
+	// Clones killed before they could clean up
+	if stale, err := filepath.Glob(filepath.Join(parent, prefix+"*")); err == nil {
+		for _, dir := range stale {
+			os.RemoveAll(dir)
+		}
+	}
+	tmp, err := os.MkdirTemp(parent, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to create a directory to clone into: %w", err)
+	}
+	defer os.RemoveAll(tmp) // nothing left to remove after the move
+
+	err = withRetries(ctx, "Clone of "+url, func() error {
+		os.RemoveAll(tmp)
+		return clone(ctx, url, tmp, version, o)
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to move the clone of %s into place: %w", url, err)
+	}
+	return nil
+}
+
+// clone makes one attempt at cloning url to path
+func clone(ctx context.Context, url, path, version string, o Options) error {
+	auth, err := authFor(url)
+	if err != nil {
+		return err
+	}
+	from, auth, err := fetchSource(ctx, url, auth, o.Progress)
+	if err != nil {
+		return err
+	}
 	opts := &git.CloneOptions{
-		URL:   url,
-		Depth: 1,
+		URL:      from,
+		Auth:     auth,
+		Depth:    1,
+		Progress: o.Progress,
 	}
 
 	// If version is specified, clone at that reference
@@ -20,16 +94,27 @@ func Clone(url, path, version string) error {
 		opts.ReferenceName = plumbing.ReferenceName(version)
 	}
 
-	_, err := git.PlainClone(path, false, opts)
+	repo, err := git.PlainCloneContext(ctx, path, false, opts)
 	if err != nil {
-		return fmt.Errorf("failed to clone %s: %w", url, err)
+		return classify(fmt.Errorf("failed to clone %s: %w", url, err))
+	}
+	if from != url {
+		if err := setOrigin(repo, url); err != nil {
+			return err
+		}
+	}
+	if err := lfsSmudge(ctx, repo, url, from); err != nil {
+		return err
 	}
 
+	if o.RecurseSubmodules {
+		return updateSubmodules(ctx, repo, url, git.DefaultSubmoduleRecursionDepth)
+	}
 	return nil
 }
 
 // Pull updates the repository at the specified path and returns the new commit hash
-func Pull(path string) (string, error) {
+func Pull(ctx context.Context, path string, o Options) (string, error) {
 	repo, err := git.PlainOpen(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to open repo: %w", err)
@@ -40,18 +125,287 @@ func Pull(path string) (string, error) {
 		return "", fmt.Errorf("failed to get worktree: %w", err)
 	}
 
-	err = worktree.Pull(&git.PullOptions{
+	url, auth, err := origin(repo)
+	if err != nil {
+		return "", err
+	}
+	from, auth, err := fetchSource(ctx, url, auth, o.Progress)
+	if err != nil {
+		return "", err
+	}
+
+	if err := lfsClean(repo); err != nil {
+		return "", err
+	}
+	err = worktree.PullContext(ctx, &git.PullOptions{
 		RemoteName: "origin",
+		RemoteURL:  from,
+		Auth:       auth,
+		Progress:   o.Progress,
 	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return "", fmt.Errorf("failed to pull: %w", err)
+		return "", classify(fmt.Errorf("failed to pull: %w", err))
+	}
+	if err := lfsSmudge(ctx, repo, url, from); err != nil {
+		return "", err
+	}
+	// Also when already up to date, so added submodules get initialized
+	if o.RecurseSubmodules {
+		if err := updateSubmodules(ctx, repo, url, git.DefaultSubmoduleRecursionDepth); err != nil {
+			return "", err
+		}
 	}
 
 	// Get and return new commit hash
 	return GetCommitHash(path)
 }
 
-// GetCommitHash returns the short commit hash of HEAD
+// Checkout fetches ref (a branch, tag or commit hash) from origin into the
+// repository at path, checks it out and returns the commit hash
+// A branch is checked out as a local branch at origin's tip, so later Pulls
+// follow it; tags and commits leave HEAD detached. Local changes in the way
+// fail the checkout rather than being overwritten.
+func Checkout(ctx context.Context, path, ref string, o Options) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo: %w", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+	url, auth, err := origin(repo)
+	if err != nil {
+		return "", err
+	}
+	from, auth, err := fetchSource(ctx, url, auth, o.Progress)
+	if err != nil {
+		return "", err
+	}
+
+	// Shallow clones stay shallow: fetch only the tips
+	depth := 0
+	if shallow, err := repo.Storer.Shallow(); err == nil && len(shallow) > 0 {
+		depth = 1
+	}
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RemoteURL:  from,
+		Auth:       auth,
+		Depth:      depth,
+		Tags:       git.AllTags,
+		RefSpecs:   []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Progress:   o.Progress,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", classify(fmt.Errorf("failed to fetch from %s: %w", url, err))
+	}
+
+	opts := &git.CheckoutOptions{}
+	branch := plumbing.NewRemoteReferenceName("origin", ref)
+	if tip, err := repo.Reference(branch, true); err == nil {
+		local := plumbing.NewBranchReferenceName(ref)
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(local, tip.Hash())); err != nil {
+			return "", fmt.Errorf("failed to set branch %s: %w", ref, err)
+		}
+		opts.Branch = local
+	} else if hash, err := resolve(ctx, repo, ref, from, depth, auth, o.Progress); err == nil {
+		opts.Hash = hash
+	} else {
+		return "", classify(fmt.Errorf("failed to find %s in %s: %w", ref, url, err))
+	}
+
+	if err := lfsClean(repo); err != nil {
+		return "", err
+	}
+	if err := worktree.Checkout(opts); err != nil {
+		return "", classify(fmt.Errorf("failed to check out %s: %w", ref, err))
+	}
+	if err := lfsSmudge(ctx, repo, url, from); err != nil {
+		return "", err
+	}
+	if o.RecurseSubmodules {
+		if err := updateSubmodules(ctx, repo, url, git.DefaultSubmoduleRecursionDepth); err != nil {
+			return "", err
+		}
+	}
+	return GetCommitHash(path)
+}
+
+// resolve returns the commit a tag or commit hash names, fetching a full hash
+// origin's branches and tags don't reach by itself (from origin's url, or its mirror)
+func resolve(ctx context.Context, repo *git.Repository, ref, from string, depth int, auth transport.AuthMethod, progress io.Writer) (plumbing.Hash, error) {
+	for _, rev := range []string{plumbing.NewTagReferenceName(ref).String(), ref} {
+		if hash, err := repo.ResolveRevision(plumbing.Revision(rev)); err == nil {
+			return *hash, nil
+		}
+	}
+	if !plumbing.IsHash(ref) {
+		return plumbing.ZeroHash, syncerr.Wrap(syncerr.NotFound, errors.New("no such branch, tag or commit"))
+	}
+
+	// Servers only hand out commits that are no tip with allowReachableSHA1InWant;
+	// otherwise deepen a shallow clone to full history, as git fetch --unshallow
+	fetched := plumbing.ReferenceName("refs/sync/checkout")
+	err := repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RemoteURL:  from,
+		Auth:       auth,
+		Depth:      depth,
+		RefSpecs:   []config.RefSpec{config.RefSpec(ref + ":" + fetched.String())},
+		Progress:   progress,
+	})
+	if errors.Is(err, git.ErrExactSHA1NotSupported) && depth > 0 {
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: "origin",
+			RemoteURL:  from,
+			Auth:       auth,
+			Depth:      math.MaxInt32,
+			RefSpecs:   []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+			Progress:   progress,
+		})
+	}
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return plumbing.ZeroHash, err
+	}
+	repo.Storer.RemoveReference(fetched)
+	if _, err := repo.CommitObject(plumbing.NewHash(ref)); err != nil {
+		return plumbing.ZeroHash, syncerr.Wrap(syncerr.NotFound, err)
+	}
+	return plumbing.NewHash(ref), nil
+}
+
+// RemoteTags lists the tags of the remote at url by the commit they point to,
+// without cloning it
+func RemoteTags(url string) (map[string]string, error) {
+	auth, err := authFor(url)
+	if err != nil {
+		return nil, err
+	}
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{url}})
+	refs, err := remote.List(&git.ListOptions{Auth: auth, PeelingOption: git.AppendPeeled})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list tags of %s: %w", url, err))
+	}
+
+	tags := make(map[string]string)
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		// Annotated tags are listed twice; the peeled name^{} carries the commit
+		name, peeled := strings.CutSuffix(ref.Name().Short(), "^{}")
+		if _, seen := tags[name]; !seen || peeled {
+			tags[name] = ref.Hash().String()
+		}
+	}
+	return tags, nil
+}
+
+// OriginURL returns the URL of the origin remote of the repository at path
+func OriginURL(path string) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo: %w", err)
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return "", fmt.Errorf("failed to get remote origin: %w", err)
+	}
+	if urls := remote.Config().URLs; len(urls) > 0 {
+		return urls[0], nil
+	}
+	return "", fmt.Errorf("remote origin of %s has no URL", path)
+}
+
+// origin returns the URL of a repository's origin remote and the credentials for it
+func origin(repo *git.Repository) (string, transport.AuthMethod, error) {
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get remote origin: %w", err)
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", nil, nil
+	}
+	auth, err := authFor(urls[0])
+	if err != nil {
+		return "", nil, err
+	}
+	return urls[0], auth, nil
+}
+
+// setOrigin points a repository's origin remote at url
+func setOrigin(repo *git.Repository, url string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repo config: %w", err)
+	}
+	cfg.Remotes["origin"].URLs = []string{url}
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to set the URL of origin: %w", err)
+	}
+	return nil
+}
+
+// updateSubmodules initializes the submodules of repo (cloned from url) and
+// checks out the commits it records, then does the same for theirs, down to
+// depth levels
+// Each submodule authenticates per its own URL, as set by Configure.
+func updateSubmodules(ctx context.Context, repo *git.Repository, url string, depth git.SubmoduleRescursivity) error {
+	if depth == 0 {
+		return nil
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+
+	for _, sub := range submodules {
+		cfg := sub.Config()
+		subURL := submoduleURL(url, cfg.URL)
+		cfg.URL = subURL // go-git would resolve a relative URL against the working directory
+		auth, err := authFor(subURL)
+		if err != nil {
+			return err
+		}
+		err = sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{Init: true, Auth: auth})
+		if err != nil {
+			return classify(fmt.Errorf("failed to update submodule %s from %s: %w", cfg.Path, subURL, err))
+		}
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("failed to open submodule %s: %w", cfg.Path, err)
+		}
+		if err := updateSubmodules(ctx, subRepo, subURL, depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submoduleURL resolves a submodule URL relative to its superproject's remote,
+// e.g. ../lib.git next to https://github.com/acme/app.git
+func submoduleURL(parent, url string) string {
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url
+	}
+	root, err := transport.NewEndpoint(parent)
+	if err != nil {
+		return url
+	}
+	root.Path = path.Join(root.Path, url)
+	if root.Protocol == "file" {
+		return root.Path
+	}
+	return root.String()
+}
+
+// GetCommitHash returns the full commit hash of HEAD
 func GetCommitHash(path string) (string, error) {
 	repo, err := git.PlainOpen(path)
 	if err != nil {
@@ -63,13 +417,7 @@ func GetCommitHash(path string) (string, error) {
 		return "", fmt.Errorf("failed to get HEAD: %w", err)
 	}
 
-	// Return short hash (first 7 characters)
-	hash := head.Hash().String()
-	if len(hash) > 7 {
-		hash = hash[:7]
-	}
-
-	return hash, nil
+	return head.Hash().String(), nil
 }
 
 // GetCommitHashFromBinary returns the commit hash from a binary's parent .src directory
@@ -81,3 +429,24 @@ func GetCommitHashFromBinary(binPath string) (string, error) {
 
 	return GetCommitHash(srcDir)
 }
+
+// classify gives clone and pull errors their kind: local changes in the way,
+// rejected credentials, a missing repo, or a timeout, dropped connection or
+// server error
+func classify(err error) error {
+	var netErr net.Error
+	var httpErr *githttp.Err
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return syncerr.Wrap(syncerr.Network, err)
+	case errors.As(err, &httpErr) && httpErr.Response != nil && httpErr.Response.StatusCode >= 500:
+		return syncerr.Wrap(syncerr.Network, err)
+	case errors.Is(err, git.ErrUnstagedChanges), errors.Is(err, git.ErrWorktreeNotClean):
+		return syncerr.Wrap(syncerr.WorktreeDirty, err)
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+		return syncerr.Wrap(syncerr.AuthFailed, err)
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return syncerr.Wrap(syncerr.NotFound, err)
+	}
+	return err
+}
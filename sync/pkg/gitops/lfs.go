@@ -0,0 +1,472 @@
+package gitops
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+const (
+	lfsPointerMax = 1024 // the largest an LFS pointer file may be
+	lfsBatchSize  = 100  // objects per batch API request
+	lfsMediaType  = "application/vnd.git-lfs+json"
+)
+
+// lfsPointer is a file checked out as a Git LFS pointer
+type lfsPointer struct {
+	path    string // in the worktree
+	mode    os.FileMode
+	pointer []byte // the pointer file, as committed
+	oid     string // sha256 of the object
+	size    int64
+}
+
+// lfsObject is an object in a batch API request or response
+type lfsObject struct {
+	OID     string               `json:"oid"`
+	Size    int64                `json:"size"`
+	Actions map[string]lfsAction `json:"actions,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// lfsAction is where the batch API says to download an object from
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// lfsSmudge replaces the Git LFS pointers checked out in repo (cloned from
+// url) with their objects, as git lfs pull does
+// Objects are cached in .git/lfs/objects, or with git.mirrors next to the
+// mirror from, which a checkout of another commit reuses. They are fetched
+// through the LFS batch API: lfs.url of .lfsconfig, else the remote's
+// /info/lfs, over HTTPS for SSH remotes. Local remotes are read directly.
+func lfsSmudge(ctx context.Context, repo *git.Repository, url, from string) error {
+	if !lfsEnabled() {
+		return nil
+	}
+	root, pointers, err := lfsPointers(repo)
+	if err != nil || len(pointers) == 0 {
+		return err
+	}
+	store := lfsStore(root, url, from)
+
+	var missing []lfsPointer
+	var size int64
+	for _, p := range pointers {
+		if _, err := os.Stat(lfsObjectPath(store, p.oid)); err != nil {
+			missing = append(missing, p)
+			size += p.size
+		}
+	}
+	if len(missing) > 0 {
+		logger.Info("Fetching Git LFS objects", "url", url, "objects", len(missing), "bytes", size)
+		if err := lfsFetch(ctx, root, url, store, missing); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range pointers {
+		if err := lfsWrite(filepath.Join(root, p.path), lfsObjectPath(store, p.oid), p.mode); err != nil {
+			return fmt.Errorf("failed to check out LFS object %s: %w", p.path, err)
+		}
+	}
+	return nil
+}
+
+// lfsEnabled reports whether Git LFS objects are checked out
+func lfsEnabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return lfs
+}
+
+// lfsClean puts the pointers back in place of the LFS objects lfsSmudge
+// checked out, so go-git sees a clean worktree before a pull or checkout
+// Files changed since are left alone and still count as local changes.
+func lfsClean(repo *git.Repository) error {
+	if !lfsEnabled() {
+		return nil
+	}
+	root, pointers, err := lfsAllPointers(repo)
+	if err != nil {
+		return err
+	}
+	for _, p := range pointers {
+		file := filepath.Join(root, p.path)
+		if info, err := os.Stat(file); err != nil || info.Size() != p.size {
+			continue
+		}
+		if sum, err := fileSHA256(file); err != nil || sum != p.oid {
+			continue
+		}
+		if err := os.WriteFile(file, p.pointer, p.mode); err != nil {
+			return fmt.Errorf("failed to restore the LFS pointer %s: %w", p.path, err)
+		}
+	}
+	return nil
+}
+
+// lfsPointers returns the worktree root of repo and the files in it that
+// are still LFS pointers
+func lfsPointers(repo *git.Repository) (string, []lfsPointer, error) {
+	root, all, err := lfsAllPointers(repo)
+	if err != nil {
+		return "", nil, err
+	}
+	var pointers []lfsPointer
+	for _, p := range all {
+		if data, err := os.ReadFile(filepath.Join(root, p.path)); err == nil && bytes.Equal(data, p.pointer) {
+			pointers = append(pointers, p)
+		}
+	}
+	return root, pointers, nil
+}
+
+// lfsAllPointers returns the worktree root of repo and the files its index
+// has as LFS pointers, whether or not lfsSmudge replaced them since
+func lfsAllPointers(repo *git.Repository) (string, []lfsPointer, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the index: %w", err)
+	}
+
+	var pointers []lfsPointer
+	for _, e := range idx.Entries {
+		if e.Size > lfsPointerMax || (e.Mode != filemode.Regular && e.Mode != filemode.Executable) {
+			continue
+		}
+		blob, err := repo.BlobObject(e.Hash)
+		if err != nil || blob.Size > lfsPointerMax {
+			continue
+		}
+		r, err := blob.Reader()
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			continue
+		}
+		if oid, size, ok := parseLFSPointer(data); ok {
+			mode, _ := e.Mode.ToOSFileMode()
+			pointers = append(pointers, lfsPointer{path: filepath.FromSlash(e.Name), mode: mode, pointer: data, oid: oid, size: size})
+		}
+	}
+	return worktree.Filesystem.Root(), pointers, nil
+}
+
+// parseLFSPointer returns the object a pointer file names, or false when
+// data is no pointer
+// A pointer is "version https://git-lfs.github.com/spec/v1", then
+// "oid sha256:<hex>" and "size <bytes>" among sorted key/value lines.
+func parseLFSPointer(data []byte) (string, int64, bool) {
+	var oid string
+	size := int64(-1)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for i := 0; scanner.Scan(); i++ {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		switch {
+		case !ok:
+			return "", 0, false
+		case i == 0:
+			if key != "version" || (value != "https://git-lfs.github.com/spec/v1" && value != "https://hawser.github.com/spec/v1") {
+				return "", 0, false
+			}
+		case key == "oid":
+			hash, ok := strings.CutPrefix(value, "sha256:")
+			if _, err := hex.DecodeString(hash); !ok || err != nil || len(hash) != sha256.Size*2 {
+				return "", 0, false
+			}
+			oid = hash
+		case key == "size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return "", 0, false
+			}
+			size = n
+		}
+	}
+	return oid, size, oid != "" && size >= 0
+}
+
+// lfsStore returns the directory LFS objects of the clone at root are cached in
+func lfsStore(root, url, from string) string {
+	if from != url {
+		return filepath.Join(from, "lfs", "objects") // with the mirror, shared by its clones
+	}
+	return filepath.Join(root, ".git", "lfs", "objects")
+}
+
+// lfsObjectPath returns where an object is kept in a store, laid out as git-lfs does
+func lfsObjectPath(store, oid string) string {
+	return filepath.Join(store, oid[0:2], oid[2:4], oid)
+}
+
+// lfsFetch downloads objects into store, verifying their checksums
+func lfsFetch(ctx context.Context, root, url, store string, objects []lfsPointer) error {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return fmt.Errorf("invalid remote %s: %w", url, err)
+	}
+	api := lfsURL(root)
+	if api == "" && ep.Protocol == "file" {
+		return lfsCopyLocal(ep.Path, store, objects)
+	}
+	if api == "" {
+		api = lfsDefaultURL(ep)
+	}
+	auth, err := authFor(api)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(objects); start += lfsBatchSize {
+		batch := objects[start:min(start+lfsBatchSize, len(objects))]
+		answer, err := lfsBatch(ctx, api, auth, batch)
+		if err != nil {
+			return err
+		}
+		for _, obj := range answer {
+			if obj.Error != nil {
+				kind := syncerr.Unknown
+				if obj.Error.Code == http.StatusNotFound || obj.Error.Code == http.StatusGone {
+					kind = syncerr.NotFound
+				}
+				return syncerr.Wrap(kind, fmt.Errorf("LFS object %s of %s: %s", obj.OID, url, obj.Error.Message))
+			}
+			download, ok := obj.Actions["download"]
+			if !ok {
+				continue // the server says it already is here
+			}
+			if err := lfsDownload(ctx, download, store, obj.OID, obj.Size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lfsURL returns lfs.url from the .lfsconfig at the worktree root, if any
+func lfsURL(root string) string {
+	f, err := os.Open(filepath.Join(root, ".lfsconfig"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	cfg := formatcfg.New()
+	if err := formatcfg.NewDecoder(f).Decode(cfg); err != nil {
+		return ""
+	}
+	return cfg.Section("lfs").Option("url")
+}
+
+// lfsDefaultURL returns the LFS API git-lfs assumes for a remote, e.g.
+// https://github.com/acme/app.git/info/lfs for git@github.com:acme/app
+func lfsDefaultURL(ep *transport.Endpoint) string {
+	scheme := ep.Protocol
+	if scheme != "http" {
+		scheme = "https"
+	}
+	host := ep.Host
+	if ep.Port != 0 && scheme == ep.Protocol {
+		host += ":" + strconv.Itoa(ep.Port)
+	}
+	path := strings.TrimSuffix(strings.TrimPrefix(ep.Path, "/"), "/")
+	if !strings.HasSuffix(path, ".git") {
+		path += ".git"
+	}
+	return scheme + "://" + host + "/" + path + "/info/lfs"
+}
+
+// lfsBatch asks the LFS API at api where to download objects from
+func lfsBatch(ctx context.Context, api string, auth transport.AuthMethod, objects []lfsPointer) ([]lfsObject, error) {
+	request := struct {
+		Operation string      `json:"operation"`
+		Transfers []string    `json:"transfers"`
+		Objects   []lfsObject `json:"objects"`
+	}{Operation: "download", Transfers: []string{"basic"}}
+	for _, p := range objects {
+		request.Objects = append(request.Objects, lfsObject{OID: p.oid, Size: p.size})
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, api+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LFS URL %s: %w", api, err)
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	if basic, ok := auth.(*githttp.BasicAuth); ok {
+		req.SetBasicAuth(basic.Username, basic.Password)
+	}
+	resp, err := nethttp.Client().Do(req)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to reach the LFS server %s: %w", api, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, syncerr.Wrap(lfsKind(resp.StatusCode), fmt.Errorf("LFS server %s: %s", api, resp.Status))
+	}
+
+	var answer struct {
+		Objects []lfsObject `json:"objects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("invalid response from the LFS server %s: %w", api, err)
+	}
+	return answer.Objects, nil
+}
+
+// lfsDownload downloads an object into store
+// The batch API's credentials are not sent: downloads usually go to storage
+// with a signed URL or the action's own headers.
+func lfsDownload(ctx context.Context, action lfsAction, store, oid string, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, action.Href, nil)
+	if err != nil {
+		return fmt.Errorf("invalid download URL for LFS object %s: %w", oid, err)
+	}
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+	resp, err := nethttp.Client().Do(req)
+	if err != nil {
+		return classify(fmt.Errorf("failed to download LFS object %s: %w", oid, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return syncerr.Wrap(lfsKind(resp.StatusCode), fmt.Errorf("failed to download LFS object %s: %s", oid, resp.Status))
+	}
+	return lfsStoreObject(resp.Body, store, oid, size)
+}
+
+// lfsCopyLocal copies objects from the LFS store of a local remote
+func lfsCopyLocal(remote, store string, objects []lfsPointer) error {
+	sources := []string{filepath.Join(remote, ".git", "lfs", "objects"), filepath.Join(remote, "lfs", "objects")}
+	for _, p := range objects {
+		var f *os.File
+		var err error
+		for _, src := range sources {
+			if f, err = os.Open(lfsObjectPath(src, p.oid)); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return syncerr.Wrap(syncerr.NotFound, fmt.Errorf("LFS object %s of %s is not in %s: %w", p.path, remote, sources[0], err))
+		}
+		err = lfsStoreObject(f, store, p.oid, p.size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lfsStoreObject writes an object from r into store, unless it does not
+// match its oid and size
+func lfsStoreObject(r io.Reader, store, oid string, size int64) error {
+	target := lfsObjectPath(store, oid)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create the LFS object store: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), oid+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to store LFS object %s: %w", oid, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to download LFS object %s: %w", oid, err))
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); n != size || sum != oid {
+		return syncerr.Wrap(syncerr.ChecksumMismatch, fmt.Errorf("LFS object %s: got %d bytes with sha256 %s, want %d bytes", oid, n, sum, size))
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// lfsWrite replaces the pointer file at path with the object at obj
+func lfsWrite(path, obj string, mode os.FileMode) error {
+	src, err := os.Open(obj)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".lfs-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lfsKind gives an LFS server's error status its kind
+func lfsKind(status int) syncerr.Kind {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return syncerr.AuthFailed
+	case status == http.StatusNotFound:
+		return syncerr.NotFound
+	case status == http.StatusTooManyRequests || status >= 500:
+		return syncerr.Network
+	}
+	return syncerr.Unknown
+}
+
+// fileSHA256 returns the hex sha256 of a file's content
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,100 @@
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Commit is a commit as listed by Log
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Subject string    `json:"subject"` // first line of the message
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"` // authored
+}
+
+// Log lists the commits of the repository at path that to has and from
+// doesn't, newest first, like git log from..to
+// from and to may be abbreviated hashes, tags or branches. A shallow clone
+// whose history doesn't reach from fails rather than listing a partial range.
+func Log(path, from, to string) ([]Commit, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repo: %w", err)
+	}
+	fromHash, err := repo.ResolveRevision(plumbing.Revision(from))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in %s: %w", from, path, err)
+	}
+	toHash, err := repo.ResolveRevision(plumbing.Revision(to))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in %s: %w", to, path, err)
+	}
+
+	// History a shallow clone cut off is fine below from, where both sides
+	// stop, but not on the way from to down to from
+	shallow := make(map[plumbing.Hash]bool)
+	if cut, err := repo.Storer.Shallow(); err == nil {
+		for _, h := range cut {
+			shallow[h] = true
+		}
+	}
+	seen := make(map[plumbing.Hash]bool)
+	if _, err := walk(repo, *fromHash, seen, shallow, false); err != nil {
+		return nil, err
+	}
+	commits, err := walk(repo, *toHash, seen, shallow, true)
+	if err != nil {
+		return nil, fmt.Errorf("history of %s does not reach %s: %w", path, from, err)
+	}
+
+	list := make([]Commit, 0, len(commits))
+	for _, c := range commits {
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		list = append(list, Commit{SHA: c.Hash.String(), Subject: subject, Author: c.Author.Name, Date: c.Author.When})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Date.After(list[j].Date)
+	})
+	return list, nil
+}
+
+// walk visits start and its ancestors not yet in seen, marking them seen and
+// returning them
+// The walk ends at the shallow commits of a shallow clone, or in strict mode
+// fails there.
+func walk(repo *git.Repository, start plumbing.Hash, seen, shallow map[plumbing.Hash]bool, strict bool) ([]*object.Commit, error) {
+	var visited []*object.Commit
+	queue := []plumbing.Hash{start}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		c, err := repo.CommitObject(hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil, fmt.Errorf("commit %s is missing", hash)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		seen[hash] = true
+		visited = append(visited, c)
+		if shallow[hash] {
+			if strict {
+				return nil, fmt.Errorf("commit %s is the end of a shallow clone", hash)
+			}
+			continue
+		}
+		queue = append(queue, c.ParentHashes...)
+	}
+	return visited, nil
+}
@@ -0,0 +1,121 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/filelock"
+)
+
+// mirrorRefSpecs are the refs a mirror keeps: branches and tags, not the
+// pull request refs GitHub also advertises
+var mirrorRefSpecs = []config.RefSpec{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
+// fetchSource returns where to fetch the remote at url from: with git.mirrors
+// enabled its local mirror, brought up to date first, else url itself with auth
+// Local paths are never mirrored.
+func fetchSource(ctx context.Context, url string, auth transport.AuthMethod, progress io.Writer) (string, transport.AuthMethod, error) {
+	mu.RLock()
+	dir := mirrorDir
+	mu.RUnlock()
+	if dir == "" || url == "" {
+		return url, auth, nil
+	}
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid remote %s: %w", url, err)
+	}
+	if ep.Protocol == "file" {
+		return url, auth, nil
+	}
+
+	// e.g. <dir>/github.com/influxdata/telegraf.git
+	name := strings.TrimSuffix(filepath.Clean("/"+ep.Path), ".git") + ".git"
+	path := filepath.Join(dir, ep.Host, name)
+	if err := updateMirror(ctx, url, path, auth, progress); err != nil {
+		return "", nil, err
+	}
+	return path, nil, nil
+}
+
+// updateMirror creates the bare mirror of url at path, or fetches what it
+// lacks, dropping branches and tags the remote deleted
+// A lock next to the mirror keeps concurrent clones from fetching into it at
+// once.
+func updateMirror(ctx context.Context, url, path string, auth transport.AuthMethod, progress io.Writer) error {
+	lock, err := lockMirror(ctx, path+".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	repo, err := git.PlainOpen(path)
+	created := errors.Is(err, git.ErrRepositoryNotExists)
+	if created {
+		repo, err = git.PlainInit(path, true)
+		if err == nil {
+			_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}, Fetch: mirrorRefSpecs, Mirror: true})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open mirror %s: %w", path, err)
+	}
+
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return fmt.Errorf("failed to get remote origin of mirror %s: %w", path, err)
+	}
+	err = remote.FetchContext(ctx, &git.FetchOptions{RemoteName: "origin", Auth: auth, RefSpecs: mirrorRefSpecs, Prune: true, Progress: progress})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		if created {
+			os.RemoveAll(path) // a half-made mirror would pass for an empty one next time
+		}
+		return classify(fmt.Errorf("failed to update the mirror of %s: %w", url, err))
+	}
+	return mirrorHead(ctx, remote, repo, auth)
+}
+
+// lockMirror waits for the lock of a mirror until ctx is done
+func lockMirror(ctx context.Context, path string) (*filelock.Handle, error) {
+	for {
+		lock, ok, err := filelock.TryAcquire(path)
+		if err != nil || ok {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, classify(fmt.Errorf("mirror %s is locked by another clone: %w", strings.TrimSuffix(path, ".lock"), ctx.Err()))
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// mirrorHead points the mirror's HEAD at the remote's default branch, which
+// clones without a version check out
+func mirrorHead(ctx context.Context, remote *git.Remote, repo *git.Repository, auth transport.AuthMethod) error {
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return classify(fmt.Errorf("failed to list refs of %s: %w", remote.Config().URLs[0], err))
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, ref.Target())); err != nil {
+				return fmt.Errorf("failed to set HEAD of the mirror: %w", err)
+			}
+		}
+	}
+	return nil
+}
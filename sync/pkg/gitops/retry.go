@@ -0,0 +1,36 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// logger logs git operations worth knowing about as they happen
+var logger = logging.For("gitops")
+
+// withRetries runs op, retrying it per git.retries with doubling backoff
+// while it fails with a network error and ctx isn't done
+func withRetries(ctx context.Context, what string, op func() error) error {
+	mu.RLock()
+	left, wait := retries, backoff
+	mu.RUnlock()
+
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || left <= 0 || ctx.Err() != nil || syncerr.KindOf(err) != syncerr.Network {
+			return err
+		}
+		logger.Warn("Retrying after a network error", "op", what, "attempt", attempt, "wait", wait, "err", err)
+		select {
+		case <-ctx.Done():
+			return classify(fmt.Errorf("%w (gave up retrying: %w)", err, ctx.Err()))
+		case <-time.After(wait):
+		}
+		left--
+		wait *= 2
+	}
+}
@@ -0,0 +1,145 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// logger logs ledger imports
+var logger = logging.For("history")
+
+// Entry is a single update attempt recorded in the ledger
+type Entry struct {
+	Time      time.Time     `json:"time"`
+	Subsystem string        `json:"subsystem"`
+	From      string        `json:"from,omitempty"` // version before the update
+	To        string        `json:"to,omitempty"`   // version after the update
+	Trigger   string        `json:"trigger"`        // poll, taskfile, webhook, manual, nats, rollback, approved, delta, promote, adopt, regression
+	Success   bool          `json:"success"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+	ErrorKind syncerr.Kind  `json:"errorKind,omitempty"` // e.g. build_failed, see sync errors
+	Disk      int64         `json:"disk,omitempty"`      // bytes of free space a successful update used up
+	Published time.Time     `json:"published,omitzero"`  // when upstream published the version that triggered it, if known
+}
+
+// keyFormat gives fixed-width UTC keys so the store iterates in time order
+const keyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// key returns the state store key for an entry
+func (e Entry) key() string {
+	return e.Time.UTC().Format(keyFormat) + "/" + e.Subsystem
+}
+
+// Append records an entry in the state store
+func Append(e Entry) error {
+	if err := importLedger(); err != nil {
+		return err
+	}
+	return state.Put(state.BucketUpdates, e.key(), e)
+}
+
+// Load reads all recorded entries, oldest first
+// An empty store is not an error (no updates recorded yet)
+func Load() ([]Entry, error) {
+	if err := importLedger(); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	err := state.ForEach(state.BucketUpdates, func(key string, data []byte) error {
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("history entry %s: %w", key, err)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+// Latest returns the most recent entry per subsystem
+func Latest(entries []Entry) map[string]Entry {
+	latest := make(map[string]Entry)
+	for _, e := range entries {
+		latest[e.Subsystem] = e
+	}
+	return latest
+}
+
+// At returns the last successful update per subsystem at or before t
+func At(entries []Entry, t time.Time) map[string]Entry {
+	installed := make(map[string]Entry)
+	for _, e := range entries {
+		if e.Time.After(t) {
+			break
+		}
+		if e.Success {
+			installed[e.Subsystem] = e
+		}
+	}
+	return installed
+}
+
+// importLedger moves entries from the old <data dir>/history.jsonl ledger into
+// the state store, renaming the file to history.jsonl.imported when done
+func importLedger() error {
+	dir, err := config.DataDir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "history.jsonl")
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := state.Put(state.BucketUpdates, e.key(), e); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return fmt.Errorf("failed to retire ledger: %w", err)
+	}
+	logger.Info("Imported history entries into the state store", "entries", count, "from", path)
+	return nil
+}
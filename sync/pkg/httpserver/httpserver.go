@@ -0,0 +1,53 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/pki"
+)
+
+// New creates an http.Server with the timeouts, limits and TLS settings from cfg
+func New(addr string, handler http.Handler, cfg config.ServerConfig) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		Protocols:         new(http.Protocols),
+	}
+
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := pki.ServerTLSConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	// HTTP/1 is always served; HTTP/2 only when enabled (h2c without TLS)
+	srv.Protocols.SetHTTP1(true)
+	if cfg.HTTP2.Enabled {
+		if srv.TLSConfig != nil {
+			srv.Protocols.SetHTTP2(true)
+		} else {
+			srv.Protocols.SetUnencryptedHTTP2(true)
+		}
+		srv.HTTP2 = &http.HTTP2Config{
+			MaxConcurrentStreams: cfg.HTTP2.MaxConcurrentStreams,
+		}
+	}
+
+	return srv, nil
+}
+
+// ListenAndServe serves HTTPS when the server has a TLS config, HTTP otherwise
+func ListenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,137 @@
+package i18n
+
+// catalogs holds the messages of each locale, keyed by message ID
+// en must have every message; other locales fall back to it for missing ones.
+// hint.<kind> entries translate the English hints of pkg/syncerr, so en has none.
+var catalogs = map[string]map[string]string{
+	"en": {
+		"config.load_failed": "Failed to load config",
+
+		"check.no_repos":          "No repos configured in sync.yaml",
+		"check.unknown_subsystem": "Unknown subsystem %s (not in the repos of sync.yaml)",
+		"check.token_failed":      "Failed to load GitHub token: %v",
+		"check.checking":          "Checking for upstream updates...",
+		"check.up_to_date":        "%s: up-to-date (%s)",
+		"check.available":         "%s: %s → %s (update available)",
+		"check.supersedes":        "%s: %s → %s (update available: release %s supersedes the pinned %s)",
+
+		"history.empty":             "No updates recorded yet",
+		"history.state_at":          "Subsystem state at %s:",
+		"history.installed_current": "%s: %s (installed %s, current)",
+		"history.installed_via":     "%s: %s (installed %s via %s)",
+		"history.unknown":           "%s: unknown (no install recorded at or before this time)",
+
+		"pending.none":      "No updates awaiting approval",
+		"pending.header":    "Updates awaiting approval:",
+		"pending.entry":     "%-12s %s → %s  (%s, detected %s)",
+		"pending.hint":      "Run `sync approve <subsystem>` to apply or `sync reject <subsystem>` to discard",
+		"pending.discarded": "Discarded %s update %s → %s",
+
+		"status.none":        "No updates queued or running",
+		"status.header":      "Update queue:",
+		"status.running":     "%-14s %-12s running for %s (%s)",
+		"status.queued":      "%-14s %-12s #%d queued (%s)",
+		"status.retrying":    "%-14s %-12s #%d retrying after %d failed attempt(s), not before %s",
+		"status.eta":         "ETA %s (in %s)",
+		"status.eta_unknown": "ETA unknown",
+		"status.done_by":     "All queued updates done by about %s (in %s)",
+
+		"freeze.frozen":       "Updates frozen: %s",
+		"freeze.detail":       "%s (%s, by %s)",
+		"freeze.until":        "until %s",
+		"freeze.until_thawed": "until thawed",
+		"freeze.note":         "Automatic updates wait until `sync thaw`; sync update, approve and rollback still run",
+		"freeze.not_frozen":   "Updates are not frozen",
+		"freeze.thawed":       "Updates thawed (lifted %s)",
+		"audit.empty":         "No audited actions recorded",
+
+		"rollback.done":    "%s rolled back: %s → %s",
+		"rollback.restart": "Restart it to run the restored binary: task reload PROC=%s",
+		"promote.none":     "No releases promoted yet",
+
+		"phase.snapshot": "snapshotting data",
+		"phase.build":    "building",
+		"phase.download": "downloading the release",
+		"phase.scan":     "scanning the build",
+		"phase.validate": "checking configs",
+		"phase.install":  "installing",
+		"phase.render":   "writing configs",
+		"phase.restart":  "restarting",
+		"phase.migrate":  "running migrations",
+		"phase.health":   "checking health",
+	},
+	"de": {
+		"config.load_failed": "Konfiguration konnte nicht geladen werden",
+
+		"check.no_repos":          "Keine Repos in sync.yaml konfiguriert",
+		"check.unknown_subsystem": "Unbekanntes Subsystem %s (nicht unter den Repos in sync.yaml)",
+		"check.token_failed":      "GitHub-Token konnte nicht geladen werden: %v",
+		"check.checking":          "Suche nach Upstream-Updates...",
+		"check.up_to_date":        "%s: aktuell (%s)",
+		"check.available":         "%s: %s → %s (Update verfügbar)",
+		"check.supersedes":        "%s: %s → %s (Update verfügbar: Release %s löst das gepinnte %s ab)",
+
+		"history.empty":             "Noch keine Updates aufgezeichnet",
+		"history.state_at":          "Stand der Subsysteme am %s:",
+		"history.installed_current": "%s: %s (installiert %s, aktuell)",
+		"history.installed_via":     "%s: %s (installiert %s über %s)",
+		"history.unknown":           "%s: unbekannt (bis zu diesem Zeitpunkt keine Installation aufgezeichnet)",
+
+		"pending.none":      "Keine Updates warten auf Freigabe",
+		"pending.header":    "Updates, die auf Freigabe warten:",
+		"pending.entry":     "%-12s %s → %s  (%s, erkannt %s)",
+		"pending.hint":      "`sync approve <subsystem>` wendet ein Update an, `sync reject <subsystem>` verwirft es",
+		"pending.discarded": "Update für %s verworfen: %s → %s",
+
+		"status.none":        "Keine Updates in der Warteschlange oder in Arbeit",
+		"status.header":      "Update-Warteschlange:",
+		"status.running":     "%-14s %-12s läuft seit %s (%s)",
+		"status.queued":      "%-14s %-12s #%d wartet (%s)",
+		"status.retrying":    "%-14s %-12s #%d neuer Versuch nach %d Fehlschlag/-schlägen, frühestens %s",
+		"status.eta":         "fertig etwa %s (in %s)",
+		"status.eta_unknown": "Ende unbekannt",
+		"status.done_by":     "Alle Updates der Warteschlange fertig etwa %s (in %s)",
+
+		"freeze.frozen":       "Updates eingefroren: %s",
+		"freeze.detail":       "%s (%s, von %s)",
+		"freeze.until":        "bis %s",
+		"freeze.until_thawed": "bis zum Auftauen",
+		"freeze.note":         "Automatische Updates warten bis `sync thaw`; sync update, approve und rollback laufen weiter",
+		"freeze.not_frozen":   "Updates sind nicht eingefroren",
+		"freeze.thawed":       "Updates aufgetaut (%s aufgehoben)",
+		"audit.empty":         "Keine protokollierten Aktionen",
+
+		"rollback.done":    "%s zurückgesetzt: %s → %s",
+		"rollback.restart": "Zum Ausführen des wiederhergestellten Binaries neu starten: task reload PROC=%s",
+		"promote.none":     "Noch keine Releases befördert",
+
+		"phase.snapshot": "Daten-Snapshot",
+		"phase.build":    "Build",
+		"phase.download": "Release wird heruntergeladen",
+		"phase.scan":     "Build wird gescannt",
+		"phase.validate": "Konfiguration wird geprüft",
+		"phase.install":  "Installation",
+		"phase.render":   "Konfiguration wird geschrieben",
+		"phase.restart":  "Neustart",
+		"phase.migrate":  "Migrationen",
+		"phase.health":   "Health-Check",
+
+		"hint.unknown":             "siehe die Fehlermeldung und das Log davor",
+		"hint.config_invalid":      "sync.yaml (oder die Datei in SYNC_CONFIG) korrigieren und erneut versuchen",
+		"hint.auth_failed":         "GITHUB_TOKEN (oder secrets.github_token_file) bzw. git.credentials für Clone und Pull prüfen: sie fehlen, sind abgelaufen oder haben keinen Lesezugriff auf das Repo",
+		"hint.rate_limited":        "das GitHub-API-Kontingent ist aufgebraucht; Token setzen, seltener pollen oder auf den Reset warten",
+		"hint.not_found":           "Repo, Branch oder gepinnten Tag in sync.yaml und im Taskfile des Subsystems prüfen",
+		"hint.network":             "Verbindung zu GitHub prüfen (Proxy, DNS, Firewall); der nächste Poll versucht es erneut",
+		"hint.frozen":              "Updates sind eingefroren: sync audit zeigt, wer sie warum eingefroren hat; sync thaw hebt das auf, sync update übersteuert es",
+		"hint.build_failed":        "task sync:update SUBSYSTEM=<subsystem> ausführen, um den Build nachzuvollziehen; die vorherige Version bleibt aktiv",
+		"hint.checksum_mismatch":   "eine Datei passt nicht zu ihrer veröffentlichten oder aufgezeichneten Prüfsumme; nicht ausführen: Download wiederholen oder mit sync update neu installieren",
+		"hint.migration_failed":    "das Datenverzeichnis wurde aus dem Backup wiederhergestellt; Migrations-Task korrigieren und erneut updaten",
+		"hint.health_check_failed": "die neue Version hat task <subsystem>:health nicht bestanden; Logs prüfen, bei Bedarf sync rollback <subsystem>",
+		"hint.worktree_dirty":      "lokale Änderungen im .src-Checkout des Subsystems committen, stashen oder verwerfen",
+		"hint.signature_invalid":   "der Upstream-Tag oder das Release-Asset ist nicht von einem vertrauenswürdigen Schlüssel oder einer Identität signiert; Release prüfen, dann signatures oder artifact.cosign in sync.yaml anpassen",
+		"hint.platform_mismatch":   "der Build ist für ein anderes Betriebssystem oder eine andere Architektur als dieser Host; einen dafür gebauten installieren (GOOS/GOARCH des Builders oder das Release-Asset prüfen)",
+		"hint.disk_full":           "Speicherplatz freigeben (sync gc entfernt alte installierte Versionen) oder disk.reserve_bytes senken, dann erneut versuchen; es wurde nichts verändert",
+		"hint.config_rejected":     "eine Subsystem-Konfiguration ließ sich nicht erzeugen oder die neue Version lehnt sie ab; das Update wurde nicht installiert, vorherige Version und Konfiguration bleiben aktiv: Konfiguration, Template oder vars in sync.yaml für die neue Version anpassen (sync render --dry-run prüft sie) und erneut aktualisieren",
+		"hint.scan_failed":         "ein Scanner hat den neuen Build beanstandet oder konnte ihn nicht prüfen; er wurde nicht installiert, die vorherige Version bleibt aktiv: Befund in sync audit ansehen, das Upstream-Release prüfen und den Scanner korrigieren oder aktualisieren, dann erneut aktualisieren",
+	},
+}
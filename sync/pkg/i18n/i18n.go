@@ -0,0 +1,102 @@
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default is the locale every message exists in, used when another locale lacks one
+const Default = "en"
+
+var (
+	mu      sync.RWMutex
+	current = Default
+)
+
+// Supported returns the locales with a catalog, sorted
+func Supported() []string {
+	list := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		list = append(list, locale)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Normalize reduces a locale setting like "de_DE.UTF-8" or "de-AT" to a
+// supported locale, reporting false for unsupported ones
+// "C" and "POSIX" stand for the default locale.
+func Normalize(locale string) (string, bool) {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == "c" || locale == "posix" || strings.HasPrefix(locale, "c.") {
+		return Default, true
+	}
+	lang, _, _ := strings.Cut(locale, ".")
+	lang, _, _ = strings.Cut(lang, "@")
+	lang, _, _ = strings.Cut(strings.ReplaceAll(lang, "-", "_"), "_")
+	if _, ok := catalogs[lang]; !ok {
+		return "", false
+	}
+	return lang, true
+}
+
+// Detect picks the locale for user-facing messages: SYNC_LOCALE, then the
+// configured locale (sync.yaml's locale:), then LC_ALL, LC_MESSAGES and LANG
+// Unset and unsupported settings are skipped; if none is left, it is the default.
+func Detect(configured string) string {
+	for _, setting := range []string{os.Getenv("SYNC_LOCALE"), configured, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")} {
+		if setting == "" {
+			continue
+		}
+		if locale, ok := Normalize(setting); ok {
+			return locale
+		}
+	}
+	return Default
+}
+
+// Use sets the locale of T and Or (the default for unsupported locales)
+func Use(locale string) {
+	locale, ok := Normalize(locale)
+	if !ok {
+		locale = Default
+	}
+	mu.Lock()
+	current = locale
+	mu.Unlock()
+}
+
+// Locale returns the locale in use
+func Locale() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// T formats the message key in the current locale
+// Messages missing from the locale fall back to the default, then to the key
+// itself. Translations may reorder arguments with %[n]s.
+func T(key string, args ...any) string {
+	format, ok := catalogs[Locale()][key]
+	if !ok {
+		if format, ok = catalogs[Default][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Or returns the current locale's message for key, or fallback if it has none
+// It localizes text kept in English elsewhere, such as the hints of error kinds.
+func Or(key, fallback string) string {
+	if msg, ok := catalogs[Locale()][key]; ok {
+		return msg
+	}
+	return fallback
+}
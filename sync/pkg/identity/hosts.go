@@ -0,0 +1,52 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// Host is a host registered with this controller
+type Host struct {
+	Public
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"` // last registration
+}
+
+// Record verifies a registration and adds or updates its host
+func Record(r Registration) (Host, error) {
+	if err := r.Verify(); err != nil {
+		return Host{}, err
+	}
+	h := Host{Public: r.Public, FirstSeen: r.Time, LastSeen: r.Time}
+	var old Host
+	if found, err := state.Get(state.BucketHosts, r.ID, &old); err != nil {
+		return Host{}, err
+	} else if found {
+		h.FirstSeen = old.FirstSeen
+	}
+	return h, state.Put(state.BucketHosts, r.ID, h)
+}
+
+// Hosts returns the registered hosts, by name
+func Hosts() ([]Host, error) {
+	var hosts []Host
+	err := state.ForEach(state.BucketHosts, func(key string, data []byte) error {
+		var h Host
+		if err := json.Unmarshal(data, &h); err != nil {
+			return fmt.Errorf("host %s: %w", key, err)
+		}
+		hosts = append(hosts, h)
+		return nil
+	})
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Name != hosts[j].Name {
+			return hosts[i].Name < hosts[j].Name
+		}
+		return hosts[i].ID < hosts[j].ID
+	})
+	return hosts, err
+}
@@ -0,0 +1,269 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// maxClockSkew is how far the time of a registration may be off the
+// controller's clock
+const maxClockSkew = 10 * time.Minute
+
+// Public is what the fleet knows about a host
+type Public struct {
+	ID     string            `json:"id"` // derived from the public key, stable across renames
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Identity is this host's identity, generated on first boot
+// The private key never leaves <data dir>/identity/key.pem; the controller
+// only ever sees the public key and signatures made with it.
+type Identity struct {
+	Public
+	PublicKey    ed25519.PublicKey `json:"publicKey"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	RegisteredAt time.Time         `json:"registeredAt,omitzero"` // when the controller accepted it
+
+	key ed25519.PrivateKey
+}
+
+var (
+	mu      sync.Mutex
+	current *Identity
+)
+
+// Dir returns where the identity is kept: <data dir>/identity
+func Dir() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "identity"), nil
+}
+
+// Ensure loads this host's identity, generating it on first boot, and applies
+// the name and labels of sync.yaml
+func Ensure(cfg config.IdentityConfig) (*Identity, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	id, err := load(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		id, err = generate(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	if name != id.Name || !maps.Equal(cfg.Labels, id.Labels) {
+		id.Name, id.Labels = name, cfg.Labels
+		id.RegisteredAt = time.Time{} // the controller learns the new name on the next registration
+		if err := id.save(dir); err != nil {
+			return nil, err
+		}
+	}
+	current = id
+	return id, nil
+}
+
+// Current returns this host's identity, or nil if it has none yet
+// Commands other than the daemons read it from disk without creating it.
+func Current() *Identity {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		if dir, err := Dir(); err == nil {
+			current, _ = load(dir)
+		}
+	}
+	return current
+}
+
+// ID returns the ID of this host's identity, or "" if it has none yet
+func ID() string {
+	if id := Current(); id != nil {
+		return id.ID
+	}
+	return ""
+}
+
+// MarkRegistered records that the controller accepted the identity
+func (id *Identity) MarkRegistered(t time.Time) error {
+	mu.Lock()
+	defer mu.Unlock()
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	id.RegisteredAt = t
+	return id.save(dir)
+}
+
+// Registration is a host introducing itself to the controller, signed with
+// its key
+type Registration struct {
+	Public
+	PublicKey ed25519.PublicKey `json:"publicKey"`
+	Time      time.Time         `json:"time"`
+	Signature []byte            `json:"signature"` // over the registration without it
+}
+
+// Register returns a signed registration of the identity
+func (id *Identity) Register() (Registration, error) {
+	r := Registration{Public: id.Public, PublicKey: id.PublicKey, Time: time.Now().UTC()}
+	payload, err := r.payload()
+	if err != nil {
+		return r, err
+	}
+	r.Signature = ed25519.Sign(id.key, payload)
+	return r, nil
+}
+
+// Sign signs data with the identity's key, e.g. an installer generated on
+// this host
+func (id *Identity) Sign(data []byte) []byte {
+	return ed25519.Sign(id.key, data)
+}
+
+// PublicKeyPEM returns the public key as a PKIX PEM block, as openssl reads it
+func (id *Identity) PublicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(id.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// Verify checks that the registration was signed with the key its ID names,
+// recently
+func (r Registration) Verify() error {
+	if len(r.PublicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	if r.ID != fingerprint(r.PublicKey) {
+		return fmt.Errorf("ID %s does not match the public key", r.ID)
+	}
+	payload, err := r.payload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(r.PublicKey, payload, r.Signature) {
+		return errors.New("invalid signature")
+	}
+	if skew := time.Since(r.Time); skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("registration time %s is off by %s", r.Time.Format(time.RFC3339), skew.Round(time.Second))
+	}
+	return nil
+}
+
+func (r Registration) payload() ([]byte, error) {
+	r.Signature = nil
+	return json.Marshal(r)
+}
+
+// fingerprint derives the host ID from its public key, e.g. h-3zq5...
+func fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	return "h-" + strings.ToLower(enc.EncodeToString(sum[:10]))
+}
+
+func generate(dir string) (*Identity, error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0o600); err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Public:    Public{ID: fingerprint(pub)},
+		PublicKey: pub,
+		CreatedAt: time.Now().UTC(),
+		key:       key,
+	}, nil
+}
+
+func load(dir string) (*Identity, error) {
+	keyPEM, err := os.ReadFile(filepath.Join(dir, "key.pem"))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", filepath.Join(dir, "key.pem"))
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, "key.pem"), err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", filepath.Join(dir, "key.pem"))
+	}
+
+	id := &Identity{}
+	data, err := os.ReadFile(filepath.Join(dir, "identity.json"))
+	if err == nil {
+		err = json.Unmarshal(data, id)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, "identity.json"), err)
+	}
+
+	// The key is what identifies the host; the rest is derived or configured
+	pub := key.Public().(ed25519.PublicKey)
+	if !bytes.Equal(id.PublicKey, pub) {
+		id.PublicKey, id.RegisteredAt = pub, time.Time{}
+	}
+	id.ID, id.key = fingerprint(pub), key
+	if id.CreatedAt.IsZero() {
+		id.CreatedAt = time.Now().UTC()
+	}
+	return id, nil
+}
+
+func (id *Identity) save(dir string) error {
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "identity.json.tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "identity.json"))
+}
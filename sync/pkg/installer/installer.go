@@ -0,0 +1,255 @@
+// Package installer generates the bootstrap script that provisions a new
+// host in one command: it checks out the project, fetches the pinned builds
+// and verifies their SHA256s, writes the host's sync.yaml, installs the
+// service and waits for the host to register with the controller
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Pin is a build the installer fetches
+type Pin struct {
+	Subsystem string
+	Version   string
+	Files     map[string]string // file name -> SHA256 the download must match
+}
+
+// Options describe the installer to generate
+type Options struct {
+	Repo      string // project repository the host checks out
+	Ref       string // project commit it checks out
+	Pins      []Pin
+	Config    []byte // the host's sync.yaml
+	Register  bool   // wait for the controller to accept the host (needs nats.url)
+	System    bool   // install system-wide (task service:install:system)
+	User      string // with System: the account the service runs as
+	Generated string // where and when it was generated, for the header
+}
+
+// Generate returns the installer script
+func Generate(o Options) ([]byte, error) {
+	if len(o.Config) > 0 && !bytes.HasSuffix(o.Config, []byte("\n")) {
+		o.Config = append(o.Config, '\n')
+	}
+	if bytes.Contains(o.Config, []byte("\n"+configEOF+"\n")) {
+		return nil, fmt.Errorf("sync.yaml may not contain a line %s", configEOF)
+	}
+	var b bytes.Buffer
+	if err := script.Execute(&b, o); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Pins resolves the versions of a lockfile (subsystem -> version, a commit
+// hash prefix will do) to installed builds, whose files the installer pins
+// Versions not installed on this host can't be pinned.
+func Pins(lock map[string]string) ([]Pin, error) {
+	pins := make([]Pin, 0, len(lock))
+	for subsystem, ref := range lock {
+		version, err := versions.Resolve(subsystem, ref)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", subsystem, err)
+		}
+		dir, err := versions.Dir(subsystem, version)
+		if err != nil {
+			return nil, err
+		}
+		files, err := versions.Digests(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s %s: %w", subsystem, version, err)
+		}
+		// .version records the install here, not what the download brings
+		delete(files, ".version")
+		if len(files) == 0 {
+			return nil, fmt.Errorf("%s %s has no files to pin", subsystem, version)
+		}
+		pins = append(pins, Pin{Subsystem: subsystem, Version: version, Files: files})
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Subsystem < pins[j].Subsystem })
+	return pins, nil
+}
+
+// ReadLockfile reads a lockfile as gc.lockfiles takes them: YAML mapping
+// subsystem -> version
+func ReadLockfile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	var lock map[string]string
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", filepath.Base(path), err)
+	}
+	if len(lock) == 0 {
+		return nil, fmt.Errorf("lockfile %s pins nothing", filepath.Base(path))
+	}
+	return lock, nil
+}
+
+// HostConfig returns sync.yaml src with the identity name and labels, and
+// the NATS URL the host registers over, set where given; the rest, comments
+// included, is kept
+func HostConfig(src []byte, name string, labels map[string]string, natsURL string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sync.yaml: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("sync.yaml is not a mapping")
+	}
+
+	if name != "" {
+		set(root, []string{"identity", "name"}, &yaml.Node{Kind: yaml.ScalarNode, Value: name})
+	}
+	if len(labels) > 0 {
+		m := &yaml.Node{Kind: yaml.MappingNode}
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: k}, &yaml.Node{Kind: yaml.ScalarNode, Value: labels[k]})
+		}
+		set(root, []string{"identity", "labels"}, m)
+	}
+	if natsURL != "" {
+		set(root, []string{"nats", "url"}, &yaml.Node{Kind: yaml.ScalarNode, Value: natsURL})
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// set puts value at path in the mapping m, creating the mappings on the way
+func set(m *yaml.Node, path []string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			m.Content[i+1] = value
+			return
+		}
+		if m.Content[i+1].Kind != yaml.MappingNode {
+			m.Content[i+1] = &yaml.Node{Kind: yaml.MappingNode}
+		}
+		set(m.Content[i+1], path[1:], value)
+		return
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: path[0]})
+	if len(path) == 1 {
+		m.Content = append(m.Content, value)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	m.Content = append(m.Content, child)
+	set(child, path[1:], value)
+}
+
+// configEOF ends the here-document holding sync.yaml in the script
+const configEOF = "SYNC_YAML_EOF"
+
+// quote quotes s for sh
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+var script = template.Must(template.New("installer").Funcs(template.FuncMap{
+	"quote": quote,
+	"short": revision.Short,
+	"eof":   func() string { return configEOF },
+}).Parse(`#!/bin/sh
+# plat-telemetry installer, generated by sync generate installer {{.Generated}}
+#
+# Checks out {{.Repo}} at {{short .Ref}}, fetches the pinned builds and
+# verifies their SHA256s, writes sync/sync.yaml, installs and starts the
+# service{{if .Register}}, and waits for the controller to accept the host{{end}}.
+# Verify the signature before running it:
+#   openssl pkeyutl -verify -pubin -inkey <script>.pub -rawin -in <script> -sigfile <script>.sig
+#
+# PLAT_DIR is where the project is checked out (default: ~/plat-telemetry).
+set -eu
+
+REPO={{quote .Repo}}
+REF={{quote .Ref}}
+DIR="${PLAT_DIR:-$HOME/plat-telemetry}"
+
+die() { printf '❌ %s\n' "$*" >&2; exit 1; }
+sha256() {
+	if command -v sha256sum >/dev/null 2>&1; then sha256sum "$1"; else shasum -a 256 "$1"; fi | cut -d' ' -f1
+}
+verify() {
+	[ -f "$1/.bin/$2" ] || die "$1: $2 is missing after the download"
+	got=$(sha256 "$1/.bin/$2")
+	[ "$got" = "$3" ] || die "$1: $2 has SHA256 $got, pinned $3"
+}
+
+for tool in git task curl tar; do
+	command -v "$tool" >/dev/null 2>&1 || die "$tool is required"
+done
+
+echo "▶ Checking out $REPO at $REF into $DIR"
+[ -d "$DIR/.git" ] || git clone --quiet "$REPO" "$DIR"
+cd "$DIR"
+git fetch --quiet origin
+git -c advice.detachedHead=false checkout --quiet "$REF"
+{{range .Pins}}{{$sub := .Subsystem}}
+echo "▶ Fetching {{.Subsystem}} {{short .Version}}"
+task {{.Subsystem}}:bin:download VERSION={{quote .Version}}
+{{- range $file, $sum := .Files}}
+verify {{$sub}} {{quote $file}} {{$sum}}
+{{- end}}
+{{end}}
+{{- if .Config}}
+echo "▶ Writing sync/sync.yaml"
+cat > sync/sync.yaml <<'{{eof}}'
+{{printf "%s" .Config}}{{eof}}
+{{end}}
+echo "▶ Installing the service"
+{{- if .System}}
+task service:install:system{{if .User}} USER={{quote .User}}{{end}}
+sudo service/.bin/plat-telemetry-svc start
+{{- else}}
+task service:install
+service/.bin/plat-telemetry-svc start
+{{- end}}
+{{if .Register}}
+echo "▶ Waiting for the controller to accept this host"
+i=0
+until sync/.bin/sync identity --json 2>/dev/null | grep -q '"registeredAt"'; do
+	i=$((i + 1))
+	if [ "$i" -ge 60 ]; then
+		echo "⚠️  Not registered yet; run sync/.bin/sync identity once NATS is reachable"
+		exit 0
+	fi
+	sleep 2
+done
+{{end}}
+echo "✅ Installed"
+`))
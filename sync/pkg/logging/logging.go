@@ -0,0 +1,144 @@
+// Package logging configures log/slog for sync: the level (--log-level,
+// LOG_LEVEL), the handler (--log-format, LOG_FORMAT: text or json) and a
+// logger per component, e.g. poller or webhook
+// Messages still logged with the log package go through the same handler;
+// their emoji marker gives the level (❌ error, ⚠️ warn, others info).
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Log formats
+const (
+	FormatText = "text" // key=value pairs, as slog.TextHandler writes them
+	FormatJSON = "json" // one JSON object per line, for Telegraf or Loki
+)
+
+// level is the minimum level logged; records of every logger check it
+var level = new(slog.LevelVar)
+
+// markers maps the emoji markers of log package messages that carry a
+// severity to their level; every other marker is info
+var markers = map[string]slog.Level{
+	"❌": slog.LevelError,
+	"💥": slog.LevelError,
+	"⚠": slog.LevelWarn,
+	"❓": slog.LevelWarn,
+}
+
+// markerPattern matches the indentation and emoji marker (with its variation
+// selector) a log package message starts with
+var markerPattern = regexp.MustCompile(`^\s*([\x{1F300}-\x{1FAFF}\x{2600}-\x{27BF}\x{23E9}-\x{23FA}\x{2B50}])?\x{FE0F}?\s*`)
+
+// Setup makes slog's default logger write to w in format ("" is text), at
+// the level set, and routes the log package through it
+// The level comes from LOG_LEVEL unless SetLevel is called, and the format
+// from LOG_FORMAT when format is "".
+func Setup(w io.Writer, format string) error {
+	if format == "" {
+		format = os.Getenv("LOG_FORMAT")
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := SetLevel(v); err != nil {
+			return fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case "", FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q (want %s or %s)", format, FormatText, FormatJSON)
+	}
+	slog.SetDefault(slog.New(h))
+
+	// After SetDefault, which would log everything from the log package at info
+	log.SetFlags(0)
+	log.SetOutput(bridge{})
+	return nil
+}
+
+// SetLevel sets the minimum level logged: debug, info, warn or error
+func SetLevel(s string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+	level.Set(l)
+	return nil
+}
+
+// For returns the logger of a component; its records carry component=<name>
+// Loggers may be created before Setup, e.g. in package variables: they use
+// whatever handler is the default when they log.
+func For(component string) *slog.Logger {
+	return slog.New(deferred{attrs: []slog.Attr{slog.String("component", component)}})
+}
+
+// deferred hands records to slog's default handler at the time they are
+// logged, with the attributes and group of the logger
+type deferred struct {
+	attrs []slog.Attr
+	group string
+}
+
+func (d deferred) handler() slog.Handler {
+	h := slog.Default().Handler().WithAttrs(d.attrs)
+	if d.group != "" {
+		h = h.WithGroup(d.group)
+	}
+	return h
+}
+
+func (d deferred) Enabled(ctx context.Context, l slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, l)
+}
+
+func (d deferred) Handle(ctx context.Context, r slog.Record) error {
+	return d.handler().Handle(ctx, r)
+}
+
+// Past a group, attributes and groups bind to the default handler at the
+// time; loggers nest groups rarely enough for that to do
+func (d deferred) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if d.group != "" {
+		return d.handler().WithAttrs(attrs)
+	}
+	return deferred{attrs: append(d.attrs[:len(d.attrs):len(d.attrs)], attrs...)}
+}
+
+func (d deferred) WithGroup(name string) slog.Handler {
+	if d.group != "" {
+		return d.handler().WithGroup(name)
+	}
+	return deferred{attrs: d.attrs, group: name}
+}
+
+// bridge logs what the log package writes, one message per Write, at the
+// level of its emoji marker
+type bridge struct{}
+
+func (bridge) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	l := slog.LevelInfo
+	if m := markerPattern.FindStringSubmatch(msg); m != nil {
+		if ml, ok := markers[m[1]]; ok {
+			l = ml
+		}
+		msg = msg[len(m[0]):]
+	}
+	slog.Default().Log(context.Background(), l, msg)
+	return len(p), nil
+}
@@ -0,0 +1,164 @@
+//go:build !nometrics
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func init() {
+	capabilities.Register(capabilities.Control, "prometheus")
+}
+
+var (
+	pollCycles = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sync_poll_cycles_total",
+		Help: "Polling cycles completed.",
+	})
+
+	checks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_checks_total",
+		Help: "Subsystem update checks performed, by result (ok, error).",
+	}, []string{"subsystem", "result"})
+
+	githubErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sync_github_api_errors_total",
+		Help: "GitHub API requests that failed or returned an error status.",
+	})
+
+	githubNotModified = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sync_github_not_modified_total",
+		Help: "GitHub API requests answered 304 Not Modified from a stored ETag (free of rate limit).",
+	})
+
+	rateLimitRemaining = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sync_github_rate_limit_remaining",
+		Help: "GitHub API requests remaining in the current rate-limit window.",
+	})
+
+	updatesTriggered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_updates_triggered_total",
+		Help: "Updates triggered, by trigger (poll, taskfile, webhook, manual).",
+	}, []string{"subsystem", "trigger"})
+
+	updatesSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_updates_succeeded_total",
+		Help: "Updates that completed successfully.",
+	}, []string{"subsystem"})
+
+	updatesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_updates_failed_total",
+		Help: "Updates that failed.",
+	}, []string{"subsystem"})
+
+	lastUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_last_update_timestamp_seconds",
+		Help: "Unix time of the last successful update.",
+	}, []string{"subsystem"})
+
+	updateDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "sync_update_duration_seconds",
+		Help: "Duration of update runs (clone, build, verify, reload).",
+		// Builds range from seconds (downloads) to tens of minutes (telegraf from source)
+		Buckets: []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"subsystem"})
+
+	queuePosition = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_update_queue_position",
+		Help: "Place of a queued update in the daemon's queue (1 = next to start, 0 = running).",
+	}, []string{"subsystem"})
+
+	updateETA = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_update_eta_timestamp_seconds",
+		Help: "Unix time a queued or running update is estimated to finish, from recent update durations.",
+	}, []string{"subsystem"})
+
+	forkBehind = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_fork_commits_behind",
+		Help: "Upstream commits missing from a fork's tracked branch.",
+	}, []string{"subsystem"})
+
+	forkAhead = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_fork_commits_ahead",
+		Help: "Commits on a fork's tracked branch that upstream does not have.",
+	}, []string{"subsystem"})
+)
+
+// Handler serves the metrics in Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// PollCycle counts a completed polling cycle
+func PollCycle() {
+	pollCycles.Inc()
+}
+
+// Check counts a subsystem check
+func Check(subsystem string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	checks.WithLabelValues(subsystem, result).Inc()
+}
+
+// GitHubResponse records the outcome of a GitHub API request
+func GitHubResponse(resp *http.Response, err error) {
+	if err != nil || resp.StatusCode >= 400 {
+		githubErrors.Inc()
+	}
+	if resp == nil {
+		return
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		rateLimitRemaining.Set(float64(remaining))
+	}
+}
+
+// GitHubNotModified counts a conditional GitHub request that returned 304
+func GitHubNotModified() {
+	githubNotModified.Inc()
+}
+
+// UpdateTriggered counts the start of an update
+func UpdateTriggered(subsystem, trigger string) {
+	updatesTriggered.WithLabelValues(subsystem, trigger).Inc()
+}
+
+// UpdateFinished records the result and duration of an update
+func UpdateFinished(subsystem string, success bool, duration time.Duration) {
+	updateDuration.WithLabelValues(subsystem).Observe(duration.Seconds())
+	if !success {
+		updatesFailed.WithLabelValues(subsystem).Inc()
+		return
+	}
+	updatesSucceeded.WithLabelValues(subsystem).Inc()
+	lastUpdate.WithLabelValues(subsystem).SetToCurrentTime()
+}
+
+// Queue replaces the queue gauges with the daemon's queued and running updates
+// Updates without an estimate (zero ETA) only get a position.
+func Queue(positions map[string]int, etas map[string]time.Time) {
+	queuePosition.Reset()
+	updateETA.Reset()
+	for subsystem, position := range positions {
+		queuePosition.WithLabelValues(subsystem).Set(float64(position))
+		if eta := etas[subsystem]; !eta.IsZero() {
+			updateETA.WithLabelValues(subsystem).Set(float64(eta.Unix()))
+		}
+	}
+}
+
+// Fork records how far a fork is behind and ahead of its upstream
+func Fork(subsystem string, behind, ahead int) {
+	forkBehind.WithLabelValues(subsystem).Set(float64(behind))
+	forkAhead.WithLabelValues(subsystem).Set(float64(ahead))
+}
@@ -0,0 +1,39 @@
+//go:build nometrics
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Handler reports that metrics were compiled out of this build (-tags nometrics)
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "metrics not compiled into this build", http.StatusNotFound)
+	})
+}
+
+// PollCycle is a no-op without metrics
+func PollCycle() {}
+
+// Check is a no-op without metrics
+func Check(subsystem string, err error) {}
+
+// GitHubResponse is a no-op without metrics
+func GitHubResponse(resp *http.Response, err error) {}
+
+// GitHubNotModified is a no-op without metrics
+func GitHubNotModified() {}
+
+// UpdateTriggered is a no-op without metrics
+func UpdateTriggered(subsystem, trigger string) {}
+
+// UpdateFinished is a no-op without metrics
+func UpdateFinished(subsystem string, success bool, duration time.Duration) {}
+
+// Queue is a no-op without metrics
+func Queue(positions map[string]int, etas map[string]time.Time) {}
+
+// Fork is a no-op without metrics
+func Fork(subsystem string, behind, ahead int) {}
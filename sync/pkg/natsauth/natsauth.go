@@ -0,0 +1,33 @@
+//go:build !nonats
+
+package natsauth
+
+import (
+	"fmt"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/nats-io/nats.go"
+)
+
+// Options returns the credentials and TLS options for cfg, shared by every
+// NATS connection sync makes
+func Options(cfg config.NATSConfig) ([]nats.Option, error) {
+	var opts []nats.Option
+	switch {
+	case cfg.Credentials != "":
+		opts = append(opts, nats.UserCredentials(cfg.Credentials))
+	case cfg.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(cfg.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load NATS nkey: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	if cfg.TLS.CAFile != "" {
+		opts = append(opts, nats.RootCAs(cfg.TLS.CAFile))
+	}
+	if cfg.TLS.CertFile != "" {
+		opts = append(opts, nats.ClientCert(cfg.TLS.CertFile, cfg.TLS.KeyFile))
+	}
+	return opts, nil
+}
@@ -0,0 +1,65 @@
+//go:build !nonats
+
+package natscmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/nats-io/nats.go"
+)
+
+// ServeFreeze applies the freezes and thaws announced on subject
+// Every daemon applies every announcement (the newest change wins), and on
+// each (re)connect asks the fleet on <subject>.sync to re-announce its latest
+// change, so hosts that were offline or newly started catch up.
+func ServeFreeze(nc *nats.Conn, subject string) error {
+	_, err := nc.Subscribe(subject, func(msg *nats.Msg) {
+		var c freeze.Change
+		if err := json.Unmarshal(msg.Data, &c); err != nil || c.Time.IsZero() {
+			logger.Warn("Ignoring malformed update freeze", "subject", msg.Subject)
+			return
+		}
+		applied, err := freeze.Apply(c, "NATS")
+		switch {
+		case err != nil:
+			logger.Error("Failed to apply update freeze", "by", c.Actor, "err", err)
+		case applied && c.Frozen:
+			logger.Info("Updates frozen fleet-wide", "freeze", c.Freeze)
+		case applied:
+			logger.Info("Updates thawed fleet-wide", "lifted", c.Freeze.Reason, "by", c.Actor)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	_, err = nc.Subscribe(subject+".sync", func(*nats.Msg) {
+		c, found, err := freeze.Latest()
+		if err != nil || !found {
+			return
+		}
+		data, _ := json.Marshal(c)
+		if err := nc.Publish(subject, data); err != nil {
+			logger.Warn("Failed to re-announce update freeze", "err", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s.sync: %w", subject, err)
+	}
+
+	events.OnConnect(func(nc *nats.Conn) {
+		if err := nc.Publish(subject+".sync", nil); err != nil {
+			logger.Warn("Failed to request the fleet's update freeze", "err", err)
+		}
+	})
+	// The connection may already be up, before the hook was registered
+	if nc.IsConnected() {
+		nc.Publish(subject+".sync", nil)
+	}
+
+	logger.Info("Sharing update freezes", "subject", subject)
+	return nil
+}
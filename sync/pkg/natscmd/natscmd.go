@@ -0,0 +1,90 @@
+package natscmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/nats-io/nats.go"
+)
+
+// logger logs the commands, registrations, freezes and releases received over NATS
+var logger = logging.For("natscmd")
+
+func init() {
+	capabilities.Register(capabilities.Control, "nats-commands")
+}
+
+// queueGroup ensures only one sync daemon handles each command when several subscribe
+const queueGroup = "sync"
+
+// subsystemPattern restricts subsystem names taken from subjects
+var subsystemPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Reply acknowledges a command
+type Reply struct {
+	Accepted  bool   `json:"accepted"`
+	Subsystem string `json:"subsystem,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Serve subscribes to <prefix>.<subsystem> and queues an update for each
+// request, replying with an acknowledgment
+func Serve(nc *nats.Conn, prefix string) (*nats.Subscription, error) {
+	sub, err := nc.QueueSubscribe(prefix+".*", queueGroup, func(msg *nats.Msg) {
+		subsystem := strings.TrimPrefix(msg.Subject, prefix+".")
+
+		if err := validate(subsystem); err != nil {
+			logger.Warn("Rejected NATS update command", "subsystem", subsystem, "err", err)
+			respond(msg, Reply{Accepted: false, Subsystem: subsystem, Message: err.Error()})
+			return
+		}
+
+		logger.Info("NATS update command", "subsystem", subsystem)
+		if err := updater.Enqueue(updater.Request{Subsystem: subsystem, Trigger: updater.TriggerNATS}); err != nil {
+			respond(msg, Reply{Accepted: false, Subsystem: subsystem, Message: err.Error()})
+			return
+		}
+		respond(msg, Reply{Accepted: true, Subsystem: subsystem, Message: "update queued"})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s.*: %w", prefix, err)
+	}
+
+	logger.Info("Listening for update commands", "subject", prefix+".<subsystem>")
+	return sub, nil
+}
+
+// validate checks that subsystem names a real subsystem with a Taskfile
+func validate(subsystem string) error {
+	if !subsystemPattern.MatchString(subsystem) {
+		return fmt.Errorf("invalid subsystem name")
+	}
+
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(root, subsystem, "Taskfile.yml")); err != nil {
+		return fmt.Errorf("unknown subsystem %s", subsystem)
+	}
+	return nil
+}
+
+// respond sends the reply if the sender asked for one
+func respond(msg *nats.Msg, reply Reply) {
+	if msg.Reply == "" {
+		return
+	}
+	data, _ := json.Marshal(reply)
+	if err := msg.Respond(data); err != nil {
+		logger.Warn("Failed to reply to NATS command", "err", err)
+	}
+}
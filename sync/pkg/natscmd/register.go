@@ -0,0 +1,126 @@
+//go:build !nonats
+
+package natscmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/nats-io/nats.go"
+)
+
+// registerTimeout is how long a host waits for the controller to accept its
+// registration
+const registerTimeout = 10 * time.Second
+
+// ServeRegistrations records the hosts registering on subject, as the
+// controller, and replies whether their registration was accepted
+// Registrations must be signed with the key their ID is derived from, so a
+// host can't register under another's ID.
+func ServeRegistrations(nc *nats.Conn, subject string) error {
+	_, err := nc.QueueSubscribe(subject, queueGroup, func(msg *nats.Msg) {
+		var r identity.Registration
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			respond(msg, Reply{Accepted: false, Message: "malformed registration"})
+			return
+		}
+		h, err := identity.Record(r)
+		if err != nil {
+			logger.Warn("Rejected host registration", "id", r.ID, "name", r.Name, "err", err)
+			respond(msg, Reply{Accepted: false, Message: err.Error()})
+			return
+		}
+		logger.Info("Host registered", "id", h.ID, "name", h.Name)
+		respond(msg, Reply{Accepted: true, Message: "registered"})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+	logger.Info("Accepting host registrations", "subject", subject)
+	return nil
+}
+
+// Registration retry backoff: the first retry waits registerRetry, each one
+// after it twice as long up to maxRegisterRetry
+const (
+	registerRetry    = 5 * time.Second
+	maxRegisterRetry = 5 * time.Minute
+)
+
+// RegisterOnConnect registers this host's identity with the controller on
+// subject, retrying with backoff until it is accepted
+// A host that boots before the controller is listening registers once it is;
+// a (re)connect retries right away.
+func RegisterOnConnect(nc *nats.Conn, subject string, id *identity.Identity) {
+	if !id.RegisteredAt.IsZero() {
+		return
+	}
+	connected := make(chan struct{}, 1)
+	events.OnConnect(func(*nats.Conn) {
+		select {
+		case connected <- struct{}{}:
+		default:
+		}
+	})
+	go keepRegistering(nc, subject, id, connected)
+}
+
+// keepRegistering tries to register while connected until the controller
+// accepts, waiting out the backoff or the next connect between attempts
+func keepRegistering(nc *nats.Conn, subject string, id *identity.Identity, connected <-chan struct{}) {
+	delay := registerRetry
+	for {
+		if nc.IsConnected() {
+			// This attempt covers any connect signalled before it
+			select {
+			case <-connected:
+			default:
+			}
+			err := register(nc, subject, id)
+			if err == nil {
+				return
+			}
+			logger.Warn("Host registration failed; retrying", "wait", delay, "err", err)
+		}
+		select {
+		case <-connected:
+			delay = registerRetry
+		case <-time.After(delay):
+			delay = min(delay*2, maxRegisterRetry)
+		}
+	}
+}
+
+func register(nc *nats.Conn, subject string, id *identity.Identity) error {
+	r, err := id.Register()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	msg, err := nc.Request(subject, data, registerTimeout)
+	if errors.Is(err, nats.ErrNoResponders) {
+		return fmt.Errorf("no controller listening on %s", subject)
+	}
+	if err != nil {
+		return err
+	}
+	var reply Reply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return fmt.Errorf("malformed reply: %w", err)
+	}
+	if !reply.Accepted {
+		return fmt.Errorf("rejected by the controller: %s", reply.Message)
+	}
+	if err := id.MarkRegistered(time.Now().UTC()); err != nil {
+		return err
+	}
+	logger.Info("Registered with the controller", "name", id.Name, "id", id.ID)
+	return nil
+}
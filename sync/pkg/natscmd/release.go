@@ -0,0 +1,70 @@
+//go:build !nonats
+
+package natscmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/promote"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/nats-io/nats.go"
+)
+
+// ServeReleases applies the releases promoted on subject and installs those
+// promoted into this host's environment
+// As with freezes, each (re)connect asks the fleet on <subject>.sync to
+// re-announce its releases, so hosts that missed a promotion catch up.
+func ServeReleases(nc *nats.Conn, subject string) error {
+	_, err := nc.Subscribe(subject, func(msg *nats.Msg) {
+		var r promote.Release
+		if err := json.Unmarshal(msg.Data, &r); err != nil || r.Time.IsZero() || r.Environment == "" {
+			logger.Warn("Ignoring malformed release", "subject", msg.Subject)
+			return
+		}
+		applied, err := promote.Apply(r, "NATS")
+		if err != nil {
+			logger.Error("Failed to record promoted release", "by", r.By, "err", err)
+			return
+		}
+		if applied {
+			logger.Info("Release promoted", "subsystem", r.Subsystem, "version", revision.Short(r.Version), "environment", r.Environment, "by", r.By)
+		}
+		updater.Reconcile()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	_, err = nc.Subscribe(subject+".sync", func(*nats.Msg) {
+		releases, err := promote.List("")
+		if err != nil {
+			logger.Warn("Failed to read promoted releases", "err", err)
+			return
+		}
+		for _, r := range releases {
+			data, _ := json.Marshal(r)
+			if err := nc.Publish(subject, data); err != nil {
+				logger.Warn("Failed to re-announce promoted releases", "err", err)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s.sync: %w", subject, err)
+	}
+
+	events.OnConnect(func(nc *nats.Conn) {
+		if err := nc.Publish(subject+".sync", nil); err != nil {
+			logger.Warn("Failed to request the fleet's promoted releases", "err", err)
+		}
+	})
+	if nc.IsConnected() {
+		nc.Publish(subject+".sync", nil)
+	}
+
+	logger.Info("Sharing promoted releases", "subject", subject)
+	return nil
+}
@@ -0,0 +1,206 @@
+package natsserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/pki"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nkeys"
+)
+
+// logger logs the embedded server starting and its leaf node links
+var logger = logging.For("natsserver")
+
+func init() {
+	capabilities.Register(capabilities.Control, "embedded-nats")
+}
+
+// readyTimeout bounds how long Start waits for the server to accept clients
+const readyTimeout = 10 * time.Second
+
+// Start runs the embedded nats-server described by cfg
+// Returns nil if another process (usually another sync daemon) already
+// listens on the client port; callers then connect to that server instead.
+func Start(cfg config.EmbeddedNATSConfig) (*server.Server, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	if !free(addr) {
+		logger.Info("Embedded NATS port already in use; connecting to the running server", "addr", addr)
+		return nil, nil
+	}
+
+	opts, err := options(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := server.NewServer(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure embedded NATS: %w", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(readyTimeout) {
+		s.Shutdown()
+		return nil, fmt.Errorf("embedded NATS on %s not ready after %s", addr, readyTimeout)
+	}
+
+	logger.Info("Embedded NATS listening", "name", cfg.Name, "url", s.ClientURL())
+	if cfg.Leaf.Port != 0 {
+		logger.Info("Accepting leaf node connections", "addr", net.JoinHostPort(cfg.Leaf.Host, strconv.Itoa(cfg.Leaf.Port)))
+	}
+	for _, r := range cfg.Leaf.Remotes {
+		logger.Info("Joining as a leaf node", "urls", r.URLs)
+	}
+	return s, nil
+}
+
+// options maps the sync config onto nats-server options
+// The config_file is read first and the sync settings applied over it; a
+// listener beyond loopback without auth and TLS is refused either way.
+func options(cfg config.EmbeddedNATSConfig) (*server.Options, error) {
+	opts := &server.Options{}
+	if cfg.ConfigFile != "" {
+		if err := opts.ProcessConfigFile(cfg.ConfigFile); err != nil {
+			return nil, fmt.Errorf("config_file: %w", err)
+		}
+	}
+	opts.ServerName = cfg.Name
+	opts.Host = cfg.Host
+	opts.Port = cfg.Port
+	opts.NoSigs = true // the sync daemon owns signal handling
+
+	users, nkeys, err := logins(cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	opts.Users = append(opts.Users, users...)
+	opts.Nkeys = append(opts.Nkeys, nkeys...)
+	if cfg.TLS.Enabled() {
+		if opts.TLSConfig, err = pki.ServerTLSConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile); err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		opts.TLS = true
+		opts.TLSVerify = cfg.TLS.ClientCAFile != ""
+	}
+
+	if cfg.Leaf.Port != 0 {
+		opts.LeafNode.Host = cfg.Leaf.Host
+		opts.LeafNode.Port = cfg.Leaf.Port
+		users, nkeys, err := logins(cfg.Leaf.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("leaf.auth: %w", err)
+		}
+		opts.LeafNode.Users = append(opts.LeafNode.Users, users...)
+		if len(nkeys) > 0 {
+			opts.LeafNode.Nkey = nkeys[0].Nkey
+		}
+		if cfg.Leaf.TLS.Enabled() {
+			if opts.LeafNode.TLSConfig, err = pki.ServerTLSConfig(cfg.Leaf.TLS.CertFile, cfg.Leaf.TLS.KeyFile, cfg.Leaf.TLS.ClientCAFile); err != nil {
+				return nil, fmt.Errorf("leaf.tls: %w", err)
+			}
+		}
+	}
+	for i, r := range cfg.Leaf.Remotes {
+		remote := &server.RemoteLeafOpts{Credentials: r.Credentials}
+		for _, raw := range r.URLs {
+			u, err := url.Parse(raw)
+			if err != nil {
+				return nil, fmt.Errorf("leaf remote %d: invalid url %q: %w", i, raw, err)
+			}
+			remote.URLs = append(remote.URLs, u)
+		}
+		if remote.TLSConfig, err = remoteTLS(r.TLS); err != nil {
+			return nil, fmt.Errorf("leaf remote %d: %w", i, err)
+		}
+		remote.TLS = remote.TLSConfig != nil
+		opts.LeafNode.Remotes = append(opts.LeafNode.Remotes, remote)
+	}
+
+	if err := exposed(opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// logins turns the configured logins into nats-server users, reading each
+// password from its file or env var
+func logins(auth config.NATSAuthConfig) ([]*server.User, []*server.NkeyUser, error) {
+	var users []*server.User
+	for _, u := range auth.Users {
+		password, err := secrets.New("NATS password of "+u.User, u.PasswordEnv, u.PasswordFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if password.Get() == "" {
+			return nil, nil, fmt.Errorf("user %s has an empty password", u.User)
+		}
+		users = append(users, &server.User{Username: u.User, Password: password.Get()})
+	}
+	var nkeyUsers []*server.NkeyUser
+	for _, k := range auth.NKeys {
+		if !nkeys.IsValidPublicUserKey(k) {
+			return nil, nil, fmt.Errorf("invalid public user nkey %q", k)
+		}
+		nkeyUsers = append(nkeyUsers, &server.NkeyUser{Nkey: k})
+	}
+	return users, nkeyUsers, nil
+}
+
+// remoteTLS builds the TLS config for joining a hub, if any is set: its CA on
+// top of the system roots, and a client certificate
+func remoteTLS(t config.NATSTLSConfig) (*tls.Config, error) {
+	if t.CAFile == "" && t.CertFile == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.CAFile != "" {
+		pool, err := pki.SystemPoolWith(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// exposed refuses listeners other machines can reach without both auth and
+// TLS: whoever connects could publish update commands, freezes, promoted
+// releases and host registrations
+func exposed(opts *server.Options) error {
+	operator := len(opts.TrustedOperators) > 0 || len(opts.TrustedKeys) > 0
+	clientAuth := operator || len(opts.Users) > 0 || len(opts.Nkeys) > 0 || opts.Username != "" || opts.Authorization != ""
+	if !config.Loopback(opts.Host) && (!clientAuth || opts.TLSConfig == nil) {
+		return fmt.Errorf("refusing to listen on %s without auth and tls (set nats.embedded.auth and tls, or host 127.0.0.1)", opts.Host)
+	}
+	leaf := opts.LeafNode
+	leafAuth := operator || len(leaf.Users) > 0 || leaf.Username != "" || leaf.Nkey != ""
+	if leaf.Port != 0 && !config.Loopback(leaf.Host) && (!leafAuth || leaf.TLSConfig == nil) {
+		return fmt.Errorf("refusing to accept leaf nodes on %s without auth and tls (set nats.embedded.leaf.auth and leaf.tls)", leaf.Host)
+	}
+	return nil
+}
+
+// free reports whether addr can be listened on
+func free(addr string) bool {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
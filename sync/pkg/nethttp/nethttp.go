@@ -0,0 +1,49 @@
+package nethttp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/pki"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+var (
+	mu        sync.RWMutex
+	transport http.RoundTripper = http.DefaultTransport
+)
+
+// Configure sets the transport of every outbound request sync makes: proxies
+// from HTTPS_PROXY, HTTP_PROXY and NO_PROXY, and the CAs of network.ca_bundle
+// on top of the system roots
+func Configure(cfg config.NetworkConfig) error {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if cfg.CABundle != "" {
+		pool, err := pki.SystemPoolWith(cfg.CABundle)
+		if err != nil {
+			return syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("network.ca_bundle: %w", err))
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	transport = t
+	return nil
+}
+
+// Transport returns the configured transport (http.DefaultTransport until Configure)
+func Transport() http.RoundTripper {
+	mu.RLock()
+	defer mu.RUnlock()
+	return transport
+}
+
+// Client returns a client using Transport
+func Client() *http.Client {
+	return &http.Client{Transport: Transport()}
+}
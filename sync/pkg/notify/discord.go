@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+func init() {
+	register(config.NotifyDiscord, discord, false)
+}
+
+// Discord's limits on an embed's title and description
+const (
+	discordMaxTitle  = 256
+	discordMaxOutput = 3000 // of the 4096 characters of the description
+)
+
+// discordColors are the embed colors by severity
+var discordColors = map[string]int{
+	config.SeverityInfo:    0x2eb886,
+	config.SeverityWarning: 0xdaa038,
+	config.SeverityError:   0xa30200,
+}
+
+// discordMessage is the body of a Discord channel webhook
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string        `json:"title"`
+	URL         string        `json:"url,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Color       int           `json:"color"`
+	Footer      discordFooter `json:"footer"`
+	Timestamp   string        `json:"timestamp"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+// discord formats m for a Discord webhook: an embed titled with m, linked to
+// the changelog, describing the details and the output in a code block
+func discord(m Message) any {
+	title := []rune(m.Title)
+	if len(title) > discordMaxTitle {
+		title = append(title[:discordMaxTitle-1], '…')
+	}
+	description := m.Text
+	if m.Output != "" {
+		description += "\n```\n" + tail(m.Output, discordMaxOutput) + "\n```"
+	}
+	return discordMessage{
+		Username: "sync",
+		Embeds: []discordEmbed{{
+			Title:       string(title),
+			URL:         m.Link,
+			Description: description,
+			Color:       discordColors[m.Severity],
+			Footer:      discordFooter{Text: "sync on " + m.Host},
+			Timestamp:   m.Time.UTC().Format(time.RFC3339),
+		}},
+	}
+}
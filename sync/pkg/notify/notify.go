@@ -0,0 +1,353 @@
+// Package notify posts update events to chat channels and webhooks
+// Each sink of notify.sinks is a channel's incoming webhook (Slack, Discord)
+// filtered by subsystem and severity: updates available or awaiting
+// approval, updates applied with a changelog link, and failures with the end
+// of the build output. Webhook sinks get every event as JSON instead, for
+// tooling of our own.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// logger logs sinks starting and notifications that could not be posted
+var logger = logging.For("notify")
+
+// queueSize is how many messages wait for a slow sink before new ones are dropped
+const queueSize = 64
+
+// pending counts the messages queued or being posted, for Flush
+var pending sync.WaitGroup
+
+// Message is an update event as a chat message
+type Message struct {
+	Severity  string // info, warning or error
+	Subsystem string
+	Title     string // one line, e.g. "✅ nats updated on edge-1: a1b2c3d → e4f5a6b"
+	Text      string // details, may be empty
+	Link      string // changelog of the update, if known
+	Output    string // failed updates: the end of the build output
+	Host      string // this host's name
+	Time      time.Time
+	Event     events.Event // the event the message is about
+}
+
+// format turns a message into the JSON body a type of webhook takes
+type format func(Message) any
+
+// sinkType is a kind of sink: how it formats messages, and whether it gets
+// every event rather than only those chat channels are told of
+type sinkType struct {
+	format format
+	every  bool
+}
+
+// sinkTypes are the sink types of this build, by name
+var sinkTypes = make(map[string]sinkType)
+
+// register makes a sink type usable in notify.sinks
+// Sink files call it from init(), so sync capabilities lists them.
+func register(name string, f format, every bool) {
+	sinkTypes[name] = sinkType{format: f, every: every}
+	capabilities.Register(capabilities.Notifier, name)
+}
+
+// sink posts the messages it wants to one webhook, in order, off the
+// publisher's goroutine
+type sink struct {
+	config.NotifySink
+	sinkType
+	url     *secrets.Secret
+	key     *secrets.Secret // signs the payload, if set
+	timeout time.Duration
+	queue   chan Message
+}
+
+// newSink reads the webhook URL and signing key of c
+func newSink(c config.NotifySink, timeout time.Duration) (*sink, error) {
+	t, ok := sinkTypes[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("sink type %s is not in this build", c.Type)
+	}
+	for _, e := range c.Events {
+		if !slices.Contains(events.Types, e) {
+			return nil, fmt.Errorf("unknown event type %q (want one of %s)", e, strings.Join(events.Types, ", "))
+		}
+	}
+	url, err := secrets.New(c.Name+" webhook URL", c.URLEnv, c.URLFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &sink{NotifySink: c, sinkType: t, url: url, timeout: timeout}
+	if c.SecretFile != "" || c.SecretEnv != "" {
+		if s.key, err = secrets.New(c.Name+" signing key", c.SecretEnv, c.SecretFile); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Start posts update events to the sinks of notify.sinks until the process exits
+// A sink whose URL can't be read is skipped with a warning.
+func Start(cfg *config.Config) {
+	var started []*sink
+	for _, c := range cfg.Notify.Sinks {
+		s, err := newSink(c, cfg.Notify.Timeout)
+		if err != nil {
+			logger.Warn("Notifications disabled", "sink", c.Name, "err", err)
+			continue
+		}
+		go s.url.Watch(context.Background(), cfg.Secrets.ReloadInterval)
+		if s.key != nil {
+			go s.key.Watch(context.Background(), cfg.Secrets.ReloadInterval)
+		}
+		s.queue = make(chan Message, queueSize)
+		go s.run()
+		started = append(started, s)
+	}
+	if len(started) == 0 {
+		return
+	}
+
+	host := hostName(cfg)
+	events.Subscribe(func(e events.Event) {
+		m, chat := messageFor(cfg, host, e)
+		for _, s := range started {
+			if !chat && !s.every || !s.Wants(e.Type, m.Subsystem, m.Severity) {
+				continue
+			}
+			pending.Add(1)
+			select {
+			case s.queue <- m:
+			default:
+				pending.Done()
+				logger.Warn("Notification dropped; the queue is full", "sink", s.Name, "waiting", queueSize)
+			}
+		}
+	})
+	logger.Info("Posting update notifications", "sinks", len(started))
+}
+
+// run posts queued messages until the queue closes
+func (s *sink) run() {
+	for m := range s.queue {
+		if err := s.post(m); err != nil {
+			logger.Warn("Failed to notify", "sink", s.Name, "title", m.Title, "err", err)
+		}
+		pending.Done()
+	}
+}
+
+// Flush waits until the queued notifications are posted, or ctx is done
+// Daemons call it on shutdown, after the last update has finished.
+func Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// post sends m to the webhook
+func (s *sink) post(m Message) error {
+	url := s.url.Get()
+	if url == "" {
+		return fmt.Errorf("no webhook URL in %s", orEnv(s.URLFile, s.URLEnv))
+	}
+	payload, contentType := s.format(m), "application/json"
+	if s.Format == config.EventFormatCloudEvents {
+		payload, contentType = m.Event.Cloud(payload), events.CloudEventsContentType
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.every {
+		req.Header.Set("X-Sync-Event", m.Event.Type)
+	}
+	if s.key != nil {
+		key := s.key.Get()
+		if key == "" {
+			return fmt.Errorf("no signing key in %s", orEnv(s.SecretFile, s.SecretEnv))
+		}
+		req.Header.Set("X-Sync-Signature-256", "sha256="+sign(key, body))
+	}
+	resp, err := nethttp.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// Test posts a test message to each sink of notify.sinks, or only to the one
+// named, and returns the result by sink
+func Test(cfg *config.Config, name string) (map[string]error, error) {
+	results := make(map[string]error)
+	host := hostName(cfg)
+	for _, c := range cfg.Notify.Sinks {
+		if name != "" && c.Name != name {
+			continue
+		}
+		s, err := newSink(c, cfg.Notify.Timeout)
+		if err == nil {
+			now := time.Now()
+			err = s.post(Message{
+				Severity: config.SeverityInfo,
+				Title:    "🔔 Test notification from sync on " + host,
+				Text:     fmt.Sprintf("Sink %s (%s) receives %s and above", c.Name, c.Type, c.Severity),
+				Host:     host,
+				Time:     now,
+				Event:    events.Event{Type: TestEvent, Time: now},
+			})
+		}
+		results[c.Name] = err
+	}
+	if len(results) == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("no notify sink named %s", name)
+		}
+		return nil, fmt.Errorf("no notify sinks configured")
+	}
+	return results, nil
+}
+
+// messageFor returns the message for an event, and whether it is one chat
+// channels are told of; webhook sinks get the others as info
+func messageFor(cfg *config.Config, host string, e events.Event) (Message, bool) {
+	m := Message{Severity: config.SeverityInfo, Subsystem: e.Subsystem, Host: host, Time: e.Time, Event: e}
+	versions := fmt.Sprintf("%s → %s", orUnknown(e.From), orUnknown(e.To))
+	switch e.Type {
+	case events.UpdateAvailable:
+		m.Severity = config.SeverityInfo
+		m.Title = fmt.Sprintf("📣 Update available for %s on %s: %s", e.Subsystem, host, versions)
+		m.Text = fmt.Sprintf("Detected by %s; not applied automatically", e.Trigger)
+		m.Link = changelog(cfg, e)
+	case events.UpdatePending:
+		m.Severity = config.SeverityInfo
+		m.Title = fmt.Sprintf("⏸ %s update awaits approval on %s: %s", e.Subsystem, host, versions)
+		m.Text = fmt.Sprintf("Apply it with `sync approve %s`, or discard it with `sync reject %s`", e.Subsystem, e.Subsystem)
+		m.Link = changelog(cfg, e)
+	case events.UpdateCompleted:
+		m.Severity = config.SeverityInfo
+		m.Title = fmt.Sprintf("✅ %s updated on %s: %s", e.Subsystem, host, versions)
+		m.Text = fmt.Sprintf("Trigger %s, took %s", e.Trigger, e.Duration.Round(time.Second))
+		m.Link = changelog(cfg, e)
+	case events.UpdateFailed:
+		m.Severity = config.SeverityError
+		m.Title = fmt.Sprintf("❌ %s update failed on %s", e.Subsystem, host)
+		kind := syncerr.Describe(syncerr.Kind(e.ErrorKind))
+		m.Text = fmt.Sprintf("%s (%s)\n→ %s", e.Error, kind.Kind, strings.ReplaceAll(kind.Hint, "<subsystem>", e.Subsystem))
+		m.Output = e.Output
+	case events.UpdateRegressed:
+		m.Severity = config.SeverityWarning
+		m.Title = fmt.Sprintf("⚠️ %s %s regressed on %s; rolling back", e.Subsystem, orUnknown(e.From), host)
+		m.Text = e.Error
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+// changelog links the upstream commits between the versions of an event, if
+// both are known
+func changelog(cfg *config.Config, e events.Event) string {
+	repo, ok := cfg.Repo(e.Subsystem)
+	if !ok || e.From == "" || e.To == "" || revision.Same(e.From, e.To) {
+		return ""
+	}
+	base := repo.Artifact.BaseURL
+	if base == "" {
+		base = config.DefaultArtifactBaseURL
+	}
+	return fmt.Sprintf("%s/%s/compare/%s...%s", strings.TrimSuffix(base, "/"), repo.Repo, e.From, e.To)
+}
+
+// hostName returns the name this host goes by: its identity's, else the
+// configured one, else the hostname
+func hostName(cfg *config.Config) string {
+	if id := identity.Current(); id != nil && id.Name != "" {
+		return id.Name
+	}
+	if cfg.Identity.Name != "" {
+		return cfg.Identity.Name
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// sign returns the hex HMAC-SHA256 of body under key
+func sign(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// tail returns about the last n bytes of s, starting at a line
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[len(s)-n:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return "…\n" + strings.ToValidUTF8(s, "")
+}
+
+// orUnknown returns version shortened for display, or "?" if it is empty
+func orUnknown(version string) string {
+	if version == "" {
+		return "?"
+	}
+	return revision.Short(version)
+}
+
+// orEnv names where a URL comes from, for errors
+func orEnv(file, env string) string {
+	if file != "" {
+		return file
+	}
+	return "$" + env
+}
@@ -0,0 +1,53 @@
+package notify
+
+import "github.com/joeblew99/plat-telemetry/sync/pkg/config"
+
+func init() {
+	register(config.NotifySlack, slack, false)
+}
+
+// slackMaxOutput is how much build output a Slack message quotes; attachment
+// text is cut off at 3000 characters
+const slackMaxOutput = 2000
+
+// slackColors are the attachment bar colors by severity
+var slackColors = map[string]string{
+	config.SeverityInfo:    "#2eb886",
+	config.SeverityWarning: "#daa038",
+	config.SeverityError:   "#a30200",
+}
+
+// slackMessage is the body of a Slack incoming webhook
+type slackMessage struct {
+	Text        string            `json:"text"` // notification and fallback text
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color     string `json:"color"`
+	Title     string `json:"title"`
+	TitleLink string `json:"title_link,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Footer    string `json:"footer"`
+	Ts        int64  `json:"ts"`
+}
+
+// slack formats m for a Slack incoming webhook: the title, linked to the
+// changelog, over the details and the output in a code block
+func slack(m Message) any {
+	text := m.Text
+	if m.Output != "" {
+		text += "\n```" + tail(m.Output, slackMaxOutput) + "```"
+	}
+	return slackMessage{
+		Text: m.Title,
+		Attachments: []slackAttachment{{
+			Color:     slackColors[m.Severity],
+			Title:     m.Title,
+			TitleLink: m.Link,
+			Text:      text,
+			Footer:    "sync on " + m.Host,
+			Ts:        m.Time.Unix(),
+		}},
+	}
+}
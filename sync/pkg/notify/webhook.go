@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+)
+
+func init() {
+	register(config.NotifyWebhook, webhook, true)
+}
+
+// TestEvent is the type of the event sync notify test posts to webhook sinks
+const TestEvent = "notify.test"
+
+// webhookPayload is the body of an outbound webhook: the event as
+// GET /api/events streams it, plus what the chat sinks would show
+type webhookPayload struct {
+	events.Event
+	Host     string `json:"host"`
+	Severity string `json:"severity"`
+	Title    string `json:"title,omitempty"` // chat message title, for events chat channels are told of
+	Text     string `json:"text,omitempty"`
+	Link     string `json:"link,omitempty"` // changelog of the update, if known
+}
+
+// webhook formats m for an outbound webhook
+func webhook(m Message) any {
+	return webhookPayload{
+		Event:    m.Event,
+		Host:     m.Host,
+		Severity: m.Severity,
+		Title:    m.Title,
+		Text:     m.Text,
+		Link:     m.Link,
+	}
+}
@@ -0,0 +1,279 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// File names inside the CA directory
+const (
+	CACertFile = "ca.crt"
+	CAKeyFile  = "ca.key"
+)
+
+// Validity periods for generated certificates
+const (
+	CAValidity   = 10 * 365 * 24 * time.Hour
+	CertValidity = 2 * 365 * 24 * time.Hour
+)
+
+// Init creates a new CA key pair in dir
+// It refuses to overwrite an existing CA so issued certificates stay valid
+func Init(dir string) error {
+	certPath := filepath.Join(dir, CACertFile)
+	if _, err := os.Stat(certPath); err == nil {
+		return fmt.Errorf("CA already exists at %s", certPath)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create CA dir: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "plat-telemetry sync CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	return writePair(dir, "ca", der, key)
+}
+
+// Issue signs a certificate for host with the CA in dir
+// The certificate is valid for both server and client authentication, so the
+// same identity works whichever side of the connection a host is on.
+// Returns the paths of the written certificate and key.
+func Issue(dir, host string) (string, string, error) {
+	if err := validHost(host); err != nil {
+		return "", "", err
+	}
+	caCert, caKey, err := loadCA(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return "", "", err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(CertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign certificate: %w", err)
+	}
+
+	if err := writePair(dir, host, der, key); err != nil {
+		return "", "", err
+	}
+
+	return filepath.Join(dir, host+".crt"), filepath.Join(dir, host+".key"), nil
+}
+
+// validHost checks that host is an IP address or DNS name, as the certificate
+// is issued for it and written to <host>.crt and <host>.key in the CA dir
+// "ca" would overwrite the CA's own pair, and separators or ".." would write
+// outside the dir.
+func validHost(host string) error {
+	if strings.EqualFold(host, "ca") {
+		return fmt.Errorf("invalid host %q: the CA's own certificate and key are ca.crt and ca.key", host)
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if !dnsName.MatchString(host) || len(host) > 253 {
+		return fmt.Errorf("invalid host %q: want a DNS name or IP address", host)
+	}
+	return nil
+}
+
+// dnsName matches a DNS name: dot-separated labels of letters, digits and
+// inner hyphens, up to 63 characters each
+var dnsName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+
+// ServerTLSConfig loads a server certificate and, when clientCAFile is set,
+// requires and verifies client certificates signed by that CA
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pool, err := loadPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// ClientTLSConfig builds a client config that presents certFile/keyFile and
+// trusts servers signed by caFile, on top of the system roots
+// Without caFile, RootCAs is left nil: the system roots, or whatever roots the
+// caller's transport already trusts.
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := SystemPoolWith(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// loadCA reads the CA certificate and key from dir
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, CACertFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA certificate (run 'sync ca init' first): %w", err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, CAKeyFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("invalid CA PEM data")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+// SystemPoolWith returns the system roots plus the CAs in caFile, for clients
+// that must also trust a private CA
+func SystemPoolWith(caFile string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool() // e.g. no system store; trust the bundle alone
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// loadPool reads a PEM bundle into a certificate pool
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// writePair writes <name>.crt and <name>.key (key readable by owner only)
+func writePair(dir, name string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	return nil
+}
+
+// newSerial returns a random 128-bit certificate serial number
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial: %w", err)
+	}
+	return serial, nil
+}
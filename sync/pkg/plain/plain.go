@@ -0,0 +1,92 @@
+package plain
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+)
+
+// enabled is set once at startup, before any output
+var enabled atomic.Bool
+
+// Enable turns plain output on for every Writer and for subprocesses, which
+// inherit NO_COLOR (honoured by task and most build tools)
+func Enable() {
+	enabled.Store(true)
+	os.Setenv("NO_COLOR", "1")
+}
+
+// Enabled reports whether plain output is on
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// FromEnv turns plain output on when SYNC_PLAIN is true (1, true...)
+func FromEnv() {
+	if on, err := strconv.ParseBool(os.Getenv("SYNC_PLAIN")); err == nil && on {
+		Enable()
+	}
+}
+
+// Level prefixes replacing the emoji markers
+const (
+	Error = "[ERROR]"
+	Warn  = "[WARN]"
+	OK    = "[OK]"
+	Info  = "[INFO]"
+)
+
+// levels maps the markers that carry a severity; every other emoji is Info
+var levels = map[string]string{
+	"❌": Error,
+	"💥": Error,
+	"⚠": Warn,
+	"❓": Warn,
+	"✅": OK,
+}
+
+var (
+	// emojiPattern matches an emoji marker (with its variation selector) and the spacing after it
+	emojiPattern = regexp.MustCompile(`([\x{1F300}-\x{1FAFF}\x{2600}-\x{27BF}\x{23E9}-\x{23FA}\x{2B50}])\x{FE0F}? *`)
+	// ansiPattern matches ANSI escape sequences: colors, cursor movement, line clearing
+	ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+)
+
+// String replaces emoji markers in s with leveled text prefixes and strips ANSI
+// escapes, if plain output is on
+func String(s string) string {
+	if !Enabled() {
+		return s
+	}
+	s = ansiPattern.ReplaceAllString(s, "")
+	return emojiPattern.ReplaceAllStringFunc(s, func(m string) string {
+		level, ok := levels[emojiPattern.FindStringSubmatch(m)[1]]
+		if !ok {
+			level = Info
+		}
+		return level + " "
+	})
+}
+
+// Writer applies String to everything written through it
+// Like redact.Writer, it relies on markers not being split across Writes.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w; output passes through unchanged while plain output is off
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (p *Writer) Write(b []byte) (int, error) {
+	if !Enabled() {
+		return p.w.Write(b)
+	}
+	if _, err := io.WriteString(p.w, String(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
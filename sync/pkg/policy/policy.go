@@ -0,0 +1,372 @@
+// Package policy evaluates the conditions of sync.yaml's policies, which
+// decide what happens to a detected update before it is enqueued
+// Conditions are expressions in a small CEL-like language, parsed with
+// go/parser: literals, attributes (subsystem, host.labels.site), comparisons,
+// && || !, and a few functions. Rules change with the config, not the binary.
+package policy
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a compiled condition
+type Expr struct {
+	src  string
+	node ast.Expr
+}
+
+// Compile parses a condition, checking that it only uses what Eval supports
+func Compile(src string) (*Expr, error) {
+	node, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", src, err)
+	}
+	if err := check(node); err != nil {
+		return nil, fmt.Errorf("%q: %w", src, err)
+	}
+	return &Expr{src: src, node: node}, nil
+}
+
+// String returns the condition as written
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the condition against attrs
+// Attribute values are strings, numbers (int or float64), bools, or nested
+// map[string]string and map[string]any; a missing attribute or map key is "".
+func (e *Expr) Eval(attrs map[string]any) (bool, error) {
+	v, err := eval(e.node, attrs)
+	if err != nil {
+		return false, fmt.Errorf("%q: %w", e.src, err)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%q: result is %s, not a bool", e.src, typeName(v))
+	}
+	return b, nil
+}
+
+// functions are the functions conditions may call, with their argument count
+// (-1: any, at least one)
+var functions = map[string]int{
+	"oneOf":      -1, // oneOf(day, "Saturday", "Sunday")
+	"startsWith": 2,  // startsWith(subsystem, "nats")
+	"endsWith":   2,
+	"contains":   2,
+	"matches":    2, // matches(to, "^v2\\.") with a Go regexp
+}
+
+func check(node ast.Expr) error {
+	var err error
+	ast.Inspect(node, func(n ast.Node) bool {
+		if err != nil || n == nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.BinaryExpr:
+			switch n.Op {
+			case token.LAND, token.LOR, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			default:
+				err = fmt.Errorf("operator %s is not supported", n.Op)
+			}
+		case *ast.UnaryExpr:
+			if n.Op != token.NOT && n.Op != token.SUB {
+				err = fmt.Errorf("operator %s is not supported", n.Op)
+			}
+		case *ast.BasicLit:
+			if n.Kind == token.CHAR || n.Kind == token.IMAG {
+				err = fmt.Errorf("literal %s is not supported; strings take double quotes", n.Value)
+			}
+		case *ast.CallExpr:
+			ident, ok := n.Fun.(*ast.Ident)
+			if !ok {
+				err = fmt.Errorf("only the functions %s can be called", functionNames())
+				return false
+			}
+			want, known := functions[ident.Name]
+			switch {
+			case !known:
+				err = fmt.Errorf("unknown function %s (have %s)", ident.Name, functionNames())
+			case want < 0 && len(n.Args) < 1, want >= 0 && len(n.Args) != want:
+				err = fmt.Errorf("%s takes %s argument(s), not %d", ident.Name, argCount(want), len(n.Args))
+			case ident.Name == "matches":
+				if lit, ok := n.Args[1].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					s, _ := strconv.Unquote(lit.Value)
+					if _, rerr := regexp.Compile(s); rerr != nil {
+						err = fmt.Errorf("matches: %w", rerr)
+					}
+				}
+			}
+			// Inspect the arguments, not the function name as an attribute
+			for _, a := range n.Args {
+				if err == nil {
+					err = check(a)
+				}
+			}
+			return false
+		case *ast.Ident, *ast.SelectorExpr, *ast.ParenExpr:
+		case *ast.IndexExpr:
+			// host.labels["region"], for keys that aren't identifiers
+		default:
+			err = fmt.Errorf("%T is not supported", n)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func eval(node ast.Expr, attrs map[string]any) (any, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return eval(n.X, attrs)
+	case *ast.BasicLit:
+		if n.Kind == token.STRING {
+			return strconv.Unquote(n.Value)
+		}
+		return strconv.ParseFloat(n.Value, 64)
+	case *ast.Ident:
+		switch n.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return normalize(lookup(attrs, n.Name)), nil
+	case *ast.SelectorExpr:
+		x, err := eval(n.X, attrs)
+		if err != nil {
+			return nil, err
+		}
+		return field(x, n.Sel.Name)
+	case *ast.IndexExpr:
+		x, err := eval(n.X, attrs)
+		if err != nil {
+			return nil, err
+		}
+		key, err := eval(n.Index, attrs)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("index is %s, not a string", typeName(key))
+		}
+		return field(x, s)
+	case *ast.UnaryExpr:
+		x, err := eval(n.X, attrs)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == token.NOT {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, fmt.Errorf("! needs a bool, not %s", typeName(x))
+			}
+			return !b, nil
+		}
+		f, ok := x.(float64)
+		if !ok {
+			return nil, fmt.Errorf("- needs a number, not %s", typeName(x))
+		}
+		return -f, nil
+	case *ast.BinaryExpr:
+		return binary(n, attrs)
+	case *ast.CallExpr:
+		return call(n, attrs)
+	}
+	return nil, fmt.Errorf("%T is not supported", node)
+}
+
+func binary(n *ast.BinaryExpr, attrs map[string]any) (any, error) {
+	x, err := eval(n.X, attrs)
+	if err != nil {
+		return nil, err
+	}
+	// && and || short-circuit, so a guard can protect what follows it
+	if n.Op == token.LAND || n.Op == token.LOR {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, not %s", n.Op, typeName(x))
+		}
+		if b == (n.Op == token.LOR) {
+			return b, nil
+		}
+		y, err := eval(n.Y, attrs)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok = y.(bool); !ok {
+			return nil, fmt.Errorf("%s needs bools, not %s", n.Op, typeName(y))
+		}
+		return b, nil
+	}
+
+	y, err := eval(n.Y, attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case token.EQL:
+		return equal(x, y)
+	case token.NEQ:
+		eq, err := equal(x, y)
+		return !eq, err
+	}
+	c, err := compare(x, y)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.Op, err)
+	}
+	switch n.Op {
+	case token.LSS:
+		return c < 0, nil
+	case token.LEQ:
+		return c <= 0, nil
+	case token.GTR:
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func call(n *ast.CallExpr, attrs map[string]any) (any, error) {
+	name := n.Fun.(*ast.Ident).Name
+	args := make([]any, len(n.Args))
+	for i, a := range n.Args {
+		v, err := eval(a, attrs)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	if name == "oneOf" {
+		for _, a := range args[1:] {
+			if eq, err := equal(args[0], a); err != nil {
+				return nil, fmt.Errorf("oneOf: %w", err)
+			} else if eq {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	s, ok1 := args[0].(string)
+	arg, ok2 := args[1].(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("%s needs strings, not %s and %s", name, typeName(args[0]), typeName(args[1]))
+	}
+	switch name {
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "contains":
+		return strings.Contains(s, arg), nil
+	default:
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("matches: %w", err)
+		}
+		return re.MatchString(s), nil
+	}
+}
+
+// lookup returns the attribute name, or "" if it is not set
+func lookup(attrs map[string]any, name string) any {
+	if v, ok := attrs[name]; ok {
+		return v
+	}
+	return ""
+}
+
+// field returns a key of a map attribute, or "" if it is not set
+func field(x any, name string) (any, error) {
+	switch m := x.(type) {
+	case map[string]any:
+		return normalize(lookup(m, name)), nil
+	case map[string]string:
+		return m[name], nil
+	case string:
+		// An unset map attribute: its keys are unset too
+		if m == "" {
+			return "", nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no field %s", typeName(x), name)
+}
+
+// normalize turns the numbers of attrs into float64, as number literals are
+func normalize(v any) any {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case nil:
+		return ""
+	}
+	return v
+}
+
+func equal(x, y any) (bool, error) {
+	if typeName(x) != typeName(y) {
+		return false, fmt.Errorf("cannot compare %s with %s", typeName(x), typeName(y))
+	}
+	switch x.(type) {
+	case string, float64, bool:
+		return x == y, nil
+	}
+	return false, fmt.Errorf("cannot compare %s values", typeName(x))
+}
+
+func compare(x, y any) (int, error) {
+	switch a := x.(type) {
+	case float64:
+		if b, ok := y.(float64); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if b, ok := y.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot order %s and %s", typeName(x), typeName(y))
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a bool"
+	case map[string]any, map[string]string:
+		return "a map"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func functionNames() string {
+	return "oneOf, startsWith, endsWith, contains and matches"
+}
+
+func argCount(n int) string {
+	if n < 0 {
+		return "at least 1"
+	}
+	return strconv.Itoa(n)
+}
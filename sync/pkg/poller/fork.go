@@ -0,0 +1,93 @@
+package poller
+
+import (
+	"context"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/forks"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// forkDue reports whether a fork's comparison with upstream is due
+func (p *Poller) forkDue(repo config.RepoConfig, now time.Time) bool {
+	if !repo.Fork.Enabled() {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !now.Before(p.forkNext[repo.Repo])
+}
+
+// compareFork compares a fork with its upstream and records the result
+// A fork.diverged event is published when the fork falls threshold commits
+// behind, once per crossing rather than on every comparison. With fork.merge,
+// a fork that is behind gets a pull request merging upstream.
+func (p *Poller) compareFork(ctx context.Context, repo config.RepoConfig) error {
+	logger.Debug("Comparing fork with upstream", "repo", repo.Repo, "upstream", repo.Fork.Upstream, "branch", repo.Fork.Branch)
+	d, err := checker.ForkDivergence(ctx, p.client, repo)
+	if err != nil {
+		return err
+	}
+	previous := status.RecordDivergence(d)
+	p.mu.Lock()
+	p.forkNext[repo.Repo] = time.Now().Add(repo.Fork.Interval)
+	p.mu.Unlock()
+	metrics.Fork(repo.Subsystem, d.Behind, d.Ahead)
+
+	if d.Behind == 0 {
+		logger.Info("Fork is even with upstream", "subsystem", repo.Subsystem, "upstream", d.Upstream, "ahead", d.Ahead)
+		return nil
+	}
+	logger.Info("Fork is behind upstream", "subsystem", repo.Subsystem, "upstream", d.Upstream, "behind", d.Behind, "ahead", d.Ahead)
+	if d.Diverged(repo.Fork.Threshold) && (previous == nil || !previous.Diverged(repo.Fork.Threshold)) {
+		logger.Warn("Fork passed its divergence threshold", "subsystem", repo.Subsystem, "threshold", repo.Fork.Threshold)
+		events.Publish(events.Event{
+			Type:      events.ForkDiverged,
+			Subsystem: repo.Subsystem,
+			Upstream:  d.Upstream,
+			Behind:    d.Behind,
+			Ahead:     d.Ahead,
+		})
+	}
+
+	if !repo.Fork.Merge {
+		return nil
+	}
+	if updater.DryRun() {
+		logger.Info("Dry run: would merge upstream and open a pull request", "subsystem", repo.Subsystem, "upstream", d.Upstream, "branch", repo.Fork.MergeBranch)
+		return nil
+	}
+	result, err := forks.Merge(ctx, p.client, repo, d)
+	switch {
+	case err != nil:
+		return err
+	case result.Conflict:
+		logger.Warn("Upstream does not merge cleanly; conflicts reported", "subsystem", repo.Subsystem, "upstream", d.Upstream, "fork", d.Fork, "url", result.URL)
+	default:
+		logger.Info("Merged upstream", "subsystem", repo.Subsystem, "upstream", d.Upstream, "commit", revision.Short(result.Commit), "branch", repo.Fork.MergeBranch, "url", result.URL)
+	}
+	return nil
+}
+
+// green reports whether the checks of a fork commit passed, for require_green
+func (p *Poller) green(ctx context.Context, repo config.RepoConfig, commit string) (bool, error) {
+	state, err := checker.CommitChecks(ctx, p.client, repo.Repo, commit)
+	if err != nil {
+		return false, err
+	}
+	switch state {
+	case checker.ChecksSuccess:
+		return true, nil
+	case checker.ChecksFailure:
+		logger.Warn("Not updating: the commit's checks failed", "subsystem", repo.Subsystem, "version", revision.Short(commit))
+	default:
+		logger.Info("Not updating yet: the commit's checks are still running", "subsystem", repo.Subsystem, "version", revision.Short(commit))
+	}
+	return false, nil
+}
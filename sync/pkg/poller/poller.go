@@ -2,233 +2,349 @@ package poller
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"os/exec"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v80/github"
 	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/clock"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
 )
 
-// RepoConfig holds configuration for checking a repository
-type RepoConfig struct {
-	Subsystem string
-	UseTag    bool   // true = check tag from Taskfile, false = check branch
-	Branch    string // branch name if UseTag=false
-}
+// logger logs poll cycles, repo checks and fork comparisons
+var logger = logging.For("poller")
 
 // Poller checks GitHub repositories for updates periodically
 type Poller struct {
-	client   *github.Client
-	interval time.Duration
-	repos    map[string]RepoConfig // repo -> config mapping
+	client    *github.Client
+	interval  time.Duration // tick interval (shortest repo interval)
+	repos     []config.RepoConfig
+	next      map[string]time.Time // repo -> next scheduled check, on the monotonic clock
+	forkNext  map[string]time.Time // repo -> next comparison of a fork with upstream, likewise
+	triggered map[string]string    // subsystem -> upstream version that last triggered an update
+	checks    config.ChecksConfig
+
+	// mu guards paused, and next, forkNext and triggered while a cycle's checks run
+	mu     sync.Mutex
+	paused time.Time // GitHub quota exhausted until then
 }
 
-// NewPoller creates a new poller with 1-hour interval
-// Set GITHUB_TOKEN env var for authenticated requests (5000/hour vs 60/hour)
-func NewPoller() *Poller {
-	// Use GitHub token from env if available (increases rate limit to 5000/hour)
-	var client *github.Client
-	token := os.Getenv("GITHUB_TOKEN")
-	if token != "" {
-		client = github.NewClient(nil).WithAuthToken(token)
-		log.Printf("🔑 Using authenticated GitHub API (5000 req/hour)")
-	} else {
-		client = github.NewClient(nil)
-		log.Printf("⚠️  Using unauthenticated GitHub API (60 req/hour). Set GITHUB_TOKEN for higher limits.")
-	}
-
-	return &Poller{
-		client:   client,
-		interval: 1 * time.Hour, // Reduced from 5min to avoid rate limits
-		repos: map[string]RepoConfig{
-			"nats-io/nats-server": {
-				Subsystem: "nats",
-				UseTag:    true, // Version read from Taskfile via config:version task
-			},
-			"liftbridge-io/liftbridge": {
-				Subsystem: "liftbridge",
-				UseTag:    false,
-				Branch:    "master",
-			},
-			"influxdata/telegraf": {
-				Subsystem: "telegraf",
-				UseTag:    false,
-				Branch:    "master",
-			},
-		},
+// NewPoller creates a new poller for the repos declared in cfg
+// Provide a GitHub token for authenticated requests (5000/hour vs 60/hour)
+func NewPoller(cfg *config.Config, token *secrets.Secret) *Poller {
+	// Tick at the shortest repo interval so every repo is checked on time
+	interval := cfg.Interval
+	for _, repo := range cfg.Repos {
+		if repo.Interval < interval {
+			interval = repo.Interval
+		}
+	}
+
+	p := &Poller{
+		client:    ghclient.New(token, cfg.Provider, cfg.FixturesDir, cfg.GitHub),
+		interval:  interval,
+		repos:     cfg.Repos,
+		next:      make(map[string]time.Time),
+		forkNext:  make(map[string]time.Time),
+		triggered: make(map[string]string),
+		checks:    cfg.Checks,
+	}
+	p.restore()
+	return p
+}
+
+// restore resumes the check schedule and triggered versions persisted by a
+// previous run, so a restart neither re-polls everything nor re-triggers updates
+// The persisted times are wall clock times; a check is put off by its interval
+// at most, however wrong the clock was then or is now.
+func (p *Poller) restore() {
+	now := time.Now()
+	for _, repo := range p.repos {
+		if last := status.LastCheck(repo.Subsystem); !last.IsZero() {
+			p.next[repo.Repo] = now.Add(clock.Until(last.Add(repo.Interval), repo.Interval))
+		}
+		if last := status.LastDivergence(repo.Subsystem); repo.Fork.Enabled() && !last.IsZero() {
+			p.forkNext[repo.Repo] = now.Add(clock.Until(last.Add(repo.Fork.Interval), repo.Fork.Interval))
+		}
+
+		var version string
+		found, err := state.Get(state.BucketTriggers, repo.Subsystem, &version)
+		if err != nil {
+			logger.Warn("Could not load trigger state", "subsystem", repo.Subsystem, "err", err)
+			continue
+		}
+		if found {
+			p.triggered[repo.Subsystem] = version
+		}
 	}
 }
 
 // Start begins the polling loop
+// Intervals run on the monotonic clock. When the wall clock jumps, e.g. once
+// NTP has set a device's bad RTC right, every repo is checked again so the
+// check times recorded in status are right too.
 func (p *Poller) Start() error {
-	log.Printf("🔄 Starting poller (interval: %v)", p.interval)
+	logger.Info("Starting poller", "repos", len(p.repos), "interval", p.interval)
+
+	jumps := make(chan time.Duration, 1)
+	go clock.Watch(context.Background(), clock.DefaultInterval, clock.DefaultThreshold, func(jump time.Duration) {
+		select {
+		case jumps <- jump:
+		default: // a re-check is already pending
+		}
+	})
 
 	// Do initial check immediately
-	p.checkAll()
+	p.checkAll(time.Now())
 
 	// Then poll on interval
 	ticker := time.NewTicker(p.interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		p.checkAll()
+	for {
+		select {
+		case now := <-ticker.C:
+			p.checkAll(now)
+		case jump := <-jumps:
+			logger.Warn("Wall clock jumped; re-evaluating check schedules", "jump", jump.Round(time.Second))
+			p.resync()
+			p.checkAll(time.Now())
+		}
 	}
+}
 
-	return nil
+// resync makes every repo and fork comparison due, after a wall clock jump
+// A quota pause is left alone: it counts down on the monotonic clock.
+func (p *Poller) resync() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.next)
+	clear(p.forkNext)
 }
 
-// checkAll checks all upstream repositories for updates
-func (p *Poller) checkAll() {
-	log.Printf("📡 Polling upstream source repositories for new commits...")
+// checkResult is the outcome of one repo check in a cycle
+type checkResult struct {
+	repo    config.RepoConfig
+	update  bool  // upstream differs from the installed version
+	skipped bool  // not checked: the GitHub quota ran out earlier in the cycle
+	err     error // check failed
+}
 
-	for repo, config := range p.repos {
-		log.Printf("   Checking %s (%s)...", repo, config.Subsystem)
-		if err := p.checkRepo(repo, config); err != nil {
-			log.Printf("   ❌ Failed to check %s: %v", repo, err)
-		}
+// checkAll checks all upstream repositories that are due for a check
+// Up to checks.concurrency repos are checked at once; the cycle summary is
+// logged when the last one finishes.
+func (p *Poller) checkAll(now time.Time) {
+	if paused := p.pausedUntil(); now.Before(paused) {
+		logger.Warn("GitHub API quota exhausted; skipping this cycle", "until", paused.Format(time.TimeOnly))
+		return
 	}
-	log.Printf("📡 Polling cycle complete")
-}
+	logger.Info("Polling upstream source repositories for new commits")
 
-// checkRepo checks a single repository for updates
-func (p *Poller) checkRepo(repo string, config RepoConfig) error {
-	ctx := context.Background()
+	var due []config.RepoConfig
+	for _, repo := range p.repos {
+		if now.Before(p.next[repo.Repo]) {
+			continue
+		}
+		p.next[repo.Repo] = now.Add(repo.Interval)
+		due = append(due, repo)
+	}
 
-	// Parse repo into owner/name
-	owner, repoName := parseRepo(repo)
-	if owner == "" || repoName == "" {
-		return fmt.Errorf("invalid repo format: %s", repo)
+	results := make([]checkResult, len(due))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(p.checks.Concurrency, len(due)) {
+		wg.Go(func() {
+			for i := range indexes {
+				results[i] = p.check(due[i])
+			}
+		})
+	}
+	for i := range due {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var updates, failed, skipped int
+	for _, r := range results {
+		switch {
+		case r.skipped:
+			skipped++
+		case r.err != nil:
+			failed++
+			logger.Error("Failed to check", "repo", r.repo.Repo, "subsystem", r.repo.Subsystem, "err", r.err, "hint", syncerr.Hint(syncerr.KindOf(r.err)))
+		case r.update:
+			updates++
+		}
+	}
+	if skipped > 0 {
+		logger.Warn("GitHub API quota exhausted; skipped repos", "skipped", skipped, "until", p.pausedUntil().Format(time.TimeOnly))
 	}
 
-	var latestHash string
-	var err error
+	status.RecordCycle()
+	metrics.PollCycle()
+	logger.Info("Polling cycle complete", "checked", len(due)-skipped, "updates", updates, "failed", failed,
+		"skipped", skipped, "duration", time.Since(now).Round(time.Millisecond))
+}
 
-	if config.UseTag {
-		// Get desired version from Taskfile
-		tag, err := getDesiredVersion(config.Subsystem)
-		if err != nil {
-			return fmt.Errorf("failed to get desired version from Taskfile: %w", err)
-		}
+// check runs one repo check with the configured timeout
+func (p *Poller) check(repo config.RepoConfig) checkResult {
+	if time.Now().Before(p.pausedUntil()) {
+		p.reschedule(repo, p.pausedUntil())
+		return checkResult{repo: repo, skipped: true}
+	}
 
-		// Check specific tag (for repos with pinned versions like NATS)
-		log.Printf("   → Fetching tag %s from %s/%s", tag, owner, repoName)
-		latestHash, err = p.getTagCommit(ctx, owner, repoName, tag)
-		if err != nil {
-			return fmt.Errorf("failed to get tag commit: %w", err)
-		}
-	} else {
-		// Check latest commit on branch
-		log.Printf("   → Fetching latest commit from %s/%s [%s]", owner, repoName, config.Branch)
-		latestHash, err = p.getLatestCommit(ctx, owner, repoName, config.Branch)
-		if err != nil {
-			return fmt.Errorf("failed to get latest commit: %w", err)
+	ctx, cancel := context.WithTimeout(context.Background(), p.checks.Timeout)
+	defer cancel()
+
+	logger.Debug("Checking", "repo", repo.Repo, "subsystem", repo.Subsystem)
+	update, err := p.checkRepo(ctx, repo)
+	if err == nil && p.forkDue(repo, time.Now()) {
+		// A failed comparison is retried next check; it doesn't fail this one
+		if ferr := p.compareFork(ctx, repo); ferr != nil {
+			logger.Warn("Fork comparison failed", "repo", repo.Repo, "subsystem", repo.Subsystem, "err", ferr)
+			if reset, limited := rateLimited(ferr); limited {
+				p.pause(reset)
+			}
 		}
 	}
-
-	// Get current version from subsystem
-	currentHash, err := checker.GetCurrentVersion(config.Subsystem)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("check timed out after %s: %w", p.checks.Timeout, err)
+	}
 	if err != nil {
-		log.Printf("⚠️  Could not read current version for %s: %v", config.Subsystem, err)
-		return nil
+		status.RecordCheck(repo.Subsystem, "", "", err)
+		metrics.Check(repo.Subsystem, err)
 	}
-
-	// Compare versions
-	if latestHash != currentHash {
-		log.Printf("   🆕 Update available for %s: %s -> %s", config.Subsystem, currentHash, latestHash)
-		log.Printf("   ▶  Triggering rebuild for %s", config.Subsystem)
-		go triggerUpdate(config.Subsystem)
-	} else {
-		log.Printf("   ✅ %s is up to date (%s)", config.Subsystem, currentHash)
+	if reset, limited := rateLimited(err); limited {
+		// Repos not yet checked stay due and are checked once the quota resets
+		p.pause(reset)
+		p.reschedule(repo, reset)
 	}
-
-	return nil
+	return checkResult{repo: repo, update: update, err: err}
 }
 
-// getTagCommit gets the commit hash for a specific tag
-func (p *Poller) getTagCommit(ctx context.Context, owner, repo, tag string) (string, error) {
-	// Get the reference for the specific tag
-	ref, _, err := p.client.Git.GetRef(ctx, owner, repo, "tags/"+tag)
-	if err != nil {
-		return "", fmt.Errorf("failed to get tag ref: %w", err)
+// pause stops checks until the GitHub quota resets
+func (p *Poller) pause(until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until.After(p.paused) {
+		p.paused = until
 	}
+}
 
-	// Get commit hash from tag
-	commitHash := ref.GetObject().GetSHA()
-	if len(commitHash) > 7 {
-		commitHash = commitHash[:7]
-	}
+// pausedUntil returns when checks may resume after an exhausted quota
+func (p *Poller) pausedUntil() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
 
-	return commitHash, nil
+// reschedule moves a repo's next check
+func (p *Poller) reschedule(repo config.RepoConfig, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next[repo.Repo] = at
 }
 
-// getLatestCommit gets the latest commit hash from a branch
-func (p *Poller) getLatestCommit(ctx context.Context, owner, repo, branch string) (string, error) {
-	commits, _, err := p.client.Repositories.ListCommits(ctx, owner, repo, &github.CommitsListOptions{
-		SHA:         branch,
-		ListOptions: github.ListOptions{PerPage: 1},
-	})
+// checkRepo checks a single repository for updates, reporting whether one is available
+func (p *Poller) checkRepo(ctx context.Context, repo config.RepoConfig) (bool, error) {
+	switch repo.Mode {
+	case config.ModeTag:
+		logger.Debug("Fetching the Taskfile's pinned tag", "repo", repo.Repo)
+	case config.ModeReleases:
+		logger.Debug("Fetching releases newer than the Taskfile's pin", "repo", repo.Repo)
+	default:
+		logger.Debug("Fetching latest commit", "repo", repo.Repo, "branch", repo.Branch)
+	}
+	latest, err := checker.LatestVersion(ctx, p.client, repo)
 	if err != nil {
-		return "", fmt.Errorf("failed to list commits: %w", err)
+		return false, err
 	}
+	latestHash := latest.Commit
 
-	if len(commits) == 0 {
-		return "", fmt.Errorf("no commits found")
+	// Get current version from subsystem
+	currentHash, err := checker.GetCurrentVersion(repo.Subsystem)
+	if err != nil {
+		logger.Warn("Could not read current version", "subsystem", repo.Subsystem, "err", err)
+		status.RecordCheck(repo.Subsystem, "", latestHash, fmt.Errorf("could not read current version: %w", err))
+		metrics.Check(repo.Subsystem, err)
+		return false, nil
 	}
+	status.RecordCheck(repo.Subsystem, currentHash, latestHash, nil)
+	metrics.Check(repo.Subsystem, nil)
 
-	commitHash := commits[0].GetSHA()
-	if len(commitHash) > 7 {
-		commitHash = commitHash[:7]
+	// Compare versions
+	if revision.Same(latestHash, currentHash) {
+		logger.Info("Up to date", "subsystem", repo.Subsystem, "version", revision.Short(currentHash))
+		return false, nil
 	}
 
-	return commitHash, nil
-}
-
-// parseRepo splits "owner/repo" into (owner, repo)
-func parseRepo(repo string) (string, string) {
-	// Simple split on "/"
-	for i, c := range repo {
-		if c == '/' {
-			return repo[:i], repo[i+1:]
+	logger.Info("Update available", "subsystem", repo.Subsystem, "from", revision.Short(currentHash), "to", revision.Short(latestHash))
+	if latest.Supersedes() {
+		logger.Info("Release supersedes the pin", "subsystem", repo.Subsystem, "release", latest.Release, "pin", latest.Pin)
+	}
+	switch {
+	case latest.Signer != "":
+		logger.Info("Tag signed", "subsystem", repo.Subsystem, "signer", latest.Signer)
+	case latest.Unverified != "":
+		logger.Warn("Unverified signature; updating anyway (signatures policy warn)", "subsystem", repo.Subsystem, "reason", latest.Unverified)
+	}
+	if repo.Fork.RequireGreen {
+		// Not recorded as triggered, so the next check looks again
+		if green, err := p.green(ctx, repo, latestHash); err != nil || !green {
+			return true, err
 		}
 	}
-	return "", ""
-}
-
-// getDesiredVersion reads the desired version from subsystem Taskfile
-func getDesiredVersion(subsystem string) (string, error) {
-	// Call task <subsystem>:config:version to get the pinned version
-	cmd := exec.Command("task", subsystem+":config:version")
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to run task %s:config:version: %w", subsystem, err)
+	if !p.trigger(repo.Subsystem, latestHash) {
+		logger.Info("Update already attempted; waiting for a new upstream version", "subsystem", repo.Subsystem, "version", revision.Short(latestHash))
+		return true, nil
 	}
-
-	// Trim whitespace and return
-	version := strings.TrimSpace(string(output))
-	if version == "" {
-		return "", fmt.Errorf("empty version returned from task %s:config:version", subsystem)
+	if !updater.DryRun() {
+		if err := state.Put(state.BucketTriggers, repo.Subsystem, latestHash); err != nil {
+			logger.Warn("Failed to persist trigger state", "subsystem", repo.Subsystem, "err", err)
+		}
 	}
-
-	return version, nil
+	logger.Info("Triggering rebuild", "subsystem", repo.Subsystem, "version", revision.Short(latestHash))
+	if err := updater.Submit(updater.Request{Subsystem: repo.Subsystem, Trigger: updater.TriggerPoll, Target: latestHash, Release: latest.Release, Published: latest.Published}); err != nil {
+		logger.Error("Update failed", "subsystem", repo.Subsystem, "err", err)
+	}
+	return true, nil
 }
 
-// triggerUpdate executes the update workflow for a subsystem
-func triggerUpdate(subsystem string) {
-	log.Printf("▶ Triggering update for %s", subsystem)
-
-	// Call task sync:update with SUBSYSTEM env var
-	cmd := exec.Command("task", "sync:update")
-	cmd.Env = append(os.Environ(), fmt.Sprintf("SUBSYSTEM=%s", subsystem))
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("❌ Update failed for %s: %v\n%s", subsystem, err, output)
-		return
+// trigger records version as the last trigger for a subsystem, reporting
+// false if it already was
+// Dry runs only remember the trigger in memory, so a later real run still updates.
+func (p *Poller) trigger(subsystem, version string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if revision.Same(p.triggered[subsystem], version) {
+		return false
 	}
+	p.triggered[subsystem] = version
+	return true
+}
 
-	log.Printf("✅ Update completed for %s\n%s", subsystem, output)
+// rateLimited reports whether err means the GitHub quota is exhausted, and until when
+func rateLimited(err error) (time.Time, bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		// The reset is a wall clock time; GitHub quotas reset within the hour
+		return time.Now().Add(clock.Until(rateErr.Rate.Reset.Time, time.Hour)), true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) && abuseErr.RetryAfter != nil {
+		return time.Now().Add(*abuseErr.RetryAfter), true
+	}
+	return time.Time{}, false
 }
@@ -0,0 +1,176 @@
+// Package processes reports the state of the processes the stack runs, from
+// the Process Compose API the service wrapper's process-compose serves
+package processes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// timeout bounds each call to the Process Compose API
+const timeout = 5 * time.Second
+
+// settle is how long a process may fail its readiness probe after starting
+// before it counts as unhealthy
+const settle = time.Minute
+
+// ErrNotRunning is returned when process-compose is not running (no socket)
+var ErrNotRunning = errors.New("process-compose is not running")
+
+// Process is the state of one process of the stack, e.g. nats or telegraf
+type Process struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace,omitempty"`
+	Status    string        `json:"status"` // as process-compose reports it: Running, Restarting, Completed, Disabled, ...
+	Health    string        `json:"health"` // healthy, unhealthy, starting or stopped
+	Ready     string        `json:"ready"`  // the readiness probe's verdict: Ready, Not Ready, or - without a probe
+	PID       int           `json:"pid,omitempty"`
+	Restarts  int           `json:"restarts"`
+	ExitCode  int           `json:"exitCode"`
+	Uptime    time.Duration `json:"uptime,omitempty"`
+	Memory    int64         `json:"memory,omitempty"` // resident bytes
+	CPU       float64       `json:"cpu,omitempty"`    // percent
+}
+
+// state is a process as the Process Compose API encodes it
+type state struct {
+	Name          string        `json:"name"`
+	Namespace     string        `json:"namespace"`
+	Status        string        `json:"status"`
+	IsReady       string        `json:"is_ready"`
+	HasReadyProbe bool          `json:"has_ready_probe"`
+	Restarts      int           `json:"restarts"`
+	ExitCode      int           `json:"exit_code"`
+	Pid           int           `json:"pid"`
+	Age           time.Duration `json:"age"`
+	Mem           int64         `json:"mem"`
+	CPU           float64       `json:"cpu"`
+}
+
+// Socket returns where process-compose serves its API: $PC_SOCKET, as for
+// the pc tasks, else pc/.pc.sock in the project root
+func Socket() (string, error) {
+	if path := os.Getenv("PC_SOCKET"); path != "" {
+		return path, nil
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "pc", ".pc.sock"), nil
+}
+
+// List returns the state of every process process-compose manages, by name
+func List(ctx context.Context) ([]Process, error) {
+	var body struct {
+		Data []state `json:"data"`
+	}
+	if err := do(ctx, http.MethodGet, "/processes", &body); err != nil {
+		return nil, err
+	}
+	list := make([]Process, 0, len(body.Data))
+	for _, s := range body.Data {
+		p := Process{
+			Name:      s.Name,
+			Namespace: s.Namespace,
+			Status:    s.Status,
+			Health:    health(s),
+			Ready:     s.IsReady,
+			Restarts:  s.Restarts,
+			ExitCode:  s.ExitCode,
+			Memory:    s.Mem,
+			CPU:       s.CPU,
+		}
+		if running(s.Status) {
+			p.PID, p.Uptime = s.Pid, s.Age
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Restart restarts one process, e.g. after its binary was replaced; the
+// others keep running
+func Restart(ctx context.Context, name string) error {
+	return do(ctx, http.MethodPost, "/process/restart/"+url.PathEscape(name), nil)
+}
+
+// do calls the Process Compose API over its unix socket
+func do(ctx context.Context, method, path string, out any) error {
+	socket, err := Socket()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return fmt.Errorf("%w (no %s)", ErrNotRunning, socket)
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://process-compose"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("process-compose API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return fmt.Errorf("process-compose API: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("process-compose API: %w", err)
+	}
+	return nil
+}
+
+// running reports whether process-compose reports a live process
+func running(status string) bool {
+	return status == "Running" || status == "Launched"
+}
+
+// health sums up a process: healthy when it runs and its readiness probe,
+// if any, passes; a probe failing within settle of the start is still starting
+func health(s state) string {
+	switch {
+	case s.Status == "Launching" || s.Status == "Pending" || s.Status == "Restarting":
+		return "starting"
+	case s.Status == "Disabled" || s.Status == "Skipped" || s.Status == "Foreground",
+		s.Status == "Completed" && s.ExitCode == 0:
+		return "stopped"
+	case !running(s.Status):
+		return "unhealthy"
+	case s.HasReadyProbe && s.IsReady != "Ready":
+		if s.Age < settle {
+			return "starting"
+		}
+		return "unhealthy"
+	}
+	return "healthy"
+}
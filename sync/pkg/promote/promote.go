@@ -0,0 +1,245 @@
+package promote
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Release is the build of a subsystem an environment should run
+// Files pins the exact artifact: hosts in the environment install this
+// version only if every file matches, never a rebuild of the same commit.
+type Release struct {
+	Environment string            `json:"environment"`
+	Subsystem   string            `json:"subsystem"`
+	Version     string            `json:"version"`
+	Files       map[string]string `json:"files"` // file name -> SHA256
+	From        string            `json:"from"`  // environment it soaked in
+	SoakedSince time.Time         `json:"soakedSince"`
+	By          string            `json:"by"`
+	Time        time.Time         `json:"time"`
+	// Seq counts the promotions of the subsystem into the environment: each
+	// is one past the release it replaces, so hosts agree on the latest
+	// whatever their clocks say
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// maxClockSkew is how far ahead of this host's clock an announced release
+// may be dated
+const maxClockSkew = 5 * time.Minute
+
+var (
+	mu         sync.RWMutex
+	announcers []func(Release)
+)
+
+// OnChange registers fn to announce releases promoted on this host to other hosts
+func OnChange(fn func(Release)) {
+	mu.Lock()
+	defer mu.Unlock()
+	announcers = append(announcers, fn)
+}
+
+// Promote records the release of subsystem running in from as the release of to
+// On a host in from, that is the active installed version; elsewhere it is the
+// release promoted into from earlier. It must have run in from for from's
+// soak time, unless force is set.
+func Promote(cfg *config.Config, subsystem, from, to string, force bool, actor string) (Release, error) {
+	stage := cfg.Stage(from)
+	if stage < 0 {
+		return Release{}, fmt.Errorf("unknown environment %s", from)
+	}
+	if cfg.Stage(to) != stage+1 {
+		return Release{}, fmt.Errorf("%s does not follow %s in environments (%s)", to, from, pipeline(cfg))
+	}
+
+	source, err := running(cfg, subsystem, from)
+	if err != nil {
+		return Release{}, err
+	}
+	if soak, soaked := cfg.Environments[stage].Soak, time.Since(source.SoakedSince); soaked < soak && !force {
+		return Release{}, fmt.Errorf("%s %s has soaked in %s for %s of %s (--force to promote anyway)",
+			subsystem, source.Version, from, soaked.Round(time.Minute), soak)
+	}
+	current, found, err := Get(to, subsystem)
+	if err != nil {
+		return Release{}, err
+	}
+	if found && current.Version == source.Version && maps.Equal(current.Files, source.Files) {
+		return Release{}, fmt.Errorf("%s %s is already the release in %s", subsystem, source.Version, to)
+	}
+
+	r := Release{
+		Environment: to,
+		Subsystem:   subsystem,
+		Version:     source.Version,
+		Files:       source.Files,
+		From:        from,
+		SoakedSince: source.SoakedSince,
+		By:          actor,
+		Time:        time.Now(),
+		Seq:         current.Seq + 1,
+	}
+	if err := record(r, ""); err != nil {
+		return Release{}, err
+	}
+	announce(r)
+	return r, nil
+}
+
+// running returns what subsystem runs in env, as far as this host knows
+func running(cfg *config.Config, subsystem, env string) (Release, error) {
+	if cfg.Environment != env {
+		r, found, err := Get(env, subsystem)
+		if err != nil {
+			return Release{}, err
+		}
+		if !found {
+			if cfg.Stage(env) == 0 {
+				return Release{}, fmt.Errorf("%s builds from source: promote from a %s host, where the build is installed", env, env)
+			}
+			return Release{}, fmt.Errorf("no release of %s has been promoted into %s", subsystem, env)
+		}
+		// Promoted releases soak from the time they were promoted
+		r.SoakedSince = r.Time
+		return r, nil
+	}
+
+	version, err := versions.Active(subsystem)
+	if err != nil {
+		return Release{}, err
+	}
+	if version == "" {
+		return Release{}, fmt.Errorf("%s has no installed version on this host", subsystem)
+	}
+	dir, err := versions.Dir(subsystem, version)
+	if err != nil {
+		return Release{}, err
+	}
+	files, err := versions.Digests(dir)
+	if err != nil {
+		return Release{}, fmt.Errorf("failed to hash %s %s: %w", subsystem, version, err)
+	}
+	return Release{Subsystem: subsystem, Version: version, Files: files, SoakedSince: activatedAt(subsystem, version)}, nil
+}
+
+// activatedAt returns when version last went live, per the update history,
+// falling back to its install time
+func activatedAt(subsystem, version string) time.Time {
+	if entries, err := history.Load(); err == nil {
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if e.Subsystem == subsystem && e.Success && revision.Same(e.To, version) {
+				return e.Time.Add(e.Duration)
+			}
+		}
+	}
+	list, _ := versions.List(subsystem)
+	for _, v := range list {
+		if v.Version == version {
+			return v.InstalledAt
+		}
+	}
+	return time.Now()
+}
+
+// Get returns the release promoted into env for subsystem
+func Get(env, subsystem string) (Release, bool, error) {
+	var r Release
+	found, err := state.Get(state.BucketReleases, env+"/"+subsystem, &r)
+	if err != nil {
+		return Release{}, false, fmt.Errorf("failed to read %s release of %s: %w", env, subsystem, err)
+	}
+	return r, found, nil
+}
+
+// List returns the releases of env (all environments if empty), by environment and subsystem
+func List(env string) ([]Release, error) {
+	var list []Release
+	err := state.ForEach(state.BucketReleases, func(key string, data []byte) error {
+		if env != "" && !strings.HasPrefix(key, env+"/") {
+			return nil
+		}
+		var r Release
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("release %s: %w", key, err)
+		}
+		list = append(list, r)
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Environment != list[j].Environment {
+			return list[i].Environment < list[j].Environment
+		}
+		return list[i].Subsystem < list[j].Subsystem
+	})
+	return list, err
+}
+
+// Apply records a release announced by another host, unless this host already
+// has the same or a later one for that environment, reporting whether it was applied
+// Releases are ordered by Seq. Time comes from the announcing host's clock, so
+// it only breaks ties, and a release dated too far ahead is refused rather
+// than left to outrank every later promotion.
+func Apply(r Release, source string) (bool, error) {
+	if ahead := time.Until(r.Time); ahead > maxClockSkew {
+		return false, fmt.Errorf("refusing %s release of %s: dated %s ahead of this host's clock", r.Environment, r.Subsystem, ahead.Round(time.Second))
+	}
+	current, found, err := Get(r.Environment, r.Subsystem)
+	if err != nil {
+		return false, err
+	}
+	if found && !later(r, current) {
+		return false, nil
+	}
+	return true, record(r, source)
+}
+
+// later reports whether r was promoted after current
+func later(r, current Release) bool {
+	if r.Seq != current.Seq {
+		return r.Seq > current.Seq
+	}
+	return r.Time.After(current.Time)
+}
+
+// record stores a release and writes it to the audit log
+func record(r Release, source string) error {
+	if err := state.Put(state.BucketReleases, r.Environment+"/"+r.Subsystem, r); err != nil {
+		return fmt.Errorf("failed to store %s release of %s: %w", r.Environment, r.Subsystem, err)
+	}
+	detail := fmt.Sprintf("%s %s: %s → %s", r.Subsystem, r.Version, r.From, r.Environment)
+	if source != "" {
+		detail += " (via " + source + ")"
+	}
+	return audit.Append(audit.Entry{Time: r.Time, Action: audit.ActionPromote, Actor: r.By, Detail: detail})
+}
+
+// announce passes a local promotion to the registered announcers
+func announce(r Release) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, fn := range announcers {
+		fn(r)
+	}
+}
+
+// pipeline returns e.g. "dev → staging → prod"
+func pipeline(cfg *config.Config) string {
+	names := make([]string, len(cfg.Environments))
+	for i, e := range cfg.Environments {
+		names[i] = e.Name
+	}
+	return strings.Join(names, " → ")
+}
@@ -0,0 +1,89 @@
+package redact
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+// minLength avoids redacting trivially short values that would mangle output
+const minLength = 6
+
+// tokenPattern matches GitHub token formats even when their value isn't registered
+var tokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+
+// secretEnvPattern matches env var names whose values are treated as secret
+var secretEnvPattern = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSWORD|PASSWD|CREDENTIAL|API_?KEY|PRIVATE_?KEY)`)
+
+var (
+	mu      sync.RWMutex
+	sources []func() []string
+)
+
+// Register adds a source of secret values; it is called on every redaction so
+// rotated values are picked up
+func Register(source func() []string) {
+	mu.Lock()
+	defer mu.Unlock()
+	sources = append(sources, source)
+}
+
+// RegisterEnv redacts the values of env vars whose names look secret
+func RegisterEnv() {
+	Register(func() []string {
+		var values []string
+		for _, kv := range os.Environ() {
+			name, value, ok := strings.Cut(kv, "=")
+			if ok && secretEnvPattern.MatchString(name) {
+				values = append(values, value)
+			}
+		}
+		return values
+	})
+}
+
+// String scrubs all known secret values from s
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, source := range sources {
+		for _, value := range source() {
+			if len(value) >= minLength {
+				s = strings.ReplaceAll(s, value, Placeholder)
+			}
+		}
+	}
+
+	return tokenPattern.ReplaceAllString(s, Placeholder)
+}
+
+// Bytes scrubs all known secret values from b
+func Bytes(b []byte) []byte {
+	return []byte(String(string(b)))
+}
+
+// Writer scrubs everything written through it
+// Secrets are only caught when they fall within a single Write, which holds
+// for the log package (one Write per entry).
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w with redaction
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (r *Writer) Write(p []byte) (int, error) {
+	if _, err := r.w.Write(Bytes(p)); err != nil {
+		return 0, err
+	}
+	// Report the original length; callers don't care that the output changed size
+	return len(p), nil
+}
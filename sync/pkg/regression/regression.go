@@ -0,0 +1,243 @@
+package regression
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/nethttp"
+)
+
+// sampleTimeout bounds reading one metric
+const sampleTimeout = 10 * time.Second
+
+// Regression is a metric that went past its threshold
+type Regression struct {
+	Metric    string
+	Baseline  float64 // the first sample after the update
+	Value     float64
+	Threshold string // e.g. "max 0" or "max_increase 50"
+}
+
+func (r *Regression) Error() string {
+	return fmt.Sprintf("%s regressed: %g (was %g, %s)", r.Metric, r.Value, r.Baseline, r.Threshold)
+}
+
+// Watch samples the metrics every interval until the window is over and
+// returns the first regression, or nil if none regressed
+// The first sample is the baseline max_increase is measured from. A counter
+// that drops has restarted with its process, and counts on from where it was.
+// Metrics that can't be read are reported to onError and skipped.
+func Watch(ctx context.Context, cfg config.RegressionConfig, onError func(config.RegressionMetric, error)) error {
+	type state struct {
+		baseline, last, offset float64
+		sampled                bool
+	}
+	states := make([]state, len(cfg.Metrics))
+
+	deadline := time.Now().Add(cfg.Window)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		for i, m := range cfg.Metrics {
+			value, err := Sample(ctx, m)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				onError(m, err)
+				continue
+			}
+
+			st := &states[i]
+			if !st.sampled {
+				st.baseline, st.last, st.sampled = value, value, true
+			}
+			if value < st.last {
+				st.offset += st.last
+			}
+			st.last = value
+
+			if m.Max != nil && value > *m.Max {
+				return &Regression{Metric: m.Name, Baseline: st.baseline, Value: value, Threshold: fmt.Sprintf("max %g", *m.Max)}
+			}
+			if m.MaxIncrease != nil && value+st.offset-st.baseline > *m.MaxIncrease {
+				return &Regression{Metric: m.Name, Baseline: st.baseline, Value: value + st.offset,
+					Threshold: fmt.Sprintf("max_increase %g", *m.MaxIncrease)}
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample reads the current value of a metric
+func Sample(ctx context.Context, m config.RegressionMetric) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, sampleTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := nethttp.Client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: %s", m.URL, resp.Status)
+	}
+
+	body := io.LimitReader(resp.Body, 16<<20)
+	if m.Prometheus != "" {
+		return prometheusValue(body, m.Prometheus)
+	}
+	return jsonValue(body, m.JSON)
+}
+
+// prometheusValue sums the samples of the series in Prometheus text format
+// matching selector, e.g. internal_write_errors{output="influxdb"}
+func prometheusValue(r io.Reader, selector string) (float64, error) {
+	name, matchers, err := parseSelector(selector)
+	if err != nil {
+		return 0, err
+	}
+
+	sum, found := 0.0, false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		labels := ""
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				continue
+			}
+			labels = line[i+1 : j]
+			line = line[:i] + " " + line[j+1:]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != name || !hasLabels(labels, matchers) {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: invalid value %q", name, fields[1])
+		}
+		sum, found = sum+v, true
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no series matches %s", selector)
+	}
+	return sum, nil
+}
+
+// parseSelector splits name{a="x",b="y"} into the name and its label matchers
+func parseSelector(selector string) (string, map[string]string, error) {
+	name, rest, ok := strings.Cut(selector, "{")
+	if !ok {
+		return strings.TrimSpace(selector), nil, nil
+	}
+	rest, ok = strings.CutSuffix(strings.TrimSpace(rest), "}")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid selector %q: missing }", selector)
+	}
+	matchers, err := parseLabels(rest)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return strings.TrimSpace(name), matchers, nil
+}
+
+// parseLabels parses a="x",b="y"
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("label without value in %q", s)
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, fmt.Errorf("unquoted value of label %s", key)
+		}
+		value, n := "", 1
+		for ; n < len(rest) && rest[n] != '"'; n++ {
+			if rest[n] == '\\' && n+1 < len(rest) {
+				n++
+			}
+			value += string(rest[n])
+		}
+		if n >= len(rest) {
+			return nil, fmt.Errorf("unterminated value of label %s", key)
+		}
+		labels[strings.TrimSpace(key)] = value
+		s = strings.TrimPrefix(strings.TrimSpace(rest[n+1:]), ",")
+		s = strings.TrimSpace(s)
+	}
+	return labels, nil
+}
+
+// hasLabels reports whether the labels of a series include all matchers
+func hasLabels(labels string, matchers map[string]string) bool {
+	if len(matchers) == 0 {
+		return true
+	}
+	have, err := parseLabels(labels)
+	if err != nil {
+		return false
+	}
+	for k, v := range matchers {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonValue returns the number at a dot-separated path of a JSON document
+func jsonValue(r io.Reader, path string) (float64, error) {
+	var doc any
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return 0, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	v := doc
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return 0, fmt.Errorf("%s: %s is not an object", path, key)
+		}
+		if v, ok = obj[key]; !ok {
+			return 0, fmt.Errorf("%s: no field %s", path, key)
+		}
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a number", path)
+	}
+	return n.Float64()
+}
@@ -0,0 +1,100 @@
+// Package render generates the runtime configs of subsystems (nats.conf,
+// telegraf.conf) from templates and the central config in sync.yaml
+// Templates are Go text/templates; they see the installed version, so a
+// setting a new version adds or drops can be guarded with
+// {{if .AtLeast "v2.11.0"}} and rendered in as the update installs it.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/semver"
+)
+
+// Host is this host as templates see it
+type Host struct {
+	ID       string            // identity ID, stable across renames
+	Name     string            // identity name (default: the hostname)
+	Hostname string            // OS hostname
+	Labels   map[string]string // identity labels, e.g. site: ams
+}
+
+// Data is what a config template is executed with
+type Data struct {
+	Subsystem   string
+	Version     string // installed commit
+	Release     string // installed release, e.g. v2.10.24; "" when the binary doesn't tell
+	Environment string // promotion stage of this host, if any
+	Host        Host
+	Vars        map[string]any // vars of sync.yaml, overlaid with the config's own
+}
+
+// AtLeast reports whether the installed release is v or newer
+// An unknown release is not at least anything, so guarded settings stay out.
+func (d Data) AtLeast(v string) (bool, error) {
+	want, ok := semver.Parse(v)
+	if !ok {
+		return false, fmt.Errorf("AtLeast: %q is not a version", v)
+	}
+	have, ok := semver.Parse(d.Release)
+	return ok && semver.Compare(have, want) >= 0, nil
+}
+
+// Matches reports whether the installed release satisfies a constraint,
+// e.g. ">= 2.10, < 2.12"; an unknown release matches nothing
+func (d Data) Matches(constraint string) (bool, error) {
+	c, err := semver.ParseConstraint(constraint)
+	if err != nil {
+		return false, fmt.Errorf("Matches: %w", err)
+	}
+	have, ok := semver.Parse(d.Release)
+	return ok && c.Check(have), nil
+}
+
+// funcs are the functions templates can call besides the builtins
+var funcs = template.FuncMap{
+	// default returns value unless it is empty, e.g. {{default 4222 (index .Vars "nats_port")}}
+	"default": func(def, value any) any {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+	// quote returns s as a double-quoted string, which both NATS and TOML configs accept
+	"quote": func(s any) string {
+		return strconv.Quote(fmt.Sprint(s))
+	},
+}
+
+// Execute renders the template at path with data
+// Referring to a var that isn't set is an error rather than an empty value;
+// use default or index for optional ones.
+func Execute(path string, data Data) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(filepath.Base(path)).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Vars returns global overlaid with local, neither being modified
+func Vars(global, local map[string]any) map[string]any {
+	vars := make(map[string]any, len(global)+len(local))
+	maps.Copy(vars, global)
+	maps.Copy(vars, local)
+	return vars
+}
@@ -0,0 +1,218 @@
+// Package report summarizes the update history over a period, per subsystem,
+// for team reviews: how often updates landed, how many failed and why, how
+// long an upstream release took to be running here, and how often an update
+// had to be rolled back.
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+)
+
+// Report is the update history of [Since, Until] summarized
+type Report struct {
+	Since      time.Time   `json:"since"`
+	Until      time.Time   `json:"until"`
+	Subsystems []Subsystem `json:"subsystems"`
+	Total      Subsystem   `json:"total"` // all subsystems together
+}
+
+// Subsystem is the summary of one subsystem's updates
+// Rollbacks (sync rollback and automatic ones after a regression) are
+// counted apart from the updates they undo.
+type Subsystem struct {
+	Subsystem   string               `json:"subsystem"`
+	Updates     int                  `json:"updates"` // update attempts
+	Succeeded   int                  `json:"succeeded"`
+	Failed      int                  `json:"failed"`
+	FailureRate float64              `json:"failureRate"` // failed / updates, 0 without updates
+	PerWeek     float64              `json:"perWeek"`     // successful updates per week
+	Failures    map[syncerr.Kind]int `json:"failures,omitempty"`
+	Rollbacks   int                  `json:"rollbacks"`
+	Regressions int                  `json:"regressions"` // of the rollbacks, those after a regression
+
+	// Mean time from upstream publishing a version to it running here, over
+	// the successful updates that know when it was published (see LeadTimes)
+	LeadTime  time.Duration `json:"leadTime,omitempty"`
+	LeadTimes int           `json:"leadTimes"`
+
+	MeanDuration time.Duration `json:"meanDuration,omitempty"` // of the successful updates
+	LastUpdate   time.Time     `json:"lastUpdate,omitzero"`    // last successful one
+}
+
+// New summarizes the entries recorded in [since, until], per subsystem
+// Subsystems without entries in the period are listed with zeros, so a
+// subsystem that never updated stands out.
+func New(entries []history.Entry, subsystems []string, since, until time.Time) Report {
+	r := Report{Since: since, Until: until}
+	by := make(map[string]*summary)
+	for _, name := range subsystems {
+		by[name] = &summary{Subsystem: Subsystem{Subsystem: name}}
+	}
+	total := &summary{Subsystem: Subsystem{Subsystem: "total"}}
+	for _, e := range entries {
+		if e.Time.Before(since) || e.Time.After(until) {
+			continue
+		}
+		s, ok := by[e.Subsystem]
+		if !ok {
+			s = &summary{Subsystem: Subsystem{Subsystem: e.Subsystem}}
+			by[e.Subsystem] = s
+		}
+		s.add(e)
+		total.add(e)
+	}
+
+	weeks := until.Sub(since).Hours() / (7 * 24)
+	for _, s := range by {
+		r.Subsystems = append(r.Subsystems, s.finish(weeks))
+	}
+	sort.Slice(r.Subsystems, func(i, j int) bool { return r.Subsystems[i].Subsystem < r.Subsystems[j].Subsystem })
+	r.Total = total.finish(weeks)
+	return r
+}
+
+// summary accumulates a Subsystem
+type summary struct {
+	Subsystem
+	lead, duration time.Duration
+}
+
+// add counts one history entry
+func (s *summary) add(e history.Entry) {
+	switch e.Trigger {
+	case updater.TriggerRegression:
+		s.Regressions++
+		s.Rollbacks++
+		return
+	case updater.TriggerRollback:
+		s.Rollbacks++
+		return
+	}
+
+	s.Updates++
+	if !e.Success {
+		s.Failed++
+		if s.Failures == nil {
+			s.Failures = make(map[syncerr.Kind]int)
+		}
+		s.Failures[orUnknown(e.ErrorKind)]++
+		return
+	}
+	s.Succeeded++
+	s.duration += e.Duration
+	done := e.Time.Add(e.Duration)
+	if done.After(s.LastUpdate) {
+		s.LastUpdate = done
+	}
+	if !e.Published.IsZero() && done.After(e.Published) {
+		s.lead += done.Sub(e.Published)
+		s.LeadTimes++
+	}
+}
+
+// finish computes the rates and means over a period of weeks
+func (s *summary) finish(weeks float64) Subsystem {
+	if s.Updates > 0 {
+		s.FailureRate = float64(s.Failed) / float64(s.Updates)
+	}
+	if weeks > 0 {
+		s.PerWeek = float64(s.Succeeded) / weeks
+	}
+	if s.Succeeded > 0 {
+		s.MeanDuration = (s.duration / time.Duration(s.Succeeded)).Round(time.Second)
+	}
+	if s.LeadTimes > 0 {
+		s.LeadTime = (s.lead / time.Duration(s.LeadTimes)).Round(time.Minute)
+	}
+	return s.Subsystem
+}
+
+// WriteText writes r as an aligned table with the failure kinds below it
+func WriteText(w io.Writer, r Report) {
+	fmt.Fprintf(w, "📊 Updates %s – %s\n\n", r.Since.Local().Format("2006-01-02"), r.Until.Local().Format("2006-01-02"))
+	fmt.Fprintf(w, "%-12s %7s %7s %8s %8s %9s %12s %9s\n", "SUBSYSTEM", "UPDATES", "FAILED", "FAIL %", "PER WK", "ROLLBACKS", "LEAD TIME", "DURATION")
+	for _, s := range append(r.Subsystems, r.Total) {
+		fmt.Fprintf(w, "%-12s %7d %7d %7.0f%% %8.1f %9d %12s %9s\n",
+			s.Subsystem, s.Updates, s.Failed, 100*s.FailureRate, s.PerWeek, s.Rollbacks, leadTime(s), orDash(s.MeanDuration))
+	}
+	if kinds := failures(r.Total); kinds != "" {
+		fmt.Fprintf(w, "\nFailures: %s\n", kinds)
+	}
+}
+
+// WriteMarkdown writes r as a Markdown table, for pasting into a review
+func WriteMarkdown(w io.Writer, r Report) {
+	fmt.Fprintf(w, "## Updates %s – %s\n\n", r.Since.Local().Format("2006-01-02"), r.Until.Local().Format("2006-01-02"))
+	fmt.Fprintln(w, "| Subsystem | Updates | Failed | Failure rate | Per week | Rollbacks | Lead time | Duration | Failures |")
+	fmt.Fprintln(w, "|-----------|--------:|-------:|-------------:|---------:|----------:|----------:|---------:|----------|")
+	for _, s := range append(r.Subsystems, r.Total) {
+		name := "`" + s.Subsystem + "`"
+		if s.Subsystem == r.Total.Subsystem {
+			name = "**total**"
+		}
+		fmt.Fprintf(w, "| %s | %d | %d | %.0f%% | %.1f | %d | %s | %s | %s |\n",
+			name, s.Updates, s.Failed, 100*s.FailureRate, s.PerWeek, s.Rollbacks, leadTime(s), orDash(s.MeanDuration), failures(s))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Lead time: mean time from upstream publishing a version to it running here (n = updates that know when it was published).")
+}
+
+// leadTime formats the mean lead time of s with its sample size
+func leadTime(s Subsystem) string {
+	if s.LeadTimes == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s (n=%d)", Days(s.LeadTime), s.LeadTimes)
+}
+
+// failures lists the failure kinds of s, most frequent first
+func failures(s Subsystem) string {
+	kinds := make([]syncerr.Kind, 0, len(s.Failures))
+	for k := range s.Failures {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if s.Failures[kinds[i]] != s.Failures[kinds[j]] {
+			return s.Failures[kinds[i]] > s.Failures[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	list := make([]string, len(kinds))
+	for i, k := range kinds {
+		list[i] = fmt.Sprintf("%s ×%d", k, s.Failures[k])
+	}
+	return strings.Join(list, ", ")
+}
+
+// Days formats d in days and hours once it is a day or longer, e.g. 2d5h
+func Days(d time.Duration) string {
+	if d < 24*time.Hour {
+		return d.String()
+	}
+	days := d / (24 * time.Hour)
+	return fmt.Sprintf("%dd%dh", days, (d-days*24*time.Hour)/time.Hour)
+}
+
+// orDash returns d as text, or "-" if it is zero
+func orDash(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.String()
+}
+
+// orUnknown returns kind, or syncerr.Unknown for entries recorded without one
+func orUnknown(kind syncerr.Kind) syncerr.Kind {
+	if kind == "" {
+		return syncerr.Unknown
+	}
+	return kind
+}
@@ -0,0 +1,62 @@
+package revision
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// Shortest hash abbreviations: git's minimum, and the one Same takes (what
+// .version files recorded before full hashes were stored)
+const (
+	minHash   = 4
+	minAbbrev = 7
+)
+
+var length atomic.Int32
+
+func init() {
+	length.Store(config.DefaultHashLength)
+}
+
+// SetLength sets how many characters Short keeps (display.hash_length)
+func SetLength(n int) {
+	if n <= 0 {
+		n = config.DefaultHashLength
+	}
+	length.Store(int32(n))
+}
+
+// Short abbreviates a full commit hash (SHA-1 or SHA-256) for display
+// Anything else, such as a release tag, a timestamp version or a hash already
+// recorded short, is returned as is. Metadata and state keep the full hash;
+// only output shortens it.
+func Short(version string) string {
+	n := int(length.Load())
+	if (len(version) != 40 && len(version) != 64) || !IsHash(version) || len(version) <= n {
+		return version
+	}
+	return version[:n]
+}
+
+// IsHash reports whether version looks like a (possibly abbreviated) commit hash
+func IsHash(version string) bool {
+	if len(version) < minHash || len(version) > 64 {
+		return false
+	}
+	return strings.Trim(version, "0123456789abcdef") == ""
+}
+
+// Same reports whether two versions name the same commit: they are equal, or
+// both are hashes and the shorter abbreviates the longer (as a version recorded
+// in the short form does a full hash)
+func Same(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= minAbbrev && IsHash(a) && IsHash(b) && strings.HasPrefix(b, a)
+}
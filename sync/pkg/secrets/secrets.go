@@ -0,0 +1,171 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+)
+
+// logger logs secrets being rotated or failing to reload
+var logger = logging.For("secrets")
+
+// Secret is a credential that can be rotated at runtime
+// The value comes from a file (re-read when it changes) or, failing that, an env var.
+type Secret struct {
+	name string
+	env  string
+	file string
+
+	mu        sync.RWMutex
+	value     string
+	previous  string
+	rotatedAt time.Time
+	modTime   time.Time
+	watching  bool
+}
+
+var (
+	loadedMu sync.Mutex
+	loaded   = map[source]*Secret{}
+)
+
+// source is where a secret's value comes from
+type source struct{ env, file string }
+
+// New loads a secret from file (if set) or env
+// Secrets are shared per env var and file: loading one again refreshes and
+// returns the same Secret, so callers that load per operation don't register
+// a redaction source each time.
+func New(name, env, file string) (*Secret, error) {
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+
+	src := source{env: env, file: file}
+	s, ok := loaded[src]
+	if !ok {
+		s = &Secret{name: name, env: env, file: file}
+	}
+
+	if file == "" {
+		s.mu.Lock()
+		s.value = os.Getenv(env)
+		s.mu.Unlock()
+	} else if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		loaded[src] = s
+		redact.Register(s.values)
+	}
+	return s, nil
+}
+
+// Get returns the current value
+func (s *Secret) Get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+// Previous returns the value replaced by the last rotation, if that rotation
+// happened within grace. Lets verifiers accept both during a changeover.
+func (s *Secret) Previous(grace time.Duration) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.previous == "" || time.Since(s.rotatedAt) > grace {
+		return ""
+	}
+	return s.previous
+}
+
+// values returns the current and previous values for redaction
+func (s *Secret) values() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return []string{s.value, s.previous}
+}
+
+// Watch re-reads the secret file every interval until ctx is cancelled
+// Secrets sourced from env vars cannot change and are not watched. As
+// Secrets are shared, a Secret already being watched is left to that watcher.
+func (s *Secret) Watch(ctx context.Context, interval time.Duration) {
+	if s.file == "" {
+		return
+	}
+	s.mu.Lock()
+	if s.watching {
+		s.mu.Unlock()
+		return
+	}
+	s.watching = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.watching = false
+		s.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rotated, err := s.reload()
+			if err != nil {
+				logger.Warn("Failed to reload secret; keeping the current value", "secret", s.name, "err", err)
+				continue
+			}
+			if rotated {
+				logger.Info("Secret rotated", "secret", s.name, "file", s.file)
+			}
+		}
+	}
+}
+
+// reload reads the file if it changed, returning true when the value rotated
+func (s *Secret) reload() (bool, error) {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", s.file, err)
+	}
+
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", s.file, err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return false, fmt.Errorf("%s is empty", s.file)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.modTime = info.ModTime()
+	if value == s.value {
+		return false, nil
+	}
+
+	rotated := s.value != ""
+	s.previous = s.value
+	s.value = value
+	s.rotatedAt = time.Now()
+	return rotated, nil
+}
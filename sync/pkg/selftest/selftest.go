@@ -0,0 +1,292 @@
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/gitops"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Subsystem is the name of the temporary subsystem the self-test registers
+const Subsystem = "selftest"
+
+// Step is the outcome of one self-test stage
+type Step struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Skipped  bool          `json:"skipped,omitempty"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// taskfile is the trivial build for the temporary subsystem: it "compiles"
+// the upstream VERSION file into the staging dir and writes .version like
+// real subsystems
+const taskfile = `version: '3'
+
+vars:
+  BIN: '{{.SYNC_STAGING_DIR | default ".bin"}}'
+
+tasks:
+  bin:build:
+    cmds:
+      - mkdir -p {{.BIN}}
+      - cp .src/VERSION {{.BIN}}/selftest
+      - |
+        echo "commit: {{.SELFTEST_COMMIT}}" > {{.BIN}}/.version
+        echo "timestamp: $(date -u +%Y-%m-%dT%H:%M:%SZ)" >> {{.BIN}}/.version
+`
+
+// state is shared between steps
+type state struct {
+	root     string // throwaway project root
+	upstream string // local "upstream" repository
+	dir      string // <root>/selftest
+	first    string // initial upstream commit
+	second   string // commit pushed during the test
+}
+
+// Run executes the self-test in a throwaway directory and returns every step
+// Steps after the first failure are not run.
+func Run() ([]Step, error) {
+	root, err := os.MkdirTemp("", "sync-selftest-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(root)
+
+	// Point version lookups at the throwaway root for the duration of the test
+	prevRoot, hadRoot := os.LookupEnv("SYNC_ROOT")
+	os.Setenv("SYNC_ROOT", root)
+	defer func() {
+		if hadRoot {
+			os.Setenv("SYNC_ROOT", prevRoot)
+		} else {
+			os.Unsetenv("SYNC_ROOT")
+		}
+	}()
+
+	st := &state{
+		root:     root,
+		upstream: filepath.Join(root, "upstream"),
+		dir:      filepath.Join(root, Subsystem),
+	}
+
+	stages := []struct {
+		name string
+		fn   func(*state) (string, error)
+	}{
+		{"create upstream repo", createUpstream},
+		{"register subsystem", register},
+		{"initial build", initialBuild},
+		{"push upstream commit", pushCommit},
+		{"detect update", detect},
+		{"pull and build", update},
+		{"verify install", verifyInstall},
+		{"rollback", rollback},
+	}
+
+	var steps []Step
+	for _, stage := range stages {
+		start := time.Now()
+		detail, err := stage.fn(st)
+		step := Step{Name: stage.name, OK: err == nil, Detail: detail, Duration: time.Since(start)}
+		if err != nil {
+			step.Detail = err.Error()
+		}
+		steps = append(steps, step)
+		if err != nil {
+			return steps, nil
+		}
+	}
+
+	return steps, nil
+}
+
+// createUpstream initialises the local upstream repo with one commit
+func createUpstream(st *state) (string, error) {
+	if _, err := git.PlainInit(st.upstream, false); err != nil {
+		return "", fmt.Errorf("failed to init upstream: %w", err)
+	}
+	hash, err := commit(st.upstream, "1")
+	if err != nil {
+		return "", err
+	}
+	st.first = hash
+	return "upstream at " + hash, nil
+}
+
+// register lays out the subsystem directory and clones the upstream into .src
+func register(st *state) (string, error) {
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(st.dir, "Taskfile.yml"), []byte(taskfile), 0644); err != nil {
+		return "", err
+	}
+	if err := gitops.Clone(context.Background(), st.upstream, filepath.Join(st.dir, ".src"), "", gitops.Options{}); err != nil {
+		return "", err
+	}
+	return "cloned into " + filepath.Join(Subsystem, ".src"), nil
+}
+
+// initialBuild builds and installs the first version
+func initialBuild(st *state) (string, error) {
+	if err := build(st, st.first); err != nil {
+		return "", err
+	}
+	current, err := checker.GetCurrentVersion(Subsystem)
+	if err != nil {
+		return "", err
+	}
+	if current != st.first {
+		return "", fmt.Errorf("installed %s, expected %s", current, st.first)
+	}
+	return "installed " + current, nil
+}
+
+// pushCommit adds a new upstream commit
+func pushCommit(st *state) (string, error) {
+	hash, err := commit(st.upstream, "2")
+	if err != nil {
+		return "", err
+	}
+	st.second = hash
+	return "upstream at " + hash, nil
+}
+
+// detect compares the upstream head with the installed version, as the poller does
+func detect(st *state) (string, error) {
+	latest, err := gitops.GetCommitHash(st.upstream)
+	if err != nil {
+		return "", err
+	}
+	current, err := checker.GetCurrentVersion(Subsystem)
+	if err != nil {
+		return "", err
+	}
+	if latest == current {
+		return "", fmt.Errorf("no update detected (installed %s, upstream %s)", current, latest)
+	}
+	return fmt.Sprintf("%s -> %s", current, latest), nil
+}
+
+// update pulls the new commit and rebuilds
+func update(st *state) (string, error) {
+	hash, err := gitops.Pull(context.Background(), filepath.Join(st.dir, ".src"), gitops.Options{})
+	if err != nil {
+		return "", err
+	}
+	if hash != st.second {
+		return "", fmt.Errorf("pulled %s, expected %s", hash, st.second)
+	}
+	if err := build(st, hash); err != nil {
+		return "", err
+	}
+	return "built " + hash, nil
+}
+
+// verifyInstall checks the installed version and binary contents
+func verifyInstall(st *state) (string, error) {
+	current, err := checker.GetCurrentVersion(Subsystem)
+	if err != nil {
+		return "", err
+	}
+	if current != st.second {
+		return "", fmt.Errorf("installed %s, expected %s", current, st.second)
+	}
+	data, err := os.ReadFile(filepath.Join(st.dir, ".bin", Subsystem))
+	if err != nil {
+		return "", err
+	}
+	if string(data) != "2" {
+		return "", fmt.Errorf("installed binary has stale contents %q", data)
+	}
+	return "installed " + current, nil
+}
+
+// rollback switches back to the first build, as sync rollback does
+func rollback(st *state) (string, error) {
+	previous, err := versions.Previous(Subsystem)
+	if err != nil {
+		return "", err
+	}
+	if err := versions.Activate(Subsystem, previous); err != nil {
+		return "", err
+	}
+
+	current, err := checker.GetCurrentVersion(Subsystem)
+	if err != nil {
+		return "", err
+	}
+	if current != st.first {
+		return "", fmt.Errorf("rolled back to %s, expected %s", current, st.first)
+	}
+	data, err := os.ReadFile(filepath.Join(st.dir, ".bin", Subsystem))
+	if err != nil {
+		return "", err
+	}
+	if string(data) != "1" {
+		return "", fmt.Errorf("restored binary has contents %q", data)
+	}
+	return fmt.Sprintf("%s -> %s", st.second, current), nil
+}
+
+// build runs the subsystem's bin:build task in the staging dir and installs
+// the result under .bin/versions/, as the updater does around task sync:update
+func build(st *state, commit string) error {
+	staging, err := versions.Stage(Subsystem)
+	if err != nil {
+		return err
+	}
+	defer versions.Unstage(Subsystem)
+
+	cmd := exec.Command("task", "-d", st.dir, "bin:build", "SELFTEST_COMMIT="+commit)
+	cmd.Env = append(os.Environ(), "SYNC_STAGING_DIR="+staging)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("task bin:build failed: %w\n%s", err, output)
+	}
+
+	installed, err := versions.Install(Subsystem)
+	if err != nil {
+		return err
+	}
+	if installed != commit {
+		return fmt.Errorf("installed version %q, expected %s", installed, commit)
+	}
+	return nil
+}
+
+// commit writes contents to VERSION in repo and commits it, returning its hash
+func commit(repo, contents string) (string, error) {
+	r, err := git.PlainOpen(repo)
+	if err != nil {
+		return "", err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(repo, "VERSION"), []byte(contents), 0644); err != nil {
+		return "", err
+	}
+	if _, err := wt.Add("VERSION"); err != nil {
+		return "", err
+	}
+	_, err = wt.Commit("selftest: version "+contents, &git.CommitOptions{
+		Author: &object.Signature{Name: "sync selftest", Email: "selftest@localhost", When: time.Now()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+	return gitops.GetCommitHash(repo)
+}
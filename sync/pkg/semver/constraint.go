@@ -0,0 +1,200 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of version ranges, e.g. ">=2.10, <3" or "~2.10 || ^3.1"
+// Comparators separated by commas or spaces must all match; alternatives are
+// separated by ||. Supported: =, !=, >, >=, <, <=, ~ (patch updates), ^ (no
+// breaking change) and partial versions such as 2.10 or 2.x.
+type Constraint struct {
+	text string
+	any  [][]comparator
+}
+
+// comparator compares a version against a bound
+type comparator struct {
+	op    string
+	bound Version
+}
+
+// ParseConstraint reads a constraint
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: strings.TrimSpace(s)}
+	for alt := range strings.SplitSeq(s, "||") {
+		var all []comparator
+		for _, term := range terms(alt) {
+			cmps, err := parseTerm(term)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			all = append(all, cmps...)
+		}
+		if len(all) == 0 {
+			return Constraint{}, fmt.Errorf("invalid constraint %q: empty range", s)
+		}
+		c.any = append(c.any, all)
+	}
+	return c, nil
+}
+
+// Check reports whether v satisfies the constraint
+// Prereleases are compared by precedence like any version, except that an
+// upper bound excludes its own: <2.11.0 does not match 2.11.0-rc.1. Callers
+// that don't want prereleases at all filter them out.
+func (c Constraint) Check(v Version) bool {
+	for _, all := range c.any {
+		ok := true
+		for _, cmp := range all {
+			if !cmp.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the constraint as given
+func (c Constraint) String() string {
+	return c.text
+}
+
+// terms splits a range into its comparators, keeping "op version" together
+func terms(s string) []string {
+	var list []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if n := len(list); n > 0 && strings.Trim(list[n-1], "=!<>~^") == "" {
+			list[n-1] += f
+			continue
+		}
+		list = append(list, f)
+	}
+	return list
+}
+
+// parseTerm turns one comparator, possibly with a partial version, into the
+// bounds it stands for
+func parseTerm(term string) ([]comparator, error) {
+	op := strings.TrimRight(term[:len(term)-len(strings.TrimLeft(term, "=!<>~^"))], " ")
+	v, parts, err := partial(term[len(op):])
+	if err != nil {
+		return nil, err
+	}
+	// The first version past the given parts, e.g. 2.11.0 for 2.10
+	next := func(parts int) Version {
+		switch parts {
+		case 1:
+			return Version{Major: v.Major + 1}
+		case 2:
+			return Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+
+	switch op {
+	case "", "=":
+		if parts == 0 {
+			return []comparator{{">=", Version{}}}, nil
+		}
+		if parts == 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{{">=", v}, {"<", next(parts)}}, nil
+	case "!=":
+		if parts < 3 {
+			return nil, fmt.Errorf("%s needs a full version", term)
+		}
+		return []comparator{{"!=", v}}, nil
+	case ">", "<=":
+		if parts == 0 {
+			return nil, fmt.Errorf("%s needs a version", term)
+		}
+		if parts == 3 {
+			return []comparator{{op, v}}, nil
+		}
+		if op == ">" {
+			return []comparator{{">=", next(parts)}}, nil
+		}
+		return []comparator{{"<", next(parts)}}, nil
+	case ">=", "<":
+		if parts == 0 {
+			return nil, fmt.Errorf("%s needs a version", term)
+		}
+		return []comparator{{op, v}}, nil
+	case "~":
+		if parts == 0 {
+			return nil, fmt.Errorf("%s needs a version", term)
+		}
+		return []comparator{{">=", v}, {"<", next(min(parts, 2))}}, nil
+	case "^":
+		if parts == 0 {
+			return nil, fmt.Errorf("%s needs a version", term)
+		}
+		// The leftmost non-zero part may not change
+		switch {
+		case v.Major > 0 || parts == 1:
+			return []comparator{{">=", v}, {"<", next(1)}}, nil
+		case v.Minor > 0 || parts == 2:
+			return []comparator{{">=", v}, {"<", next(2)}}, nil
+		}
+		return []comparator{{">=", v}, {"<", next(3)}}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// partial parses a version that may leave out trailing parts (2.10, 2.x, *),
+// returning how many parts were given
+func partial(s string) (Version, int, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" || s == "*" || s == "x" || s == "X" {
+		return Version{}, 0, nil
+	}
+	if v, ok := Parse(s); ok {
+		return v, 3, nil
+	}
+
+	var nums [3]int
+	parts := 0
+	for _, p := range strings.Split(s, ".") {
+		if p == "*" || p == "x" || p == "X" {
+			break
+		}
+		n, ok := number(p)
+		if !ok || parts == 3 {
+			return Version{}, 0, fmt.Errorf("%q is not a version", s)
+		}
+		nums[parts] = n
+		parts++
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2], Original: s}, parts, nil
+}
+
+// matches reports whether v satisfies a single comparator
+func (c comparator) matches(v Version) bool {
+	d := Compare(v, c.bound)
+	switch c.op {
+	case "=":
+		return d == 0
+	case "!=":
+		return d != 0
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		// <2.11.0 means before 2.11, so not its release candidates either
+		if v.IsPrerelease() && !c.bound.IsPrerelease() && v.Major == c.bound.Major && v.Minor == c.bound.Minor && v.Patch == c.bound.Patch {
+			return false
+		}
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return false
+}
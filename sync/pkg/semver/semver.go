@@ -0,0 +1,110 @@
+package semver
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version, e.g. v2.10.24 or 2.11.0-rc.1
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string // e.g. "rc.1"; empty for a release
+	Original            string // as given, e.g. the release tag
+}
+
+// Parse reads MAJOR.MINOR.PATCH with an optional "v" prefix, -prerelease and +build
+// Build metadata is ignored, as semver requires for precedence.
+func Parse(s string) (Version, bool) {
+	v := Version{Original: s}
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, v.Prerelease, _ = strings.Cut(rest, "-")
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return Version{}, false
+	}
+	nums := make([]int, 3)
+	for i, p := range parts {
+		n, ok := number(p)
+		if !ok {
+			return Version{}, false
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	return v, true
+}
+
+// IsPrerelease reports whether v is a prerelease (alpha, beta, rc...)
+func (v Version) IsPrerelease() bool {
+	return v.Prerelease != ""
+}
+
+// String returns the version as given
+func (v Version) String() string {
+	return v.Original
+}
+
+// Compare returns -1, 0 or +1 as a is lower than, equal to or higher than b
+// A prerelease is lower than its release: 2.11.0-rc.1 < 2.11.0.
+func Compare(a, b Version) int {
+	for _, d := range []int{a.Major - b.Major, a.Minor - b.Minor, a.Patch - b.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case a.Prerelease == b.Prerelease:
+		return 0
+	case a.Prerelease == "":
+		return 1
+	case b.Prerelease == "":
+		return -1
+	}
+	return comparePrerelease(a.Prerelease, b.Prerelease)
+}
+
+// comparePrerelease orders dot-separated identifiers: numeric ones
+// numerically and below alphanumeric ones, which compare as text
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aNum := number(as[i])
+		bn, bNum := number(bs[i])
+		switch {
+		case aNum && bNum:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aNum:
+			return -1
+		case bNum:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+// number parses a non-negative decimal without sign or spaces
+func number(s string) (int, bool) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	register(config.StateFile, func(*config.Config) (Backend, error) { return fileBackend{}, nil })
+}
+
+// lockTimeout bounds how long to wait for another sync daemon holding the store
+const lockTimeout = 5 * time.Second
+
+// Path returns the file backend's location: <data dir>/state.db
+func Path() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.db"), nil
+}
+
+// fileBackend keeps the store in a bbolt file in the data directory
+type fileBackend struct{}
+
+// open opens the store for a single transaction
+// The daemons run as separate processes and bbolt holds an exclusive file
+// lock while open, so the store is never kept open between operations.
+func open(readOnly bool) (*bolt.DB, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	if readOnly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func (fileBackend) Put(bucket, key string, data []byte) error {
+	db, err := open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+func (fileBackend) Delete(bucket, key string) (bool, error) {
+	db, err := open(false)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	found := false
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil || b.Get([]byte(key)) == nil {
+			return nil
+		}
+		found = true
+		return b.Delete([]byte(key))
+	})
+	return found, err
+}
+
+func (fileBackend) Get(bucket, key string) ([]byte, error) {
+	var data []byte
+	err := view(bucket, func(b *bolt.Bucket) error {
+		if v := b.Get([]byte(key)); v != nil {
+			data = append([]byte{}, v...) // only valid during the transaction
+		}
+		return nil
+	})
+	return data, err
+}
+
+func (fileBackend) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	return view(bucket, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// view runs fn in a read-only transaction; a missing store or bucket is empty
+func view(bucket string, fn func(b *bolt.Bucket) error) error {
+	db, err := open(true)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return fn(b)
+	})
+}
@@ -0,0 +1,181 @@
+//go:build !nonats
+
+package state
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/natsauth"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func init() {
+	register(config.StateNATS, func(cfg *config.Config) (Backend, error) {
+		prefix := cfg.State.NATS.Prefix
+		if prefix == "" {
+			host, err := os.Hostname()
+			if err != nil {
+				return nil, fmt.Errorf("state.nats.prefix is unset and the hostname unknown: %w", err)
+			}
+			prefix = host
+		}
+		return &natsBackend{nats: cfg.NATS, cfg: cfg.State.NATS, prefix: kvToken(prefix)}, nil
+	})
+}
+
+// natsBackend keeps the store in a NATS JetStream key-value bucket
+// Keys are <prefix>.<bucket>.<key>, the key base64url-encoded since KV keys
+// allow few characters, so hosts sharing the bucket keep their own state.
+// The connection is made on first use and kept; an unreachable server fails
+// the operation, and the next one tries again.
+type natsBackend struct {
+	nats   config.NATSConfig
+	cfg    config.StateNATSConfig
+	prefix string
+
+	mu sync.Mutex
+	kv jetstream.KeyValue
+}
+
+// kvToken makes s a single KV key token, replacing dots and the characters
+// keys don't allow
+func kvToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// store returns the key-value bucket, connecting and creating it if needed
+func (n *natsBackend) store(ctx context.Context) (jetstream.KeyValue, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.kv != nil {
+		return n.kv, nil
+	}
+
+	opts := []nats.Option{nats.Name("sync-state"), nats.Timeout(n.cfg.Timeout)}
+	auth, err := natsauth.Options(n.nats)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := nats.Connect(n.nats.URL, append(opts, auth...)...)
+	if err != nil {
+		return nil, syncerr.Wrap(syncerr.Network, fmt.Errorf("failed to connect to NATS at %s for the state store: %w", n.nats.URL, err))
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to use JetStream: %w", err)
+	}
+	kv, err := js.KeyValue(ctx, n.cfg.Bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: n.cfg.Bucket, Description: "sync daemon state"})
+	}
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to open state bucket %s (JetStream enabled on the server?): %w", n.cfg.Bucket, err)
+	}
+	n.kv = kv
+	return kv, nil
+}
+
+// key returns the KV key of bucket/key
+func (n *natsBackend) key(bucket, key string) string {
+	return n.prefix + "." + bucket + "." + base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func (n *natsBackend) Put(bucket, key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	defer cancel()
+	kv, err := n.store(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := kv.Put(ctx, n.key(bucket, key), data); err != nil {
+		return fmt.Errorf("failed to write %s/%s to the state bucket: %w", bucket, key, err)
+	}
+	return nil
+}
+
+func (n *natsBackend) Delete(bucket, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	defer cancel()
+	kv, err := n.store(ctx)
+	if err != nil {
+		return false, err
+	}
+	k := n.key(bucket, key)
+	if _, err := kv.Get(ctx, k); errors.Is(err, jetstream.ErrKeyNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read %s/%s from the state bucket: %w", bucket, key, err)
+	}
+	if err := kv.Delete(ctx, k); err != nil {
+		return false, fmt.Errorf("failed to delete %s/%s from the state bucket: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
+func (n *natsBackend) Get(bucket, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	defer cancel()
+	kv, err := n.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e, err := kv.Get(ctx, n.key(bucket, key))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s from the state bucket: %w", bucket, key, err)
+	}
+	return e.Value(), nil
+}
+
+// ForEach reads the bucket's current values with one watch, then calls fn
+func (n *natsBackend) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	defer cancel()
+	kv, err := n.store(ctx)
+	if err != nil {
+		return err
+	}
+	prefix := n.prefix + "." + bucket + "."
+	w, err := kv.WatchFiltered(ctx, []string{prefix + ">"}, jetstream.IgnoreDeletes())
+	if err != nil {
+		return fmt.Errorf("failed to list bucket %s in the state bucket: %w", bucket, err)
+	}
+	defer w.Stop()
+
+	var entries []entry
+	for e := range w.Updates() {
+		if e == nil {
+			break // the initial values are all delivered
+		}
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(e.Key(), prefix))
+		if err != nil {
+			continue // not written by sync
+		}
+		entries = append(entries, entry{key: string(key), data: e.Value()})
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to list bucket %s in the state bucket: %w", bucket, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return each(entries, fn)
+}
@@ -0,0 +1,148 @@
+//go:build !nosqlite
+
+package state
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	register(config.StateSQLite, func(cfg *config.Config) (Backend, error) {
+		path, err := sqlitePath(cfg.State.Path)
+		if err != nil {
+			return nil, err
+		}
+		return &sqliteBackend{path: path}, nil
+	})
+}
+
+// sqliteSchema holds every bucket in one table; keys sort bytewise, as in bbolt
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS state (
+	bucket TEXT NOT NULL,
+	key    TEXT NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID`
+
+// sqliteBackend keeps the store in a SQLite database
+// WAL mode and a busy timeout let the daemons share it as they share the
+// bbolt file. The database is created on first use.
+type sqliteBackend struct {
+	path string
+
+	mu sync.Mutex
+	db *sql.DB
+}
+
+// sqlitePath resolves state.path: default <data dir>/state.sqlite, relative
+// paths relative to the project root
+func sqlitePath(path string) (string, error) {
+	if path == "" {
+		dir, err := config.DataDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "state.sqlite"), nil
+	}
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, path), nil
+}
+
+// open returns the database, creating it and its table the first time
+func (s *sqliteBackend) open() (*sql.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db != nil {
+		return s.db, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+s.path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err == nil {
+		_, err = db.Exec(sqliteSchema)
+	}
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, fmt.Errorf("failed to open state store %s: %w", s.path, err)
+	}
+	s.db = db
+	return db, nil
+}
+
+func (s *sqliteBackend) Put(bucket, key string, data []byte) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO state (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`, bucket, key, data)
+	return err
+}
+
+func (s *sqliteBackend) Delete(bucket, key string) (bool, error) {
+	db, err := s.open()
+	if err != nil {
+		return false, err
+	}
+	result, err := db.Exec(`DELETE FROM state WHERE bucket = ? AND key = ?`, bucket, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqliteBackend) Get(bucket, key string) ([]byte, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = db.QueryRow(`SELECT value FROM state WHERE bucket = ? AND key = ?`, bucket, key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
+
+// ForEach reads the bucket before calling fn, so fn may write to the store
+func (s *sqliteBackend) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(`SELECT key, value FROM state WHERE bucket = ? ORDER BY key`, bucket)
+	if err != nil {
+		return err
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.key, &e.data); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return each(entries, fn)
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// Buckets used by the sync packages
+const (
+	BucketUpdates    = "updates"    // update attempts, keyed by time (pkg/history)
+	BucketSubsystems = "subsystems" // last check result per subsystem (pkg/status)
+	BucketTriggers   = "triggers"   // upstream version that last triggered an update (pkg/poller)
+	BucketTaskfiles  = "taskfiles"  // last seen Taskfile version (pkg/taskfile-poller)
+	BucketPending    = "pending"    // updates awaiting approval, keyed by subsystem (pkg/updater)
+	BucketQueue      = "queue"      // queued and retrying updates, keyed by daemon/subsystem (pkg/updater)
+	BucketOutbox     = "outbox"     // NATS messages awaiting a connection, keyed by time (pkg/events)
+	BucketETags      = "etags"      // last GitHub response per URL for conditional requests (pkg/ghclient)
+	BucketArtifacts  = "artifacts"  // installed files referencing each stored blob, keyed by digest/ref (pkg/artifacts)
+	BucketAudit      = "audit"      // operator actions, keyed by time (pkg/audit)
+	BucketFreeze     = "freeze"     // current update freeze or thaw (pkg/freeze)
+	BucketReleases   = "releases"   // release promoted into each environment, keyed env/subsystem (pkg/promote)
+	BucketHosts      = "hosts"      // hosts registered with this controller, keyed by identity (pkg/identity)
+	BucketTrains     = "trains"     // release trains, keyed by name (pkg/updater)
+	BucketBuilds     = "builds"     // environment of each source build, keyed by build ID (pkg/buildenv)
+)
+
+// Buckets lists every bucket, for copying a store to another backend
+var Buckets = []string{
+	BucketUpdates, BucketSubsystems, BucketTriggers, BucketTaskfiles, BucketPending, BucketQueue,
+	BucketOutbox, BucketETags, BucketArtifacts, BucketAudit, BucketFreeze, BucketReleases, BucketHosts, BucketTrains,
+	BucketBuilds,
+}
+
+// Backend keeps the buckets' keys and their JSON values
+// It must be safe to use from several goroutines, and from several sync
+// processes sharing the store.
+type Backend interface {
+	Put(bucket, key string, data []byte) error
+	Get(bucket, key string) ([]byte, error) // nil without the key
+	Delete(bucket, key string) (bool, error)
+	ForEach(bucket string, fn func(key string, data []byte) error) error // in key order
+}
+
+var (
+	mu      sync.RWMutex
+	backend Backend = fileBackend{}
+	openers         = make(map[string]func(cfg *config.Config) (Backend, error))
+)
+
+// register makes a backend selectable as state.backend
+// Backend files call it from init(), so backends compiled out of a build are
+// neither selectable nor listed by sync capabilities.
+func register(name string, open func(cfg *config.Config) (Backend, error)) {
+	openers[name] = open
+	capabilities.Register(capabilities.Storage, name)
+}
+
+// Configure switches the store to the backend state.backend selects
+func Configure(cfg *config.Config) error {
+	b, err := Open(cfg, cfg.State.Backend)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	backend = b
+	return nil
+}
+
+// Open returns the named backend, configured per cfg
+func Open(cfg *config.Config, name string) (Backend, error) {
+	open, ok := openers[name]
+	if !ok {
+		names := make([]string, 0, len(openers))
+		for n := range openers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("state backend %q is not in this build (it has %s)", name, strings.Join(names, ", ")))
+	}
+	return open(cfg)
+}
+
+// current returns the configured backend
+func current() Backend {
+	mu.RLock()
+	defer mu.RUnlock()
+	return backend
+}
+
+// Put stores v as JSON under bucket/key
+func Put(bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return current().Put(bucket, key, data)
+}
+
+// Delete removes bucket/key, reporting whether it existed
+func Delete(bucket, key string) (bool, error) {
+	return current().Delete(bucket, key)
+}
+
+// Get decodes bucket/key into v, reporting whether the key exists
+func Get(bucket, key string, v any) (bool, error) {
+	data, err := current().Get(bucket, key)
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// ForEach calls fn for every key in bucket, in key order
+func ForEach(bucket string, fn func(key string, data []byte) error) error {
+	return current().ForEach(bucket, fn)
+}
+
+// entry is a key and its value, as backends that read a bucket before
+// iterating it collect them
+type entry struct {
+	key  string
+	data []byte
+}
+
+// each calls fn for every entry, in order
+func each(entries []entry, fn func(key string, data []byte) error) error {
+	for _, e := range entries {
+		if err := fn(e.key, e.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy copies every key of every bucket from one backend to another,
+// returning how many it copied
+// Keys already in to are overwritten; the rest of to is left alone.
+func Copy(from, to Backend) (int, error) {
+	n := 0
+	for _, bucket := range Buckets {
+		err := from.ForEach(bucket, func(key string, data []byte) error {
+			if err := to.Put(bucket, key, data); err != nil {
+				return err
+			}
+			n++
+			return nil
+		})
+		if err != nil {
+			return n, fmt.Errorf("failed to copy bucket %s: %w", bucket, err)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,243 @@
+package status
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// logger logs status records that could not be persisted
+var logger = logging.For("status")
+
+// Subsystem is the last known sync state of one subsystem
+type Subsystem struct {
+	Subsystem       string         `json:"subsystem"`
+	Current         string         `json:"current"`
+	Latest          string         `json:"latest"`
+	UpdateAvailable bool           `json:"updateAvailable"`
+	LastCheck       time.Time      `json:"lastCheck,omitzero"`
+	LastCheckError  string         `json:"lastCheckError,omitempty"`
+	LastCheckKind   syncerr.Kind   `json:"lastCheckErrorKind,omitempty"` // see GET /api/errors
+	LastUpdate      *history.Entry `json:"lastUpdate,omitempty"`
+
+	Divergence *checker.Divergence `json:"divergence,omitempty"` // forks: last comparison with upstream
+}
+
+// Daemon is the overall health of the running sync daemon
+type Daemon struct {
+	Daemon     string         `json:"daemon"`
+	Identity   string         `json:"identity,omitempty"` // ID of this host's identity, see pkg/identity
+	Healthy    bool           `json:"healthy"`
+	StartedAt  time.Time      `json:"startedAt"`
+	Uptime     string         `json:"uptime"`
+	LastCycle  time.Time      `json:"lastCycle,omitzero"`
+	Subsystems int            `json:"subsystems"`
+	Failing    int            `json:"failing"`          // subsystems whose last check or update failed
+	Frozen     *freeze.Freeze `json:"frozen,omitempty"` // active update freeze, if any
+}
+
+var (
+	mu         sync.RWMutex
+	daemon     = "sync"
+	startedAt  = time.Now()
+	lastCycle  time.Time
+	subsystems = make(map[string]*Subsystem)
+)
+
+// SetDaemon names the running daemon (poll, poll-taskfiles, watch)
+func SetDaemon(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	daemon = name
+}
+
+// Load restores the last known check results of this daemon and the latest
+// update per subsystem from the state store, so a restart starts from the
+// previous state instead of an empty one
+func Load() error {
+	mu.Lock()
+	prefix := daemon + "/"
+	mu.Unlock()
+
+	saved := make(map[string]Subsystem)
+	err := state.ForEach(state.BucketSubsystems, func(key string, data []byte) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		var s Subsystem
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		saved[s.Subsystem] = s
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	entries, err := history.Load()
+	if err != nil {
+		return err
+	}
+	latest := history.Latest(entries)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name, s := range saved {
+		restored := s
+		subsystems[name] = &restored
+	}
+	for name, e := range latest {
+		if s, ok := subsystems[name]; ok {
+			s.LastUpdate = &e
+		}
+	}
+	return nil
+}
+
+// RecordCycle marks the completion of a polling cycle
+func RecordCycle() {
+	mu.Lock()
+	defer mu.Unlock()
+	lastCycle = time.Now()
+}
+
+// RecordCheck records the result of checking a subsystem for updates
+func RecordCheck(subsystem, current, latest string, err error) {
+	mu.Lock()
+	s := get(subsystem)
+	s.LastCheck = time.Now()
+	s.LastCheckError, s.LastCheckKind = "", ""
+	if err != nil {
+		s.LastCheckError, s.LastCheckKind = err.Error(), syncerr.KindOf(err)
+	} else {
+		s.Current = current
+		s.Latest = latest
+		s.UpdateAvailable = !revision.Same(current, latest)
+	}
+	saved := *s
+	saved.LastUpdate = nil // updates are persisted by the history ledger
+	key := daemon + "/" + subsystem
+	mu.Unlock()
+
+	if perr := state.Put(state.BucketSubsystems, key, saved); perr != nil {
+		logger.Warn("Failed to persist check result", "subsystem", subsystem, "err", perr)
+	}
+}
+
+// RecordDivergence records a fork's comparison with its upstream, returning
+// the previous one (nil if none) so crossings of the threshold can be told
+// apart from forks that stay behind
+func RecordDivergence(d checker.Divergence) *checker.Divergence {
+	mu.Lock()
+	s := get(d.Subsystem)
+	previous := s.Divergence
+	s.Divergence = &d
+	saved := *s
+	saved.LastUpdate = nil
+	key := daemon + "/" + d.Subsystem
+	mu.Unlock()
+
+	if err := state.Put(state.BucketSubsystems, key, saved); err != nil {
+		logger.Warn("Failed to persist divergence", "subsystem", d.Subsystem, "err", err)
+	}
+	return previous
+}
+
+// LastDivergence returns when a fork was last compared with upstream (zero if never)
+func LastDivergence(subsystem string) time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	if s, ok := subsystems[subsystem]; ok && s.Divergence != nil {
+		return s.Divergence.Checked
+	}
+	return time.Time{}
+}
+
+// LastCheck returns when a subsystem was last checked (zero if never)
+func LastCheck(subsystem string) time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	if s, ok := subsystems[subsystem]; ok {
+		return s.LastCheck
+	}
+	return time.Time{}
+}
+
+// RecordUpdate records the result of an update attempt
+func RecordUpdate(e history.Entry) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s := get(e.Subsystem)
+	s.LastUpdate = &e
+	if e.Success {
+		s.Current = e.To
+		s.UpdateAvailable = s.Latest != "" && !revision.Same(s.Current, s.Latest)
+	}
+}
+
+// Subsystems returns a snapshot of all tracked subsystems, sorted by name
+func Subsystems() []Subsystem {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]Subsystem, 0, len(subsystems))
+	for _, s := range subsystems {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Subsystem < list[j].Subsystem
+	})
+	return list
+}
+
+// Status returns the overall daemon health
+// The daemon is healthy unless every tracked subsystem is failing.
+func Status() Daemon {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	failing := 0
+	for _, s := range subsystems {
+		if s.LastCheckError != "" || (s.LastUpdate != nil && !s.LastUpdate.Success) {
+			failing++
+		}
+	}
+
+	d := Daemon{
+		Daemon:     daemon,
+		Identity:   identity.ID(),
+		Healthy:    len(subsystems) == 0 || failing < len(subsystems),
+		StartedAt:  startedAt,
+		Uptime:     time.Since(startedAt).Round(time.Second).String(),
+		LastCycle:  lastCycle,
+		Subsystems: len(subsystems),
+		Failing:    failing,
+	}
+	if f, active, _ := freeze.Current(); active {
+		d.Frozen = &f
+	}
+	return d
+}
+
+// get returns the entry for subsystem, creating it if needed (mu must be held)
+func get(subsystem string) *Subsystem {
+	s, ok := subsystems[subsystem]
+	if !ok {
+		s = &Subsystem{Subsystem: subsystem}
+		subsystems[subsystem] = s
+	}
+	return s
+}
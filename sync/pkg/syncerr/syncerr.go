@@ -0,0 +1,127 @@
+package syncerr
+
+import (
+	"errors"
+	"sort"
+)
+
+// Kind classifies a failure so tooling can branch on it instead of parsing messages
+type Kind string
+
+// Error kinds
+const (
+	Unknown           Kind = "unknown"
+	ConfigInvalid     Kind = "config_invalid"
+	AuthFailed        Kind = "auth_failed"
+	RateLimited       Kind = "rate_limited"
+	NotFound          Kind = "not_found"
+	Network           Kind = "network"
+	Frozen            Kind = "frozen"
+	BuildFailed       Kind = "build_failed"
+	ChecksumMismatch  Kind = "checksum_mismatch"
+	MigrationFailed   Kind = "migration_failed"
+	HealthCheckFailed Kind = "health_check_failed"
+	WorktreeDirty     Kind = "worktree_dirty"
+	SignatureInvalid  Kind = "signature_invalid"
+	PlatformMismatch  Kind = "platform_mismatch"
+	DiskFull          Kind = "disk_full"
+	ConfigRejected    Kind = "config_rejected"
+	ScanFailed        Kind = "scan_failed"
+)
+
+// Info describes a kind: the CLI exit code it maps to and what to do about it
+type Info struct {
+	Kind     Kind   `json:"kind"`
+	ExitCode int    `json:"exitCode"`
+	Hint     string `json:"hint"`
+}
+
+// kinds holds the taxonomy; exit codes are stable, so new kinds get new codes
+// 1 stays the catch-all and 2 is taken by flag parsing errors.
+var kinds = map[Kind]Info{
+	Unknown:           {ExitCode: 1, Hint: "see the error message and the log above it"},
+	ConfigInvalid:     {ExitCode: 3, Hint: "fix sync.yaml (or the file in SYNC_CONFIG) and try again"},
+	AuthFailed:        {ExitCode: 4, Hint: "check GITHUB_TOKEN (or secrets.github_token_file), or git.credentials for clones and pulls: it may be missing, expired or lack repo read access"},
+	RateLimited:       {ExitCode: 5, Hint: "the GitHub API quota is exhausted; set a token, lower the poll frequency, or wait for the reset"},
+	NotFound:          {ExitCode: 6, Hint: "check the repo, branch or pinned tag in sync.yaml and the subsystem Taskfile"},
+	Network:           {ExitCode: 7, Hint: "check connectivity to GitHub (proxy, DNS, firewall); the next poll retries"},
+	Frozen:            {ExitCode: 8, Hint: "updates are frozen: sync audit shows who froze them and why; sync thaw lifts the freeze, sync update overrides it"},
+	BuildFailed:       {ExitCode: 10, Hint: "run task sync:update SUBSYSTEM=<subsystem> to reproduce the build; the previous version stays active"},
+	ChecksumMismatch:  {ExitCode: 11, Hint: "a file does not match its published or recorded checksum; do not run it: retry the download, or reinstall with sync update"},
+	MigrationFailed:   {ExitCode: 12, Hint: "the data dir was restored from the backup; fix the migration task and update again"},
+	HealthCheckFailed: {ExitCode: 13, Hint: "the new version failed task <subsystem>:health; check its logs, then sync rollback <subsystem> if needed"},
+	WorktreeDirty:     {ExitCode: 14, Hint: "commit, stash or discard the local changes in the subsystem's .src checkout"},
+	SignatureInvalid:  {ExitCode: 15, Hint: "the upstream tag or release asset is not signed by a trusted key or identity; check the release, then fix signatures or artifact.cosign in sync.yaml"},
+	PlatformMismatch:  {ExitCode: 16, Hint: "the build is for another OS or architecture than this host; install one built for it (check the builder's GOOS/GOARCH or the release asset)"},
+	DiskFull:          {ExitCode: 17, Hint: "free up disk space (sync gc removes old installed versions) or lower disk.reserve_bytes, then try again; nothing was changed"},
+	ConfigRejected:    {ExitCode: 18, Hint: "a subsystem config failed to render or the new version rejects it; the update was not installed and the previous version and config stay active: adapt the config, template or vars in sync.yaml to the new version (sync render --dry-run checks them) and update again"},
+	ScanFailed:        {ExitCode: 19, Hint: "a scanner flagged the new build or could not scan it; it was not installed and the previous version stays active: see the scanner's verdict in sync audit, check the upstream release, and fix or update the scanner before updating again"},
+}
+
+// Error is an error with a kind
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap gives err a kind; nil stays nil, and an error that already has a kind keeps it
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of err, Unknown if it has none ("" for nil)
+func KindOf(err error) Kind {
+	if err == nil {
+		return ""
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Unknown
+}
+
+// Hint returns what to do about an error of kind
+func Hint(kind Kind) string {
+	return Describe(kind).Hint
+}
+
+// ExitCode returns the CLI exit code for err
+func ExitCode(err error) int {
+	return Describe(KindOf(err)).ExitCode
+}
+
+// Describe returns the taxonomy entry of kind (Unknown's for kinds not listed)
+func Describe(kind Kind) Info {
+	info, ok := kinds[kind]
+	if !ok {
+		kind, info = Unknown, kinds[Unknown]
+	}
+	info.Kind = kind
+	return info
+}
+
+// All returns the taxonomy, by exit code
+func All() []Info {
+	list := make([]Info, 0, len(kinds))
+	for kind := range kinds {
+		list = append(list, Describe(kind))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ExitCode < list[j].ExitCode })
+	return list
+}
@@ -1,26 +1,39 @@
 package taskfilepoller
 
 import (
-	"log"
-	"os"
+	"context"
 	"os/exec"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/workers"
 )
 
+// logger logs Taskfile checks and the updates they trigger
+var logger = logging.For("taskfile-poller")
+
 // TaskfilePoller monitors Taskfiles for version changes
 type TaskfilePoller struct {
 	interval   time.Duration
 	subsystems []string
 	versions   map[string]string // subsystem -> last known version
+	workers    *workers.Pool     // runs the triggered updates
 }
 
-// NewTaskfilePoller creates a new Taskfile poller
-func NewTaskfilePoller() *TaskfilePoller {
+// NewTaskfilePoller creates a new Taskfile poller that triggers updates on pool
+func NewTaskfilePoller(pool *workers.Pool) *TaskfilePoller {
 	return &TaskfilePoller{
 		interval: 30 * time.Second, // Check every 30 seconds
 		versions: make(map[string]string),
+		workers:  pool,
 	}
 }
 
@@ -50,7 +63,7 @@ func (p *TaskfilePoller) discoverSubsystems() ([]string, error) {
 
 // Start begins the polling loop
 func (p *TaskfilePoller) Start() error {
-	log.Printf("🔄 Starting Taskfile poller (interval: %v)", p.interval)
+	logger.Info("Starting Taskfile poller", "interval", p.interval)
 
 	// Discover subsystems dynamically
 	subsystems, err := p.discoverSubsystems()
@@ -58,17 +71,30 @@ func (p *TaskfilePoller) Start() error {
 		return err
 	}
 	p.subsystems = subsystems
-	log.Printf("   Discovered %d subsystems with config:version: %v", len(subsystems), subsystems)
+	logger.Info("Discovered subsystems with config:version", "subsystems", subsystems)
 
 	// Initialize current versions
 	for _, subsystem := range p.subsystems {
 		version, err := p.getTaskfileVersion(subsystem)
 		if err != nil {
-			log.Printf("⚠️  Could not read initial version for %s: %v", subsystem, err)
+			logger.Warn("Could not read initial version", "subsystem", subsystem, "err", err)
+			continue
+		}
+		// Resume from the version seen by the previous run, so a Taskfile
+		// changed while the poller was down still triggers an update
+		var last string
+		if found, err := state.Get(state.BucketTaskfiles, subsystem, &last); err != nil {
+			logger.Warn("Could not load last version", "subsystem", subsystem, "err", err)
+		} else if found && !revision.Same(last, version) {
+			logger.Info("Taskfile version changed while stopped", "subsystem", subsystem, "from", revision.Short(last), "to", revision.Short(version))
+			p.versions[subsystem] = last
 			continue
 		}
-		p.versions[subsystem] = version
-		log.Printf("   %s: %s", subsystem, version)
+
+		p.save(subsystem, version)
+		status.RecordCheck(subsystem, version, version, nil)
+		metrics.Check(subsystem, nil)
+		logger.Info("Taskfile version", "subsystem", subsystem, "version", revision.Short(version))
 	}
 
 	// Poll on interval
@@ -84,13 +110,17 @@ func (p *TaskfilePoller) Start() error {
 
 // checkAll checks all subsystem Taskfiles for version changes
 func (p *TaskfilePoller) checkAll() {
-	log.Printf("📝 Checking Taskfiles for version changes...")
+	logger.Debug("Checking Taskfiles for version changes")
 
 	for _, subsystem := range p.subsystems {
 		if err := p.checkSubsystem(subsystem); err != nil {
-			log.Printf("   ❌ Failed to check %s: %v", subsystem, err)
+			logger.Error("Failed to check", "subsystem", subsystem, "err", err, "hint", syncerr.Hint(syncerr.KindOf(err)))
+			status.RecordCheck(subsystem, "", "", err)
+			metrics.Check(subsystem, err)
 		}
 	}
+	status.RecordCycle()
+	metrics.PollCycle()
 }
 
 // checkSubsystem checks a single subsystem Taskfile
@@ -103,22 +133,39 @@ func (p *TaskfilePoller) checkSubsystem(subsystem string) error {
 
 	// Get last known version
 	lastVersion := p.versions[subsystem]
+	status.RecordCheck(subsystem, lastVersion, currentVersion, nil)
+	metrics.Check(subsystem, nil)
 
 	// Compare
-	if currentVersion != lastVersion {
-		log.Printf("   🆕 Taskfile version changed for %s: %s -> %s", subsystem, lastVersion, currentVersion)
-		log.Printf("   ▶  Triggering rebuild for %s", subsystem)
+	if !revision.Same(currentVersion, lastVersion) {
+		logger.Info("Taskfile version changed", "subsystem", subsystem, "from", revision.Short(lastVersion), "to", revision.Short(currentVersion))
 
 		// Update stored version
-		p.versions[subsystem] = currentVersion
+		p.save(subsystem, currentVersion)
 
 		// Trigger update workflow
-		go p.triggerUpdate(subsystem)
+		if err := p.workers.Go("update "+subsystem+" (taskfile)", func(context.Context) {
+			p.triggerUpdate(subsystem, currentVersion)
+		}); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// save records the last seen version in memory and in the state store
+// Dry runs keep it in memory only, so a later real run still sees the change.
+func (p *TaskfilePoller) save(subsystem, version string) {
+	p.versions[subsystem] = version
+	if updater.DryRun() {
+		return
+	}
+	if err := state.Put(state.BucketTaskfiles, subsystem, version); err != nil {
+		logger.Warn("Failed to persist version", "subsystem", subsystem, "err", err)
+	}
+}
+
 // getTaskfileVersion reads the version from subsystem Taskfile
 func (p *TaskfilePoller) getTaskfileVersion(subsystem string) (string, error) {
 	cmd := exec.Command("task", subsystem+":config:version")
@@ -132,17 +179,9 @@ func (p *TaskfilePoller) getTaskfileVersion(subsystem string) (string, error) {
 }
 
 // triggerUpdate executes the update workflow for a subsystem
-func (p *TaskfilePoller) triggerUpdate(subsystem string) {
-	log.Printf("▶ Triggering update for %s (Taskfile version changed)", subsystem)
-
-	cmd := exec.Command("task", "sync:update")
-	cmd.Env = append(os.Environ(), "SUBSYSTEM="+subsystem)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("❌ Update failed for %s: %v\n%s", subsystem, err, output)
-		return
+func (p *TaskfilePoller) triggerUpdate(subsystem, version string) {
+	logger.Info("Triggering update", "subsystem", subsystem, "version", revision.Short(version))
+	if err := updater.Submit(updater.Request{Subsystem: subsystem, Trigger: updater.TriggerTaskfile, Target: version}); err != nil {
+		logger.Error("Update failed", "subsystem", subsystem, "err", err)
 	}
-
-	log.Printf("✅ Update completed for %s", subsystem)
 }
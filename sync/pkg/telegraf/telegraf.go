@@ -0,0 +1,276 @@
+// Package telegraf checks a telegraf update against the plugins our config
+// uses: it diffs the plugin registries of the installed and the new version,
+// so a plugin that is removed or deprecated is noticed before the rollout
+package telegraf
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+)
+
+// kinds are the plugin kinds a config declares as [[<kind>.<name>]]
+var kinds = []string{"inputs", "outputs", "processors", "aggregators", "secretstores"}
+
+// maxAdded is how many of the plugins added a note names
+const maxAdded = 10
+
+// section matches a plugin section header of telegraf.conf, e.g. [[inputs.cpu]]
+var section = regexp.MustCompile(`^\s*\[\[\s*([a-z]+)\.([A-Za-z0-9_]+)\s*\]\]`)
+
+// Deprecation is telegraf's notice for a deprecated plugin
+type Deprecation struct {
+	Since     string `json:"since,omitempty"`     // version deprecating it, e.g. 1.27.0
+	RemovalIn string `json:"removalIn,omitempty"` // version removing it
+	Notice    string `json:"notice,omitempty"`    // what to use instead
+}
+
+// Registry is the plugins of one telegraf version, as <kind>.<name>
+type Registry struct {
+	Plugins    map[string]bool
+	Deprecated map[string]Deprecation
+}
+
+// Deprecated is a plugin our config uses that the new version deprecates
+type Deprecated struct {
+	Plugin string `json:"plugin"` // e.g. inputs.cassandra
+	Deprecation
+}
+
+// Compatibility is how a telegraf update affects the plugins our config uses
+type Compatibility struct {
+	Config     string       `json:"config"`               // the config checked, relative to the project root
+	Used       int          `json:"used"`                 // plugins it uses
+	Removed    []string     `json:"removed,omitempty"`    // used, and gone from the new version
+	Deprecated []Deprecated `json:"deprecated,omitempty"` // used, and newly deprecated
+	Added      []string     `json:"added,omitempty"`      // new plugins, used or not
+	Error      string       `json:"error,omitempty"`      // why the check couldn't run
+}
+
+// Breaking reports whether the update removes or deprecates a plugin we use
+func (c *Compatibility) Breaking() bool {
+	return c != nil && (len(c.Removed) > 0 || len(c.Deprecated) > 0)
+}
+
+// Notes returns the compatibility note for an approval prompt, a line each:
+// the plugins removed and deprecated first, then how many were added
+func (c *Compatibility) Notes() []string {
+	if c == nil {
+		return nil
+	}
+	if c.Error != "" {
+		return []string{"❓ Plugin compatibility unknown: " + c.Error}
+	}
+	var notes []string
+	for _, p := range c.Removed {
+		notes = append(notes, fmt.Sprintf("❌ %s is removed; %s uses it", p, c.Config))
+	}
+	for _, d := range c.Deprecated {
+		note := fmt.Sprintf("⚠️  %s is deprecated", d.Plugin)
+		if d.Since != "" {
+			note += " since " + d.Since
+		}
+		if d.RemovalIn != "" {
+			note += ", removal in " + d.RemovalIn
+		}
+		if d.Notice != "" {
+			note += ": " + d.Notice
+		}
+		notes = append(notes, note)
+	}
+	if !c.Breaking() {
+		notes = append(notes, fmt.Sprintf("✅ The %d plugin(s) %s uses are all still supported", c.Used, c.Config))
+	}
+	if len(c.Added) > 0 {
+		added := strings.Join(c.Added[:min(len(c.Added), maxAdded)], ", ")
+		if len(c.Added) > maxAdded {
+			added += ", …"
+		}
+		notes = append(notes, fmt.Sprintf("🆕 %d plugin(s) added: %s", len(c.Added), added))
+	}
+	return notes
+}
+
+// ConfigPlugins returns the plugins a telegraf config declares, e.g.
+// inputs.cpu, sorted
+func ConfigPlugins(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var plugins []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := section.FindStringSubmatch(scanner.Text())
+		if m == nil || !slices.Contains(kinds, m[1]) {
+			continue
+		}
+		if p := m[1] + "." + m[2]; !slices.Contains(plugins, p) {
+			plugins = append(plugins, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(plugins)
+	return plugins, nil
+}
+
+// Fetch reads the plugin registry of repo (owner/name) at ref from GitHub: the
+// plugins registered in plugins/<kind>/all and the deprecations listed in
+// plugins/<kind>/deprecations.go
+func Fetch(ctx context.Context, client *github.Client, repo, ref string) (Registry, error) {
+	r := Registry{Plugins: make(map[string]bool), Deprecated: make(map[string]Deprecation)}
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" {
+		return r, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("invalid repo format: %s", repo))
+	}
+	opts := &github.RepositoryContentGetOptions{Ref: ref}
+
+	for _, kind := range kinds {
+		_, dir, resp, err := client.Repositories.GetContents(ctx, owner, name, path.Join("plugins", kind, "all"), opts)
+		if resp != nil && resp.StatusCode == 404 {
+			continue // e.g. secretstores, before telegraf had them
+		}
+		if err != nil {
+			return r, ghclient.Classify(fmt.Errorf("failed to list %s plugins at %s: %w", kind, ref, err))
+		}
+		for _, entry := range dir {
+			plugin, ok := strings.CutSuffix(entry.GetName(), ".go")
+			if ok && entry.GetType() == "file" && plugin != "all" && !strings.HasSuffix(plugin, "_test") {
+				r.Plugins[kind+"."+plugin] = true
+			}
+		}
+
+		file, _, resp, err := client.Repositories.GetContents(ctx, owner, name, path.Join("plugins", kind, "deprecations.go"), opts)
+		if resp != nil && resp.StatusCode == 404 {
+			continue
+		}
+		if err != nil {
+			return r, ghclient.Classify(fmt.Errorf("failed to read %s deprecations at %s: %w", kind, ref, err))
+		}
+		src, err := file.GetContent()
+		if err != nil {
+			return r, fmt.Errorf("failed to decode %s deprecations at %s: %w", kind, ref, err)
+		}
+		deprecations, err := parseDeprecations(src)
+		if err != nil {
+			return r, fmt.Errorf("%s deprecations at %s: %w", kind, ref, err)
+		}
+		for plugin, d := range deprecations {
+			r.Deprecated[kind+"."+plugin] = d
+		}
+	}
+	if len(r.Plugins) == 0 {
+		return r, fmt.Errorf("no plugins registered in %s at %s: not telegraf?", repo, ref)
+	}
+	return r, nil
+}
+
+// parseDeprecations reads the Deprecations map of a telegraf deprecations.go:
+// plugin name -> telegraf.DeprecationInfo{Since, RemovalIn, Notice}
+func parseDeprecations(src string) (map[string]Deprecation, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "deprecations.go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	deprecations := make(map[string]Deprecation)
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		if _, ok := lit.Type.(*ast.MapType); !ok {
+			return true
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			plugin, ok := stringLit(kv.Key)
+			if !ok {
+				continue
+			}
+			var d Deprecation
+			if info, ok := kv.Value.(*ast.CompositeLit); ok {
+				for _, field := range info.Elts {
+					fkv, ok := field.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					key, _ := fkv.Key.(*ast.Ident)
+					value, _ := stringLit(fkv.Value)
+					switch key.String() {
+					case "Since":
+						d.Since = value
+					case "RemovalIn":
+						d.RemovalIn = value
+					case "Notice":
+						d.Notice = value
+					}
+				}
+			}
+			deprecations[plugin] = d
+		}
+		return false
+	})
+	return deprecations, nil
+}
+
+// stringLit returns the value of a string literal, possibly concatenated
+func stringLit(e ast.Expr) (string, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.BinaryExpr:
+		a, ok := stringLit(e.X)
+		b, ok2 := stringLit(e.Y)
+		return a + b, ok && ok2 && e.Op == token.ADD
+	}
+	return "", false
+}
+
+// Compare checks the plugins used against the registries of the installed
+// (from) and the new (to) version
+func Compare(used []string, from, to Registry) Compatibility {
+	c := Compatibility{Used: len(used)}
+	for _, p := range used {
+		switch {
+		case from.Plugins[p] && !to.Plugins[p]:
+			c.Removed = append(c.Removed, p)
+		case to.Plugins[p]:
+			d, deprecated := to.Deprecated[p]
+			if _, was := from.Deprecated[p]; deprecated && !was {
+				c.Deprecated = append(c.Deprecated, Deprecated{Plugin: p, Deprecation: d})
+			}
+		}
+	}
+	for p := range to.Plugins {
+		if !from.Plugins[p] {
+			c.Added = append(c.Added, p)
+		}
+	}
+	sort.Strings(c.Added)
+	return c
+}
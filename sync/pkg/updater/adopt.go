@@ -0,0 +1,220 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Adoption describes a manually installed binary brought under sync management
+type Adoption struct {
+	Subsystem string `json:"subsystem"`
+	Binary    string `json:"binary"`            // path it was adopted from
+	Name      string `json:"name"`              // file name under .bin/
+	Probe     string `json:"probe,omitempty"`   // first line of its version output
+	Release   string `json:"release,omitempty"` // version found in the probe, e.g. v2.10.24
+	Commit    string `json:"commit"`            // version recorded in .version
+	SHA256    string `json:"sha256"`
+}
+
+// probeArgs are tried in order until the binary prints something that looks like a version
+var probeArgs = [][]string{{"--version"}, {"version"}, {"-version"}, {"-v"}}
+
+// versionPattern finds a semantic version in version output, e.g. "nats-server: v2.10.24"
+var versionPattern = regexp.MustCompile(`\bv?(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?)\b`)
+
+// Probe runs a binary's version flag and returns the first line of its output
+// with the version found in it ("" if none of the usual flags yields one)
+func Probe(binary string) (string, string) {
+	for _, args := range probeArgs {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cmd := exec.CommandContext(ctx, binary, args...)
+		cmd.WaitDelay = time.Second
+		output, _ := cmd.CombinedOutput() // some binaries exit non-zero after printing their version
+		cancel()
+
+		for _, line := range strings.Split(string(output), "\n") {
+			if m := versionPattern.FindStringSubmatch(line); m != nil {
+				return strings.TrimSpace(line), "v" + m[1]
+			}
+		}
+	}
+	return "", ""
+}
+
+// Fingerprint returns the SHA256 of a file, hex encoded
+func Fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Adopt installs a manually installed binary as the active version of a
+// subsystem without rebuilding it, and records it in the ledger
+// The binary is copied into .bin/ (or taken as is if it is there already) with
+// a .version for a.Commit, then installed like a fresh build. A subsystem that
+// already has an active version is only adopted over with force.
+func Adopt(a Adoption, force bool) (history.Entry, error) {
+	lock, err := lockSubsystem(a.Subsystem)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	defer lock.Release()
+
+	from, _ := versions.Active(a.Subsystem)
+	if from != "" && !force {
+		return history.Entry{}, fmt.Errorf("%s is already managed (active version %s); use --force to replace it", a.Subsystem, from)
+	}
+
+	start := time.Now()
+	metrics.UpdateTriggered(a.Subsystem, TriggerAdopt)
+
+	var version string
+	err = func() error {
+		bin, err := versions.BinDir(a.Subsystem)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(bin, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", bin, err)
+		}
+		// Resolve before detaching, in case it is a .bin/ link into the active version
+		src, err := filepath.EvalSymlinks(a.Binary)
+		if err != nil {
+			return err
+		}
+		// Don't write the binary and .version through the links into the active version
+		if err := versions.Detach(a.Subsystem); err != nil {
+			return err
+		}
+		if err := copyBinary(src, filepath.Join(bin, a.Name)); err != nil {
+			restoreLinks(a.Subsystem, from)
+			return err
+		}
+
+		var info bytes.Buffer
+		fmt.Fprintf(&info, "commit: %s\n", a.Commit)
+		fmt.Fprintf(&info, "timestamp: %s\n", start.UTC().Format(time.RFC3339))
+		fmt.Fprintf(&info, "checksum: %s\n", a.SHA256)
+		fmt.Fprintf(&info, "adopted: %s\n", a.Binary)
+		// It was installed by hand on this host
+		fmt.Fprintf(&info, "os: %s\narch: %s\n", runtime.GOOS, runtime.GOARCH)
+		if a.Release != "" {
+			fmt.Fprintf(&info, "release: %s\n", a.Release)
+		}
+		if err := os.WriteFile(filepath.Join(bin, ".version"), info.Bytes(), 0644); err != nil {
+			restoreLinks(a.Subsystem, from)
+			return fmt.Errorf("failed to write .version: %w", err)
+		}
+
+		if version, err = versions.Install(a.Subsystem); err != nil {
+			return fmt.Errorf("failed to install: %w", err)
+		}
+		logger.Info("Adopted", "subsystem", a.Subsystem, "version", revision.Short(version), "binary", a.Binary)
+		rerender(a.Subsystem)
+		return nil
+	}()
+
+	entry := history.Entry{
+		Time:      start,
+		Subsystem: a.Subsystem,
+		From:      from,
+		Trigger:   TriggerAdopt,
+		Success:   err == nil,
+		Duration:  time.Since(start),
+	}
+	if err != nil {
+		entry.Error = redact.String(err.Error())
+		entry.ErrorKind = syncerr.KindOf(err)
+	} else {
+		entry.To = version
+	}
+
+	status.RecordUpdate(entry)
+	metrics.UpdateFinished(a.Subsystem, entry.Success, entry.Duration)
+	publishResult(entry, nil)
+	if herr := history.Append(entry); herr != nil {
+		logger.Warn("Failed to record history", "subsystem", a.Subsystem, "err", herr)
+	}
+
+	if err != nil {
+		return entry, fmt.Errorf("adopt failed for %s: %w", a.Subsystem, err)
+	}
+	detail := fmt.Sprintf("%s %s from %s (sha256 %s)", a.Subsystem, version, a.Binary, a.SHA256)
+	if aerr := audit.Append(audit.Entry{Time: start, Action: audit.ActionAdopt, Actor: audit.Actor(), Detail: detail}); aerr != nil {
+		logger.Warn("Failed to record adopt in the audit log", "subsystem", a.Subsystem, "err", aerr)
+	}
+	return entry, nil
+}
+
+// restoreLinks re-activates the version that was active before a failed adopt
+func restoreLinks(subsystem, version string) {
+	if version == "" {
+		return
+	}
+	if err := versions.Activate(subsystem, version); err != nil {
+		logger.Warn("Failed to restore the previous version", "subsystem", subsystem, "version", version, "err", err)
+	}
+}
+
+// copyBinary copies src to dst with its permissions, through a temporary file
+// so a running binary at dst is replaced rather than overwritten
+// Adopting a binary that is already at dst leaves it in place.
+func copyBinary(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".adopt-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := tmp.Chmod(srcInfo.Mode().Perm() | 0100); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
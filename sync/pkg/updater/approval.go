@@ -0,0 +1,181 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/telegraf"
+)
+
+// PendingUpdate is a detected update waiting for `sync approve` or `sync reject`
+type PendingUpdate struct {
+	Subsystem string    `json:"subsystem"`
+	Trigger   string    `json:"trigger"`            // what detected the update
+	From      string    `json:"from,omitempty"`     // installed version when detected
+	Target    string    `json:"target,omitempty"`   // upstream version, if known
+	Release   string    `json:"release,omitempty"`  // releases mode: the release tag
+	Published time.Time `json:"published,omitzero"` // when upstream published it, if known
+	Time      time.Time `json:"time"`
+
+	// Compatibility is how the update affects the telegraf plugins in use,
+	// for repos with plugins:
+	Compatibility *telegraf.Compatibility `json:"compatibility,omitempty"`
+}
+
+// Submit applies a detected update according to the subsystem's policy
+// auto adds it to the update queue, approve holds it for `sync approve`, and
+// notify only announces it; a matching rule of policies: overrides the repo's
+// policy, and may also deny the update. With release trains, updates that
+// would be applied or held board the train instead. Operator-initiated
+// updates (sync update, NATS commands) skip the policy. Hosts in a promoted
+// environment only announce detected updates: they install what is promoted
+// into their environment.
+func Submit(req Request) error {
+	if env, promoted := promotedEnvironment(); promoted {
+		announce(req, "not applied: "+env+" installs promoted releases")
+		return nil
+	}
+
+	action, rule := policyFor(req)
+	if tc, _ := trainConfig(); tc.Enabled() && (action == config.PolicyAuto || action == config.PolicyApprove) {
+		return board(req)
+	}
+	switch action {
+	case config.PolicyApprove:
+		return hold(req)
+	case config.PolicyNotify:
+		if rule != nil {
+			announce(req, "policy "+rule.Name+", not applied")
+		} else {
+			announce(req, "policy notify, not applied")
+		}
+		return nil
+	case config.PolicyDeny:
+		logger.Info("Update denied by policy", "subsystem", req.Subsystem, "policy", rule.Name)
+		return nil
+	default:
+		return Enqueue(req)
+	}
+}
+
+// announce logs and publishes a detected update that is not applied, and why
+func announce(req Request, why string) {
+	from, _ := checker.GetCurrentVersion(req.Subsystem)
+	logger.Info("Update available", "subsystem", req.Subsystem, "from", orUnknown(from), "to", orUnknown(req.Target), "reason", why)
+	events.Publish(events.Event{
+		Type:      events.UpdateAvailable,
+		Subsystem: req.Subsystem,
+		From:      from,
+		To:        req.Target,
+		Trigger:   req.Trigger,
+	})
+}
+
+// hold records req as pending approval, replacing any older pending update
+func hold(req Request) error {
+	from, _ := checker.GetCurrentVersion(req.Subsystem)
+	if DryRun() {
+		logger.Info("Dry run: would queue the update for approval", "subsystem", req.Subsystem, "from", orUnknown(from), "to", orUnknown(req.Target))
+		return nil
+	}
+
+	p := PendingUpdate{
+		Subsystem:     req.Subsystem,
+		Trigger:       req.Trigger,
+		From:          from,
+		Target:        req.Target,
+		Release:       req.Release,
+		Published:     req.Published,
+		Time:          time.Now(),
+		Compatibility: compatibility(req.Subsystem, from, req.Target),
+	}
+	if err := state.Put(state.BucketPending, req.Subsystem, p); err != nil {
+		return fmt.Errorf("failed to queue update for %s: %w", req.Subsystem, err)
+	}
+
+	logger.Info("Update queued for approval", "subsystem", req.Subsystem, "approve", "sync approve "+req.Subsystem)
+	events.Publish(events.Event{
+		Type:      events.UpdatePending,
+		Time:      p.Time,
+		Subsystem: p.Subsystem,
+		From:      p.From,
+		To:        p.Target,
+		Trigger:   p.Trigger,
+	})
+	return nil
+}
+
+// Pending returns the updates awaiting approval, by subsystem
+func Pending() ([]PendingUpdate, error) {
+	var pending []PendingUpdate
+	err := state.ForEach(state.BucketPending, func(_ string, data []byte) error {
+		var p PendingUpdate
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		pending = append(pending, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending updates: %w", err)
+	}
+	return pending, nil
+}
+
+// Approve runs the pending update for subsystem, removing it once it succeeds
+// A failed update stays pending, to be approved again or rejected.
+func Approve(subsystem string) (PendingUpdate, error) {
+	p, err := pending(subsystem)
+	if err != nil {
+		return p, err
+	}
+	if err := Run(Request{Subsystem: subsystem, Trigger: TriggerApproved, Target: p.Target, Release: p.Release, Published: p.Published}); err != nil {
+		return p, err
+	}
+	return p, drop(p)
+}
+
+// Reject discards the pending update for subsystem
+// The pollers remember the rejected version, so it is not queued again;
+// the next upstream change is.
+func Reject(subsystem string) (PendingUpdate, error) {
+	p, err := pending(subsystem)
+	if err != nil {
+		return p, err
+	}
+	return p, drop(p)
+}
+
+// pending returns the pending update for subsystem
+func pending(subsystem string) (PendingUpdate, error) {
+	var p PendingUpdate
+	found, err := state.Get(state.BucketPending, subsystem, &p)
+	if err != nil {
+		return p, fmt.Errorf("failed to read pending update for %s: %w", subsystem, err)
+	}
+	if !found {
+		return p, fmt.Errorf("no pending update for %s", subsystem)
+	}
+	return p, nil
+}
+
+// drop removes pending update p, unless a newer one has replaced it since
+// In dry-run mode the update stays queued.
+func drop(p PendingUpdate) error {
+	if DryRun() {
+		return nil
+	}
+	current, err := pending(p.Subsystem)
+	if err != nil || !current.Time.Equal(p.Time) {
+		return nil
+	}
+	if _, err := state.Delete(state.BucketPending, p.Subsystem); err != nil {
+		return fmt.Errorf("failed to remove pending update for %s: %w", p.Subsystem, err)
+	}
+	return nil
+}
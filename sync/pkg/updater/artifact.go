@@ -0,0 +1,224 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/artifacts"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/download"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// installAsset installs the prebuilt release asset of req into the staging
+// dir bin instead of building from source: the asset for this OS/arch is
+// downloaded, checked against the release's checksums file, unpacked, and
+// given a .version recording the tag's commit. With artifact.cosign, its
+// Sigstore signature is verified too. It returns a log of what it did.
+func installAsset(req Request, repo config.RepoConfig, bin string, t *tracker) ([]byte, error) {
+	a := repo.Artifact
+	site := strings.TrimSuffix(a.BaseURL, "/") + "/" + repo.Repo
+	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
+	defer cancel()
+
+	tag := req.Release
+	if tag == "" {
+		pin, err := checker.PinnedVersion(ctx, repo.Subsystem)
+		if err != nil {
+			return nil, err
+		}
+		tag = pin
+	}
+	commit := req.Target
+	if commit == "" {
+		var err error
+		if commit, err = tagCommit(ctx, site, tag); err != nil {
+			return nil, err
+		}
+	}
+
+	name, sums := expandAsset(a.Asset, tag), expandAsset(a.Checksums, tag)
+	base := site + "/releases/download/" + tag + "/"
+	var out strings.Builder
+	fmt.Fprintf(&out, "release %s asset %s\n", tag, name)
+
+	want, err := download.Checksum(ctx, base+sums, name)
+	if err != nil {
+		return []byte(out.String()), err
+	}
+
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(bin, ".download-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := filepath.Join(tmp, name)
+	last := 0
+	err = download.File(ctx, base+name, archive, func(done, total int64) {
+		if total <= 0 {
+			return
+		}
+		if percent := int(done * 100 / total); percent != last {
+			last = percent
+			t.publish(PhaseDownload, percent, fmt.Sprintf("%s %s of %s", name, versions.FormatBytes(done), versions.FormatBytes(total)))
+		}
+	})
+	if err != nil {
+		return []byte(out.String()), err
+	}
+
+	got, err := artifacts.Digest(archive)
+	if err != nil {
+		return []byte(out.String()), err
+	}
+	if got != want {
+		return []byte(out.String()), syncerr.Wrap(syncerr.ChecksumMismatch, fmt.Errorf("%s checksum mismatch: %s lists %s, downloaded %s", name, sums, want, got))
+	}
+	fmt.Fprintf(&out, "verified sha256 %s against %s\n", got, sums)
+	if a.Cosign.Enabled() {
+		log, err := verifyCosign(ctx, a.Cosign, base, tag, name, archive)
+		out.Write(log)
+		if err != nil {
+			return []byte(out.String()), err
+		}
+	}
+
+	binary := a.Binary
+	if runtime.GOOS == "windows" && !strings.HasSuffix(binary, ".exe") {
+		binary += ".exe"
+	}
+	if err := download.Extract(archive, name, binary, bin); err != nil {
+		return []byte(out.String()), fmt.Errorf("failed to unpack %s: %w", name, err)
+	}
+	sum, err := artifacts.Digest(filepath.Join(bin, binary))
+	if err != nil {
+		return []byte(out.String()), err
+	}
+
+	// The asset was picked for this host
+	version := fmt.Sprintf("commit: %s\ntimestamp: %s\nchecksum: %s\nrelease: %s\nos: %s\narch: %s\n",
+		commit, time.Now().UTC().Format(time.RFC3339), sum, tag, runtime.GOOS, runtime.GOARCH)
+	if err := os.WriteFile(filepath.Join(bin, ".version"), []byte(version), 0644); err != nil {
+		return []byte(out.String()), err
+	}
+	fmt.Fprintf(&out, "installed %s (%s)\n", binary, commit)
+	return []byte(out.String()), nil
+}
+
+// verifyCosign checks the cosign signature (and attestation, if configured) of
+// the downloaded asset, fetching the files cosign needs from the same release
+// into the asset's directory
+func verifyCosign(ctx context.Context, c config.CosignConfig, base, tag, name, archive string) ([]byte, error) {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return nil, fmt.Errorf("artifact.cosign is set but cosign is not installed: %w", err)
+	}
+	dir := filepath.Dir(archive)
+	fetch := func(pattern string) (string, error) {
+		file := expandAsset(strings.ReplaceAll(pattern, "{asset}", name), tag)
+		path := filepath.Join(dir, filepath.Base(file))
+		return path, download.File(ctx, base+file, path, nil)
+	}
+
+	var trust []string
+	if c.Key != "" {
+		key := c.Key
+		if !filepath.IsAbs(key) {
+			root, err := config.ProjectRoot()
+			if err != nil {
+				return nil, err
+			}
+			key = filepath.Join(root, key)
+		}
+		trust = append(trust, "--key", key)
+	} else {
+		if c.Identity != "" {
+			trust = append(trust, "--certificate-identity", c.Identity)
+		} else {
+			trust = append(trust, "--certificate-identity-regexp", c.IdentityRegexp)
+		}
+		trust = append(trust, "--certificate-oidc-issuer", c.Issuer)
+	}
+
+	// The signature flag also carries the attestation, in the same format
+	sigFlag, sigFile := "--bundle", c.Bundle
+	if c.Bundle == "" {
+		sigFlag, sigFile = "--signature", c.Signature
+	}
+	args := append([]string{"verify-blob"}, trust...)
+	sig, err := fetch(sigFile)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, sigFlag, sig)
+	if c.Bundle == "" && c.Certificate != "" {
+		cert, err := fetch(c.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--certificate", cert)
+	}
+
+	var out bytes.Buffer
+	if err := cosign(ctx, &out, append(args, archive)...); err != nil {
+		return out.Bytes(), syncerr.Wrap(syncerr.SignatureInvalid, fmt.Errorf("%s failed cosign verification: %w", name, err))
+	}
+	fmt.Fprintf(&out, "verified cosign signature of %s\n", name)
+
+	if c.Attestation != "" {
+		att, err := fetch(c.Attestation)
+		if err != nil {
+			return out.Bytes(), err
+		}
+		args := append([]string{"verify-blob-attestation", "--type", c.AttestationType}, trust...)
+		if err := cosign(ctx, &out, append(args, sigFlag, att, archive)...); err != nil {
+			return out.Bytes(), syncerr.Wrap(syncerr.SignatureInvalid, fmt.Errorf("%s failed %s attestation verification: %w", name, c.AttestationType, err))
+		}
+		fmt.Fprintf(&out, "verified %s attestation of %s\n", c.AttestationType, name)
+	}
+	return out.Bytes(), nil
+}
+
+// cosign runs cosign with args, logging its output to out
+func cosign(ctx context.Context, out *bytes.Buffer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	cmd.Stdout, cmd.Stderr = out, out
+	return cmd.Run()
+}
+
+// expandAsset fills in the {tag}, {version}, {os} and {arch} of an asset name
+func expandAsset(pattern, tag string) string {
+	return strings.NewReplacer(
+		"{tag}", tag,
+		"{version}", strings.TrimPrefix(tag, "v"),
+		"{os}", runtime.GOOS,
+		"{arch}", runtime.GOARCH,
+	).Replace(pattern)
+}
+
+// tagCommit looks up the commit of tag with git ls-remote, for updates
+// started without a known upstream version (e.g. sync update)
+// Like the checker's GitHub lookup, it takes the ref itself, not the peeled commit.
+func tagCommit(ctx context.Context, remote, tag string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "ls-remote", remote, "refs/tags/"+tag).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up tag %s: %w", tag, err)
+	}
+	sha, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\t")
+	if len(sha) < 7 {
+		return "", fmt.Errorf("tag %s not found in %s", tag, remote)
+	}
+	return sha, nil
+}
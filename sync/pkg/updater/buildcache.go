@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// buildEnv returns the GOCACHE, GOMODCACHE and GOCACHEPROG settings of
+// build.cache for a source build's environment
+// Relative directories are relative to the project root and ~/ is the home
+// directory; the go command creates them when missing.
+func buildEnv() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg == nil {
+		return nil
+	}
+	cache := cfg.Build.Cache
+
+	var env []string
+	for _, v := range []struct{ name, dir string }{
+		{"GOCACHE", cache.Dir},
+		{"GOMODCACHE", cache.ModDir},
+	} {
+		if v.dir == "" {
+			continue
+		}
+		env = append(env, v.name+"="+cachePath(v.dir))
+	}
+	if cache.Prog != "" {
+		env = append(env, "GOCACHEPROG="+cache.Prog)
+	}
+	return env
+}
+
+// cachePath resolves a configured cache directory to an absolute path, as
+// the go command requires
+func cachePath(dir string) string {
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if !filepath.IsAbs(dir) {
+		if root, err := config.ProjectRoot(); err == nil {
+			return filepath.Join(root, dir)
+		}
+	}
+	return dir
+}
@@ -0,0 +1,34 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/buildenv"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+)
+
+// captureBuild records the environment a source build of subsystem runs in
+func captureBuild(subsystem string, env []string) *buildenv.Environment {
+	dir := ""
+	if root, err := config.ProjectRoot(); err == nil {
+		dir = filepath.Join(root, subsystem, ".src")
+	}
+	e := buildenv.Capture(dir, env)
+	return &e
+}
+
+// recordBuild keeps the environment of a source build that was installed as
+// version, for sync builds; "" is the version the build's .version names
+func recordBuild(req Request, version string, env buildenv.Environment) {
+	if version == "" {
+		version, _ = checker.GetCurrentVersion(req.Subsystem)
+	}
+	host, _ := os.Hostname()
+	b := buildenv.Build{Subsystem: req.Subsystem, Version: version, Trigger: req.Trigger, Time: time.Now(), Host: host, Env: env}
+	if err := buildenv.Record(b); err != nil {
+		logger.Warn("Failed to record the build environment", "subsystem", req.Subsystem, "err", err)
+	}
+}
@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/ghclient"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/telegraf"
+)
+
+// compatibility checks a held update of a subsystem with plugins: against
+// the plugins its telegraf config uses, for the approval prompt
+// It returns nil for subsystems without plugins:, and the reason in Error
+// when the check can't run; it never holds up queueing the update.
+func compatibility(subsystem, from, to string) *telegraf.Compatibility {
+	repo := repoFor(subsystem)
+	if repo.Plugins == "" {
+		return nil
+	}
+	c := &telegraf.Compatibility{Config: repo.Plugins}
+	if err := checkCompatibility(c, repo, from, to); err != nil {
+		logger.Warn("Could not check plugin compatibility", "subsystem", subsystem, "err", err)
+		c.Error = err.Error()
+		return c
+	}
+	level := slog.LevelInfo
+	if c.Breaking() {
+		level = slog.LevelWarn
+	}
+	for _, note := range c.Notes() {
+		logger.Log(context.Background(), level, "Plugin compatibility", "subsystem", subsystem, "note", note)
+	}
+	return c
+}
+
+// checkCompatibility fills c in from the plugin registries of from and to
+func checkCompatibility(c *telegraf.Compatibility, repo config.RepoConfig, from, to string) error {
+	if from == "" || to == "" {
+		return fmt.Errorf("versions unknown")
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return err
+	}
+	used, err := telegraf.ConfigPlugins(filepath.Join(root, repo.Plugins))
+	if err != nil {
+		return fmt.Errorf("failed to read the plugins in use: %w", err)
+	}
+
+	mu.RLock()
+	conf := cfg
+	mu.RUnlock()
+	token, err := secrets.New("GitHub token", "GITHUB_TOKEN", conf.Secrets.GitHubTokenFile)
+	if err != nil {
+		return err
+	}
+	client := ghclient.New(token, conf.Provider, conf.FixturesDir, conf.GitHub)
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Checks.Timeout)
+	defer cancel()
+
+	old, err := telegraf.Fetch(ctx, client, repo.Repo, from)
+	if err != nil {
+		return err
+	}
+	registry, err := telegraf.Fetch(ctx, client, repo.Repo, to)
+	if err != nil {
+		return err
+	}
+	*c = telegraf.Compare(used, old, registry)
+	c.Config = repo.Plugins
+	return nil
+}
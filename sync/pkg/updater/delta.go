@@ -0,0 +1,125 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/delta"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// ApplyDelta installs and activates the version a patch file builds, restarts
+// the subsystem's processes on it, and records it in the ledger
+// With fallback, a patch that does not apply (wrong base, corrupt download)
+// falls back to fetching the full artifact with task <subsystem>:bin:download.
+func ApplyDelta(subsystem, path string, fallback bool) (history.Entry, error) {
+	lock, err := lockSubsystem(subsystem)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	defer lock.Release()
+
+	from, _ := versions.Active(subsystem)
+	start := time.Now()
+	metrics.UpdateTriggered(subsystem, TriggerDelta)
+
+	to, err := func() (string, error) {
+		m, err := delta.Apply(subsystem, path)
+		if err == nil {
+			if err := versions.Store(subsystem, m.To); err != nil {
+				logger.Warn("Failed to deduplicate in the artifact store", "subsystem", subsystem, "version", m.To, "err", err)
+			}
+			if err := versions.Activate(subsystem, m.To); err != nil {
+				return "", err
+			}
+			logger.Info("Patched", "subsystem", subsystem, "from", revision.Short(m.From), "to", revision.Short(m.To))
+			rerender(subsystem)
+			return m.To, nil
+		}
+		if !fallback {
+			return "", err
+		}
+
+		logger.Warn("Patch did not apply; downloading the full artifact", "subsystem", subsystem, "err", err)
+		return downloadFull(subsystem, from)
+	}()
+
+	// As for any update, the processes restart to run the new version, which
+	// must then pass the health check
+	repo := repoFor(subsystem)
+	if err == nil {
+		if err = restartProcesses(repo); err == nil {
+			err = checkHealth(repo)
+		}
+	}
+
+	entry := history.Entry{
+		Time:      start,
+		Subsystem: subsystem,
+		From:      from,
+		Trigger:   TriggerDelta,
+		Success:   err == nil,
+		Duration:  time.Since(start),
+	}
+	if err != nil {
+		entry.Error = redact.String(err.Error())
+		entry.ErrorKind = syncerr.KindOf(err)
+	} else {
+		entry.To = to
+	}
+
+	status.RecordUpdate(entry)
+	metrics.UpdateFinished(subsystem, entry.Success, entry.Duration)
+	publishResult(entry, nil)
+	if herr := history.Append(entry); herr != nil {
+		logger.Warn("Failed to record history", "subsystem", subsystem, "err", herr)
+	}
+
+	if err != nil {
+		return entry, fmt.Errorf("delta update failed for %s: %w", subsystem, err)
+	}
+	watchRegression(subsystem, to, repo.Regression)
+	return entry, nil
+}
+
+// downloadFull installs the subsystem's full release artifact, downloaded
+// into the staging dir so the previous version stays active if it fails
+func downloadFull(subsystem, previous string) (string, error) {
+	staging, err := versions.Stage(subsystem)
+	if err != nil {
+		return "", err
+	}
+	defer versions.Unstage(subsystem)
+
+	cmd := exec.Command("task", subsystem+":bin:download")
+	cmd.Env = append(os.Environ(), "SYNC_STAGING_DIR="+staging)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		var installed string
+		if installed, err = versions.Install(subsystem); err == nil {
+			if installed == "" {
+				installed = previous
+			}
+			rerender(subsystem)
+			return installed, nil
+		}
+	} else {
+		err = fmt.Errorf("full download failed: %w\n%s", err, redact.Bytes(output))
+	}
+
+	// Install may have failed halfway through switching
+	if previous != "" {
+		if aerr := versions.Activate(subsystem, previous); aerr != nil {
+			logger.Warn("Failed to reactivate the previous version", "subsystem", subsystem, "version", previous, "err", aerr)
+		}
+	}
+	return "", err
+}
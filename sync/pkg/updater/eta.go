@@ -0,0 +1,208 @@
+package updater
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// States of a QueuedUpdate
+const (
+	QueueRunning  = "running"
+	QueueWaiting  = "queued"
+	QueueRetrying = "retrying" // waiting out the backoff after a failed attempt
+)
+
+// estimateSamples is how many recent successful updates of a subsystem its
+// duration estimate is the median of
+const estimateSamples = 5
+
+// QueuedUpdate is an update queued or running in one of the daemons, with its
+// place in the queue and when it is expected to finish
+type QueuedUpdate struct {
+	Daemon    string    `json:"daemon"`
+	Subsystem string    `json:"subsystem"`
+	Trigger   string    `json:"trigger"`
+	Target    string    `json:"target,omitempty"` // upstream version, if known
+	State     string    `json:"state"`            // running, queued or retrying
+	Position  int       `json:"position"`         // in its daemon's queue: 1 is next to start, 0 while running
+	Attempts  int       `json:"attempts,omitempty"`
+	Started   time.Time `json:"started,omitzero"` // while running
+	NextAt    time.Time `json:"nextAt,omitzero"`  // earliest start, while waiting
+
+	Estimate time.Duration `json:"estimate,omitempty"` // typical duration of the subsystem's updates
+	ETA      time.Time     `json:"eta,omitzero"`       // estimated completion; zero if unknown
+}
+
+// Queued returns the updates queued or running in every daemon, in the order
+// each daemon will run them
+// ETAs assume each daemon runs queue.concurrency updates at once, each taking
+// the median duration of its subsystem's recent successful updates (or of all
+// subsystems' without history of its own). Waiting updates have no ETA while
+// updates are frozen.
+func Queued() ([]QueuedUpdate, error) {
+	byDaemon := make(map[string][]*Job)
+	err := state.ForEach(state.BucketQueue, func(key string, data []byte) error {
+		var j Job
+		if err := json.Unmarshal(data, &j); err != nil {
+			return err
+		}
+		daemon, _, _ := strings.Cut(key, "/")
+		byDaemon[daemon] = append(byDaemon[daemon], &j)
+		return nil
+	})
+	if err != nil || len(byDaemon) == 0 {
+		return nil, err
+	}
+
+	entries, err := history.Load()
+	if err != nil {
+		return nil, err
+	}
+	estimates, fallback := estimates(entries)
+	_, frozen, _ := freeze.Current()
+
+	concurrency := config.DefaultQueueConcurrency
+	mu.RLock()
+	if cfg != nil {
+		concurrency = cfg.Queue.Concurrency
+	}
+	mu.RUnlock()
+
+	daemons := make([]string, 0, len(byDaemon))
+	for d := range byDaemon {
+		daemons = append(daemons, d)
+	}
+	sort.Strings(daemons)
+
+	now := time.Now()
+	var list []QueuedUpdate
+	for _, d := range daemons {
+		jobs := byDaemon[d]
+		// The order take picks them in: running first, then by earliest start
+		sort.SliceStable(jobs, func(i, k int) bool {
+			ri, rk := !jobs[i].Started.IsZero(), !jobs[k].Started.IsZero()
+			if ri != rk {
+				return ri
+			}
+			return jobs[i].NextAt.Before(jobs[k].NextAt)
+		})
+
+		// free holds the time each worker is expected to become free
+		free := make([]time.Time, max(concurrency, 1))
+		for i := range free {
+			free[i] = now
+		}
+		position := 0
+		for _, j := range jobs {
+			u := QueuedUpdate{
+				Daemon:    d,
+				Subsystem: j.Request.Subsystem,
+				Trigger:   j.Request.Trigger,
+				Target:    j.Request.Target,
+				Attempts:  j.Attempts,
+				Estimate:  estimates[j.Request.Subsystem],
+			}
+			if u.Estimate == 0 {
+				u.Estimate = fallback
+			}
+
+			slot := earliest(free)
+			switch {
+			case !j.Started.IsZero():
+				u.State, u.Started = QueueRunning, j.Started
+				// Overdue builds are expected to finish any moment
+				free[slot] = later(j.Started.Add(u.Estimate), now)
+			default:
+				position++
+				u.State, u.Position, u.NextAt = QueueWaiting, position, j.NextAt
+				if j.Attempts > 0 {
+					u.State = QueueRetrying
+				}
+				free[slot] = later(free[slot], j.NextAt).Add(u.Estimate)
+			}
+			if u.Estimate > 0 && (u.State == QueueRunning || !frozen) {
+				u.ETA = free[slot]
+			}
+			list = append(list, u)
+		}
+	}
+	return list, nil
+}
+
+// estimates returns the median duration of each subsystem's recent
+// successful updates, and the median over all subsystems
+func estimates(entries []history.Entry) (map[string]time.Duration, time.Duration) {
+	recent := make(map[string][]time.Duration)
+	var all []time.Duration
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		// Rollbacks and adoptions only relink; they say nothing about build times
+		if !e.Success || e.Duration <= 0 || e.Trigger == TriggerRollback || e.Trigger == TriggerAdopt {
+			continue
+		}
+		if len(recent[e.Subsystem]) < estimateSamples {
+			recent[e.Subsystem] = append(recent[e.Subsystem], e.Duration)
+			all = append(all, e.Duration)
+		}
+	}
+
+	medians := make(map[string]time.Duration, len(recent))
+	for subsystem, durations := range recent {
+		medians[subsystem] = median(durations)
+	}
+	return medians, median(all)
+}
+
+// median returns the middle duration (0 for none)
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// earliest returns the index of the earliest time
+func earliest(times []time.Time) int {
+	first := 0
+	for i, t := range times {
+		if t.Before(times[first]) {
+			first = i
+		}
+	}
+	return first
+}
+
+// later returns the later of two times
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// publishQueue updates the queue metrics with this daemon's updates
+func (q *queue) publishQueue() {
+	list, err := Queued()
+	if err != nil {
+		return
+	}
+	positions := make(map[string]int)
+	etas := make(map[string]time.Time)
+	for _, u := range list {
+		if u.Daemon == q.daemon {
+			positions[u.Subsystem], etas[u.Subsystem] = u.Position, u.ETA
+		}
+	}
+	metrics.Queue(positions, etas)
+}
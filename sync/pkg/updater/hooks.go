@@ -0,0 +1,278 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/backup"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+func init() {
+	capabilities.Register(capabilities.Packaging, "snapshot-hook")
+}
+
+var (
+	mu  sync.RWMutex
+	cfg *config.Config
+)
+
+// Configure sets the config used to look up per-subsystem update hooks and dry-run mode
+// Without it, updates run with no migrations or health check.
+func Configure(c *config.Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+	if c.DryRun {
+		logger.Info("Dry-run mode: updates are logged, not executed")
+	}
+}
+
+// DryRun reports whether updates are only planned, not executed
+func DryRun() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return cfg != nil && cfg.DryRun
+}
+
+// Plan returns the steps an update of req would run, in order
+func Plan(req Request) []string {
+	repo := repoFor(req.Subsystem)
+	var steps []string
+
+	if need, reserve, ok := diskNeed(req.Subsystem); ok {
+		steps = append(steps, fmt.Sprintf("check %s of disk space is free (%s used recently, plus the reserve)", versions.FormatBytes(need+reserve), versions.FormatBytes(need)))
+	}
+	switch repo.Snapshot.Method {
+	case config.SnapshotCopy, config.SnapshotTar:
+		steps = append(steps, fmt.Sprintf("snapshot %s (%s, keep %d)", repo.DataDir, repo.Snapshot.Method, repo.Snapshot.Keep))
+	case config.SnapshotHook:
+		steps = append(steps, fmt.Sprintf("task %s:%s (snapshot hook)", req.Subsystem, repo.Snapshot.Task))
+	}
+	if len(repo.Migrations) > 0 && repo.Snapshot.Method != config.SnapshotCopy && repo.Snapshot.Method != config.SnapshotTar {
+		steps = append(steps, fmt.Sprintf("back up %s", repo.DataDir))
+	}
+
+	switch {
+	case req.Trigger == TriggerPromote:
+		steps = append(steps, fmt.Sprintf("install promoted release %s (installed copy, else task %s:bin:download VERSION=%s)", req.Target, req.Subsystem, req.Target))
+	case repo.Strategy == config.StrategyArtifact:
+		step := fmt.Sprintf("download release asset %s for %s/%s and verify it against %s", repo.Artifact.Asset, runtime.GOOS, runtime.GOARCH, repo.Artifact.Checksums)
+		if repo.Artifact.Cosign.Enabled() {
+			step += " and its cosign signature"
+		}
+		steps = append(steps, step)
+	default:
+		step := fmt.Sprintf("task sync:update SUBSYSTEM=%s SYNC_STAGING_DIR=%s/.bin/.staging", req.Subsystem, req.Subsystem)
+		if req.Release != "" {
+			step += " SYNC_RELEASE=" + req.Release
+		}
+		for _, kv := range buildEnv() {
+			step += " " + kv
+		}
+		steps = append(steps, step)
+	}
+	for _, s := range scannersFor(req.Subsystem) {
+		steps = append(steps, fmt.Sprintf("scan the new files with %s (%s); a finding blocks the update", s.Name, s.Command))
+	}
+	for _, t := range repo.Configs {
+		step := fmt.Sprintf("check %s against the new version", t.Output)
+		if t.Template != "" {
+			step = fmt.Sprintf("render %s from %s for the new version", t.Output, t.Template)
+		}
+		if t.Validate != "" {
+			step += ", validated with " + t.Validate
+		}
+		steps = append(steps, step+"; a rejected config blocks the update")
+	}
+	if active, _ := versions.Active(req.Subsystem); active != "" {
+		steps = append(steps, "install build under .bin/versions/ and switch current")
+	}
+	if repo.Rendered() {
+		steps = append(steps, "replace the rendered configs that changed")
+	}
+	steps = append(steps, fmt.Sprintf("restart process(es) %s through the Process Compose API", strings.Join(repo.Processes, ", ")))
+	for _, m := range repo.Migrations {
+		steps = append(steps, fmt.Sprintf("task %s:%s (migration %q)", req.Subsystem, m.Task, m.Name))
+	}
+	if repo.Health {
+		steps = append(steps, fmt.Sprintf("task %s:health", req.Subsystem))
+	}
+	if repo.Regression.Enabled() {
+		steps = append(steps, fmt.Sprintf("watch %d metric(s) for %s, rolling back if one regresses", len(repo.Regression.Metrics), repo.Regression.Window))
+	}
+	if deps := dependents(req); len(deps) > 0 {
+		steps = append(steps, fmt.Sprintf("queue rebuilds of the subsystems depending on %s: %s", req.Subsystem, strings.Join(deps, ", ")))
+	}
+	return steps
+}
+
+// logPlan reports what an update would do without running it
+func logPlan(req Request, from string) {
+	target := revision.Short(req.Target)
+	if target == "" {
+		target = "latest"
+	}
+	logger.Info("Dry run: would update", "subsystem", req.Subsystem, "from", orUnknown(from), "to", target, "trigger", req.Trigger)
+	for i, step := range Plan(req) {
+		logger.Info("Dry run: would run", "subsystem", req.Subsystem, "step", i+1, "action", step)
+	}
+}
+
+// orUnknown returns version shortened for display, or "?" if it is empty
+func orUnknown(version string) string {
+	if version == "" {
+		return "?"
+	}
+	return revision.Short(version)
+}
+
+// repoFor returns the repo config holding the hooks for a subsystem
+func repoFor(subsystem string) config.RepoConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg == nil {
+		return config.RepoConfig{Subsystem: subsystem}
+	}
+	repo, _ := cfg.Repo(subsystem)
+	return repo
+}
+
+// prepareData snapshots or backs up a subsystem data dir before an update
+// Returns the path to restore from if the update fails ("" if none), and
+// whether that path is a retained snapshot rather than a throwaway backup.
+func prepareData(repo config.RepoConfig) (string, bool, error) {
+	if repo.Snapshot.Method == "" && len(repo.Migrations) == 0 {
+		return "", false, nil
+	}
+
+	dir, err := repo.DataPath()
+	if err != nil {
+		return "", false, err
+	}
+
+	switch repo.Snapshot.Method {
+	case config.SnapshotCopy, config.SnapshotTar:
+		create := backup.Create
+		if repo.Snapshot.Method == config.SnapshotTar {
+			create = backup.CreateTar
+		}
+		path, err := create(repo.Subsystem, dir)
+		if err != nil {
+			return "", false, err
+		}
+		logger.Info("Snapshot of data saved", "subsystem", repo.Subsystem, "path", path)
+		return path, true, nil
+	case config.SnapshotHook:
+		if err := runSnapshotHook(repo, dir); err != nil {
+			return "", false, err
+		}
+	}
+
+	// Migrations need a restorable copy even when the snapshot is external
+	if len(repo.Migrations) == 0 {
+		return "", false, nil
+	}
+	path, err := backup.Create(repo.Subsystem, dir)
+	if err != nil {
+		return "", false, err
+	}
+	logger.Info("Backed up data", "subsystem", repo.Subsystem, "path", path)
+	return path, false, nil
+}
+
+// runSnapshotHook runs the subsystem snapshot task (retention is up to the task)
+func runSnapshotHook(repo config.RepoConfig, dir string) error {
+	cmd := exec.Command("task", fmt.Sprintf("%s:%s", repo.Subsystem, repo.Snapshot.Task))
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("SUBSYSTEM=%s", repo.Subsystem),
+		fmt.Sprintf("SYNC_DATA_DIR=%s", dir),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("snapshot hook failed: %w\n%s", err, redact.Bytes(output))
+	}
+	logger.Info("Snapshot hook completed", "subsystem", repo.Subsystem, "task", repo.Snapshot.Task)
+	return nil
+}
+
+// finishData cleans up after an update: retained snapshots are pruned to the
+// configured count, throwaway backups are removed once the update succeeded
+// or the data was restored from them. Only a backup a failed restore left as
+// the sole good copy of the data is kept.
+func finishData(repo config.RepoConfig, path string, retained, restoreFailed bool) {
+	if path == "" {
+		return
+	}
+
+	if retained {
+		removed, err := backup.Prune(repo.Subsystem, repo.Snapshot.Keep)
+		if err != nil {
+			logger.Warn("Failed to prune snapshots", "subsystem", repo.Subsystem, "err", err)
+		}
+		for _, s := range removed {
+			logger.Info("Pruned snapshot", "subsystem", repo.Subsystem, "path", s.Path)
+		}
+		return
+	}
+
+	if restoreFailed {
+		logger.Warn("Keeping the backup: the data dir could not be restored from it", "subsystem", repo.Subsystem, "path", path)
+		return
+	}
+	if err := os.RemoveAll(path); err != nil {
+		logger.Warn("Failed to remove the backup", "subsystem", repo.Subsystem, "path", path, "err", err)
+	}
+}
+
+// restoreData puts the saved data dir back after a failed migration or health check
+func restoreData(repo config.RepoConfig, path string) error {
+	dir, err := repo.DataPath()
+	if err != nil {
+		return err
+	}
+	if err := backup.Restore(path, dir); err != nil {
+		return err
+	}
+	logger.Info("Restored data", "subsystem", repo.Subsystem, "path", path)
+	return nil
+}
+
+// runMigrations runs the declared migration tasks in order, stopping at the first failure
+func runMigrations(repo config.RepoConfig, from, to string) error {
+	for _, m := range repo.Migrations {
+		logger.Info("Running migration", "subsystem", repo.Subsystem, "migration", m.Name)
+
+		cmd := exec.Command("task", fmt.Sprintf("%s:%s", repo.Subsystem, m.Task))
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("SUBSYSTEM=%s", repo.Subsystem),
+			fmt.Sprintf("SYNC_FROM=%s", from),
+			fmt.Sprintf("SYNC_TO=%s", to),
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return syncerr.Wrap(syncerr.MigrationFailed, fmt.Errorf("migration %q failed: %w\n%s", m.Name, err, redact.Bytes(output)))
+		}
+	}
+	return nil
+}
+
+// checkHealth runs the subsystem health task after an update
+func checkHealth(repo config.RepoConfig) error {
+	if !repo.Health {
+		return nil
+	}
+
+	cmd := exec.Command("task", fmt.Sprintf("%s:health", repo.Subsystem))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return syncerr.Wrap(syncerr.HealthCheckFailed, fmt.Errorf("health check failed: %w\n%s", err, redact.Bytes(output)))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/filelock"
+)
+
+// In-process update slots: at most one update per subsystem runs at a time,
+// and triggers that arrive meanwhile collapse into a single follow-up run
+var (
+	slotsMu sync.Mutex
+	running = make(map[string]bool)
+	queued  = make(map[string]Request)
+)
+
+// claim reports whether req may run now; otherwise it replaces any queued
+// follow-up for the subsystem
+func claim(req Request) bool {
+	slotsMu.Lock()
+	defer slotsMu.Unlock()
+	if !running[req.Subsystem] {
+		running[req.Subsystem] = true
+		return true
+	}
+	if _, ok := queued[req.Subsystem]; ok {
+		logger.Info("Update already running; coalesced trigger into the queued follow-up", "subsystem", req.Subsystem, "trigger", req.Trigger)
+	} else {
+		logger.Info("Update already running; trigger queued to run after it", "subsystem", req.Subsystem, "trigger", req.Trigger)
+	}
+	queued[req.Subsystem] = req
+	return false
+}
+
+// release hands the slot to the queued follow-up for subsystem, if any
+func release(subsystem string) (Request, bool) {
+	slotsMu.Lock()
+	defer slotsMu.Unlock()
+	if next, ok := queued[subsystem]; ok {
+		delete(queued, subsystem)
+		return next, true
+	}
+	delete(running, subsystem)
+	return Request{}, false
+}
+
+// lockPath is the cross-process lock file for a subsystem: <data dir>/locks/<subsystem>.lock
+func lockPath(subsystem string) (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "locks", subsystem+".lock"), nil
+}
+
+// lockSubsystem takes the on-disk lock serializing updates and rollbacks of a
+// subsystem across sync processes (the daemons and the CLI), waiting if needed
+func lockSubsystem(subsystem string) (*filelock.Handle, error) {
+	path, err := lockPath(subsystem)
+	if err != nil {
+		return nil, err
+	}
+
+	h, ok, err := filelock.TryAcquire(path)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return h, nil
+	}
+
+	logger.Info("Another sync process is updating; waiting for it to finish", "subsystem", subsystem)
+	h, err = filelock.Acquire(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", subsystem, err)
+	}
+	return h, nil
+}
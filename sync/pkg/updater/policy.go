@@ -0,0 +1,116 @@
+package updater
+
+import (
+	"os"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/semver"
+)
+
+// Evaluate returns the rule of policies: that applies to req, if any, and
+// the attributes its condition saw
+// A condition that fails to evaluate (e.g. compares a string with a number)
+// is logged and counts as not holding.
+func Evaluate(req Request) (*config.PolicyRule, map[string]any) {
+	mu.RLock()
+	c := cfg
+	mu.RUnlock()
+	if c == nil || len(c.Policies) == 0 {
+		return nil, nil
+	}
+
+	attrs := policyAttributes(c, req, time.Now())
+	for i := range c.Policies {
+		rule := &c.Policies[i]
+		if rule.Expr == nil {
+			continue
+		}
+		ok, err := rule.Expr.Eval(attrs)
+		if err != nil {
+			logger.Warn("Policy condition failed to evaluate", "policy", rule.Name, "subsystem", req.Subsystem, "err", err)
+			continue
+		}
+		if ok {
+			return rule, attrs
+		}
+	}
+	return nil, attrs
+}
+
+// policyAttributes returns what policy conditions see of req: the update,
+// this host and the time
+func policyAttributes(c *config.Config, req Request, now time.Time) map[string]any {
+	repo, _ := c.Repo(req.Subsystem)
+	from, _ := checker.GetCurrentVersion(req.Subsystem)
+	// Commits don't say how much an update changes; the release tags do
+	installed, _ := checker.GetCurrentRelease(req.Subsystem)
+	release := req.Release
+	if release == "" && req.Trigger == TriggerPromote {
+		release = req.Target
+	}
+
+	// Name and labels as configured, also before the identity is created
+	hostname, _ := os.Hostname()
+	host := map[string]any{"hostname": hostname, "name": c.Identity.Name, "labels": c.Identity.Labels}
+	if host["name"] == "" {
+		host["name"] = hostname
+	}
+	if c.Identity.Labels == nil {
+		host["labels"] = map[string]string{}
+	}
+	host["id"] = identity.ID()
+
+	return map[string]any{
+		"subsystem":   req.Subsystem,
+		"repo":        repo.Repo,
+		"mode":        repo.Mode,
+		"trigger":     req.Trigger,
+		"from":        from,
+		"to":          req.Target,
+		"release":     req.Release,
+		"bump":        bump(installed, release),
+		"environment": c.Environment,
+		"host":        host,
+		"day":         now.Weekday().String(),
+		"hour":        now.Hour(),
+		"date":        now.Format(time.DateOnly),
+	}
+}
+
+// bump returns which part of the version an update from → to changes: major,
+// minor, patch or prerelease, or "" when either is not a version (e.g. a
+// branch head) or they are the same
+func bump(from, to string) string {
+	a, ok1 := semver.Parse(from)
+	b, ok2 := semver.Parse(to)
+	switch {
+	case !ok1 || !ok2:
+		return ""
+	case a.Major != b.Major:
+		return "major"
+	case a.Minor != b.Minor:
+		return "minor"
+	case a.Patch != b.Patch:
+		return "patch"
+	case a.Prerelease != b.Prerelease:
+		return "prerelease"
+	}
+	return ""
+}
+
+// policyFor returns the policy that applies to a detected update: that of
+// the first matching rule of policies:, else the repo's
+func policyFor(req Request) (string, *config.PolicyRule) {
+	if rule, _ := Evaluate(req); rule != nil {
+		attrs := []any{"policy", rule.Name, "subsystem", req.Subsystem, "trigger", req.Trigger, "action", rule.Action}
+		if rule.Message != "" {
+			attrs = append(attrs, "message", rule.Message)
+		}
+		logger.Info("Policy applies", attrs...)
+		return rule.Action, rule
+	}
+	return repoFor(req.Subsystem).Policy, nil
+}
@@ -0,0 +1,89 @@
+package updater
+
+import (
+	"path/filepath"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/diskspace"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// footprintWindow is how many recent successful updates of a subsystem its
+// disk estimate looks at
+const footprintWindow = 5
+
+// preflight checks the subsystem's filesystem has room for an update before
+// it starts: the most a recent successful update used, plus disk.reserve_bytes
+// It returns the free space found (0 when the check is off or failed to
+// read it), so the update's own use can be recorded.
+func preflight(subsystem string) (int64, error) {
+	need, reserve, ok := diskNeed(subsystem)
+	if !ok {
+		return 0, nil
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return 0, err
+	}
+
+	free, err := diskspace.Check(filepath.Join(root, subsystem), "the "+subsystem+" update", need, reserve)
+	if err != nil && syncerr.KindOf(err) != syncerr.DiskFull {
+		logger.Warn("Could not check free disk space", "subsystem", subsystem, "err", err)
+		return 0, nil
+	}
+	return free, err
+}
+
+// diskNeed returns the space an update of the subsystem is estimated to take
+// and the reserve to keep on top, or false with disk checks off
+func diskNeed(subsystem string) (int64, int64, bool) {
+	mu.RLock()
+	disk := config.DiskConfig{ReserveBytes: config.DefaultDiskReserve}
+	if cfg != nil {
+		disk = cfg.Disk
+	}
+	mu.RUnlock()
+	if disk.Disabled {
+		return 0, 0, false
+	}
+	return footprint(subsystem), disk.ReserveBytes, true
+}
+
+// footprint returns the most free space one of the subsystem's recent
+// successful updates used up (0 without any recorded)
+func footprint(subsystem string) int64 {
+	entries, err := history.Load()
+	if err != nil {
+		return 0
+	}
+	var most int64
+	seen := 0
+	for i := len(entries) - 1; i >= 0 && seen < footprintWindow; i-- {
+		e := entries[i]
+		if e.Subsystem != subsystem || !e.Success || e.Disk == 0 {
+			continue
+		}
+		most = max(most, e.Disk)
+		seen++
+	}
+	return most
+}
+
+// used returns how much of the free space found before an update it took up
+func used(subsystem string, before int64) int64 {
+	if before == 0 {
+		return 0
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return 0
+	}
+	after, err := diskspace.Free(filepath.Join(root, subsystem))
+	if err != nil || after >= before {
+		return 0
+	}
+	logger.Info("Update used disk space", "subsystem", subsystem, "used", versions.FormatBytes(before-after))
+	return before - after
+}
@@ -0,0 +1,136 @@
+package updater
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+)
+
+// Update phases, in the order they run
+const (
+	PhaseSnapshot = "snapshot" // snapshot or back up the data dir
+	PhaseBuild    = "build"    // task sync:update: pull, build
+	PhaseDownload = "download" // promoted release or release asset: download and verify
+	PhaseScan     = "scan"     // run the scanners over the new build
+	PhaseValidate = "validate" // validate the subsystem's configs against the new version before installing it
+	PhaseInstall  = "install"  // install under .bin/versions/ and activate
+	PhaseRender   = "render"   // put the configs rendered for the installed version in place
+	PhaseRestart  = "restart"  // restart the subsystem's processes through the Process Compose API
+	PhaseMigrate  = "migrate"
+	PhaseHealth   = "health"
+)
+
+// tracker publishes the phases of one update as progress events
+type tracker struct {
+	req    Request
+	phases []string
+}
+
+// newTracker lists the phases req will go through for repo
+func newTracker(req Request, repo config.RepoConfig) *tracker {
+	t := &tracker{req: req}
+	if repo.Snapshot.Method != "" || len(repo.Migrations) > 0 {
+		t.phases = append(t.phases, PhaseSnapshot)
+	}
+	if req.Trigger == TriggerPromote || repo.Strategy == config.StrategyArtifact {
+		t.phases = append(t.phases, PhaseDownload)
+	} else {
+		t.phases = append(t.phases, PhaseBuild)
+	}
+	if len(scannersFor(repo.Subsystem)) > 0 {
+		t.phases = append(t.phases, PhaseScan)
+	}
+	if len(repo.Configs) > 0 {
+		t.phases = append(t.phases, PhaseValidate)
+	}
+	t.phases = append(t.phases, PhaseInstall)
+	if repo.Rendered() {
+		t.phases = append(t.phases, PhaseRender)
+	}
+	t.phases = append(t.phases, PhaseRestart)
+	if len(repo.Migrations) > 0 {
+		t.phases = append(t.phases, PhaseMigrate)
+	}
+	if repo.Health {
+		t.phases = append(t.phases, PhaseHealth)
+	}
+	return t
+}
+
+// phase announces that phase has started
+func (t *tracker) phase(phase string) {
+	t.publish(phase, 0, "")
+}
+
+// publish sends a progress event for phase, if the update goes through it
+func (t *tracker) publish(phase string, percent int, detail string) {
+	i := slices.Index(t.phases, phase)
+	if i < 0 {
+		return
+	}
+	events.Publish(events.Event{
+		Type:      events.UpdateProgress,
+		Subsystem: t.req.Subsystem,
+		Trigger:   t.req.Trigger,
+		Phase:     phase,
+		Step:      i + 1,
+		Steps:     len(t.phases),
+		Percent:   percent,
+		Detail:    detail,
+	})
+}
+
+// percentPattern finds the progress git and most download tools print,
+// e.g. "Receiving objects:  40% (120/300)"
+var percentPattern = regexp.MustCompile(`(\d{1,3})%`)
+
+// outputWriter collects the output of a phase's command and reports the
+// percentages it prints as they change
+// Lines end in \n or, for progress redrawn in place, \r.
+type outputWriter struct {
+	tracker *tracker
+	phase   string
+	output  bytes.Buffer
+	line    []byte
+	last    int
+}
+
+func (w *outputWriter) Write(b []byte) (int, error) {
+	w.output.Write(b)
+	for _, c := range b {
+		if c != '\n' && c != '\r' {
+			w.line = append(w.line, c)
+			continue
+		}
+		w.report(string(w.line))
+		w.line = w.line[:0]
+	}
+	return len(b), nil
+}
+
+// report publishes a line's percentage if it moved on from the last one
+// A lower percentage starts a new counter, e.g. "Resolving deltas" after
+// "Receiving objects".
+func (w *outputWriter) report(line string) {
+	m := percentPattern.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	percent, _ := strconv.Atoi(m[1])
+	if percent == w.last || percent > 100 {
+		return
+	}
+	w.last = percent
+	w.tracker.publish(w.phase, percent, redact.String(strings.TrimSpace(line)))
+}
+
+// Bytes returns everything the command wrote
+func (w *outputWriter) Bytes() []byte {
+	return w.output.Bytes()
+}
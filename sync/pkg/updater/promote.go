@@ -0,0 +1,117 @@
+package updater
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/promote"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// promotedEnvironment returns this host's environment if it installs
+// promoted releases instead of building upstream changes
+func promotedEnvironment() (string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg == nil || !cfg.Promoted() {
+		return "", false
+	}
+	return cfg.Environment, true
+}
+
+// Reconcile queues an update for every subsystem whose active version differs
+// from the release promoted into this host's environment
+// Releases already queued keep their place and retry schedule; rules of
+// policies: other than auto hold a release back, the repo's policy does not.
+func Reconcile() {
+	env, promoted := promotedEnvironment()
+	if !promoted {
+		return
+	}
+	releases, err := promote.List(env)
+	if err != nil {
+		logger.Warn("Could not read the promoted releases", "environment", env, "err", err)
+		return
+	}
+	for _, r := range releases {
+		req := Request{Subsystem: r.Subsystem, Trigger: TriggerPromote, Target: r.Version}
+		if active, _ := versions.Active(r.Subsystem); active != r.Version && !waiting(req) {
+			logger.Info("Promoted release differs from the active version", "subsystem", r.Subsystem, "active", orUnknown(active), "environment", env, "release", revision.Short(r.Version), "from", r.From)
+			if action, rule := policyFor(req); rule != nil && action != config.PolicyAuto {
+				// Nothing to approve or announce: the release stays promoted and
+				// installs on the next reconcile the policy allows
+				logger.Info("Not installing now; retried with the next release or restart", "subsystem", r.Subsystem, "release", revision.Short(r.Version), "policy", rule.Name)
+				continue
+			}
+			Enqueue(req)
+		}
+	}
+}
+
+// installRelease installs and activates the exact build promoted into this
+// host's environment, reusing an installed copy whose files match, else
+// fetching it with task <subsystem>:bin:download VERSION=<version>
+// The download goes to the staging dir bin; one whose files differ from the
+// promoted ones is discarded instead of installed.
+func installRelease(subsystem, version, bin string, t *tracker) ([]byte, error) {
+	env, promoted := promotedEnvironment()
+	if !promoted {
+		return nil, fmt.Errorf("this host is not in a promoted environment")
+	}
+	r, found, err := promote.Get(env, subsystem)
+	if err != nil {
+		return nil, err
+	}
+	if !found || !revision.Same(r.Version, version) {
+		return nil, fmt.Errorf("%s %s is not the release promoted into %s", subsystem, version, env)
+	}
+
+	if dir, err := versions.Dir(subsystem, version); err == nil {
+		if files, err := versions.Digests(dir); err == nil && maps.Equal(files, r.Files) {
+			logger.Info("Reusing installed version", "subsystem", subsystem, "version", revision.Short(version), "from", r.From)
+			return nil, versions.Activate(subsystem, version)
+		}
+	}
+
+	cmd := exec.Command("task", subsystem+":bin:download", "VERSION="+version)
+	cmd.Env = append(os.Environ(), "SYNC_STAGING_DIR="+bin)
+	out := &outputWriter{tracker: t, phase: PhaseDownload}
+	cmd.Stdout, cmd.Stderr = out, out
+	err = cmd.Run()
+	output := out.Bytes()
+	if err != nil {
+		return output, fmt.Errorf("download of %s %s failed: %w", subsystem, version, err)
+	}
+
+	files, err := versions.Digests(bin)
+	if info, ierr := checker.ReadVersionFile(filepath.Join(bin, ".version")); err == nil && ierr == nil {
+		err = info.CheckPlatform()
+	}
+	if err == nil && !maps.Equal(files, r.Files) {
+		err = syncerr.Wrap(syncerr.ChecksumMismatch, fmt.Errorf("downloaded %s %s differs from the build that soaked in %s", subsystem, version, r.From))
+	}
+	if err != nil {
+		discard(bin, files)
+		return output, err
+	}
+
+	// The matching digests include .version, so this installs as version
+	_, err = versions.Install(subsystem)
+	return output, err
+}
+
+// discard removes the files of a rejected download from the staging dir
+func discard(bin string, files map[string]string) {
+	for name := range files {
+		if err := os.Remove(filepath.Join(bin, name)); err != nil {
+			logger.Warn("Failed to remove a rejected download", "file", name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// idleWait is how long an idle worker sleeps when nothing is scheduled
+const idleWait = time.Hour
+
+// freezeRecheck is how often a job held by an update freeze checks for the thaw
+const freezeRecheck = time.Minute
+
+// Job is an update in the daemon's queue
+type Job struct {
+	Request   Request   `json:"request"`
+	Attempts  int       `json:"attempts"` // failed attempts so far
+	Enqueued  time.Time `json:"enqueued"`
+	NextAt    time.Time `json:"nextAt"` // earliest time the next attempt may start
+	LastError string    `json:"lastError,omitempty"`
+	Next      *Request  `json:"next,omitempty"`   // trigger that arrived while the job was running
+	Started   time.Time `json:"started,omitzero"` // start of the running attempt; zero while waiting
+
+	running bool
+}
+
+// queue runs the daemon's updates on a bounded pool of workers
+// Jobs are deduplicated per subsystem and persisted under
+// <daemon>/<subsystem>, so retries survive a restart of the daemon.
+type queue struct {
+	cfg     config.QueueConfig
+	daemon  string
+	wake    chan struct{}
+	stop    chan struct{} // closed by StopQueue
+	workers sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+var (
+	queueMu sync.RWMutex
+	active  *queue
+)
+
+// StartQueue starts the update queue workers for a daemon
+// and resumes the jobs it left queued or retrying when it last stopped.
+// Without a running queue, Enqueue runs updates synchronously.
+func StartQueue(cfg config.QueueConfig, daemon string) {
+	q := &queue{
+		cfg:    cfg,
+		daemon: daemon,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		jobs:   make(map[string]*Job),
+	}
+
+	prefix := daemon + "/"
+	err := state.ForEach(state.BucketQueue, func(key string, data []byte) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		var j Job
+		if err := json.Unmarshal(data, &j); err != nil {
+			return err
+		}
+		j.Started = time.Time{} // the attempt that was running died with the daemon
+		q.jobs[j.Request.Subsystem] = &j
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Could not restore queued updates", "err", err)
+	}
+	if len(q.jobs) > 0 {
+		logger.Info("Resuming queued updates", "queued", len(q.jobs))
+	}
+
+	queueMu.Lock()
+	active = q
+	queueMu.Unlock()
+
+	for i := 0; i < cfg.Concurrency; i++ {
+		q.workers.Go(q.work)
+	}
+	q.publishQueue()
+	q.signal()
+}
+
+// StopQueue stops the queue workers once their running updates end, waiting
+// for them until ctx is done
+// Jobs still queued stay persisted (and triggers arriving now are persisted
+// too) for the daemon's next start to resume.
+func StopQueue(ctx context.Context) error {
+	queueMu.RLock()
+	q := active
+	queueMu.RUnlock()
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	select {
+	case <-q.stop:
+	default:
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var running []string
+	for subsystem, j := range q.jobs {
+		if j.running {
+			running = append(running, subsystem)
+		}
+	}
+	sort.Strings(running)
+	return fmt.Errorf("%d update(s) still running: %s", len(running), strings.Join(running, ", "))
+}
+
+// Enqueue adds an update to the daemon's queue, bypassing the approval policy
+// A queued, not yet running update for the same subsystem is replaced; one
+// that arrives while the subsystem is updating runs once that attempt ends.
+func Enqueue(req Request) error {
+	queueMu.RLock()
+	q := active
+	queueMu.RUnlock()
+	if q == nil || DryRun() {
+		return Run(req)
+	}
+	q.add(req)
+	q.publishQueue()
+	return nil
+}
+
+// waiting reports whether req is already in the daemon's queue
+func waiting(req Request) bool {
+	queueMu.RLock()
+	q := active
+	queueMu.RUnlock()
+	if q == nil {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j := q.jobs[req.Subsystem]
+	return j != nil && (j.Request == req || (j.Next != nil && *j.Next == req))
+}
+
+// add queues req, coalescing it with any job for the same subsystem
+func (q *queue) add(req Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	j := q.jobs[req.Subsystem]
+	switch {
+	case j == nil:
+		j = &Job{Request: req, Enqueued: now, NextAt: now}
+		q.jobs[req.Subsystem] = j
+		logger.Info("Queued update", "subsystem", req.Subsystem, "trigger", req.Trigger)
+	case j.running:
+		j.Next = &req
+		logger.Info("Update already running; trigger will run after it", "subsystem", req.Subsystem, "trigger", req.Trigger)
+	default:
+		j.Request, j.Attempts, j.NextAt, j.LastError = req, 0, now, ""
+		logger.Info("Coalesced trigger into the queued update", "subsystem", req.Subsystem, "trigger", req.Trigger)
+	}
+	q.save(j)
+	q.signal()
+}
+
+// work runs due jobs until the queue is stopped
+func (q *queue) work() {
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+		j, wait := q.take()
+		if j == nil {
+			select {
+			case <-q.wake:
+			case <-time.After(wait):
+			case <-q.stop:
+				return
+			}
+			continue
+		}
+		// Let another idle worker look for a second due job
+		q.signal()
+		q.publishQueue()
+		q.finish(j, Run(j.Request))
+		q.publishQueue()
+	}
+}
+
+// take claims the due job that has waited longest, or reports how long
+// until the next one is due
+func (q *queue) take() (*Job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due *Job
+	for _, j := range q.jobs {
+		if !j.running && (due == nil || j.NextAt.Before(due.NextAt)) {
+			due = j
+		}
+	}
+	if due == nil {
+		return nil, idleWait
+	}
+	if wait := time.Until(due.NextAt); wait > 0 {
+		return nil, wait
+	}
+	due.running, due.Started = true, time.Now()
+	q.save(due)
+	return due, 0
+}
+
+// finish schedules a retry for a failed job, or removes a completed one
+func (q *queue) finish(j *Job, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j.running, j.Started = false, time.Time{}
+	subsystem := j.Request.Subsystem
+	switch {
+	case j.Next != nil:
+		// A newer trigger supersedes the attempt that just ended
+		j.Request, j.Next = *j.Next, nil
+		j.Attempts, j.NextAt, j.LastError = 0, time.Now(), ""
+	case errors.Is(err, ErrFrozen):
+		// Held, not failed: the job keeps its retries for after the thaw
+		j.NextAt = time.Now().Add(freezeRecheck)
+		j.LastError = redact.String(err.Error())
+	case err != nil && j.Attempts < q.cfg.Retries:
+		j.Attempts++
+		delay := q.backoff(j.Attempts)
+		j.NextAt = time.Now().Add(delay)
+		j.LastError = redact.String(err.Error())
+		logger.Warn("Retrying update", "subsystem", subsystem, "wait", delay, "attempt", j.Attempts, "retries", q.cfg.Retries)
+	default:
+		if err != nil && q.cfg.Retries > 0 {
+			logger.Error("Giving up on update", "subsystem", subsystem, "retries", j.Attempts)
+		}
+		delete(q.jobs, subsystem)
+		if _, derr := state.Delete(state.BucketQueue, q.key(subsystem)); derr != nil {
+			logger.Warn("Failed to remove queued update", "subsystem", subsystem, "err", derr)
+		}
+		return
+	}
+	q.save(j)
+	q.signal()
+}
+
+// backoff returns the delay before retry n: backoff doubled per retry, capped
+func (q *queue) backoff(n int) time.Duration {
+	delay := q.cfg.Backoff
+	for i := 1; i < n && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, q.cfg.MaxBackoff)
+}
+
+// save persists a job so it survives a restart
+func (q *queue) save(j *Job) {
+	if err := state.Put(state.BucketQueue, q.key(j.Request.Subsystem), j); err != nil {
+		logger.Warn("Failed to persist queued update", "subsystem", j.Request.Subsystem, "err", err)
+	}
+}
+
+// key is the state store key of a subsystem's job
+func (q *queue) key(subsystem string) string {
+	return q.daemon + "/" + subsystem
+}
+
+// signal wakes an idle worker
+func (q *queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
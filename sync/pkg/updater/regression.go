@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/regression"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// watches tracks the regression watches still running
+var watches sync.WaitGroup
+
+// watchRegression watches a subsystem's metrics for the regression window
+// after it was updated to version to, and rolls the update back if one of
+// them regresses
+func watchRegression(subsystem, to string, cfg config.RegressionConfig) {
+	if !cfg.Enabled() {
+		return
+	}
+	logger.Info("Watching for a regression before trusting the update", "subsystem", subsystem, "version", revision.Short(to), "metrics", len(cfg.Metrics), "window", cfg.Window)
+
+	watches.Add(1)
+	go func() {
+		defer watches.Done()
+		err := regression.Watch(context.Background(), cfg, func(m config.RegressionMetric, err error) {
+			logger.Warn("Could not read metric", "subsystem", subsystem, "metric", m.Name, "err", err)
+		})
+		var reg *regression.Regression
+		switch {
+		case err == nil:
+			logger.Info("No regression after the update", "subsystem", subsystem, "version", revision.Short(to))
+			return
+		case !errors.As(err, &reg):
+			logger.Warn("Regression watch ended early; not rolling back", "subsystem", subsystem, "version", revision.Short(to), "err", err)
+			return
+		}
+
+		// A later update or a manual rollback owns the subsystem now
+		if active, _ := versions.Active(subsystem); active != to {
+			logger.Warn("Regression, but the version is no longer active; not rolling back", "subsystem", subsystem, "version", revision.Short(to), "regression", reg.Error())
+			return
+		}
+
+		logger.Warn("Regression after the update; rolling back", "subsystem", subsystem, "version", revision.Short(to), "regression", reg.Error())
+		events.Publish(events.Event{
+			Type:      events.UpdateRegressed,
+			Subsystem: subsystem,
+			From:      to,
+			Trigger:   TriggerRegression,
+			Error:     reg.Error(),
+		})
+		if _, err := rollback(subsystem, "", cfg.Restart, TriggerRegression); err != nil {
+			logger.Error("Automatic rollback failed", "subsystem", subsystem, "err", err)
+		}
+	}()
+}
+
+// WaitForWatches blocks until the regression watches of the updates this
+// process ran are over, so a one-off `sync update` sees its update through
+func WaitForWatches() {
+	watches.Wait()
+}
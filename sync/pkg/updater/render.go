@@ -0,0 +1,262 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/identity"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/render"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// validateTimeout bounds the validate command of one config; telegraf --test
+// gathers its inputs once
+const validateTimeout = time.Minute
+
+// RenderedConfig is a config rendered for, or checked against, a version
+type RenderedConfig struct {
+	Output   string `json:"output"`             // relative to the project root
+	Template string `json:"template,omitempty"` // "" for a config maintained by hand
+	Release  string `json:"release,omitempty"`  // the version it was rendered for
+	Changed  bool   `json:"changed"`            // differs from the config in place
+	Error    string `json:"error,omitempty"`    // why it failed to render or was rejected
+}
+
+// RenderConfigs renders the configs of a subsystem for its installed version
+// and writes those that changed, once every one passed validation
+// With dryRun nothing is written; with restart, the subsystem's processes
+// restart if a config changed.
+func RenderConfigs(subsystem string, dryRun, restart bool) ([]RenderedConfig, error) {
+	lock, err := lockSubsystem(subsystem)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	repo := repoFor(subsystem)
+	if len(repo.Configs) == 0 {
+		return nil, syncerr.Wrap(syncerr.ConfigInvalid, fmt.Errorf("%s has no configs to render or check", subsystem))
+	}
+	rendered, err := renderConfigs(repo, "", dryRun)
+	if err != nil || dryRun || !restart {
+		return rendered, err
+	}
+	for _, r := range rendered {
+		if r.Changed {
+			return rendered, restartProcesses(repo)
+		}
+	}
+	return rendered, nil
+}
+
+// renderConfigs renders and validates the configs of repo against the
+// staged or active version, then replaces the changed ones
+// release is used when the binary doesn't print its version.
+func renderConfigs(repo config.RepoConfig, release string, dryRun bool) ([]RenderedConfig, error) {
+	staged, err := stageConfigs(repo, release)
+	defer staged.discard()
+	if err != nil {
+		return staged.configs, err
+	}
+	return staged.configs, staged.commit(dryRun)
+}
+
+// stagedConfigs are the configs of a subsystem rendered next to the ones in
+// place and accepted by the staged or active version, waiting to replace them
+type stagedConfigs struct {
+	root      string
+	subsystem string
+	configs   []RenderedConfig
+	paths     []string // the staged copy of each config
+}
+
+// stageConfigs renders the configs of repo to <output>.new, copies those
+// maintained by hand likewise, and validates every copy with the staged
+// build (versions.Staged): during an update, the new version before it is
+// installed; otherwise the active one
+// Nothing is replaced unless all of them pass, so a version that rejects its
+// config is never switched to and never starts with half of it updated. The
+// error lists the verdict on each config.
+func stageConfigs(repo config.RepoConfig, release string) (*stagedConfigs, error) {
+	s := &stagedConfigs{subsystem: repo.Subsystem}
+	if len(repo.Configs) == 0 {
+		return s, nil
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return s, err
+	}
+	s.root = root
+	bin, err := versions.Staged(repo.Subsystem)
+	if err != nil {
+		return s, err
+	}
+	data, vars := renderData(repo, bin, release)
+	dir := filepath.Join(root, repo.Subsystem)
+
+	rejected := 0
+	for _, t := range repo.Configs {
+		output := filepath.Join(root, t.Output)
+		old, oerr := os.ReadFile(output)
+		content := old
+		if t.Template != "" {
+			data.Vars = render.Vars(vars, t.Vars)
+			if content, err = render.Execute(filepath.Join(root, t.Template), data); err != nil {
+				err = fmt.Errorf("failed to render: %w", err)
+			}
+		} else if oerr != nil {
+			logger.Warn("Not checking config", "config", t.Output, "err", oerr)
+			continue
+		}
+
+		// Validate a copy next to the config, so relative includes resolve alike
+		r := RenderedConfig{Output: t.Output, Template: t.Template, Release: data.Release, Changed: !bytes.Equal(old, content)}
+		path := output + ".new"
+		if err == nil {
+			mode := os.FileMode(0o644)
+			if info, serr := os.Stat(output); serr == nil {
+				mode = info.Mode().Perm()
+			}
+			if err = os.WriteFile(path, content, mode); err != nil {
+				return s, fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			s.paths = append(s.paths, path)
+			err = validateConfig(dir, bin, t.Validate, path)
+		} else {
+			s.paths = append(s.paths, "")
+		}
+		if err != nil {
+			r.Error = err.Error()
+			rejected++
+		}
+		s.configs = append(s.configs, r)
+	}
+	if rejected > 0 {
+		return s, syncerr.Wrap(syncerr.ConfigRejected, s.report(rejected))
+	}
+	return s, nil
+}
+
+// report explains which configs the version rejected, one line per config
+func (s *stagedConfigs) report(rejected int) error {
+	var b strings.Builder
+	release := ""
+	if len(s.configs) > 0 {
+		release = s.configs[0].Release
+	}
+	fmt.Fprintf(&b, "%s %s rejects %d of %d config(s)", s.subsystem, orUnknown(release), rejected, len(s.configs))
+	for _, r := range s.configs {
+		if r.Error == "" {
+			fmt.Fprintf(&b, "\n  ✅ %s", r.Output)
+			continue
+		}
+		fmt.Fprintf(&b, "\n  ❌ %s: %s", r.Output, strings.ReplaceAll(strings.TrimSpace(r.Error), "\n", "\n     "))
+	}
+	return errors.New(b.String())
+}
+
+// commit replaces the configs that changed with their staged copies
+func (s *stagedConfigs) commit(dryRun bool) error {
+	for i, r := range s.configs {
+		switch {
+		case !r.Changed && r.Template == "":
+			logger.Info("Config passes", "config", r.Output, "subsystem", s.subsystem, "release", orUnknown(r.Release))
+		case !r.Changed:
+			logger.Info("Config is up to date", "config", r.Output, "subsystem", s.subsystem, "release", orUnknown(r.Release))
+		case dryRun:
+			logger.Info("Dry run: would render config", "config", r.Output, "subsystem", s.subsystem, "release", orUnknown(r.Release))
+		default:
+			if err := os.Rename(s.paths[i], filepath.Join(s.root, r.Output)); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", r.Output, err)
+			}
+			logger.Info("Rendered config", "config", r.Output, "subsystem", s.subsystem, "release", orUnknown(r.Release))
+		}
+	}
+	return nil
+}
+
+// discard removes the staged copies that were not committed
+func (s *stagedConfigs) discard() {
+	for _, path := range s.paths {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
+}
+
+// rerender renders the configs of a subsystem after another version was
+// activated, e.g. by a rollback
+// The switch has already happened, so a config the version rejects is left
+// as it was rather than failing it.
+func rerender(subsystem string) {
+	if _, err := renderConfigs(repoFor(subsystem), "", false); err != nil {
+		logger.Warn("Keeping the configs as they were", "subsystem", subsystem, "err", err)
+	}
+}
+
+// renderData returns what the config templates of repo see, for the version
+// in bin, and the vars of sync.yaml the configs' own overlay
+func renderData(repo config.RepoConfig, bin, release string) (render.Data, map[string]any) {
+	data := render.Data{Subsystem: repo.Subsystem, Release: release}
+	if info, err := checker.ReadVersionFile(filepath.Join(bin, ".version")); err == nil {
+		data.Version = info.Commit
+	}
+	if _, v := Probe(filepath.Join(bin, repo.Binary())); v != "" {
+		data.Release = v
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	data.Host.Hostname, _ = os.Hostname()
+	data.Host.ID = identity.ID()
+	data.Host.Name = data.Host.Hostname
+	if cfg == nil {
+		return data, nil
+	}
+	data.Environment = cfg.Environment
+	if cfg.Identity.Name != "" {
+		data.Host.Name = cfg.Identity.Name
+	}
+	data.Host.Labels = cfg.Identity.Labels
+	return data, cfg.Vars
+}
+
+// validateConfig runs a config's validate command on the staged copy at path
+// The command runs in the subsystem dir, with .bin/ in it standing for bin,
+// where the version being checked is.
+func validateConfig(dir, bin, command, path string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil
+	}
+	for i := range args {
+		args[i] = strings.ReplaceAll(args[i], "{file}", path)
+		if rest, ok := strings.CutPrefix(args[i], ".bin/"); ok {
+			args[i] = filepath.Join(bin, rest)
+		}
+	}
+	if !filepath.IsAbs(args[0]) && strings.ContainsAny(args[0], `/\`) {
+		args[0] = filepath.Join(dir, args[0])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.WaitDelay = time.Second
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w\n%s", command, err, redact.Bytes(output))
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/processes"
+)
+
+// restartTimeout bounds restarting the processes of one subsystem
+const restartTimeout = 30 * time.Second
+
+// restartProcesses restarts the process-compose processes of a subsystem so
+// they run its new binary, leaving the rest of the stack running
+// Without process-compose running there is nothing to restart: the
+// processes start with the new binary along with the stack.
+func restartProcesses(repo config.RepoConfig) error {
+	names := repo.Processes
+	if len(names) == 0 {
+		names = []string{repo.Subsystem}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, name := range names {
+		err := processes.Restart(ctx, name)
+		switch {
+		case errors.Is(err, processes.ErrNotRunning):
+			logger.Info("process-compose is not running; the subsystem starts with the new binary along with the stack", "subsystem", repo.Subsystem)
+			return nil
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to restart process %s of %s: %w", name, repo.Subsystem, err))
+		default:
+			logger.Info("Restarted process", "subsystem", repo.Subsystem, "process", name)
+		}
+	}
+	return errors.Join(errs...)
+}
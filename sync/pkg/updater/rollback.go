@@ -0,0 +1,86 @@
+package updater
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// Rollback switches a subsystem back to an installed version and records it in the ledger
+// With to == "", the version installed before the active one is used. With
+// restart, the subsystem's processes are restarted so they run the restored
+// binary.
+func Rollback(subsystem, to string, restart bool) (history.Entry, error) {
+	return rollback(subsystem, to, restart, TriggerRollback)
+}
+
+// rollback switches versions as Rollback, recording trigger in the ledger
+func rollback(subsystem, to string, restart bool, trigger string) (history.Entry, error) {
+	// Never switch versions under a running update
+	lock, err := lockSubsystem(subsystem)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	defer lock.Release()
+
+	from, _ := versions.Active(subsystem)
+	if to == "" {
+		previous, err := versions.Previous(subsystem)
+		if err != nil {
+			return history.Entry{}, err
+		}
+		to = previous
+	} else if to, err = versions.Resolve(subsystem, to); err != nil {
+		return history.Entry{}, err
+	}
+
+	start := time.Now()
+	metrics.UpdateTriggered(subsystem, trigger)
+
+	err = func() error {
+		if err := versions.Activate(subsystem, to); err != nil {
+			return err
+		}
+		logger.Info("Rolled back", "subsystem", subsystem, "from", revision.Short(from), "to", revision.Short(to))
+		rerender(subsystem)
+
+		if restart {
+			return restartProcesses(repoFor(subsystem))
+		}
+		return nil
+	}()
+
+	entry := history.Entry{
+		Time:      start,
+		Subsystem: subsystem,
+		From:      from,
+		Trigger:   trigger,
+		Success:   err == nil,
+		Duration:  time.Since(start),
+	}
+	if err != nil {
+		entry.Error = redact.String(err.Error())
+		entry.ErrorKind = syncerr.KindOf(err)
+	} else {
+		entry.To = to
+	}
+
+	status.RecordUpdate(entry)
+	metrics.UpdateFinished(subsystem, entry.Success, entry.Duration)
+	publishResult(entry, nil)
+	if herr := history.Append(entry); herr != nil {
+		logger.Warn("Failed to record history", "subsystem", subsystem, "err", herr)
+	}
+
+	if err != nil {
+		return entry, fmt.Errorf("rollback failed for %s: %w", subsystem, err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,133 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// maxAuditDetail is how much of a scanner's verdict the audit log keeps; the
+// update's history entry has all of it
+const maxAuditDetail = 500
+
+// scannersFor returns the scanners that check builds of subsystem
+func scannersFor(subsystem string) []config.ScannerConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg == nil {
+		return nil
+	}
+	var list []config.ScannerConfig
+	for _, s := range cfg.Scanners {
+		if s.Scans(subsystem) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// scanBuild runs the scanners of subsystem over the files its build or
+// download staged, before they are installed
+// Each scanner's verdict is recorded in the audit log. The first file a
+// scanner rejects, or can't scan, fails the update with scan_failed and the
+// new files are deleted rather than left to be installed; a
+// promoted release reused from .bin/versions/ brings no new files and was
+// scanned when it was first installed.
+func scanBuild(subsystem string, scanners []config.ScannerConfig) error {
+	fresh, err := versions.Fresh(subsystem)
+	if err != nil || len(fresh) == 0 {
+		return err
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return err
+	}
+	bin, err := versions.Staged(subsystem)
+	if err != nil {
+		return err
+	}
+	info, _ := checker.ReadVersionFile(filepath.Join(bin, ".version"))
+	build := fmt.Sprintf("%s %s", subsystem, orUnknown(info.Commit))
+
+	for _, s := range scanners {
+		err := runScanner(s, root, bin, fresh)
+		detail := fmt.Sprintf("%s: %s passed %d file(s)", build, s.Name, len(fresh))
+		if err != nil {
+			detail = fmt.Sprintf("%s: %s rejected the build: %s", build, s.Name, oneLine(err.Error(), maxAuditDetail))
+		}
+		if aerr := audit.Append(audit.Entry{Action: audit.ActionScan, Actor: audit.Actor(), Detail: detail}); aerr != nil {
+			logger.Warn("Failed to record the scan in the audit log", "scanner", s.Name, "subsystem", subsystem, "err", aerr)
+		}
+		if err != nil {
+			discardBuild(bin, fresh)
+			return syncerr.Wrap(syncerr.ScanFailed, fmt.Errorf("%s rejects %s, not installing it: %w", s.Name, build, err))
+		}
+		logger.Info("Scan passed", "scanner", s.Name, "subsystem", subsystem, "version", orUnknown(info.Commit), "files", len(fresh))
+	}
+	return nil
+}
+
+// runScanner runs one scanner over each file, from the project root, within
+// its timeout for all of them
+func runScanner(s config.ScannerConfig, root, bin string, files []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	for _, name := range files {
+		path := filepath.Join(bin, name)
+		args := strings.Fields(s.Command)
+		for i := range args {
+			args[i] = strings.ReplaceAll(args[i], "{file}", path)
+		}
+		if !filepath.IsAbs(args[0]) && strings.ContainsAny(args[0], `/\`) {
+			args[0] = filepath.Join(root, args[0])
+		}
+
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Dir = root
+		cmd.WaitDelay = time.Second
+		output, err := cmd.CombinedOutput()
+		output = redact.Bytes(output)
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return fmt.Errorf("%s: timed out after %s", name, s.Timeout)
+		case err != nil:
+			return fmt.Errorf("%s: %w\n%s", name, err, strings.TrimSpace(string(output)))
+		case s.FailOnOutput && len(strings.TrimSpace(string(output))) > 0:
+			return fmt.Errorf("%s: %w\n%s", name, errFinding, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// discardBuild deletes the files of a rejected build from where it was staged
+func discardBuild(bin string, files []string) {
+	for _, name := range files {
+		if err := os.Remove(filepath.Join(bin, name)); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to delete a file of the rejected build", "file", name, "err", err)
+		}
+	}
+}
+
+// oneLine joins the lines of s with "; " and cuts it to about n bytes
+func oneLine(s string, n int) string {
+	s = strings.Join(strings.Fields(strings.ReplaceAll(s, "\n", "; ")), " ")
+	if len(s) > n {
+		s = strings.ToValidUTF8(s[:n], "") + "…"
+	}
+	return s
+}
+
+// errFinding is a scanner's output read as a finding (fail_on_output)
+var errFinding = errors.New("reported a finding")
@@ -0,0 +1,348 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/audit"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/state"
+)
+
+// Release train states
+const (
+	TrainCollecting = "collecting" // boarding detected updates until it departs
+	TrainReady      = "ready"      // departed; waiting for sync train approve
+	TrainRolling    = "rolling"    // approved; its updates are running in order
+	TrainDone       = "done"       // every update ran
+	TrainFailed     = "failed"     // an update failed; the ones after it did not run
+	TrainRejected   = "rejected"   // discarded by sync train reject
+)
+
+// Outcomes of the updates of a train
+const (
+	TrainUpdateApplied = "applied"
+	TrainUpdateFailed  = "failed"
+	TrainUpdateSkipped = "skipped" // not run: an update before it failed
+)
+
+// trainCheck is how often the daemons look for a train due to depart
+const trainCheck = time.Minute
+
+// Train is a release train: the updates detected over a period, rolled out
+// together in order with a single approval
+type Train struct {
+	Name       string          `json:"name"` // train-<date it opened>, e.g. train-2024-06-03
+	State      string          `json:"state"`
+	Opened     time.Time       `json:"opened"`
+	Departs    time.Time       `json:"departs"`              // when it stops collecting
+	Departed   time.Time       `json:"departed,omitzero"`    // when it stopped collecting
+	ApprovedBy string          `json:"approvedBy,omitempty"` // or rejected by
+	Finished   time.Time       `json:"finished,omitzero"`
+	Updates    []PendingUpdate `json:"updates"` // in rollout order
+	Results    []TrainResult   `json:"results,omitempty"`
+}
+
+// TrainResult is how one update of an approved train went
+type TrainResult struct {
+	Subsystem string `json:"subsystem"`
+	Outcome   string `json:"outcome"` // applied, failed or skipped
+	Error     string `json:"error,omitempty"`
+}
+
+// trainMu serializes changes to the trains of this process
+var trainMu sync.Mutex
+
+// trainConfig returns the train settings and the subsystems in repos order
+func trainConfig() (config.TrainConfig, []string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg == nil {
+		return config.TrainConfig{}, nil
+	}
+	var subsystems []string
+	for _, r := range cfg.Repos {
+		subsystems = append(subsystems, r.Subsystem)
+	}
+	return cfg.Train, subsystems
+}
+
+// board adds a detected update to the collecting train, opening one if there
+// is none; a newer update of a subsystem replaces the one on board
+func board(req Request) error {
+	tc, subsystems := trainConfig()
+	from, _ := checker.GetCurrentVersion(req.Subsystem)
+	if DryRun() {
+		logger.Info("Dry run: would add the update to the release train", "subsystem", req.Subsystem, "from", orUnknown(from), "to", orUnknown(req.Target))
+		return nil
+	}
+	compat := compatibility(req.Subsystem, from, req.Target)
+
+	trainMu.Lock()
+	defer trainMu.Unlock()
+	t, err := collecting()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		now := time.Now()
+		t = &Train{State: TrainCollecting, Opened: now, Departs: now.Add(tc.Period)}
+		if t.Name, err = trainName(now); err != nil {
+			return err
+		}
+		logger.Info("Release train opened", "train", t.Name, "departs", t.Departs.Local().Format(time.DateTime))
+	}
+
+	u := PendingUpdate{Subsystem: req.Subsystem, Trigger: req.Trigger, From: from, Target: req.Target, Release: req.Release, Published: req.Published, Time: time.Now(), Compatibility: compat}
+	i := slices.IndexFunc(t.Updates, func(p PendingUpdate) bool { return p.Subsystem == req.Subsystem })
+	if i >= 0 {
+		u.From = t.Updates[i].From
+		t.Updates[i] = u
+	} else {
+		t.Updates = append(t.Updates, u)
+	}
+	sortTrain(t.Updates, tc.Order, subsystems)
+	if err := saveTrain(t); err != nil {
+		return err
+	}
+	logger.Info("Update boarded release train", "subsystem", req.Subsystem, "from", orUnknown(u.From), "to", orUnknown(u.Target),
+		"train", t.Name, "updates", len(t.Updates), "departs", t.Departs.Local().Format(time.DateTime))
+	return nil
+}
+
+// sortTrain puts updates in rollout order: the subsystems of order first, in
+// that order, then the rest in repos order
+func sortTrain(updates []PendingUpdate, order, subsystems []string) {
+	rank := func(sub string) int {
+		if i := slices.Index(order, sub); i >= 0 {
+			return i
+		}
+		if i := slices.Index(subsystems, sub); i >= 0 {
+			return len(order) + i
+		}
+		return len(order) + len(subsystems)
+	}
+	sort.SliceStable(updates, func(i, j int) bool { return rank(updates[i].Subsystem) < rank(updates[j].Subsystem) })
+}
+
+// trainName returns train-<date>, with a suffix if a train of that day exists
+func trainName(t time.Time) (string, error) {
+	base := "train-" + t.Format(time.DateOnly)
+	name := base
+	for n := 2; ; n++ {
+		var existing Train
+		found, err := state.Get(state.BucketTrains, name, &existing)
+		if err != nil {
+			return "", fmt.Errorf("failed to read release trains: %w", err)
+		}
+		if !found {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// DepartTrains closes the collecting train if its period is over, so it
+// waits for approval
+func DepartTrains() {
+	trainMu.Lock()
+	defer trainMu.Unlock()
+	t, err := collecting()
+	if err != nil {
+		logger.Warn("Could not check the release train", "err", err)
+		return
+	}
+	if t == nil || time.Now().Before(t.Departs) {
+		return
+	}
+	if err := depart(t); err != nil {
+		logger.Warn("Could not close release train", "train", t.Name, "err", err)
+	}
+}
+
+// depart stops a train collecting
+func depart(t *Train) error {
+	t.State, t.Departed = TrainReady, time.Now()
+	if err := saveTrain(t); err != nil {
+		return err
+	}
+	logger.Info("Release train departed", "train", t.Name, "updates", len(t.Updates), "approve", "sync train show "+t.Name+", then sync train approve "+t.Name)
+	return nil
+}
+
+// StartTrains departs release trains on schedule, for the daemons
+func StartTrains() {
+	if tc, _ := trainConfig(); !tc.Enabled() {
+		return
+	}
+	go func() {
+		DepartTrains()
+		ticker := time.NewTicker(trainCheck)
+		defer ticker.Stop()
+		for range ticker.C {
+			DepartTrains()
+		}
+	}()
+}
+
+// Trains returns the release trains, newest first
+func Trains() ([]Train, error) {
+	var trains []Train
+	err := state.ForEach(state.BucketTrains, func(_ string, data []byte) error {
+		var t Train
+		if err := json.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		trains = append(trains, t)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release trains: %w", err)
+	}
+	sort.Slice(trains, func(i, j int) bool { return trains[i].Opened.After(trains[j].Opened) })
+	return trains, nil
+}
+
+// GetTrain returns a release train by name; "" is the newest
+func GetTrain(name string) (Train, error) {
+	if name == "" {
+		trains, err := Trains()
+		if err != nil {
+			return Train{}, err
+		}
+		if len(trains) == 0 {
+			return Train{}, errors.New("no release trains yet")
+		}
+		return trains[0], nil
+	}
+	var t Train
+	found, err := state.Get(state.BucketTrains, name, &t)
+	if err != nil {
+		return t, fmt.Errorf("failed to read release train %s: %w", name, err)
+	}
+	if !found {
+		return t, fmt.Errorf("no release train %s", name)
+	}
+	return t, nil
+}
+
+// ApproveTrain rolls out a train's updates in order, stopping at the first
+// that fails
+// A train still collecting departs early. Each update runs as if approved on
+// its own, so it goes ahead during a freeze and keeps its regression watch.
+func ApproveTrain(name, actor string) (Train, error) {
+	t, err := takeTrain(name, actor, TrainRolling)
+	if err != nil || DryRun() {
+		return t, err
+	}
+	audit.Append(audit.Entry{Time: time.Now(), Action: audit.ActionTrain, Actor: actor,
+		Detail: fmt.Sprintf("approved %s (%s)", t.Name, trainSummary(t))})
+	logger.Info("Rolling out release train", "train", t.Name, "updates", trainSummary(t))
+
+	var failed error
+	for _, u := range t.Updates {
+		result := TrainResult{Subsystem: u.Subsystem, Outcome: TrainUpdateApplied}
+		if failed != nil {
+			result.Outcome = TrainUpdateSkipped
+		} else if err := Run(Request{Subsystem: u.Subsystem, Trigger: TriggerTrain, Target: u.Target, Release: u.Release, Published: u.Published}); err != nil {
+			result.Outcome, result.Error = TrainUpdateFailed, err.Error()
+			failed = fmt.Errorf("release train %s stopped at %s: %w", t.Name, u.Subsystem, err)
+		}
+		t.Results = append(t.Results, result)
+	}
+
+	t.State, t.Finished = TrainDone, time.Now()
+	if failed != nil {
+		t.State = TrainFailed
+		logger.Error("Release train failed", "train", t.Name, "err", failed)
+	} else {
+		logger.Info("Release train rolled out", "train", t.Name)
+	}
+	if err := saveTrain(&t); err != nil {
+		logger.Warn("Could not record the outcome of release train", "train", t.Name, "err", err)
+	}
+	return t, failed
+}
+
+// RejectTrain discards a train that is collecting or waiting for approval
+func RejectTrain(name, actor string) (Train, error) {
+	t, err := takeTrain(name, actor, TrainRejected)
+	if err != nil || DryRun() {
+		return t, err
+	}
+	t.Finished = time.Now()
+	if err := saveTrain(&t); err != nil {
+		return t, err
+	}
+	audit.Append(audit.Entry{Time: time.Now(), Action: audit.ActionTrain, Actor: actor,
+		Detail: fmt.Sprintf("rejected %s (%s)", t.Name, trainSummary(t))})
+	return t, nil
+}
+
+// takeTrain moves a collecting or ready train to state, departing it first
+// if it is still collecting
+func takeTrain(name, actor, to string) (Train, error) {
+	trainMu.Lock()
+	defer trainMu.Unlock()
+	t, err := GetTrain(name)
+	if err != nil {
+		return t, err
+	}
+	switch t.State {
+	case TrainCollecting:
+		if DryRun() {
+			return t, nil
+		}
+		if err := depart(&t); err != nil {
+			return t, err
+		}
+	case TrainReady:
+	default:
+		return t, fmt.Errorf("release train %s is %s", t.Name, t.State)
+	}
+	if DryRun() {
+		return t, nil
+	}
+	t.State, t.ApprovedBy = to, actor
+	return t, saveTrain(&t)
+}
+
+// collecting returns the train boarding updates, or nil
+func collecting() (*Train, error) {
+	trains, err := Trains()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range trains {
+		if t.State == TrainCollecting {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func saveTrain(t *Train) error {
+	if err := state.Put(state.BucketTrains, t.Name, t); err != nil {
+		return fmt.Errorf("failed to save release train %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// trainSummary returns e.g. "nats v2.10.1 → v2.10.2, telegraf 1a2b3c4 → 5d6e7f8"
+func trainSummary(t Train) string {
+	if len(t.Updates) == 0 {
+		return "no updates"
+	}
+	parts := make([]string, len(t.Updates))
+	for i, u := range t.Updates {
+		parts[i] = fmt.Sprintf("%s %s → %s", u.Subsystem, orUnknown(u.From), orUnknown(u.Target))
+	}
+	return strings.Join(parts, ", ")
+}
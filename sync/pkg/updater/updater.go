@@ -0,0 +1,405 @@
+package updater
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/buildenv"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/chaos"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/events"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/freeze"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/history"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/metrics"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/status"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/syncerr"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/versions"
+)
+
+// logger logs updates and each step they take
+var logger = logging.For("updater")
+
+// Update triggers
+const (
+	TriggerPoll       = "poll"
+	TriggerTaskfile   = "taskfile"
+	TriggerWebhook    = "webhook"
+	TriggerManual     = "manual"
+	TriggerNATS       = "nats"       // remote command on the NATS mesh
+	TriggerRollback   = "rollback"   // sync rollback
+	TriggerApproved   = "approved"   // sync approve of a queued update
+	TriggerTrain      = "train"      // sync train approve of a release train
+	TriggerDelta      = "delta"      // sync delta apply
+	TriggerPromote    = "promote"    // release promoted into this host's environment
+	TriggerAdopt      = "adopt"      // sync adopt of a manually installed binary
+	TriggerRegression = "regression" // automatic rollback after the update's metrics regressed
+	TriggerDependency = "dependency" // rebuild after a subsystem this one depends on updated
+)
+
+// ErrFrozen is returned for automatic updates while `sync freeze` is in effect
+var ErrFrozen = errors.New("updates are frozen")
+
+// Request describes an update to run
+type Request struct {
+	Subsystem string    `json:"subsystem"`
+	Trigger   string    `json:"trigger"`
+	Target    string    `json:"target,omitempty"`   // upstream version that triggered the update, if known
+	Release   string    `json:"release,omitempty"`  // releases mode: the release tag to build, passed as SYNC_RELEASE
+	Published time.Time `json:"published,omitzero"` // when upstream published Target, if known
+}
+
+// Run executes the update workflow for a subsystem and records the attempt in the history ledger
+// Updates of one subsystem never overlap: a trigger that arrives while one
+// runs is coalesced into a single follow-up run, and other sync processes
+// wait on the subsystem's lock file. In dry-run mode it only logs the plan.
+// The returned error is that of req's own run; coalesced triggers return nil.
+// While updates are frozen, automatic triggers fail with ErrFrozen.
+func Run(req Request) error {
+	if f, ok := frozen(req); ok {
+		logger.Info("Not updating: updates frozen", "subsystem", req.Subsystem, "trigger", req.Trigger, "freeze", f)
+		return syncerr.Wrap(syncerr.Frozen, fmt.Errorf("%w: %s", ErrFrozen, f))
+	}
+
+	if DryRun() {
+		from, _ := checker.GetCurrentVersion(req.Subsystem)
+		logPlan(req, from)
+		return nil
+	}
+
+	if !claim(req) {
+		return nil
+	}
+	err := runLocked(req)
+	for {
+		next, ok := release(req.Subsystem)
+		if !ok {
+			return err
+		}
+		logger.Info("Running queued update", "subsystem", next.Subsystem, "trigger", next.Trigger)
+		runLocked(next)
+	}
+}
+
+// frozen returns the active freeze if it blocks req
+// Operator actions on this host (sync update, approve, rollback, delta apply)
+// go ahead; everything detected or sent from elsewhere waits for the thaw.
+func frozen(req Request) (freeze.Freeze, bool) {
+	switch req.Trigger {
+	case TriggerManual, TriggerApproved, TriggerTrain, TriggerRollback, TriggerDelta:
+		return freeze.Freeze{}, false
+	}
+	f, active, err := freeze.Current()
+	if err != nil {
+		logger.Warn("Could not check for an update freeze", "err", err)
+	}
+	return f, active
+}
+
+// runLocked runs one update while holding the subsystem's lock file
+func runLocked(req Request) error {
+	lock, err := lockSubsystem(req.Subsystem)
+	if err != nil {
+		logger.Error("Update failed", "subsystem", req.Subsystem, "err", err)
+		return fmt.Errorf("update failed for %s: %w", req.Subsystem, err)
+	}
+	defer lock.Release()
+	return run(req)
+}
+
+// run executes the update workflow
+func run(req Request) error {
+	subsystem, trigger := req.Subsystem, req.Trigger
+
+	// Version before the update (may be missing on first install)
+	from, _ := checker.GetCurrentVersion(subsystem)
+
+	start := time.Now()
+	metrics.UpdateTriggered(subsystem, trigger)
+	events.Publish(events.Event{
+		Type:      events.UpdateStarted,
+		Time:      start,
+		Subsystem: subsystem,
+		From:      from,
+		Trigger:   trigger,
+	})
+
+	// Snapshot or back up data before touching the subsystem
+	repo := repoFor(subsystem)
+	track := newTracker(req, repo)
+	// Refuse to start without room for the build, rather than fail halfway
+	free, err := preflight(subsystem)
+	var backupPath string
+	var retained bool
+	if err == nil {
+		track.phase(PhaseSnapshot)
+		backupPath, retained, err = prepareData(repo)
+	}
+
+	// Build or download into .bin/.staging, so the subsystem keeps the
+	// active version's links, and its binary, until Install switches over
+	previous, _ := versions.Active(subsystem)
+	var staging string
+	if err == nil {
+		staging, err = versions.Stage(subsystem)
+	}
+	defer versions.Unstage(subsystem)
+
+	// Call task sync:update with SUBSYSTEM env var; promoted releases are
+	// installed as soaked upstream, and the artifact strategy installs the
+	// upstream release asset, instead of building
+	cmd := exec.Command("task", "sync:update")
+	cmd.Env = append(os.Environ(), fmt.Sprintf("SUBSYSTEM=%s", subsystem))
+	cmd.Env = append(cmd.Env, buildEnv()...)
+	cmd.Env = append(cmd.Env, "SYNC_STAGING_DIR="+staging)
+	if req.Release != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("SYNC_RELEASE=%s", req.Release))
+	}
+
+	var output []byte
+	var env *buildenv.Environment
+	if err == nil {
+		err = syncerr.Wrap(syncerr.BuildFailed, chaos.Fail(chaos.Build))
+	}
+	if err == nil {
+		switch {
+		case trigger == TriggerPromote:
+			track.phase(PhaseDownload)
+			output, err = installRelease(subsystem, req.Target, staging, track)
+		case repo.Strategy == config.StrategyArtifact:
+			track.phase(PhaseDownload)
+			output, err = installAsset(req, repo, staging, track)
+		default:
+			track.phase(PhaseBuild)
+			env = captureBuild(subsystem, cmd.Env)
+			out := &outputWriter{tracker: track, phase: PhaseBuild}
+			cmd.Stdout, cmd.Stderr = out, out
+			err = cmd.Run()
+			output = out.Bytes()
+		}
+		err = syncerr.Wrap(syncerr.BuildFailed, err)
+		output = redact.Bytes(output)
+	}
+
+	// Scan the new files before anything runs them, configs checks included
+	if scanners := scannersFor(subsystem); err == nil && len(scanners) > 0 {
+		track.phase(PhaseScan)
+		if err = scanBuild(subsystem, scanners); err != nil {
+			logger.Warn("Not installing", "subsystem", subsystem, "err", err)
+		}
+	}
+
+	// Check the configs against the new version while it is only staged,
+	// rendering those with a template for it; if it rejects any, it is not
+	// installed and the previous version stays active with its configs
+	release := req.Release
+	if release == "" && trigger == TriggerPromote {
+		release = req.Target
+	}
+	staged := &stagedConfigs{}
+	if err == nil && len(repo.Configs) > 0 {
+		track.phase(PhaseValidate)
+		staged, err = stageConfigs(repo, release)
+		if err != nil {
+			logger.Warn("Not installing", "subsystem", subsystem, "err", err)
+		}
+	}
+	defer staged.discard()
+
+	// Install the build under .bin/versions/ and switch to it, or put the
+	// previous version back if a reused release was activated but failed
+	if err == nil {
+		track.phase(PhaseInstall)
+		if release != "" {
+			recordRelease(subsystem, release)
+		}
+		var installed string
+		if installed, err = versions.Install(subsystem); err == nil && installed != "" {
+			logger.Info("Installed", "subsystem", subsystem, "version", revision.Short(installed))
+		}
+		if err == nil && env != nil {
+			recordBuild(req, installed, *env)
+		}
+	} else if previous != "" {
+		if aerr := versions.Activate(subsystem, previous); aerr != nil {
+			logger.Warn("Failed to reactivate the previous version", "subsystem", subsystem, "version", previous, "err", aerr)
+		}
+	}
+
+	// Put the configs rendered for the installed version in place
+	if err == nil && repo.Rendered() {
+		track.phase(PhaseRender)
+		if err = staged.commit(false); err != nil && previous != "" {
+			if aerr := versions.Activate(subsystem, previous); aerr != nil {
+				logger.Warn("Failed to reactivate the previous version", "subsystem", subsystem, "version", previous, "err", aerr)
+			}
+		}
+	}
+
+	// Only the subsystem's processes restart; the rest of the stack keeps running
+	if err == nil {
+		track.phase(PhaseRestart)
+		if rerr := restartProcesses(repo); rerr != nil {
+			logger.Warn("Failed to restart", "subsystem", subsystem, "err", rerr)
+		}
+	}
+
+	// Migrations and health checks run against the updated subsystem;
+	// if either fails the data dir is restored from the backup
+	var hookErr error
+	if err == nil {
+		to, _ := checker.GetCurrentVersion(subsystem)
+		track.phase(PhaseMigrate)
+		hookErr = runMigrations(repo, from, to)
+		if hookErr == nil {
+			track.phase(PhaseHealth)
+			hookErr = checkHealth(repo)
+		}
+		// Simulate the updated subsystem failing its post-update health check
+		if hookErr == nil {
+			hookErr = syncerr.Wrap(syncerr.HealthCheckFailed, chaos.Fail(chaos.Health))
+		}
+		err = hookErr
+	}
+	var restoreErr error
+	if hookErr != nil && backupPath != "" {
+		if restoreErr = restoreData(repo, backupPath); restoreErr != nil {
+			err = fmt.Errorf("%w (restore also failed: %v)", err, restoreErr)
+		}
+	}
+	finishData(repo, backupPath, retained, restoreErr != nil)
+
+	entry := history.Entry{
+		Time:      start,
+		Subsystem: subsystem,
+		From:      from,
+		Trigger:   trigger,
+		Success:   err == nil,
+		Duration:  time.Since(start),
+		Published: req.Published,
+	}
+	if err != nil {
+		entry.Error = redact.String(err.Error())
+		entry.ErrorKind = syncerr.KindOf(err)
+	} else {
+		entry.To, _ = checker.GetCurrentVersion(subsystem)
+		entry.Disk = used(subsystem, free)
+	}
+
+	status.RecordUpdate(entry)
+	metrics.UpdateFinished(subsystem, entry.Success, entry.Duration)
+	publishResult(entry, output)
+	if herr := history.Append(entry); herr != nil {
+		logger.Warn("Failed to record history", "subsystem", subsystem, "err", herr)
+	}
+
+	if err != nil {
+		logger.Error("Update failed", "subsystem", subsystem, "err", err, "hint", syncerr.Hint(syncerr.KindOf(err)), outputAttr(output))
+		return fmt.Errorf("update failed for %s: %w", subsystem, err)
+	}
+
+	logger.Info("Update completed", "subsystem", subsystem, "version", revision.Short(entry.To), outputAttr(output))
+	watchRegression(subsystem, entry.To, repo.Regression)
+	rebuildDependents(req, entry.To)
+	return nil
+}
+
+// outputAttr carries the output of an update's build in its log record, or
+// nothing if the build printed none (handlers drop empty attributes)
+func outputAttr(output []byte) slog.Attr {
+	if len(output) == 0 {
+		return slog.Attr{}
+	}
+	return slog.String("output", string(output))
+}
+
+// recordRelease notes the release tag a staged build was made from in its
+// .version, unless the build recorded one itself, so policies can compare
+// releases rather than commits
+func recordRelease(subsystem, release string) {
+	// Builds left in .bin may be links into an installed version
+	dir, err := versions.Staged(subsystem)
+	bin, berr := versions.BinDir(subsystem)
+	if err != nil || berr != nil || dir == bin {
+		return
+	}
+	path := filepath.Join(dir, ".version")
+	if info, err := checker.ReadVersionFile(path); err != nil || info.Release != "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		logger.Warn("Failed to record the release", "subsystem", subsystem, "release", release, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "release: %s\n", release); err != nil {
+		logger.Warn("Failed to record the release", "subsystem", subsystem, "release", release, "err", err)
+	}
+}
+
+// dependents returns the subsystems an update of req rebuilds: those that
+// depend on it, unless this host installs promoted releases, whose builds
+// come from upstream
+func dependents(req Request) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg == nil || cfg.Promoted() || req.Trigger == TriggerPromote {
+		return nil
+	}
+	return cfg.Dependents(req.Subsystem)
+}
+
+// rebuildDependents queues a rebuild of every subsystem depending on the one
+// req updated; their own updates rebuild their dependents in turn
+func rebuildDependents(req Request, version string) {
+	for _, dep := range dependents(req) {
+		logger.Info("Rebuilding dependent", "subsystem", dep, "depends_on", req.Subsystem, "version", orUnknown(version))
+		if err := Enqueue(Request{Subsystem: dep, Trigger: TriggerDependency}); err != nil {
+			logger.Error("Rebuild of dependent failed", "subsystem", dep, "depends_on", req.Subsystem, "err", err)
+		}
+	}
+}
+
+// maxEventOutput is how much of a failed build's output update.failed carries,
+// from the end, where the error usually is
+const maxEventOutput = 4 << 10
+
+// publishResult emits update.completed or update.failed for a finished attempt
+// Failures carry the end of output, the build output (already redacted).
+func publishResult(e history.Entry, output []byte) {
+	eventType := events.UpdateCompleted
+	if !e.Success {
+		eventType = events.UpdateFailed
+	}
+	event := events.Event{
+		Type:      eventType,
+		Subsystem: e.Subsystem,
+		From:      e.From,
+		To:        e.To,
+		Trigger:   e.Trigger,
+		Duration:  e.Duration,
+		Error:     e.Error,
+		ErrorKind: string(e.ErrorKind),
+	}
+	if !e.Success && len(output) > 0 {
+		if len(output) > maxEventOutput {
+			output = output[len(output)-maxEventOutput:]
+			if i := bytes.IndexByte(output, '\n'); i >= 0 {
+				output = output[i+1:]
+			}
+		}
+		event.Output = strings.TrimSpace(string(output))
+	}
+	events.Publish(event)
+}
@@ -0,0 +1,168 @@
+package versions
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/artifacts"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy decides which installed versions GC keeps
+type Policy struct {
+	Keep   int                        // newest versions kept per subsystem (including the active one)
+	Pinned map[string]map[string]bool // subsystem -> pinned versions
+	Locked map[string]map[string]bool // subsystem -> versions referenced by lockfiles
+}
+
+// Removed is a version deleted by GC (or selected, in a dry run)
+type Removed struct {
+	Subsystem string `json:"subsystem"`
+	Version   string `json:"version"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// PolicyFromConfig builds the GC policy from the config and its lockfiles
+func PolicyFromConfig(cfg *config.Config) (Policy, error) {
+	p := Policy{
+		Keep:   cfg.GC.Keep,
+		Pinned: make(map[string]map[string]bool),
+		Locked: make(map[string]map[string]bool),
+	}
+	for _, repo := range cfg.Repos {
+		for _, v := range repo.Pinned {
+			add(p.Pinned, repo.Subsystem, v)
+		}
+	}
+
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return p, err
+	}
+	for _, path := range cfg.GC.Lockfiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return p, fmt.Errorf("failed to read lockfile: %w", err)
+		}
+		var lock map[string]string
+		if err := yaml.Unmarshal(data, &lock); err != nil {
+			return p, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+		}
+		for subsystem, v := range lock {
+			add(p.Locked, subsystem, v)
+		}
+	}
+	return p, nil
+}
+
+// Subsystems returns every subsystem with versioned installs under the project root
+func Subsystems() ([]string, error) {
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(root, "*", ".bin", versionsDir))
+	if err != nil {
+		return nil, err
+	}
+
+	subsystems := make([]string, 0, len(matches))
+	for _, m := range matches {
+		subsystems = append(subsystems, filepath.Base(filepath.Dir(filepath.Dir(m))))
+	}
+	sort.Strings(subsystems)
+	return subsystems, nil
+}
+
+// GC removes installed versions outside the policy and reports what was reclaimed
+// The newest Keep versions are kept, and the active, pinned and locked ones
+// regardless of age. With dryRun, nothing is deleted.
+func GC(subsystems []string, p Policy, dryRun bool) ([]Removed, error) {
+	var removed []Removed
+	for _, subsystem := range subsystems {
+		list, err := List(subsystem)
+		if err != nil {
+			return removed, fmt.Errorf("%s: %w", subsystem, err)
+		}
+
+		for i, v := range list {
+			if i < p.Keep || v.Active || listed(p.Pinned[subsystem], v.Version) || listed(p.Locked[subsystem], v.Version) {
+				continue
+			}
+
+			size, err := dirSize(v.Path)
+			if err != nil {
+				return removed, err
+			}
+			if !dryRun {
+				if err := os.RemoveAll(v.Path); err != nil {
+					return removed, fmt.Errorf("failed to remove %s: %w", v.Path, err)
+				}
+				if err := artifacts.Release(subsystem, v.Version); err != nil {
+					return removed, err
+				}
+			}
+			removed = append(removed, Removed{Subsystem: subsystem, Version: v.Version, Bytes: size})
+		}
+	}
+	return removed, nil
+}
+
+// listed reports whether set holds version, or a short hash of it
+func listed(set map[string]bool, version string) bool {
+	for v := range set {
+		if revision.Same(v, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatBytes renders a byte count for humans (e.g. "12.3 MiB")
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// dirSize sums the sizes of the files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// add records version v for subsystem in set
+func add(set map[string]map[string]bool, subsystem, v string) {
+	if set[subsystem] == nil {
+		set[subsystem] = make(map[string]bool)
+	}
+	set[subsystem][v] = true
+}
@@ -0,0 +1,183 @@
+package versions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/artifacts"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+)
+
+// Problems found by Verify
+const (
+	Modified   = "modified"   // content differs from the recorded SHA256
+	Missing    = "missing"    // recorded but no longer there
+	Unrecorded = "unrecorded" // present but not recorded at install time
+	Replaced   = "replaced"   // .bin/<file> is no longer a link into current/ and differs
+)
+
+// Problem is a file of an installed version that fails verification
+type Problem struct {
+	File  string `json:"file"`
+	Issue string `json:"issue"`
+	Want  string `json:"want,omitempty"`
+	Got   string `json:"got,omitempty"`
+}
+
+// Verification is the result of re-hashing an installed version
+type Verification struct {
+	Subsystem string    `json:"subsystem"`
+	Version   string    `json:"version"`
+	Active    bool      `json:"active"`
+	Recorded  bool      `json:"recorded"` // false for versions installed before checksums were recorded
+	Files     int       `json:"files"`
+	Problems  []Problem `json:"problems,omitempty"`
+}
+
+// OK reports whether every recorded file is intact
+func (v Verification) OK() bool {
+	return v.Recorded && len(v.Problems) == 0
+}
+
+// recordDigests writes the SHA256 of each file in dir into its .version as
+// "sha256 <file>: <digest>" lines, replacing any recorded before
+// The lines are sorted, so recording the same files again gives the same
+// .version (promoted releases compare its digest across hosts).
+func recordDigests(dir string) error {
+	digests, err := Digests(dir)
+	if err != nil {
+		return err
+	}
+	delete(digests, ".version")
+
+	path := filepath.Join(dir, ".version")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasPrefix(line, "sha256 ") {
+			b.WriteString(line + "\n")
+		}
+	}
+	names := make([]string, 0, len(digests))
+	for name := range digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "sha256 %s: %s\n", name, digests[name])
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Verify re-hashes the files of an installed version against the SHA256s
+// recorded when it was installed, catching tampering and partial or corrupted
+// installs. For the active version it also checks the .bin/<file> entries
+// Taskfiles run, which should still link into current/.
+func Verify(subsystem, version string) (Verification, error) {
+	v := Verification{Subsystem: subsystem, Version: version}
+	dir, err := Dir(subsystem, version)
+	if err != nil {
+		return v, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return v, fmt.Errorf("version %s of %s is not installed", version, subsystem)
+	}
+	active, err := Active(subsystem)
+	if err != nil {
+		return v, err
+	}
+	v.Active = active == version
+
+	info, err := checker.ReadVersionFile(filepath.Join(dir, ".version"))
+	if err != nil && !os.IsNotExist(err) {
+		return v, err
+	}
+	if len(info.Files) == 0 {
+		return v, nil
+	}
+	v.Recorded, v.Files = true, len(info.Files)
+
+	got, err := Digests(dir)
+	if err != nil {
+		return v, err
+	}
+	delete(got, ".version")
+	for _, name := range sortedKeys(info.Files) {
+		want := info.Files[name]
+		switch sum, ok := got[name]; {
+		case !ok:
+			v.Problems = append(v.Problems, Problem{File: name, Issue: Missing, Want: want})
+		case sum != want:
+			v.Problems = append(v.Problems, Problem{File: name, Issue: Modified, Want: want, Got: sum})
+		}
+	}
+	for _, name := range sortedKeys(got) {
+		if _, ok := info.Files[name]; !ok {
+			v.Problems = append(v.Problems, Problem{File: name, Issue: Unrecorded, Got: got[name]})
+		}
+	}
+
+	if v.Active {
+		bin, err := BinDir(subsystem)
+		if err != nil {
+			return v, err
+		}
+		for _, name := range sortedKeys(info.Files) {
+			problem, err := checkLink(bin, name, info.Files[name])
+			if err != nil {
+				return v, err
+			}
+			if problem != nil {
+				v.Problems = append(v.Problems, *problem)
+			}
+		}
+	}
+	return v, nil
+}
+
+// checkLink checks that .bin/<name> still resolves to the active version's
+// file; a regular file in its place is fine only if it has the recorded SHA256
+func checkLink(bin, name, want string) (*Problem, error) {
+	path := filepath.Join(bin, name)
+	rel := filepath.Join(".bin", name)
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return &Problem{File: rel, Issue: Missing, Want: want}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if target, err := os.Readlink(path); err == nil && target == filepath.Join(currentLink, name) {
+			return nil, nil
+		}
+	}
+	sum, err := artifacts.Digest(path)
+	if err != nil {
+		return &Problem{File: rel, Issue: Missing, Want: want}, nil
+	}
+	if sum != want {
+		return &Problem{File: rel, Issue: Replaced, Want: want, Got: sum}, nil
+	}
+	return nil, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,459 @@
+package versions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew99/plat-telemetry/sync/pkg/artifacts"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/checker"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/revision"
+)
+
+// logger logs installs the artifact store could not deduplicate
+var logger = logging.For("versions")
+
+func init() {
+	capabilities.Register(capabilities.Packaging, "versioned-install")
+}
+
+// Layout inside <subsystem>/.bin
+//
+//	versions/<version>/   one directory per installed build
+//	current -> versions/<version>
+//	<file> -> current/<file>   so .bin/<binary> keeps working for Taskfiles
+//	.staging/   an update being built or downloaded, until Install
+const (
+	versionsDir = "versions"
+	currentLink = "current"
+	stagingDir  = ".staging"
+)
+
+// Version is a build installed under <subsystem>/.bin/versions/
+type Version struct {
+	Version     string    `json:"version"`
+	Path        string    `json:"path"`
+	InstalledAt time.Time `json:"installedAt,omitzero"`
+	Platform    string    `json:"platform,omitempty"` // os/arch the build targets, if recorded
+	Active      bool      `json:"active"`
+}
+
+// BinDir returns <root>/<subsystem>/.bin
+func BinDir(subsystem string) (string, error) {
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, subsystem, ".bin"), nil
+}
+
+// Dir returns <root>/<subsystem>/.bin/versions/<version>
+func Dir(subsystem, version string) (string, error) {
+	if err := validName(version); err != nil {
+		return "", err
+	}
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(bin, versionsDir, version), nil
+}
+
+// Stage empties .bin/.staging and returns it, for an update to be built or
+// downloaded into while the active version's links stay in place
+// The subsystem keeps running the active version until Install switches to
+// the staged one; Unstage drops a staged build that is not installed.
+func Stage(subsystem string) (string, error) {
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(bin, stagingDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("failed to clear %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// Unstage removes .bin/.staging and whatever build is left in it
+func Unstage(subsystem string) error {
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(bin, stagingDir))
+}
+
+// Staged returns the directory holding the build Install would install:
+// .bin/.staging when an update was built or downloaded into it, else .bin,
+// where builds run by hand after Detach leave theirs
+func Staged(subsystem string) (string, error) {
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	staging := filepath.Join(bin, stagingDir)
+	if files, err := regularFiles(staging); err == nil && len(files) > 0 {
+		return staging, nil
+	}
+	return bin, nil
+}
+
+// Fresh returns the names of the files of the build in Staged, which Install
+// would install: regular files, as the active version's are links
+func Fresh(subsystem string) ([]string, error) {
+	dir, err := Staged(subsystem)
+	if err != nil {
+		return nil, err
+	}
+	return regularFiles(dir)
+}
+
+// regularFiles returns the names of the regular files in dir
+func regularFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			files = append(files, e.Name())
+		}
+	}
+	return files, nil
+}
+
+// Install moves a fresh build from Staged into .bin/versions/<version>/ and
+// activates it
+// The version is the commit from the build's .version file. Returns "" when
+// there is no new build (e.g. the build step was skipped).
+func Install(subsystem string) (string, error) {
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	staged, err := Staged(subsystem)
+	if err != nil {
+		return "", err
+	}
+
+	fresh, err := regularFiles(staged)
+	if err != nil || len(fresh) == 0 {
+		return "", err
+	}
+
+	version := time.Now().UTC().Format("20060102T150405Z")
+	if info, err := checker.ReadVersionFile(filepath.Join(staged, ".version")); err == nil && info.Commit != "" {
+		version = info.Commit
+	}
+	if err := validName(version); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(bin, versionsDir, version)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("failed to replace %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for _, name := range fresh {
+		if err := os.Rename(filepath.Join(staged, name), filepath.Join(dir, name)); err != nil {
+			return "", fmt.Errorf("failed to install %s: %w", name, err)
+		}
+	}
+	// Before Store: afterwards .version is a hard link shared with the artifact store
+	if err := recordDigests(dir); err != nil {
+		return "", fmt.Errorf("failed to record checksums of %s %s: %w", subsystem, version, err)
+	}
+	if err := Store(subsystem, version); err != nil {
+		logger.Warn("Failed to deduplicate in the artifact store", "subsystem", subsystem, "version", version, "err", err)
+	}
+
+	if err := Activate(subsystem, version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// Store moves the files of an installed version into the artifact store,
+// leaving hard links to the stored blobs in their place
+func Store(subsystem, version string) error {
+	dir, err := Dir(subsystem, version)
+	if err != nil {
+		return err
+	}
+	root, err := config.ProjectRoot()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		ref := artifacts.Ref{Subsystem: subsystem, Version: version, File: e.Name(), Path: rel}
+		if _, err := artifacts.Put(path, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Digests returns the SHA256 of every regular file in dir (an installed
+// version, or a staged build), keyed by file name
+func Digests(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[string]string)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if digests[e.Name()], err = artifacts.Digest(filepath.Join(dir, e.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+// Activate points .bin/current at an installed version and links its files into .bin
+// The switch itself is a single atomic rename of the current symlink. A version
+// whose .version records another OS or architecture is refused.
+func Activate(subsystem, version string) error {
+	if err := validName(version); err != nil {
+		return err
+	}
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(bin, versionsDir, version)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("version %s of %s is not installed", version, subsystem)
+	}
+	if info, err := checker.ReadVersionFile(filepath.Join(dir, ".version")); err == nil {
+		if err := info.CheckPlatform(); err != nil {
+			return fmt.Errorf("refusing to activate %s %s: %w", subsystem, revision.Short(version), err)
+		}
+	}
+
+	tmp := filepath.Join(bin, currentLink+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Join(versionsDir, version), tmp); err != nil {
+		return fmt.Errorf("failed to link %s: %w", version, err)
+	}
+	if err := os.Rename(tmp, filepath.Join(bin, currentLink)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to activate %s: %w", version, err)
+	}
+
+	for _, e := range entries {
+		link := filepath.Join(bin, e.Name())
+		target := filepath.Join(currentLink, e.Name())
+		if existing, err := os.Readlink(link); err == nil && existing == target {
+			continue
+		}
+		os.Remove(link)
+		if err := os.Symlink(target, link); err != nil {
+			return fmt.Errorf("failed to link %s: %w", e.Name(), err)
+		}
+	}
+
+	// Drop links to files the active version does not have
+	return removeLinks(bin, func(path string) bool {
+		_, err := os.Stat(path)
+		return err != nil
+	})
+}
+
+// Detach removes the .bin/<file> links so a build run by hand writes fresh
+// files instead of writing through the links into the active version. Call
+// Install after a successful build, or Activate to restore the links.
+// Updates are built in the staging dir instead (Stage), so the subsystem
+// keeps its binary meanwhile.
+func Detach(subsystem string) error {
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return err
+	}
+	return removeLinks(bin, func(string) bool { return true })
+}
+
+// Active returns the active version of a subsystem ("" if versions are not in use)
+func Active(subsystem string) (string, error) {
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(filepath.Join(bin, currentLink))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+// List returns the installed versions of a subsystem, newest first
+func List(subsystem string) ([]Version, error) {
+	bin, err := BinDir(subsystem)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(bin, versionsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := Active(subsystem)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Version
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		v := Version{
+			Version: e.Name(),
+			Path:    filepath.Join(bin, versionsDir, e.Name()),
+			Active:  e.Name() == active,
+		}
+		if info, err := checker.ReadVersionFile(filepath.Join(v.Path, ".version")); err == nil {
+			v.InstalledAt, v.Platform = info.Timestamp, info.Platform()
+		}
+		if v.InstalledAt.IsZero() {
+			if fi, err := e.Info(); err == nil {
+				v.InstalledAt = fi.ModTime()
+			}
+		}
+		list = append(list, v)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].InstalledAt.After(list[j].InstalledAt)
+	})
+	return list, nil
+}
+
+// Previous returns the version installed before the active one
+func Previous(subsystem string) (string, error) {
+	list, err := List(subsystem)
+	if err != nil {
+		return "", err
+	}
+
+	for i, v := range list {
+		if v.Active {
+			if i+1 < len(list) {
+				return list[i+1].Version, nil
+			}
+			return "", fmt.Errorf("no version of %s older than %s is installed", subsystem, v.Version)
+		}
+	}
+	if len(list) == 0 {
+		return "", fmt.Errorf("no versions of %s installed under .bin/versions/ (versioned installs start with the next update)", subsystem)
+	}
+	return "", fmt.Errorf("no active version of %s", subsystem)
+}
+
+// Resolve returns the installed version of a subsystem that ref names: the
+// version itself, or a commit hash prefix only one installed version starts with
+// This lets shortened hashes from history and logs be passed back to sync.
+func Resolve(subsystem, ref string) (string, error) {
+	if err := validName(ref); err != nil {
+		return "", err
+	}
+	list, err := List(subsystem)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, v := range list {
+		if v.Version == ref {
+			return ref, nil
+		}
+		if revision.IsHash(ref) && strings.HasPrefix(v.Version, ref) {
+			matches = append(matches, v.Version)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("version %s of %s is not installed", ref, subsystem)
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", fmt.Errorf("%s is ambiguous for %s: it abbreviates %s", ref, subsystem, strings.Join(matches, ", "))
+}
+
+// removeLinks deletes .bin/<file> links into current/ for which drop returns true
+func removeLinks(bin string, drop func(path string) bool) error {
+	entries, err := os.ReadDir(bin)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Type()&os.ModeSymlink == 0 || e.Name() == currentLink {
+			continue
+		}
+		path := filepath.Join(bin, e.Name())
+		target, err := os.Readlink(path)
+		if err != nil || !strings.HasPrefix(target, currentLink+string(os.PathSeparator)) {
+			continue
+		}
+		if drop(path) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validName rejects versions that would escape the versions directory
+func validName(version string) error {
+	if version == "" || version == "." || version == ".." || strings.ContainsAny(version, `/\`) {
+		return fmt.Errorf("invalid version name %q", version)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v80/github"
+)
+
+// requestError is a validation failure mapped to a precise HTTP status
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+func reject(status int, format string, args ...any) *requestError {
+	return &requestError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// payloadSchema lists the fields each handled event must carry
+var payloadSchema = map[string][]string{
+	"push":    {"ref", "repository.full_name"},
+	"release": {"action", "release.tag_name", "repository.full_name"},
+	"ping":    {"zen"},
+}
+
+// validateRequest checks method, content type, size, signature and payload
+// shape before the request reaches githubevents. On success the body is
+// replaced with a buffered copy so it can be read again.
+// keys are the accepted webhook secrets; signatures are only checked when the
+// first (current) key is set.
+func validateRequest(r *http.Request, maxBodyBytes int64, keys []string) *requestError {
+	if r.Method != http.MethodPost {
+		return reject(http.StatusMethodNotAllowed, "method %s not allowed, use POST", r.Method)
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	if event == "" {
+		return reject(http.StatusBadRequest, "missing X-GitHub-Event header")
+	}
+	required, ok := payloadSchema[event]
+	if !ok {
+		return reject(http.StatusUnprocessableEntity, "unsupported event type %q", event)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return reject(http.StatusUnsupportedMediaType, "missing or invalid Content-Type")
+	}
+	if mediaType != "application/json" && mediaType != "application/x-www-form-urlencoded" {
+		return reject(http.StatusUnsupportedMediaType, "unsupported Content-Type %s", mediaType)
+	}
+
+	if r.ContentLength > maxBodyBytes {
+		return reject(http.StatusRequestEntityTooLarge, "payload of %d bytes exceeds limit of %d", r.ContentLength, maxBodyBytes)
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return reject(http.StatusRequestEntityTooLarge, "payload exceeds limit of %d bytes", maxBodyBytes)
+		}
+		return reject(http.StatusBadRequest, "failed to read body: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if rerr := verifySignature(r, body, keys); rerr != nil {
+		return rerr
+	}
+	// Already verified here; githubevents would re-check against its empty secret
+	r.Header.Del(github.SHA256SignatureHeader)
+	r.Header.Del(github.SHA1SignatureHeader)
+
+	// GitHub's form encoding wraps the JSON document in a "payload" field
+	payload := body
+	if mediaType == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return reject(http.StatusBadRequest, "malformed form body: %v", err)
+		}
+		payload = []byte(form.Get("payload"))
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return reject(http.StatusBadRequest, "malformed JSON payload: %v", err)
+	}
+
+	for _, field := range required {
+		if !hasField(doc, field) {
+			return reject(http.StatusUnprocessableEntity, "%s payload missing required field %s", event, field)
+		}
+	}
+
+	return nil
+}
+
+// hasField reports whether a dotted path resolves to a non-empty string
+func hasField(doc map[string]any, path string) bool {
+	var cur any = doc
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return false
+		}
+		cur = obj[key]
+	}
+	s, ok := cur.(string)
+	return ok && s != ""
+}
+
+// verifySignature checks the HMAC signature against any of the accepted keys
+func verifySignature(r *http.Request, body []byte, keys []string) *requestError {
+	if len(keys) == 0 || keys[0] == "" {
+		return nil
+	}
+
+	signature := r.Header.Get(github.SHA256SignatureHeader)
+	if signature == "" {
+		signature = r.Header.Get(github.SHA1SignatureHeader)
+	}
+	if signature == "" {
+		return reject(http.StatusUnauthorized, "missing webhook signature")
+	}
+
+	for _, key := range keys {
+		if key != "" && github.ValidateSignature(signature, body, []byte(key)) == nil {
+			return nil
+		}
+	}
+	return reject(http.StatusUnauthorized, "invalid webhook signature")
+}
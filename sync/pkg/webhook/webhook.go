@@ -3,55 +3,83 @@ package webhook
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"os/exec"
+	"time"
 
 	"github.com/cbrgm/githubevents/v2/githubevents"
 	"github.com/google/go-github/v80/github"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/capabilities"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/config"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/logging"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/redact"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/secrets"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/updater"
+	"github.com/joeblew99/plat-telemetry/sync/pkg/workers"
 )
 
+// logger logs webhook deliveries and the updates they trigger
+var logger = logging.For("webhook")
+
+func init() {
+	capabilities.Register(capabilities.Control, "github-webhook")
+}
+
 // Server handles webhook events
 type Server struct {
-	handler *githubevents.EventHandler
+	handler      *githubevents.EventHandler
+	maxBodyBytes int64
+	secret       *secrets.Secret
+	grace        time.Duration
 }
 
 // NewServer creates a new webhook server with githubevents
-func NewServer() *Server {
+// Signatures are verified against secret (if set) before dispatch, so the
+// githubevents handler itself runs without one. After a rotation, the previous
+// secret is still accepted for grace. Updates are triggered on pool, which the
+// caller shuts down.
+func NewServer(cfg config.WebhookConfig, secret *secrets.Secret, grace time.Duration, pool *workers.Pool) *Server {
 	handler := githubevents.New("")
 
 	// Register release event handler
 	handler.OnReleaseEventPublished(func(ctx context.Context, deliveryID string, eventName string, event *github.ReleaseEvent) error {
 		repo := event.GetRepo().GetFullName()
 		tag := event.GetRelease().GetTagName()
-		log.Printf("📥 Release published: %s @ %s", repo, tag)
+		logger.Info("Release published", "repo", repo, "tag", tag, "delivery", deliveryID)
 
 		// Trigger update for this repository
-		go triggerUpdate(repo)
-		return nil
+		return triggerUpdate(pool, repo)
 	})
 
 	// Register push event handler (for DEV mode - upstream source changes)
 	handler.OnPushEventAny(func(ctx context.Context, deliveryID string, eventName string, event *github.PushEvent) error {
 		repo := event.GetRepo().GetFullName()
 		ref := event.GetRef()
-		log.Printf("📥 Push event: %s @ %s", repo, ref)
+		logger.Info("Push event", "repo", repo, "ref", ref, "delivery", deliveryID)
 
 		// Trigger update for this repository
-		go triggerUpdate(repo)
-		return nil
+		return triggerUpdate(pool, repo)
 	})
 
 	return &Server{
-		handler: handler,
+		handler:      handler,
+		maxBodyBytes: cfg.MaxBodyBytes,
+		secret:       secret,
+		grace:        grace,
 	}
 }
 
 // HandleWebhook processes incoming webhook requests
 func (s *Server) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	keys := []string{s.secret.Get(), s.secret.Previous(s.grace)}
+	if rerr := validateRequest(r, s.maxBodyBytes, keys); rerr != nil {
+		logger.Error("Webhook rejected", "status", rerr.status, "remote", r.RemoteAddr, "err", rerr)
+		http.Error(w, redact.String(rerr.msg), rerr.status)
+		return
+	}
+
 	err := s.handler.HandleEventRequest(r)
 	if err != nil {
-		log.Printf("❌ Webhook error: %v", err)
+		logger.Error("Webhook error", "remote", r.RemoteAddr, "err", err)
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
@@ -60,28 +88,22 @@ func (s *Server) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "OK")
 }
 
-// triggerUpdate executes the update workflow for a repository
-func triggerUpdate(repo string) {
+// triggerUpdate starts the update workflow for a repository on pool
+// It fails (so the delivery is answered with an error) once the pool is shutting down.
+func triggerUpdate(pool *workers.Pool, repo string) error {
 	// Map repository to subsystem
 	subsystem := mapRepoToSubsystem(repo)
 	if subsystem == "" {
-		log.Printf("⚠️  Unknown repository: %s", repo)
-		return
-	}
-
-	log.Printf("▶ Triggering update for %s (from repo %s)", subsystem, repo)
-
-	// Call task sync:update with SUBSYSTEM env var
-	cmd := exec.Command("task", "sync:update")
-	cmd.Env = append(cmd.Env, fmt.Sprintf("SUBSYSTEM=%s", subsystem))
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("❌ Update failed for %s: %v\n%s", subsystem, err, output)
-		return
+		logger.Warn("Unknown repository", "repo", repo)
+		return nil
 	}
 
-	log.Printf("✅ Update completed for %s\n%s", subsystem, output)
+	return pool.Go("update "+subsystem+" (webhook)", func(ctx context.Context) {
+		logger.Info("Triggering update", "subsystem", subsystem, "repo", repo)
+		if err := updater.Submit(updater.Request{Subsystem: subsystem, Trigger: updater.TriggerWebhook}); err != nil {
+			logger.Error("Update failed", "subsystem", subsystem, "err", err)
+		}
+	})
 }
 
 // mapRepoToSubsystem maps GitHub repository to local subsystem name
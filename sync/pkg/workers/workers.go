@@ -0,0 +1,143 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Go once the pool is shutting down
+var ErrClosed = errors.New("worker pool is shutting down")
+
+// Job is a job the pool has accepted and not yet finished
+type Job struct {
+	ID      uint64
+	Name    string    // e.g. "update nats (webhook)"
+	Started time.Time // when it was accepted; it may still be waiting for a slot
+}
+
+// Pool runs background jobs with a limit on how many run at once, and tracks
+// every accepted job until it returns, so shutdown can account for all of them
+// Each job gets its own context, cancelled when a shutdown gives up waiting.
+type Pool struct {
+	name   string
+	slots  chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	nextID uint64
+	jobs   map[uint64]Job
+}
+
+// New creates a pool running up to limit jobs at once (at least one)
+func New(name string, limit int) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		name:   name,
+		slots:  make(chan struct{}, max(limit, 1)),
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[uint64]Job),
+	}
+}
+
+// Go runs fn in the background once a slot is free
+// Jobs still waiting for a slot when a shutdown starts are dropped.
+func (p *Pool) Go(name string, fn func(ctx context.Context)) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return fmt.Errorf("%s: %w", name, ErrClosed)
+	}
+	p.nextID++
+	id := p.nextID
+	p.jobs[id] = Job{ID: id, Name: name, Started: time.Now()}
+	p.wg.Add(1)
+	p.mu.Unlock()
+
+	go func() {
+		defer p.done(id)
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+		defer func() { <-p.slots }()
+		if p.closing() {
+			return
+		}
+		ctx, cancel := context.WithCancel(p.ctx)
+		defer cancel()
+		fn(ctx)
+	}()
+	return nil
+}
+
+// done forgets a finished job
+func (p *Pool) done(id uint64) {
+	p.mu.Lock()
+	delete(p.jobs, id)
+	p.mu.Unlock()
+	p.wg.Done()
+}
+
+// closing reports whether a shutdown has started
+func (p *Pool) closing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// InFlight returns the accepted jobs that haven't finished, oldest first
+func (p *Pool) InFlight() []Job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	jobs := make([]Job, 0, len(p.jobs))
+	for _, j := range p.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+	return jobs
+}
+
+// Wait blocks until every accepted job has finished
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Shutdown stops accepting jobs, drops those waiting for a slot, and waits for
+// the running ones until ctx is done
+// If they don't finish in time, their contexts are cancelled and the error
+// names them; they may still be running when it returns.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+	}
+
+	var names []string
+	for _, j := range p.InFlight() {
+		names = append(names, fmt.Sprintf("%s (%s)", j.Name, time.Since(j.Started).Round(time.Second)))
+	}
+	p.cancel()
+	return fmt.Errorf("%s: %d job(s) still running: %s", p.name, len(names), strings.Join(names, ", "))
+}